@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// missingAlt is an image of the book without alt text, for --alt-report.
+type missingAlt struct {
+	Chapter string // archive path of the content document
+	Src     string // src attribute as written in the book
+	Alt     string // alt text derived by --derive-alt, if any
+	Source  string // where Alt was taken from
+}
+
+// deriveAlt makes up alt text for an image that has none, from its title
+// attribute, the caption of the figure it is in or else its file name, and
+// reports where the text came from.
+func deriveAlt(img *html.Node) (alt, source string) {
+	if title := strings.Join(strings.Fields(getAttr(img, "title")), " "); title != "" {
+		return title, "title"
+	}
+	for p := img.Parent; p != nil; p = p.Parent {
+		if p.Type != html.ElementNode || p.Data != "figure" {
+			continue
+		}
+		if caption := findElement(p, "figcaption"); caption != nil {
+			if text := strings.Join(strings.Fields(textContent(caption)), " "); text != "" {
+				return text, "figcaption"
+			}
+		}
+		break
+	}
+	src := getAttr(img, "src")
+	if unescaped, err := url.PathUnescape(src); err == nil {
+		src = unescaped
+	}
+	name := strings.TrimSuffix(path.Base(src), path.Ext(src))
+	name = strings.Join(strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == ' ' }), " ")
+	if name == "" || name == "." || name == "/" {
+		return "", ""
+	}
+	return name, "file name"
+}
+
+// checkAltText finds the images below n that have no alt attribute at all,
+// records them for --alt-report and, with --derive-alt, gives them alt text.
+// An empty alt attribute marks a decorative image and is left alone, as are
+// images hidden from assistive technology.
+func (rd *renderer) checkAltText(n *html.Node, contentFilePath string) {
+	if n.Type == html.ElementNode && n.Data == "img" && !hasAttr(n, "alt") &&
+		getAttr(n, "role") != "presentation" && getAttr(n, "aria-hidden") != "true" {
+		entry := missingAlt{Chapter: contentFilePath, Src: getAttr(n, "src")}
+		if rd.opts.DeriveAlt {
+			entry.Alt, entry.Source = deriveAlt(n)
+			if entry.Alt != "" {
+				n.Attr = append(n.Attr, html.Attribute{Key: "alt", Val: entry.Alt})
+			}
+		}
+		rd.missingAlt = append(rd.missingAlt, entry)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		rd.checkAltText(c, contentFilePath)
+	}
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAltReport writes one line per image without alt text to path, for
+// accessibility review. Images that were given derived alt text are listed
+// with it, as file names in particular rarely describe an image well.
+func writeAltReport(path string, images []missingAlt) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	w := bufio.NewWriter(f)
+	for _, img := range images {
+		if img.Alt != "" {
+			fmt.Fprintf(w, "%s: %s (alt from %s: %q)\n", img.Chapter, img.Src, img.Source, img.Alt)
+		} else {
+			fmt.Fprintf(w, "%s: %s\n", img.Chapter, img.Src)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestDeriveAlt(t *testing.T) {
+	tests := []struct {
+		body           string
+		expectedAlt    string
+		expectedSource string
+	}{
+		{`<img src="a.png" title=" A  map ">`, "A map", "title"},
+		{`<figure><p><img src="a.png"></p><figcaption>Figure 1: <i>Paris</i></figcaption></figure>`, "Figure 1: Paris", "figcaption"},
+		{`<img src="../images/old_town-square%202.jpg">`, "old town square 2", "file name"},
+		{`<img>`, "", ""},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		alt, source := deriveAlt(findElement(doc, "img"))
+		if alt != tt.expectedAlt || source != tt.expectedSource {
+			t.Errorf("deriveAlt(%q) = %q, %q, expected %q, %q", tt.body, alt, source, tt.expectedAlt, tt.expectedSource)
+		}
+	}
+}
+
+func TestAltReport(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<img src="map.png"><img src="rule.png" alt=""><img src="x.gif" role="presentation"><img src="photo.jpg" alt="Photo">`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd := &renderer{opts: &options{DeriveAlt: true}}
+	rd.checkAltText(doc, "OEBPS/ch1.xhtml")
+	if alt := getAttr(findElement(doc, "img"), "alt"); alt != "map" {
+		t.Errorf("checkAltText gave alt %q, expected %q", alt, "map")
+	}
+
+	reportPath := filepath.Join(t.TempDir(), "alt.txt")
+	if err := writeAltReport(reportPath, append(rd.missingAlt, missingAlt{Chapter: "OEBPS/ch2.xhtml", Src: "b.png"})); err != nil {
+		t.Fatal(err)
+	}
+	report, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "OEBPS/ch1.xhtml: map.png (alt from file name: \"map\")\nOEBPS/ch2.xhtml: b.png\n"
+	if string(report) != expected {
+		t.Errorf("writeAltReport wrote %q, expected %q", report, expected)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "archive/zip"
+
+// epubArchive is an opened EPUB with its entries indexed by name, as the
+// conversion looks up an entry for every chapter, image, stylesheet and
+// font, which scanning the entries each time would make slow on books
+// with thousands of them.
+type epubArchive struct {
+	*zip.ReadCloser
+	files map[string]*zip.File
+}
+
+// openEpubArchive opens the EPUB at path.
+func openEpubArchive(path string) (*epubArchive, error) {
+	rc, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return newEpubArchive(rc), nil
+}
+
+// newEpubArchive indexes the entries of an opened archive. Of entries with
+// the same name, the first is used.
+func newEpubArchive(rc *zip.ReadCloser) *epubArchive {
+	files := make(map[string]*zip.File, len(rc.File))
+	for _, f := range rc.File {
+		if _, ok := files[f.Name]; !ok {
+			files[f.Name] = f
+		}
+	}
+	return &epubArchive{ReadCloser: rc, files: files}
+}
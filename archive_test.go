@@ -0,0 +1,54 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEpubArchive(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, e := range []struct{ name, data string }{
+		{"OEBPS/text/c1.xhtml", "first"},
+		{"OEBPS/text/c1.xhtml", "second"},
+		{"OEBPS/images/a.png", "png"},
+	} {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, e.data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := openEpubArchive(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	tests := []struct {
+		path, expected string
+	}{
+		{"OEBPS/text/c1.xhtml", "first"},
+		{"OEBPS/text/../images/a.png", "png"},
+		{`OEBPS\images\a.png`, "png"},
+		{"OEBPS/missing.png", ""},
+		{"../outside.png", ""},
+	}
+	for _, tt := range tests {
+		data, err := readZipFile(r, tt.path)
+		if string(data) != tt.expected || (err != nil) != (tt.expected == "") {
+			t.Errorf("readZipFile(%q) = %q, %v, expected %q", tt.path, data, err, tt.expected)
+		}
+	}
+}
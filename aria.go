@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// epubTypeRoles maps epub:type values to the roles of the Digital
+// Publishing WAI-ARIA module, which carry the same meaning to browsers and
+// screen readers once the book is a single HTML page.
+var epubTypeRoles = map[string]string{
+	"abstract":        "doc-abstract",
+	"acknowledgments": "doc-acknowledgments",
+	"afterword":       "doc-afterword",
+	"appendix":        "doc-appendix",
+	"backlink":        "doc-backlink",
+	"bibliography":    "doc-bibliography",
+	"biblioref":       "doc-biblioref",
+	"chapter":         "doc-chapter",
+	"colophon":        "doc-colophon",
+	"conclusion":      "doc-conclusion",
+	"cover":           "doc-cover",
+	"credit":          "doc-credit",
+	"credits":         "doc-credits",
+	"dedication":      "doc-dedication",
+	"endnotes":        "doc-endnotes",
+	"rearnotes":       "doc-endnotes",
+	"epigraph":        "doc-epigraph",
+	"epilogue":        "doc-epilogue",
+	"errata":          "doc-errata",
+	"footnote":        "doc-footnote",
+	"note":            "doc-footnote",
+	"rearnote":        "doc-footnote",
+	"endnote":         "doc-footnote",
+	"foreword":        "doc-foreword",
+	"glossary":        "doc-glossary",
+	"glossref":        "doc-glossref",
+	"index":           "doc-index",
+	"introduction":    "doc-introduction",
+	"noteref":         "doc-noteref",
+	"notice":          "doc-notice",
+	"pagebreak":       "doc-pagebreak",
+	"part":            "doc-part",
+	"preface":         "doc-preface",
+	"prologue":        "doc-prologue",
+	"pullquote":       "doc-pullquote",
+	"qna":             "doc-qna",
+	"subtitle":        "doc-subtitle",
+	"tip":             "doc-tip",
+	"toc":             "doc-toc",
+}
+
+// sectionRoles are the roles of the parts dividing the book, whose <div>
+// elements become <section>.
+var sectionRoles = map[string]bool{
+	"doc-abstract": true, "doc-acknowledgments": true, "doc-afterword": true, "doc-appendix": true,
+	"doc-bibliography": true, "doc-chapter": true, "doc-colophon": true, "doc-conclusion": true,
+	"doc-credits": true, "doc-dedication": true, "doc-endnotes": true, "doc-epilogue": true,
+	"doc-errata": true, "doc-foreword": true, "doc-glossary": true, "doc-index": true,
+	"doc-introduction": true, "doc-part": true, "doc-preface": true, "doc-prologue": true,
+	"doc-qna": true,
+}
+
+// asideRoles are the roles of content set apart from the text, such as
+// footnotes, whose <div> elements become <aside>.
+var asideRoles = map[string]bool{
+	"doc-footnote": true, "doc-notice": true, "doc-pullquote": true, "doc-tip": true,
+}
+
+// epubTypeRole returns the ARIA role of the first epub:type of n that has
+// one, or "".
+func epubTypeRole(n *html.Node) string {
+	for _, t := range strings.Fields(getAttr(n, "epub:type")) {
+		if role := epubTypeRoles[t]; role != "" {
+			return role
+		}
+	}
+	return ""
+}
+
+// applyRole gives an element the ARIA role of its epub:type, unless it has
+// a role already, and turns a <div> dividing the book into a <section>, or
+// into an <aside> for notes and other content set apart.
+func applyRole(n *html.Node) {
+	role := epubTypeRole(n)
+	if role == "" || hasAttr(n, "role") {
+		return
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: "role", Val: role})
+	if n.DataAtom != atom.Div {
+		return
+	}
+	switch {
+	case sectionRoles[role]:
+		n.Data, n.DataAtom = "section", atom.Section
+	case asideRoles[role]:
+		n.Data, n.DataAtom = "aside", atom.Aside
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestApplyRole(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`<div epub:type="chapter"><p>Text</p></div>`, `<section epub:type="chapter" role="doc-chapter"><p>Text</p></section>`},
+		{`<div epub:type="footnote" id="n1">Note</div>`, `<aside epub:type="footnote" id="n1" role="doc-footnote">Note</aside>`},
+		{`<section epub:type="bodymatter glossary"></section>`, `<section epub:type="bodymatter glossary" role="doc-glossary"></section>`},
+		{`<blockquote epub:type="epigraph">Quote</blockquote>`, `<blockquote epub:type="epigraph" role="doc-epigraph">Quote</blockquote>`},
+		{`<a epub:type="noteref" href="#n1">1</a>`, `<a epub:type="noteref" href="#n1" role="doc-noteref">1</a>`},
+		{`<div epub:type="epigraph">Quote</div>`, `<div epub:type="epigraph" role="doc-epigraph">Quote</div>`},
+		{`<div epub:type="chapter" role="region"></div>`, `<div epub:type="chapter" role="region"></div>`},
+		{`<div epub:type="bodymatter"></div>`, `<div epub:type="bodymatter"></div>`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := findElement(doc, "body").FirstChild
+		applyRole(n)
+		var out strings.Builder
+		html.Render(&out, n)
+		if out.String() != tt.expected {
+			t.Errorf("applyRole(%q) = %q, expected %q", tt.input, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestRenderChapterBodyRole(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><body epub:type="chapter"><h1>One</h1></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd := &renderer{opts: &options{}, anchors: &anchors{}}
+	var out strings.Builder
+	rd.renderChapter(Chapter{Path: "OEBPS/ch1.xhtml", Doc: doc}, &out)
+	if expected := `<section role="doc-chapter"><h1>One</h1></section>`; out.String() != expected {
+		t.Errorf("renderChapter = %q, expected %q", out.String(), expected)
+	}
+}
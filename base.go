@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// baseURLAttrs are the attributes holding a URL that a base of the
+// document changes the meaning of.
+var baseURLAttrs = map[string]bool{"href": true, "src": true, "poster": true, "data": true}
+
+// applyBase makes the relative URLs of a content document that sets a
+// <base href> or xml:base attributes relative to the document itself, which
+// is what everything resolving them against epubDir(docPath) expects, and
+// removes the bases. URLs a base points out of the archive become absolute.
+// Links to a fragment alone are left alone: readers take them as pointing
+// into the document.
+func applyBase(doc *html.Node, docPath string) {
+	var base *url.URL
+	for b := findElement(doc, "base"); b != nil; b = findElement(doc, "base") {
+		if hasAttr(b, "href") && base == nil {
+			base = documentBase(docPath, getAttr(b, "href"))
+		}
+		b.Parent.RemoveChild(b)
+	}
+	rebase(doc, base, docPath)
+}
+
+// documentBase resolves the href of a <base> or an xml:base attribute of
+// the document at docPath. Bases in the archive are URLs with a path
+// from its root and no scheme. Bases such as file: URLs pointing at the
+// machine the book was made on are ignored, as nothing can be found there.
+func documentBase(docPath, href string) *url.URL {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err == nil && ref.Scheme != "" && ref.Scheme != "http" && ref.Scheme != "https" {
+		err = fmt.Errorf("%s: URLs are not supported", ref.Scheme)
+	}
+	if err != nil {
+		log.Printf("Warning: Ignoring the base %q of %s: %v", href, docPath, err)
+		return nil
+	}
+	return (&url.URL{Path: "/" + docPath}).ResolveReference(ref)
+}
+
+// rebase rewrites the URL attributes of n and its descendants against
+// base, or the xml:base of the elements that set one.
+func rebase(n *html.Node, base *url.URL, docPath string) {
+	if n.Type == html.ElementNode {
+		attrs := n.Attr[:0]
+		for _, attr := range n.Attr {
+			if attr.Key == "xml:base" || attr.Namespace == "xml" && attr.Key == "base" {
+				parent := base
+				if parent == nil {
+					parent = &url.URL{Path: "/" + docPath}
+				}
+				if ref, err := url.Parse(strings.TrimSpace(attr.Val)); err == nil {
+					base = parent.ResolveReference(ref)
+				}
+				continue
+			}
+			attrs = append(attrs, attr)
+		}
+		n.Attr = attrs
+		for i, attr := range n.Attr {
+			switch {
+			case base == nil:
+			case baseURLAttrs[attr.Key] && (attr.Namespace == "" || attr.Namespace == "xlink"):
+				n.Attr[i].Val = rebaseURL(attr.Val, base, docPath)
+			case attr.Key == "srcset":
+				candidates := strings.Split(attr.Val, ",")
+				for j, c := range candidates {
+					if fields := strings.Fields(c); len(fields) > 0 {
+						candidates[j] = strings.Join(append([]string{rebaseURL(fields[0], base, docPath)}, fields[1:]...), " ")
+					}
+				}
+				n.Attr[i].Val = strings.Join(candidates, ", ")
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		rebase(c, base, docPath)
+	}
+}
+
+// rebaseURL resolves a URL against base and returns it relative to the
+// directory of the document at docPath, or absolute if it is outside the
+// archive.
+func rebaseURL(ref string, base *url.URL, docPath string) string {
+	s := strings.TrimSpace(ref)
+	u, err := url.Parse(s)
+	if s == "" || strings.HasPrefix(s, "#") || err != nil || u.IsAbs() || u.Host != "" {
+		return ref
+	}
+	abs := base.ResolveReference(u)
+	if abs.Scheme != "" {
+		return abs.String()
+	}
+	rel := relativeEpubPath(epubDir(docPath), strings.TrimPrefix(abs.Path, "/"))
+	if abs.RawQuery != "" {
+		rel += "?" + abs.RawQuery
+	}
+	if abs.Fragment != "" {
+		rel += "#" + abs.Fragment
+	}
+	return rel
+}
+
+// relativeEpubPath returns the path of the archive path target relative
+// to the archive directory dir.
+func relativeEpubPath(dir, target string) string {
+	dirParts := strings.Split(normalizeEpubPath(dir), "/")
+	targetParts := strings.Split(normalizeEpubPath(target), "/")
+	if dirParts[0] == "" {
+		dirParts = nil
+	}
+	for len(dirParts) > 0 && len(targetParts) > 1 && dirParts[0] == targetParts[0] {
+		dirParts, targetParts = dirParts[1:], targetParts[1:]
+	}
+	return strings.Repeat("../", len(dirParts)) + strings.Join(targetParts, "/")
+}
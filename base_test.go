@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestApplyBase(t *testing.T) {
+	tests := []struct {
+		name, head, body, expected string
+	}{
+		{"no base", ``, `<img src="../images/a.png"><a href="#n1">1</a>`,
+			`<img src="../images/a.png"><a href="#n1">1</a>`},
+		{"base href", `<base href="../images/">`, `<img src="a%20b.png" srcset="a.png 1x, big/a.png 2x"><a href="../Text/c2.xhtml#s1">next</a><a href="#n1">1</a>`,
+			`<img src="../images/a b.png" srcset="../images/a.png 1x, ../images/big/a.png 2x"><a href="c2.xhtml#s1">next</a><a href="#n1">1</a>`},
+		{"remote base", `<base href="https://example.com/book/">`, `<a href="notes.html">notes</a><img src="data:image/png;base64,AA==">`,
+			`<a href="https://example.com/book/notes.html">notes</a><img src="data:image/png;base64,AA==">`},
+		{"file base", `<base href="file:///C:/Users/me/book/">`, `<img src="a.png">`,
+			`<img src="a.png">`},
+		{"nested xml:base", ``, `<div xml:base="/OEBPS/Images/"><img src="a.png"><p xml:base="sub/"><img src="b.png"></p></div><img src="c.png"><svg><image xml:base="/OEBPS/Images/" xlink:href="d.png"></svg>`,
+			`<div><img src="../Images/a.png"><p><img src="../Images/sub/b.png"></p></div><img src="c.png"><svg><image xlink:href="../Images/d.png"></image></svg>`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(`<html><head>` + tt.head + `</head><body>` + tt.body + `</body></html>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		applyBase(doc, "OEBPS/Text/c1.xhtml")
+		if findElement(doc, "base") != nil {
+			t.Errorf("applyBase with %s kept the <base> element", tt.name)
+		}
+		var b strings.Builder
+		for c := findElement(doc, "body").FirstChild; c != nil; c = c.NextSibling {
+			renderNodeRaw(c, &b)
+		}
+		if b.String() != tt.expected {
+			t.Errorf("applyBase with %s gave %s, expected %s", tt.name, b.String(), tt.expected)
+		}
+	}
+}
+
+func TestRelativeEpubPath(t *testing.T) {
+	tests := []struct{ dir, target, expected string }{
+		{"OEBPS/Text", "OEBPS/Text/c1.xhtml", "c1.xhtml"},
+		{"OEBPS/Text", "OEBPS/Images/a.png", "../Images/a.png"},
+		{"OEBPS", "OEBPS/Images/a.png", "Images/a.png"},
+		{"", "OEBPS/a.png", "OEBPS/a.png"},
+		{"OEBPS/Text", "cover.jpg", "../../cover.jpg"},
+	}
+	for _, tt := range tests {
+		if got := relativeEpubPath(tt.dir, tt.target); got != tt.expected {
+			t.Errorf("relativeEpubPath(%q, %q) = %q, expected %q", tt.dir, tt.target, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// matterTypes are the epub:type values of the sections --body-only leaves
+// out.
+var matterTypes = []string{"frontmatter", "backmatter", "copyright-page", "acknowledgments"}
+
+// isMatter reports whether n is marked as one of the matterTypes.
+func isMatter(n *html.Node) bool {
+	return n.Type == html.ElementNode && slices.ContainsFunc(strings.Fields(getAttr(n, "epub:type")), func(t string) bool {
+		return slices.Contains(matterTypes, t)
+	})
+}
+
+// bodyOnly keeps the body matter of the book for --body-only: chapters
+// whose <html> or <body> is marked as front or back matter are left out,
+// sections marked so are removed from the others, and chapters left
+// without content by that are dropped too. The rest are numbered anew.
+func bodyOnly(chapters []Chapter) []Chapter {
+	var kept []Chapter
+	for _, ch := range chapters {
+		body := findElement(ch.Doc, "body")
+		if body == nil || isMatter(body) || isMatter(body.Parent) {
+			continue
+		}
+		removed := removeMatter(body)
+		if removed && !hasContent(body) {
+			continue
+		}
+		kept = append(kept, ch)
+	}
+	return renumber(kept)
+}
+
+// removeMatter removes the elements below n that are marked as front or
+// back matter and reports whether there were any.
+func removeMatter(n *html.Node) bool {
+	removed := false
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if isMatter(c) {
+			n.RemoveChild(c)
+			removed = true
+		} else if removeMatter(c) {
+			removed = true
+		}
+		c = next
+	}
+	return removed
+}
+
+// hasContent reports whether n holds any text or image.
+func hasContent(n *html.Node) bool {
+	if strings.TrimSpace(textContent(n)) != "" {
+		return true
+	}
+	for _, tag := range []string{"img", "svg", "video", "audio"} {
+		if findElement(n, tag) != nil {
+			return true
+		}
+	}
+	return false
+}
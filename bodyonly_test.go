@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestBodyOnly(t *testing.T) {
+	var chapters []Chapter
+	for i, doc := range []string{
+		`<body epub:type="frontmatter titlepage"><h1>Title</h1></body>`,
+		`<body><section epub:type="copyright-page"><p>© 2020</p></section></body>`,
+		`<body><h1>One</h1><section epub:type="acknowledgments"><p>Thanks</p></section><p>Text</p></body>`,
+		`<body epub:type="bodymatter"><h1>Two</h1></body>`,
+		`<html epub:type="backmatter"><body><h1>Index</h1></body></html>`,
+	} {
+		n, err := html.Parse(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chapters = append(chapters, Chapter{Index: i, Path: string(rune('a' + i)), Doc: n})
+	}
+
+	kept := bodyOnly(chapters)
+	var paths []string
+	for i, ch := range kept {
+		if ch.Index != i {
+			t.Errorf("bodyOnly kept %s at %d, expected %d", ch.Path, ch.Index, i)
+		}
+		paths = append(paths, ch.Path)
+	}
+	if got := strings.Join(paths, ","); got != "c,d" {
+		t.Errorf("bodyOnly kept %s, expected c,d", got)
+	}
+	if text := textContent(kept[0].Doc); text != "One Text" {
+		t.Errorf("bodyOnly left %q in the chapter, expected %q", text, "One Text")
+	}
+}
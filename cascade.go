@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// styleMatch is a declaration that applies to an element, with what is
+// needed to order it in the cascade.
+type styleMatch struct {
+	decl        cssDecl
+	specificity cascadia.Specificity
+	order       int
+}
+
+// applyComputedStyles matches the rules of the given stylesheets against the
+// elements of doc and writes the winning declarations of each element into
+// its style attribute. Declarations already in a style attribute take
+// precedence over all but !important rules. Inherited values are left to the
+// renderer, so only the declarations that match an element are written.
+func (rd *renderer) applyComputedStyles(doc *html.Node, sheets []int) {
+	matches := make(map[*html.Node][]styleMatch)
+	order := 0
+	var apply func(rules []cssRule)
+	apply = func(rules []cssRule) {
+		for _, rule := range rules {
+			switch {
+			case rule.Statement || rule.Raw != "":
+			case rule.Rules != nil:
+				if rule.isAtRule("media") && !screenMedia(rule.Prelude) {
+					continue
+				}
+				apply(rule.Rules)
+			case atRuleName(rule.Prelude) == "":
+				for _, selector := range splitSelectors(rule.Prelude) {
+					sel, err := cascadia.Parse(selector)
+					if err != nil {
+						// Pseudo-elements, dynamic pseudo-classes and the like
+						// cannot be expressed as inline styles.
+						continue
+					}
+					for _, n := range cascadia.QueryAll(doc, sel) {
+						for _, decl := range rule.Decls {
+							matches[n] = append(matches[n], styleMatch{decl, sel.Specificity(), order})
+							order++
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, i := range sheets {
+		apply(rd.parsedStylesheet(i))
+	}
+
+	for n, m := range matches {
+		setStyleAttr(n, cascadeDeclarations(m, parseDeclarations(getAttr(n, "style"))))
+	}
+}
+
+// parsedStylesheet returns the rules of a collected stylesheet, parsing it
+// on first use.
+func (rd *renderer) parsedStylesheet(i int) []cssRule {
+	if rd.parsedSheets == nil {
+		rd.parsedSheets = make(map[int][]cssRule)
+	}
+	rules, ok := rd.parsedSheets[i]
+	if !ok {
+		rules = filterRules(parseCSS(rd.styles.sheets[i].Text), rd.opts.CSSFilter)
+		rd.parsedSheets[i] = rules
+	}
+	return rules
+}
+
+// cascadeDeclarations orders matched declarations by importance,
+// specificity and source order, lets the inline declarations override the
+// normal ones, and returns the winning value for each property in the order
+// the properties first appear.
+func cascadeDeclarations(matches []styleMatch, inline []cssDecl) []cssDecl {
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.decl.Important != b.decl.Important {
+			return b.decl.Important
+		}
+		if a.specificity != b.specificity {
+			return a.specificity.Less(b.specificity)
+		}
+		return a.order < b.order
+	})
+
+	var result []cssDecl
+	index := make(map[string]int)
+	set := func(d cssDecl) {
+		if i, ok := index[d.Property]; ok {
+			result[i] = d
+			return
+		}
+		index[d.Property] = len(result)
+		result = append(result, d)
+	}
+	for _, important := range []bool{false, true} {
+		for _, m := range matches {
+			if m.decl.Important == important {
+				set(m.decl)
+			}
+		}
+		for _, d := range inline {
+			if d.Important == important {
+				set(d)
+			}
+		}
+	}
+	return result
+}
+
+func setStyleAttr(n *html.Node, decls []cssDecl) {
+	style := serializeDeclarations(decls)
+	for i, attr := range n.Attr {
+		if attr.Key == "style" {
+			n.Attr[i].Val = style
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: style})
+}
+
+// screenMedia reports whether an @media prelude can apply on screen.
+func screenMedia(prelude string) bool {
+	query := strings.ToLower(strings.TrimSpace(prelude[len("@media"):]))
+	for _, q := range strings.Split(query, ",") {
+		q = strings.TrimSpace(q)
+		if !strings.HasPrefix(q, "print") && !strings.HasPrefix(q, "speech") && !strings.HasPrefix(q, "not screen") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestApplyComputedStyles(t *testing.T) {
+	css := `p { color: red; margin: 0 }
+.note { color: blue !important }
+#first { color: green; font-weight: bold }
+p::first-line { color: black }
+@media print { p { display: none } }`
+	src := `<html><body><p id="first" class="note" style="color: gray; text-align: center">A</p><p>B</p></body></html>`
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd := &renderer{opts: &options{}}
+	i := rd.styles.add("style:test", stylesheet{Text: css})
+	rd.applyComputedStyles(doc, []int{i})
+
+	body := findElement(doc, "body")
+	first, second := body.FirstChild, body.FirstChild.NextSibling
+	if style := getAttr(first, "style"); style != "color: blue !important; margin: 0; font-weight: bold; text-align: center" {
+		t.Errorf("first paragraph style = %q", style)
+	}
+	if style := getAttr(second, "style"); style != "color: red; margin: 0" {
+		t.Errorf("second paragraph style = %q", style)
+	}
+}
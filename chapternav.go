@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultNavTemplates are the chapter navigation templates of the formats
+// that write a file per chapter, used when no --nav-template is given.
+var defaultNavTemplates = map[string]string{
+	"gmi": `{{with .Prev}}=> {{.Href}} Previous: {{.Title}}
+{{end}}=> {{.Contents.Href}} {{.Contents.Title}}
+{{with .Next}}=> {{.Href}} Next: {{.Title}}
+{{end}}`,
+	"rst": `{{with .Prev}}:doc:` + "`" + `Previous: {{.Title}} <{{.Href}}>` + "`" + ` | {{end}}:doc:` + "`" + `{{.Contents.Title}} <{{.Contents.Href}}>` + "`" +
+		`{{with .Next}} | :doc:` + "`" + `Next: {{.Title}} <{{.Href}}>` + "`" + `{{end}}
+`,
+}
+
+// navLink is a link of the chapter navigation.
+type navLink struct {
+	Href  string
+	Title string
+}
+
+// chapterNav is what the navigation template is executed with, at the top
+// and again at the bottom of every chapter file.
+type chapterNav struct {
+	Prev, Next *navLink // nil in the first and the last chapter
+	Contents   navLink  // the index of the chapters
+	Bottom     bool     // whether the links go below the chapter
+}
+
+// loadNavTemplate parses the --nav-template at path, or the default one of
+// format when path is "".
+func loadNavTemplate(path, format string) (*template.Template, error) {
+	if path == "" {
+		return template.New(format).Parse(defaultNavTemplates[format])
+	}
+	tmpl, err := template.New(filepath.Base(path)).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse navigation template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// chapterNavs returns the navigation of each of the chapters with the
+// given file links and titles.
+func chapterNavs(hrefs, titles []string, contents navLink) []chapterNav {
+	navs := make([]chapterNav, len(hrefs))
+	for i := range hrefs {
+		navs[i].Contents = contents
+		if i > 0 {
+			navs[i].Prev = &navLink{Href: hrefs[i-1], Title: titles[i-1]}
+		}
+		if i+1 < len(hrefs) {
+			navs[i].Next = &navLink{Href: hrefs[i+1], Title: titles[i+1]}
+		}
+	}
+	return navs
+}
+
+// navBlock executes the navigation template for the top or the bottom of
+// a chapter, and returns its output as a block of lines, followed by a
+// blank line at the top, or "" if the template writes nothing.
+func navBlock(tmpl *template.Template, nav chapterNav, bottom bool) (string, error) {
+	nav.Bottom = bottom
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nav); err != nil {
+		return "", err
+	}
+	block := strings.Trim(b.String(), "\n")
+	if block == "" {
+		return "", nil
+	}
+	if bottom {
+		return block + "\n", nil
+	}
+	return block + "\n\n", nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNavBlock(t *testing.T) {
+	navs := chapterNavs([]string{"chapter001.gmi", "chapter002.gmi"}, []string{"One", "Two"}, navLink{Href: "index.gmi", Title: "Contents"})
+	custom := filepath.Join(t.TempDir(), "nav.tmpl")
+	if err := os.WriteFile(custom, []byte(`{{if .Bottom}}{{with .Next}}Read on: {{.Href}}{{end}}{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path, format string
+		nav          chapterNav
+		bottom       bool
+		expected     string
+	}{
+		{"", "gmi", navs[0], false, "=> index.gmi Contents\n=> chapter002.gmi Next: Two\n\n"},
+		{"", "gmi", navs[1], true, "=> chapter001.gmi Previous: One\n=> index.gmi Contents\n"},
+		{"", "rst", chapterNavs([]string{"chapter001", "chapter002"}, []string{"One", "Two"}, navLink{Href: "index", Title: "Contents"})[1], false,
+			":doc:`Previous: One <chapter001>` | :doc:`Contents <index>`\n\n"},
+		{custom, "gmi", navs[0], false, ""},
+		{custom, "gmi", navs[0], true, "Read on: chapter002.gmi\n"},
+	}
+	for _, tt := range tests {
+		tmpl, err := loadNavTemplate(tt.path, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := navBlock(tmpl, tt.nav, tt.bottom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block != tt.expected {
+			t.Errorf("navBlock(%s template %q, bottom %v) = %q, expected %q", tt.format, tt.path, tt.bottom, block, tt.expected)
+		}
+	}
+}
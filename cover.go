@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// coverImagePath returns the archive path of the book's cover image: the
+// one findCoverImage found when the package was parsed, else the manifest
+// item with the EPUB 3 cover-image property or the item named by an EPUB 2
+// <meta name="cover">, by its ID or, as some tools write it, by its href,
+// the one of the package's version first. It returns "" if the book declares no cover image.
+func coverImagePath(pkg *Package) string {
+	if pkg.CoverImage != "" {
+		return pkg.CoverImage
+	}
+	var imagePath string
+	byVersion(pkg, func() bool {
+		for _, item := range pkg.Manifest.Items {
+			if item.hasProperty("cover-image") {
+				imagePath = joinEpubPath(pkg.OpfDir, item.Href)
+				return true
+			}
+		}
+		return false
+	}, func() bool {
+		for _, meta := range pkg.Metadata.Meta {
+			if meta.Name != "cover" {
+				continue
+			}
+			content := strings.TrimSpace(meta.Content)
+			for _, item := range pkg.Manifest.Items {
+				if (item.ID == content || item.Href == content) && strings.HasPrefix(item.MediaType, "image/") {
+					imagePath = joinEpubPath(pkg.OpfDir, item.Href)
+					return true
+				}
+			}
+		}
+		return false
+	})
+	return imagePath
+}
+
+// findCoverImage returns the archive path of the book's cover image like
+// coverImagePath, or for books that only point at a cover page, with the
+// cover landmark, the guide's cover reference or a <meta name="cover">
+// naming the page, the first image shown on that page.
+func findCoverImage(pkg *Package, r *epubArchive) string {
+	if imagePath := coverImagePath(pkg); imagePath != "" {
+		return imagePath
+	}
+	pages := []string{landmarkPath(pkg, r, nil, "cover")}
+	for _, meta := range pkg.Metadata.Meta {
+		if meta.Name == "cover" {
+			for _, item := range pkg.Manifest.Items {
+				if item.ID == strings.TrimSpace(meta.Content) {
+					pages = append(pages, joinEpubPath(pkg.OpfDir, item.Href))
+				}
+			}
+		}
+	}
+	for _, page := range pages {
+		if page == "" {
+			continue
+		}
+		for _, item := range pkg.Manifest.Items {
+			if joinEpubPath(pkg.OpfDir, item.Href) == page && strings.HasPrefix(item.MediaType, "image/") {
+				return page
+			}
+		}
+		data, err := readZipFile(r, page)
+		if err != nil {
+			continue
+		}
+		doc, err := parseContent(data, page)
+		if err != nil {
+			continue
+		}
+		if src := firstImage(doc); src != "" {
+			return resolveEpubPath(epubDir(page), src)
+		}
+	}
+	return ""
+}
+
+// firstImage returns the source of the first <img> or SVG <image> below n,
+// or "".
+func firstImage(n *html.Node) string {
+	if n.Type == html.ElementNode {
+		for _, attr := range n.Attr {
+			if (n.Data == "img" && attr.Key == "src") || (n.Data == "image" && attr.Key == "href") {
+				return attr.Val
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if src := firstImage(c); src != "" {
+			return src
+		}
+	}
+	return ""
+}
+
+// showsImage reports whether a chapter displays the image at imagePath,
+// through an <img> or an SVG <image>.
+func showsImage(ch Chapter, imagePath string) bool {
+	var walk func(n *html.Node) bool
+	walk = func(n *html.Node) bool {
+		if n.Type == html.ElementNode {
+			for _, attr := range n.Attr {
+				if (n.Data == "img" && attr.Key == "src") || (n.Data == "image" && attr.Key == "href") {
+					if resolveEpubPath(epubDir(ch.Path), attr.Val) == imagePath {
+						return true
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if walk(c) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(ch.Doc)
+}
+
+// coverPage renders the cover section put before the first chapter, or ""
+// if the book has no cover image or its first chapter already shows it, as
+// most books with a cover page do.
+func (rd *renderer) coverPage(pkg *Package, chapters []Chapter) string {
+	imagePath := coverImagePath(pkg)
+	if imagePath == "" || (len(chapters) > 0 && showsImage(chapters[0], imagePath)) {
+		return ""
+	}
+	src, err := rd.resourceURL(imagePath)
+	if err != nil {
+		log.Printf("Warning: Could not embed cover image %s: %v", imagePath, err)
+		return ""
+	}
+	var size string
+	if s, ok := rd.imageSizes[imagePath]; ok {
+		size = fmt.Sprintf(` width="%d" height="%d"`, s.X, s.Y)
+	}
+	return fmt.Sprintf(`<section class="cover"><img src="%s" alt="%s"%s></section>`,
+		html.EscapeString(src), html.EscapeString(bookTitle(pkg)), size)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCoverImagePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		pkg      Package
+		expected string
+	}{
+		{
+			"cover-image property",
+			Package{OpfDir: "OEBPS", Manifest: Manifest{Items: []Item{
+				{ID: "pic", Href: "images/pic.jpg", MediaType: "image/jpeg"},
+				{ID: "c", Href: "images/cover.jpg", MediaType: "image/jpeg", Properties: "cover-image"},
+			}}},
+			"OEBPS/images/cover.jpg",
+		},
+		{
+			"meta cover",
+			Package{OpfDir: "OEBPS", Metadata: Metadata{Meta: []Meta{{Name: "cover", Content: "c"}}}, Manifest: Manifest{Items: []Item{
+				{ID: "c", Href: "cover.png", MediaType: "image/png"},
+			}}},
+			"OEBPS/cover.png",
+		},
+		{
+			"meta cover naming a page",
+			Package{Metadata: Metadata{Meta: []Meta{{Name: "cover", Content: "c"}}}, Manifest: Manifest{Items: []Item{
+				{ID: "c", Href: "cover.xhtml", MediaType: "application/xhtml+xml"},
+			}}},
+			"",
+		},
+		{
+			"meta cover naming an href",
+			Package{OpfDir: "OEBPS", Metadata: Metadata{Meta: []Meta{{Name: "cover", Content: "cover.png"}}}, Manifest: Manifest{Items: []Item{
+				{ID: "img1", Href: "cover.png", MediaType: "image/png"},
+			}}},
+			"OEBPS/cover.png",
+		},
+		{"none", Package{}, ""},
+	}
+	for _, tt := range tests {
+		if got := coverImagePath(&tt.pkg); got != tt.expected {
+			t.Errorf("coverImagePath(%s) = %q, expected %q", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestFindCoverImage(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"OEBPS/text/cover.xhtml": []byte(`<html><body><div><svg><image xlink:href="../images/cover.jpg"/></svg></div></body></html>`),
+	})
+	items := []Item{
+		{ID: "cover-page", Href: "text/cover.xhtml", MediaType: "application/xhtml+xml"},
+		{ID: "cover-jpg", Href: "images/cover.jpg", MediaType: "image/jpeg"},
+	}
+	tests := []struct {
+		name     string
+		pkg      Package
+		expected string
+	}{
+		{"guide cover page", Package{Guide: []Reference{{Type: "cover", Href: "text/cover.xhtml"}}}, "OEBPS/images/cover.jpg"},
+		{"guide cover image", Package{Guide: []Reference{{Type: "cover", Href: "images/cover.jpg"}}}, "OEBPS/images/cover.jpg"},
+		{"meta cover naming a page", Package{Metadata: Metadata{Meta: []Meta{{Name: "cover", Content: "cover-page"}}}}, "OEBPS/images/cover.jpg"},
+		{"none", Package{}, ""},
+	}
+	for _, tt := range tests {
+		tt.pkg.OpfDir, tt.pkg.Manifest.Items = "OEBPS", items
+		if got := findCoverImage(&tt.pkg, r); got != tt.expected {
+			t.Errorf("findCoverImage(%s) = %q, expected %q", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestShowsImage(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected bool
+	}{
+		{`<img src="../images/cover.jpg">`, true},
+		{`<svg><image xlink:href="../images/cover.jpg"/></svg>`, true},
+		{`<img src="../images/pic.jpg">`, false},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch := Chapter{Path: "OEBPS/text/cover.xhtml", Doc: doc}
+		if got := showsImage(ch, "OEBPS/images/cover.jpg"); got != tt.expected {
+			t.Errorf("showsImage(%q) = %v, expected %v", tt.body, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+type stylesheet struct {
+	Path string // archive path, empty for <style> elements
+	Text string
+}
+
+// stylesheetCollector gathers the CSS used by the chapters, each stylesheet
+// once, in the order it is first referenced.
+type stylesheetCollector struct {
+	index  map[string]int
+	sheets []stylesheet
+}
+
+// add records a stylesheet under key unless it is already known and returns
+// its position in the collection.
+func (sc *stylesheetCollector) add(key string, sheet stylesheet) int {
+	if i, ok := sc.index[key]; ok {
+		return i
+	}
+	if sc.index == nil {
+		sc.index = make(map[string]int)
+	}
+	sc.index[key] = len(sc.sheets)
+	sc.sheets = append(sc.sheets, sheet)
+	return len(sc.sheets) - 1
+}
+
+// collectStylesheets records the stylesheets a chapter links to and the
+// contents of its <style> elements, and returns their positions in the
+// collection.
+func (rd *renderer) collectStylesheets(doc *html.Node, contentFilePath string) []int {
+	var used []int
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "link":
+				if href := getAttr(n, "href"); href != "" && isStylesheetLink(n) {
+					used = append(used, rd.addLinkedStylesheet(resolveEpubPath(epubDir(contentFilePath), href)))
+				}
+				return
+			case "style":
+				if t := strings.ToLower(getAttr(n, "type")); t == "" || t == "text/css" {
+					// Its references are relative to the chapter, and are
+					// rewritten like those of linked stylesheets.
+					text := rd.embedCSSURLs(stripNUL(rawText(n)), contentFilePath)
+					used = append(used, rd.styles.add("style:"+text, stylesheet{Text: text}))
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return used
+}
+
+func (rd *renderer) addLinkedStylesheet(cssPath string) int {
+	if i, ok := rd.styles.index["link:"+cssPath]; ok {
+		return i
+	}
+	data, err := readZipFile(rd.r, cssPath)
+	if err != nil {
+		log.Printf("Warning: Could not read stylesheet %s: %v", cssPath, err)
+	}
+	text := rd.embedCSSURLs(stripNUL(string(data)), cssPath)
+	return rd.styles.add("link:"+cssPath, stylesheet{Path: cssPath, Text: text})
+}
+
+// embedCSSURLs replaces the url() references of CSS found in the archive file
+// at basePath with the URLs the output refers to those files by, as is done
+// for image sources. References that cannot be resolved are left unchanged.
+func (rd *renderer) embedCSSURLs(css, basePath string) string {
+	return rewriteCSSURLs(css, func(ref string) (string, bool) {
+		if ref == "" || strings.HasPrefix(ref, "#") || isExternalHref(ref) {
+			return "", false
+		}
+		ref, _, _ = strings.Cut(ref, "#")
+		ref, _, _ = strings.Cut(ref, "?")
+		archivePath := resolveEpubPath(epubDir(basePath), ref)
+		uri, err := rd.resourceURL(archivePath)
+		if err != nil {
+			log.Printf("Warning: Could not embed CSS resource %s: %v", archivePath, err)
+			return "", false
+		}
+		return uri, true
+	})
+}
+
+// embedStyleAttrURLs rewrites the url() references in the style attributes
+// of n and its descendants with embedCSSURLs.
+func (rd *renderer) embedStyleAttrURLs(n *html.Node, contentFilePath string) {
+	for i, attr := range n.Attr {
+		if attr.Key == "style" {
+			n.Attr[i].Val = rd.embedCSSURLs(attr.Val, contentFilePath)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		rd.embedStyleAttrURLs(c, contentFilePath)
+	}
+}
+
+// rewriteCSSURLs calls replace with the reference of every url() in css, and
+// of every string naming an image in an image-set(), and substitutes the
+// result where replace reports true. Other strings and comments are left
+// alone.
+func rewriteCSSURLs(css string, replace func(ref string) (string, bool)) string {
+	return rewriteCSSRefs(css, replace, false)
+}
+
+// rewriteCSSRefs implements rewriteCSSURLs. With imageSet, css is the
+// argument list of an image-set(), whose top-level strings are references.
+func rewriteCSSRefs(css string, replace func(ref string) (string, bool), imageSet bool) string {
+	var b strings.Builder
+	last := 0
+	depth := 0
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case c == '\\':
+			i++
+		case c == '"' || c == '\'':
+			end := skipCSSString(css, i)
+			if imageSet && depth == 0 && end < len(css) {
+				if uri, ok := replace(css[i+1 : end]); ok {
+					b.WriteString(css[last:i])
+					b.WriteString(`"` + uri + `"`)
+					last = end + 1
+				}
+			}
+			i = end
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				i = len(css)
+			} else {
+				i += end + 3
+			}
+		case isCSSFunction(css, i, "url("):
+			start := i + 4
+			end := scanCSS(css, start, ")")
+			if end >= len(css) {
+				i = end
+				continue
+			}
+			ref := strings.TrimSpace(css[start:end])
+			if len(ref) >= 2 && (ref[0] == '"' || ref[0] == '\'') && ref[len(ref)-1] == ref[0] {
+				ref = ref[1 : len(ref)-1]
+			}
+			if uri, ok := replace(ref); ok {
+				b.WriteString(css[last:i])
+				b.WriteString(`url("` + uri + `")`)
+				last = end + 1
+			}
+			i = end
+		case isCSSFunction(css, i, "image-set("):
+			start := i + len("image-set(")
+			end := scanCSS(css, start, ")")
+			if end >= len(css) {
+				i = end
+				continue
+			}
+			if args := rewriteCSSRefs(css[start:end], replace, true); args != css[start:end] {
+				b.WriteString(css[last:start])
+				b.WriteString(args)
+				last = end
+			}
+			i = end
+		case imageSet && c == '(':
+			depth++
+		case imageSet && c == ')' && depth > 0:
+			depth--
+		}
+	}
+	if last == 0 {
+		return css
+	}
+	b.WriteString(css[last:])
+	return b.String()
+}
+
+// isCSSFunction reports whether the CSS function name, given with its
+// opening parenthesis, starts at css[i]. Vendor prefixes such as -webkit-
+// are accepted in front of it.
+func isCSSFunction(css string, i int, name string) bool {
+	if len(css)-i <= len(name) || !strings.EqualFold(css[i:i+len(name)], name) {
+		return false
+	}
+	if i == 0 || !isCSSNameChar(css[i-1]) {
+		return true
+	}
+	if css[i-1] != '-' {
+		return false
+	}
+	j := i - 2
+	for j >= 0 && isCSSNameChar(css[j]) && css[j] != '-' {
+		j--
+	}
+	return j >= 0 && css[j] == '-' && j < i-2 && (j == 0 || !isCSSNameChar(css[j-1]))
+}
+
+func isCSSNameChar(c byte) bool {
+	return c == '-' || c == '_' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// stylesheetScope returns the class that limits the rules of the i-th
+// collected stylesheet to the chapters using it.
+func stylesheetScope(i int) string {
+	return fmt.Sprintf("css-%d", i+1)
+}
+
+// chapterScopeClass returns the class attribute of the element wrapping a
+// chapter with --scope-css: the chapter's own class followed by the scopes
+// of its stylesheets.
+func chapterScopeClass(ch Chapter, sheets []int) string {
+	classes := []string{fmt.Sprintf("ch-%d", ch.Index+1)}
+	seen := make(map[int]bool)
+	for _, i := range sheets {
+		if !seen[i] {
+			seen[i] = true
+			classes = append(classes, stylesheetScope(i))
+		}
+	}
+	return strings.Join(classes, " ")
+}
+
+// isStylesheetLink reports whether a <link> element references a persistent
+// or preferred stylesheet. Alternate stylesheets are left out.
+func isStylesheetLink(n *html.Node) bool {
+	stylesheet, alternate := false, false
+	for _, rel := range strings.Fields(strings.ToLower(getAttr(n, "rel"))) {
+		switch rel {
+		case "stylesheet":
+			stylesheet = true
+		case "alternate":
+			alternate = true
+		}
+	}
+	return stylesheet && !alternate
+}
+
+// combinedCSS concatenates the collected stylesheets into the text of a
+// single <style> element. With --scope-css the rules of each stylesheet are
+// limited to the chapters that use it.
+func (rd *renderer) combinedCSS() string {
+	var b strings.Builder
+	for i, sheet := range rd.styles.sheets {
+		text := stripCharsetRule(sheet.Text)
+		if rd.opts.ScopeCSS || rd.opts.CSSFilter != "" {
+			rules := filterRules(parseCSS(text), rd.opts.CSSFilter)
+			if rd.opts.ScopeCSS {
+				rules = scopeRules(rules, "."+stylesheetScope(i))
+			}
+			text = serializeCSS(rules)
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(text)
+		b.WriteString("\n")
+	}
+	return escapeStyleText(strings.TrimSuffix(b.String(), "\n"))
+}
+
+// escapeStyleText makes CSS safe to place in a <style> element: "</" would
+// end the element early, while "<\/" means the same in CSS.
+func escapeStyleText(css string) string {
+	return strings.ReplaceAll(css, "</", `<\/`)
+}
+
+// stripNUL removes the NUL bytes of CSS read from the book or from --css,
+// which mean nothing in CSS and would be taken for the start of the
+// placeholders streamWriter replaces.
+func stripNUL(css string) string {
+	return strings.ReplaceAll(css, "\x00", "")
+}
+
+// loadUserCSS reads the stylesheets given with --css, in order, and returns
+// them as the text of a <style> element.
+func loadUserCSS(paths []string) (string, error) {
+	var texts []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read stylesheet %s: %w", path, err)
+		}
+		if text := strings.TrimSpace(stripCharsetRule(stripNUL(string(data)))); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return escapeStyleText(strings.Join(texts, "\n\n")), nil
+}
+
+// externalStylesheet is the file name --external-css writes the CSS to.
+const externalStylesheet = "styles.css"
+
+// writeExternalCSS writes css to a stylesheet next to the HTML output and
+// returns the href linking to it. The file is always UTF-8, which it
+// declares so that it is read correctly from documents in other encodings.
+func writeExternalCSS(outputPath, css string) (string, error) {
+	path := filepath.Join(filepath.Dir(outputPath), externalStylesheet)
+	if err := os.WriteFile(path, []byte("@charset \"UTF-8\";\n"+css+"\n"), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return externalStylesheet, nil
+}
+
+// appendCSS adds the text of one <style> element after another, separated
+// by a blank line.
+func appendCSS(css, more string) string {
+	if css == "" || more == "" {
+		return css + more
+	}
+	return css + "\n\n" + more
+}
+
+// stripCharsetRule removes a leading @charset rule, which is only valid at
+// the very start of a stylesheet file.
+func stripCharsetRule(css string) string {
+	css = strings.TrimPrefix(css, "\uFEFF")
+	if !strings.HasPrefix(css, "@charset") {
+		return css
+	}
+	if end := strings.IndexByte(css, ';'); end >= 0 {
+		return css[end+1:]
+	}
+	return css
+}
+
+// cssRule is a rule of a parsed stylesheet. Style rules carry a selector
+// list in Prelude and their declarations; grouping at-rules such as @media
+// carry nested Rules; other at-rules keep their block verbatim in Raw.
+type cssRule struct {
+	Prelude   string
+	Decls     []cssDecl
+	Rules     []cssRule
+	Raw       string
+	Statement bool // an at-rule without a block, such as @import
+}
+
+type cssDecl struct {
+	Property  string
+	Value     string
+	Important bool
+}
+
+// isAtRule reports whether the rule is an at-rule of the given name, e.g.
+// "media" for @media.
+func (rule cssRule) isAtRule(name string) bool {
+	return strings.EqualFold(atRuleName(rule.Prelude), name)
+}
+
+func atRuleName(prelude string) string {
+	if !strings.HasPrefix(prelude, "@") {
+		return ""
+	}
+	end := strings.IndexAny(prelude, " \t\r\n\f({;")
+	if end < 0 {
+		end = len(prelude)
+	}
+	return prelude[1:end]
+}
+
+// parseCSS parses a stylesheet into rules. It is forgiving in the way
+// browsers are: comments are dropped and malformed input is skipped rather
+// than reported.
+func parseCSS(css string) []cssRule {
+	css = stripCSSComments(css)
+	var rules []cssRule
+	for i := 0; i < len(css); {
+		end := scanCSS(css, i, "{;}")
+		prelude := strings.TrimSpace(css[i:end])
+		if end >= len(css) {
+			break
+		}
+		switch css[end] {
+		case ';':
+			if prelude != "" {
+				rules = append(rules, cssRule{Prelude: prelude, Statement: true})
+			}
+			i = end + 1
+			continue
+		case '}':
+			// Stray closing brace.
+			i = end + 1
+			continue
+		}
+
+		blockStart := end + 1
+		blockEnd := matchingBrace(css, end)
+		block := css[blockStart:blockEnd]
+		i = blockEnd + 1
+
+		rule := cssRule{Prelude: prelude}
+		switch strings.ToLower(atRuleName(prelude)) {
+		case "":
+			rule.Decls = parseDeclarations(block)
+		case "media", "supports", "document", "-moz-document", "layer", "container":
+			rule.Rules = parseCSS(block)
+		case "font-face", "page":
+			rule.Decls = parseDeclarations(block)
+		default:
+			rule.Raw = strings.TrimSpace(block)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// parseDeclarations parses the contents of a declaration block.
+func parseDeclarations(block string) []cssDecl {
+	var decls []cssDecl
+	for i := 0; i < len(block); {
+		end := scanCSS(block, i, ";")
+		decl := block[i:end]
+		i = end + 1
+
+		name, value, ok := strings.Cut(decl, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		important := false
+		if idx := strings.LastIndex(value, "!"); idx >= 0 && strings.EqualFold(strings.TrimSpace(value[idx+1:]), "important") {
+			important = true
+			value = strings.TrimSpace(value[:idx])
+		}
+		decls = append(decls, cssDecl{Property: strings.ToLower(name), Value: value, Important: important})
+	}
+	return decls
+}
+
+// scanCSS returns the index of the first byte at or after i that is one of
+// stops and lies outside strings, parentheses and brackets, or len(s).
+func scanCSS(s string, i int, stops string) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			i++
+		case c == '"' || c == '\'':
+			i = skipCSSString(s, i)
+		case c == '(' || c == '[':
+			depth++
+		case (c == ')' || c == ']') && depth > 0:
+			depth--
+		case depth == 0 && strings.IndexByte(stops, c) >= 0:
+			return i
+		}
+	}
+	return len(s)
+}
+
+// skipCSSString returns the index of the quote closing the string that
+// starts at i.
+func skipCSSString(s string, i int) int {
+	quote := s[i]
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote, '\n':
+			return i
+		}
+	}
+	return len(s)
+}
+
+// matchingBrace returns the index of the brace closing the block opened at
+// open, or len(s) if the block is not terminated.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"', '\'':
+			i = skipCSSString(s, i)
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+func stripCSSComments(css string) string {
+	if !strings.Contains(css, "/*") {
+		return css
+	}
+	var b strings.Builder
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case c == '\\' && i+1 < len(css):
+			b.WriteString(css[i : i+2])
+			i++
+		case c == '"' || c == '\'':
+			end := min(skipCSSString(css, i), len(css)-1)
+			b.WriteString(css[i : end+1])
+			i = end
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 3
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// serializeCSS writes rules back as stylesheet text.
+func serializeCSS(rules []cssRule) string {
+	var b strings.Builder
+	writeCSSRules(&b, rules, "")
+	return b.String()
+}
+
+func writeCSSRules(b *strings.Builder, rules []cssRule, indent string) {
+	for _, rule := range rules {
+		switch {
+		case rule.Statement:
+			b.WriteString(indent + rule.Prelude + ";\n")
+		case rule.Rules != nil:
+			b.WriteString(indent + rule.Prelude + " {\n")
+			writeCSSRules(b, rule.Rules, indent+"  ")
+			b.WriteString(indent + "}\n")
+		case rule.Raw != "":
+			b.WriteString(indent + rule.Prelude + " { " + rule.Raw + " }\n")
+		default:
+			b.WriteString(indent + rule.Prelude + " {")
+			for i, d := range rule.Decls {
+				if i > 0 {
+					b.WriteString(";")
+				}
+				b.WriteString(" " + d.Property + ": " + d.Value)
+				if d.Important {
+					b.WriteString(" !important")
+				}
+			}
+			b.WriteString(" }\n")
+		}
+	}
+}
+
+// splitSelectors splits a selector list at its top-level commas.
+func splitSelectors(list string) []string {
+	var selectors []string
+	for i := 0; i <= len(list); {
+		end := scanCSS(list, i, ",")
+		if sel := strings.TrimSpace(list[i:end]); sel != "" {
+			selectors = append(selectors, sel)
+		}
+		i = end + 1
+	}
+	return selectors
+}
+
+// scopeRules prefixes every selector in rules with scope, a selector such as
+// ".css-1", so that the rules only apply inside the element matching it.
+// Selectors for the root and body elements are mapped onto the scope itself.
+func scopeRules(rules []cssRule, scope string) []cssRule {
+	for i := range rules {
+		rule := &rules[i]
+		switch {
+		case rule.Statement || rule.Raw != "":
+		case rule.Rules != nil:
+			rule.Rules = scopeRules(rule.Rules, scope)
+		case atRuleName(rule.Prelude) == "":
+			var scoped []string
+			for _, sel := range splitSelectors(rule.Prelude) {
+				scoped = append(scoped, scopeSelector(sel, scope))
+			}
+			rule.Prelude = strings.Join(scoped, ", ")
+		}
+	}
+	return rules
+}
+
+func scopeSelector(sel, scope string) string {
+	rest, stripped := sel, false
+	for _, root := range []string{"html", ":root", "body"} {
+		if compound, ok := leadingCompound(rest, root); ok {
+			rest = strings.TrimSpace(rest[len(compound):])
+			stripped = true
+		}
+	}
+	if !stripped {
+		return scope + " " + sel
+	}
+	if rest == "" {
+		return scope
+	}
+	return scope + " " + rest
+}
+
+// leadingCompound returns the compound selector at the start of sel if it
+// starts with the given type or pseudo-class selector.
+func leadingCompound(sel, name string) (string, bool) {
+	if len(sel) < len(name) || !strings.EqualFold(sel[:len(name)], name) {
+		return "", false
+	}
+	if len(sel) > len(name) && !strings.ContainsRune(" \t\n.#:[>+~", rune(sel[len(name)])) {
+		return "", false
+	}
+	end := len(name) + scanCSS(sel[len(name):], 0, " \t\n>+~")
+	return sel[:end], true
+}
+
+// serializeDeclarations writes declarations as the value of a style
+// attribute.
+func serializeDeclarations(decls []cssDecl) string {
+	var parts []string
+	for _, d := range decls {
+		part := d.Property + ": " + d.Value
+		if d.Important {
+			part += " !important"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCollectStylesheets(t *testing.T) {
+	src := `<html><head>
+<link rel="stylesheet" href="../css/missing.css">
+<link rel="alternate stylesheet" href="../css/night.css">
+<style>p { margin: 0 }</style>
+</head><body><style type="text/css">em { color: red }</style></body></html>`
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd := &renderer{opts: &options{}}
+	rd.styles.add("link:OEBPS/css/missing.css", stylesheet{Path: "OEBPS/css/missing.css"})
+	if used := rd.collectStylesheets(doc, "OEBPS/text/ch1.xhtml"); !reflect.DeepEqual(used, []int{0, 1, 2}) {
+		t.Errorf("collectStylesheets returned %v, expected [0 1 2]", used)
+	}
+	rd.collectStylesheets(doc, "OEBPS/text/ch2.xhtml")
+
+	expected := "p { margin: 0 }\n\nem { color: red }"
+	if css := rd.combinedCSS(); css != expected {
+		t.Errorf("combinedCSS() = %q, expected %q", css, expected)
+	}
+}
+
+func TestCollectStyleElementURLs(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{"OEBPS/img/x.png": {0x89, 'P', 'N', 'G'}})
+	doc, err := html.Parse(strings.NewReader(`<html><head><style>h1 { background: url(../img/x.png) }
+h2 { background: image-set("../img/x.png" 1x) }</style></head><body></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &Package{OpfDir: "OEBPS", Manifest: Manifest{Items: []Item{{ID: "x", Href: "img/x.png", MediaType: "image/png"}}}}
+	rd := newRenderer(pkg, r, &options{InlineCSS: true})
+	rd.collectStylesheets(doc, "OEBPS/text/ch1.xhtml")
+	expected := `h1 { background: url("data:image/png;base64,iVBORw==") }` + "\n" +
+		`h2 { background: image-set("data:image/png;base64,iVBORw==" 1x) }`
+	if css := rd.combinedCSS(); css != expected {
+		t.Errorf("combinedCSS() = %q, expected %q", css, expected)
+	}
+}
+
+func TestStripCharsetRule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`@charset "utf-8"; p {}`, " p {}"},
+		{"\uFEFF@charset \"utf-8\";\np {}", "\np {}"},
+		{"p { content: '@charset' }", "p { content: '@charset' }"},
+	}
+
+	for _, tt := range tests {
+		if result := stripCharsetRule(tt.input); result != tt.expected {
+			t.Errorf("stripCharsetRule(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestParseCSS(t *testing.T) {
+	src := `@import url("a.css");
+/* comment { } */
+p.x, h1 > em { color: red; content: "a;b}" ; margin : 0 !important }
+@media print { p { display: none } }
+@keyframes spin { from { opacity: 0 } to { opacity: 1 } }`
+	rules := parseCSS(src)
+	if len(rules) != 4 {
+		t.Fatalf("parseCSS returned %d rules, expected 4: %+v", len(rules), rules)
+	}
+	if !rules[0].Statement || rules[0].Prelude != `@import url("a.css")` {
+		t.Errorf("unexpected @import rule: %+v", rules[0])
+	}
+	expectedDecls := []cssDecl{
+		{Property: "color", Value: "red"},
+		{Property: "content", Value: `"a;b}"`},
+		{Property: "margin", Value: "0", Important: true},
+	}
+	if !reflect.DeepEqual(rules[1].Decls, expectedDecls) {
+		t.Errorf("declarations = %+v, expected %+v", rules[1].Decls, expectedDecls)
+	}
+	if !rules[2].isAtRule("media") || len(rules[2].Rules) != 1 {
+		t.Errorf("unexpected @media rule: %+v", rules[2])
+	}
+	if rules[3].Raw != "from { opacity: 0 } to { opacity: 1 }" {
+		t.Errorf("unexpected @keyframes block: %q", rules[3].Raw)
+	}
+}
+
+func TestScopeRules(t *testing.T) {
+	rules := parseCSS(`body { margin: 0 } html body p, .a:is(.b, .c) { color: red }
+@media screen { body.dark > div { color: white } }
+@font-face { font-family: X }`)
+	expected := `.s { margin: 0 }
+.s p, .s .a:is(.b, .c) { color: red }
+@media screen {
+  .s > div { color: white }
+}
+@font-face { font-family: X }
+`
+	if result := serializeCSS(scopeRules(rules, ".s")); result != expected {
+		t.Errorf("scopeRules result:\n%s\nexpected:\n%s", result, expected)
+	}
+}
+
+func TestLoadUserCSS(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.css")
+	b := filepath.Join(dir, "b.css")
+	os.WriteFile(a, []byte("@charset \"utf-8\";\nbody { color: #333 }\n"), 0o644)
+	os.WriteFile(b, []byte("p::after { content: \"</style>\x00\" }"), 0o644)
+
+	result, err := loadUserCSS([]string{a, b})
+	if err != nil {
+		t.Fatalf("loadUserCSS returned error: %v", err)
+	}
+	expected := "body { color: #333 }\n\np::after { content: \"<\\/style>\" }"
+	if result != expected {
+		t.Errorf("loadUserCSS = %q, expected %q", result, expected)
+	}
+	if _, err := loadUserCSS([]string{filepath.Join(dir, "missing.css")}); err == nil {
+		t.Error("loadUserCSS with a missing file returned no error")
+	}
+}
+
+func TestRewriteCSSURLs(t *testing.T) {
+	tests := []struct {
+		css      string
+		expected string
+	}{
+		{`a { background: url(bg.png) }`, `a { background: url("x:bg.png") }`},
+		{`a { src: URL( 'f.woff' ) format("woff") }`, `a { src: url("x:f.woff") format("woff") }`},
+		{`a { content: "url(no.png)" } /* url(no.png) */`, `a { content: "url(no.png)" } /* url(no.png) */`},
+		{`a { background: myurl(no.png) }`, `a { background: myurl(no.png) }`},
+		{`a { background: url(skip.png) }`, `a { background: url(skip.png) }`},
+		{
+			`h1 { background-image: image-set("h.png" 1x, url(h2.png) 2x, "h.avif" type("image/avif")) }`,
+			`h1 { background-image: image-set("x:h.png" 1x, url("x:h2.png") 2x, "x:h.avif" type("image/avif")) }`,
+		},
+		{`h1 { background: -webkit-image-set('h.png' 1x) }`, `h1 { background: -webkit-image-set("x:h.png" 1x) }`},
+		{`h1 { background: my-image-set("no.png" 1x) }`, `h1 { background: my-image-set("no.png" 1x) }`},
+	}
+	replace := func(ref string) (string, bool) {
+		return "x:" + ref, ref != "skip.png"
+	}
+	for _, test := range tests {
+		if result := rewriteCSSURLs(test.css, replace); result != test.expected {
+			t.Errorf("rewriteCSSURLs(%q) = %q, expected %q", test.css, result, test.expected)
+		}
+	}
+}
+
+func TestWriteExternalCSS(t *testing.T) {
+	dir := t.TempDir()
+	href, err := writeExternalCSS(filepath.Join(dir, "book.html"), "p { margin: 0 }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, href))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "@charset \"UTF-8\";\np { margin: 0 }\n"; string(data) != expected {
+		t.Errorf("%s = %q, expected %q", href, data, expected)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import "strings"
+
+// cssFilter decides which declarations of the book's CSS survive. Keep, if
+// set, lists the only properties retained; otherwise Drop lists the
+// properties removed. Entries ending in "-" match a property prefix.
+type cssFilter struct {
+	Keep []string
+	Drop []string
+	// DropAtRules lists at-rules removed entirely.
+	DropAtRules []string
+}
+
+var cssFilters = map[string]cssFilter{
+	"typography": {
+		Keep: []string{
+			"font-style", "font-weight", "font-variant", "font-size", "font-family",
+			"text-align", "text-indent", "text-decoration", "text-transform",
+			"line-height", "letter-spacing", "word-spacing", "white-space",
+			"vertical-align", "margin", "margin-", "list-style", "list-style-",
+			"hyphens", "-epub-hyphens", "-webkit-hyphens",
+		},
+		DropAtRules: []string{"font-face", "import", "page"},
+	},
+	"no-layout": {
+		Drop: []string{
+			"position", "top", "right", "bottom", "left", "inset", "float",
+			"clear", "z-index", "width", "height", "min-width", "min-height",
+			"max-width", "max-height", "columns", "column-", "transform",
+			"overflow", "overflow-",
+		},
+		DropAtRules: []string{"font-face", "import", "page"},
+	},
+}
+
+// filterRules returns the rules with the declarations and at-rules removed
+// by the named filter. Rules left without declarations are dropped. An
+// empty name returns the rules unchanged.
+func filterRules(rules []cssRule, name string) []cssRule {
+	filter, ok := cssFilters[name]
+	if !ok {
+		return rules
+	}
+	var result []cssRule
+	for _, rule := range rules {
+		if matchesCSSName(atRuleName(rule.Prelude), filter.DropAtRules) {
+			continue
+		}
+		switch {
+		case rule.Statement || rule.Raw != "":
+		case rule.Rules != nil:
+			rule.Rules = filterRules(rule.Rules, name)
+			if len(rule.Rules) == 0 {
+				continue
+			}
+		default:
+			rule.Decls = filterDeclarations(rule.Decls, name)
+			if len(rule.Decls) == 0 {
+				continue
+			}
+		}
+		result = append(result, rule)
+	}
+	return result
+}
+
+// filterDeclarations returns the declarations the named filter keeps.
+func filterDeclarations(decls []cssDecl, name string) []cssDecl {
+	filter, ok := cssFilters[name]
+	if !ok {
+		return decls
+	}
+	var result []cssDecl
+	for _, d := range decls {
+		if filter.Keep != nil && !matchesCSSName(d.Property, filter.Keep) {
+			continue
+		}
+		if matchesCSSName(d.Property, filter.Drop) {
+			continue
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+func matchesCSSName(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	if name == "" {
+		return false
+	}
+	for _, p := range patterns {
+		if name == p || (strings.HasSuffix(p, "-") && strings.HasPrefix(name, p)) {
+			return true
+		}
+	}
+	return false
+}
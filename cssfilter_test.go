@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestFilterRules(t *testing.T) {
+	css := `@font-face { font-family: X; src: url(x.ttf) }
+body { margin: 5%; font-family: serif; color: red }
+div.box { position: absolute; top: 0; width: 10em }
+@media screen { p { float: left; font-weight: bold } }`
+	tests := []struct {
+		filter   string
+		expected string
+	}{
+		{"typography", `body { margin: 5%; font-family: serif }
+@media screen {
+  p { font-weight: bold }
+}
+`},
+		{"no-layout", `body { margin: 5%; font-family: serif; color: red }
+@media screen {
+  p { font-weight: bold }
+}
+`},
+	}
+	for _, test := range tests {
+		if result := serializeCSS(filterRules(parseCSS(css), test.filter)); result != test.expected {
+			t.Errorf("filterRules(%q) result:\n%s\nexpected:\n%s", test.filter, result, test.expected)
+		}
+	}
+}
+
+func TestFilterDeclarations(t *testing.T) {
+	decls := parseDeclarations("float: right; margin-left: 1em; column-count: 2; text-align: center")
+	expected := "margin-left: 1em; text-align: center"
+	if result := serializeDeclarations(filterDeclarations(decls, "no-layout")); result != expected {
+		t.Errorf("filterDeclarations result = %q, expected %q", result, expected)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// minifyStylesheet rewrites CSS in its most compact form: comments and
+// optional whitespace are dropped and duplicate rules and declarations are
+// merged.
+func minifyStylesheet(css string) string {
+	var b strings.Builder
+	writeMinifiedCSS(&b, mergeCSSRules(parseCSS(css)))
+	return b.String()
+}
+
+// mergeCSSRules merges adjacent style rules with the same selector list,
+// removes style rules repeated later in the same block and drops
+// declarations repeated with the same value later in the same rule. Each of
+// these leaves the cascade unchanged.
+func mergeCSSRules(rules []cssRule) []cssRule {
+	var merged []cssRule
+	for _, rule := range rules {
+		if rule.Rules != nil {
+			rule.Rules = mergeCSSRules(rule.Rules)
+		}
+		rule.Prelude = minifySelector(rule.Prelude)
+		if n := len(merged); n > 0 && isStyleRule(rule) && isStyleRule(merged[n-1]) && merged[n-1].Prelude == rule.Prelude {
+			merged[n-1].Decls = slices.Concat(merged[n-1].Decls, rule.Decls)
+			continue
+		}
+		merged = append(merged, rule)
+	}
+
+	last := make(map[string]int)
+	for i, rule := range merged {
+		if isStyleRule(rule) {
+			rule.Decls = dedupeDeclarations(rule.Decls)
+			merged[i] = rule
+			last[styleRuleKey(rule)] = i
+		}
+	}
+	result := merged[:0]
+	for i, rule := range merged {
+		if isStyleRule(rule) && last[styleRuleKey(rule)] != i {
+			continue
+		}
+		result = append(result, rule)
+	}
+	return result
+}
+
+func isStyleRule(rule cssRule) bool {
+	return !rule.Statement && rule.Rules == nil && rule.Raw == "" && atRuleName(rule.Prelude) == ""
+}
+
+func styleRuleKey(rule cssRule) string {
+	var b strings.Builder
+	b.WriteString(rule.Prelude)
+	writeMinifiedDecls(&b, rule.Decls)
+	return b.String()
+}
+
+// dedupeDeclarations keeps the last of identical declarations. Declarations
+// of the same property with different values are kept, as they commonly
+// provide fallbacks for older readers.
+func dedupeDeclarations(decls []cssDecl) []cssDecl {
+	last := make(map[cssDecl]int)
+	for i, d := range decls {
+		d.Value = minifyCSSValue(d.Value)
+		decls[i] = d
+		last[d] = i
+	}
+	var result []cssDecl
+	for i, d := range decls {
+		if last[d] == i {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+func writeMinifiedCSS(b *strings.Builder, rules []cssRule) {
+	for _, rule := range rules {
+		switch {
+		case rule.Statement:
+			b.WriteString(minifyCSSValue(rule.Prelude) + ";")
+		case rule.Rules != nil:
+			b.WriteString(minifyCSSValue(rule.Prelude) + "{")
+			writeMinifiedCSS(b, rule.Rules)
+			b.WriteString("}")
+		case rule.Raw != "":
+			b.WriteString(minifyCSSValue(rule.Prelude) + "{" + minifyCSSValue(rule.Raw) + "}")
+		default:
+			if len(rule.Decls) == 0 {
+				continue
+			}
+			b.WriteString(rule.Prelude + "{")
+			writeMinifiedDecls(b, rule.Decls)
+			b.WriteString("}")
+		}
+	}
+}
+
+func writeMinifiedDecls(b *strings.Builder, decls []cssDecl) {
+	for i, d := range decls {
+		if i > 0 {
+			b.WriteString(";")
+		}
+		b.WriteString(d.Property + ":" + minifyCSSValue(d.Value))
+		if d.Important {
+			b.WriteString("!important")
+		}
+	}
+}
+
+// minifySelector removes the whitespace around combinators and commas of a
+// style rule's selector list. At-rule preludes are returned unchanged.
+func minifySelector(prelude string) string {
+	if atRuleName(prelude) != "" {
+		return prelude
+	}
+	return squeezeCSS(prelude, ",>+~")
+}
+
+// minifyCSSValue collapses whitespace outside strings and removes it around
+// commas.
+func minifyCSSValue(value string) string {
+	return squeezeCSS(value, ",")
+}
+
+// squeezeCSS collapses runs of whitespace outside strings into a single
+// space and removes the whitespace next to the given punctuation.
+func squeezeCSS(s, punct string) string {
+	var b strings.Builder
+	space := false
+	var prev byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 && strings.IndexByte(punct, c) < 0 && strings.IndexByte(punct, prev) < 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		end := i
+		switch c {
+		case '"', '\'':
+			end = min(skipCSSString(s, i), len(s)-1)
+		case '\\':
+			end = min(i+1, len(s)-1)
+		}
+		b.WriteString(s[i : end+1])
+		prev, i = s[end], end
+	}
+	return b.String()
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestMinifyStylesheet(t *testing.T) {
+	tests := []struct {
+		css      string
+		expected string
+	}{
+		{"/* generator */\nbody {\n  margin : 0 ;\n  font-family: \"Times  New\" ,  serif\n}\n",
+			`body{margin:0;font-family:"Times  New",serif}`},
+		{"h1 > a ,  h2 + p{color: red !important}", "h1>a,h2+p{color:red!important}"},
+		{"p { width: calc(100% - 2em) }", "p{width:calc(100% - 2em)}"},
+		{"p { color: red } p { margin: 0 }", "p{color:red;margin:0}"},
+		{"p { color: red } a { color: blue } p { color: red }", "a{color:blue}p{color:red}"},
+		{"p { display: box; display: flex; display: flex }", "p{display:box;display:flex}"},
+		{"@media  screen  and (min-width: 30em) { p { margin: 0 } }", "@media screen and (min-width: 30em){p{margin:0}}"},
+		{"@import url(a.css);\np:empty {}", "@import url(a.css);"},
+	}
+	for _, tt := range tests {
+		if result := minifyStylesheet(tt.css); result != tt.expected {
+			t.Errorf("minifyStylesheet(%q) = %q, expected %q", tt.css, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"strconv"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// imageSymbol is an image stored once in the output and shown wherever it is
+// referenced through an SVG <use> element.
+type imageSymbol struct {
+	ID            string
+	Width, Height int
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return string(sum[:])
+}
+
+// prescanImages counts how often each distinct image is referenced by the
+// <img> elements of the chapters, so that embedImage can store repeated
+// images only once.
+func (rd *renderer) prescanImages(chapters []Chapter) {
+	rd.imageHashes = make(map[string]string)
+	rd.imageRefs = make(map[string]int)
+	var walk func(n *html.Node, contentFilePath string)
+	walk = func(n *html.Node, contentFilePath string) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			if src := getAttr(n, "src"); src != "" {
+				imagePath := resolveEpubPath(epubDir(contentFilePath), src)
+				hash, ok := rd.imageHashes[imagePath]
+				if !ok {
+					data, err := readZipFile(rd.r, imagePath)
+					if err != nil {
+						return
+					}
+					hash = contentHash(data)
+					rd.imageHashes[imagePath] = hash
+					rd.imageOrder = append(rd.imageOrder, imagePath)
+				}
+				rd.imageRefs[hash]++
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, contentFilePath)
+		}
+	}
+	for _, ch := range chapters {
+		walk(ch.Doc, ch.Path)
+	}
+}
+
+// isRepeatedImage reports whether prescanImages found the image referenced
+// more than once.
+func (rd *renderer) isRepeatedImage(imagePath string) bool {
+	hash, ok := rd.imageHashes[imagePath]
+	return ok && rd.imageRefs[hash] > 1
+}
+
+// useImageSymbol turns an <img> element into an inline <svg> showing the
+// shared symbol of its image, sized like the image. It reports false, leaving
+// n unchanged, if the image cannot be stored as a symbol or is not embedded
+// at all.
+func (rd *renderer) useImageSymbol(n *html.Node, imagePath string) bool {
+	sym, ok := rd.symbols[rd.imageHashes[imagePath]]
+	if !ok {
+		data, mediaType, err := rd.readResource(imagePath)
+		if err != nil || !rd.embeds(len(data)) {
+			return false
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return false
+		}
+		uri := encodeDataURI(mediaType, data)
+		sym = imageSymbol{
+			ID:     fmt.Sprintf("e2h-img-%d", len(rd.symbolOrder)+1),
+			Width:  config.Width,
+			Height: config.Height,
+		}
+		if rd.symbols == nil {
+			rd.symbols = make(map[string]imageSymbol)
+		}
+		rd.symbols[rd.imageHashes[imagePath]] = sym
+		rd.symbolOrder = append(rd.symbolOrder, fmt.Sprintf(`<symbol id="%s" viewBox="0 0 %d %d"><image href="%s" width="%d" height="%d"></image></symbol>`,
+			sym.ID, sym.Width, sym.Height, html.EscapeString(uri), sym.Width, sym.Height))
+	}
+
+	width, height := strconv.Itoa(sym.Width), strconv.Itoa(sym.Height)
+	attrs := []html.Attribute{{Key: "viewBox", Val: fmt.Sprintf("0 0 %d %d", sym.Width, sym.Height)}}
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "src":
+		case "alt":
+			if alt := strings.TrimSpace(attr.Val); alt != "" {
+				attrs = append(attrs, html.Attribute{Key: "role", Val: "img"}, html.Attribute{Key: "aria-label", Val: alt})
+			} else {
+				attrs = append(attrs, html.Attribute{Key: "aria-hidden", Val: "true"})
+			}
+		case "width":
+			width = attr.Val
+		case "height":
+			height = attr.Val
+		default:
+			attrs = append(attrs, attr)
+		}
+	}
+	n.Data, n.DataAtom = "svg", atom.Svg
+	n.Attr = append(attrs, html.Attribute{Key: "width", Val: width}, html.Attribute{Key: "height", Val: height})
+	n.AppendChild(&html.Node{
+		Type: html.ElementNode,
+		Data: "use",
+		Attr: []html.Attribute{{Key: "href", Val: "#" + sym.ID}},
+	})
+	return true
+}
+
+// imageSymbolsHTML returns the hidden <svg> element defining the shared
+// image symbols, or "" if there are none.
+func (rd *renderer) imageSymbolsHTML() string {
+	if len(rd.symbolOrder) == 0 {
+		return ""
+	}
+	return `<svg xmlns="http://www.w3.org/2000/svg" width="0" height="0" style="position: absolute" aria-hidden="true">` +
+		strings.Join(rd.symbolOrder, "") + `</svg>`
+}
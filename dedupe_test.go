@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestUseImageSymbol(t *testing.T) {
+	pic := testPNG(t, 40, 20)
+	r := openTestArchive(t, map[string][]byte{"OEBPS/a.png": pic, "OEBPS/b.png": pic})
+	rd := &renderer{
+		r:    r,
+		opts: &options{},
+		manifestHrefMap: map[string]Item{
+			"OEBPS/a.png": {Href: "a.png", MediaType: "image/png"},
+			"OEBPS/b.png": {Href: "b.png", MediaType: "image/png"},
+		},
+	}
+	doc, err := html.Parse(strings.NewReader(`<p><img src="a.png" alt="A"></p><p><img src="b.png" alt="" width="80"></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd.prescanImages([]Chapter{{Path: "OEBPS/ch.xhtml", Doc: doc}})
+	if !rd.isRepeatedImage("OEBPS/a.png") {
+		t.Fatalf("isRepeatedImage(%q) = false, expected true", "OEBPS/a.png")
+	}
+
+	var imgs []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			imgs = append(imgs, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	expected := []string{
+		`<svg viewBox="0 0 40 20" role="img" aria-label="A" width="40" height="20"><use href="#e2h-img-1"></use></svg>`,
+		`<svg viewBox="0 0 40 20" aria-hidden="true" width="80" height="20"><use href="#e2h-img-1"></use></svg>`,
+	}
+	for i, img := range imgs {
+		path := resolveEpubPath("OEBPS", getAttr(img, "src"))
+		if !rd.useImageSymbol(img, path) {
+			t.Fatalf("useImageSymbol(%q) = false, expected true", path)
+		}
+		var out strings.Builder
+		html.Render(&out, img)
+		if out.String() != expected[i] {
+			t.Errorf("useImageSymbol(%q) rendered %q, expected %q", path, out.String(), expected[i])
+		}
+	}
+	if len(rd.symbolOrder) != 1 {
+		t.Errorf("got %d symbols, expected 1", len(rd.symbolOrder))
+	}
+	if sprites := rd.imageSymbolsHTML(); !strings.Contains(sprites, `<symbol id="e2h-img-1" viewBox="0 0 40 20"><image href="data:image/png;base64,`) {
+		t.Errorf("imageSymbolsHTML() = %q, expected the symbol of the image", sprites)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// writeDocBook writes the book as a single DocBook 5 document. Every spine
+// item becomes a <chapter>, later headings open nested <section>s and images
+// are copied next to the output file and referenced from <mediaobject>s.
+func writeDocBook(pkg *Package, r *epubArchive, outputPath string) error {
+	outFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	chapters := loadChapters(pkg, r)
+	chapterIDs := chapterIDs(chapters)
+
+	w := bufio.NewWriter(outFile)
+	w.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	w.WriteString("<book xmlns=\"http://docbook.org/ns/docbook\" xmlns:xlink=\"http://www.w3.org/1999/xlink\" version=\"5.0\">\n")
+	if m := pkg.Metadata; m.Title != "" && m.Subtitle != "" {
+		fmt.Fprintf(w, "<info><title>%s</title><subtitle>%s</subtitle></info>\n", html.EscapeString(m.Title), html.EscapeString(m.Subtitle))
+	} else {
+		fmt.Fprintf(w, "<info><title>%s</title></info>\n", html.EscapeString(bookTitle(pkg)))
+	}
+
+	for _, ch := range chapters {
+		dw := &docbookWriter{
+			w:          w,
+			r:          r,
+			pkg:        pkg,
+			chapter:    ch,
+			assetDir:   filepath.Dir(outputPath),
+			chapterIDs: chapterIDs,
+			titleNode:  chapterHeading(ch),
+		}
+		dw.writeChapter()
+	}
+
+	w.WriteString("</book>\n")
+	return w.Flush()
+}
+
+// docbookWriter converts one chapter body to DocBook markup. HTML freely
+// mixes text and blocks, so paragraphs are opened lazily whenever inline
+// content appears outside of one.
+type docbookWriter struct {
+	w          *bufio.Writer
+	r          *epubArchive
+	pkg        *Package
+	chapter    Chapter
+	assetDir   string
+	chapterIDs map[string]string
+	titleNode  *html.Node
+
+	inPara   bool
+	sections []int // heading levels of the open <section>s
+	blocks   int   // number of open block() wrappers such as <blockquote>
+}
+
+func (dw *docbookWriter) writeChapter() {
+	fmt.Fprintf(dw.w, "<chapter xml:id=\"%s\">\n<title>%s</title>\n",
+		dw.chapterIDs[dw.chapter.Path], html.EscapeString(chapterTitle(dw.chapter)))
+	if body := findElement(dw.chapter.Doc, "body"); body != nil {
+		dw.walkChildren(body)
+	}
+	dw.closePara()
+	for range dw.sections {
+		dw.w.WriteString("</section>\n")
+	}
+	dw.w.WriteString("</chapter>\n")
+}
+
+func (dw *docbookWriter) walkChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		dw.walk(c)
+	}
+}
+
+func (dw *docbookWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text := n.Data
+		if !dw.inPara {
+			text = strings.TrimLeft(text, " \t\r\n")
+			if text == "" {
+				return
+			}
+		}
+		dw.openPara()
+		dw.w.WriteString(html.EscapeString(text))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	tag := n.Data
+	switch tag {
+	case "script", "style", "link", "meta", "head", "title", "hr":
+		return
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		dw.closePara()
+		if n == dw.titleNode {
+			return
+		}
+		// A section cannot open inside a blockquote or list, as it would
+		// only be closed after it.
+		if dw.blocks > 0 {
+			fmt.Fprintf(dw.w, "<bridgehead>%s</bridgehead>\n", html.EscapeString(textContent(n)))
+			return
+		}
+		dw.openSection(int(tag[1]-'0'), textContent(n))
+		return
+	case "p":
+		dw.closePara()
+		dw.walkChildren(n)
+		dw.closePara()
+		return
+	case "ul", "ol":
+		dw.block(map[string]string{"ul": "itemizedlist", "ol": "orderedlist"}[tag], n)
+		return
+	case "li":
+		dw.block("listitem", n)
+		return
+	case "blockquote":
+		dw.block("blockquote", n)
+		return
+	case "pre":
+		dw.closePara()
+		dw.w.WriteString("<programlisting>")
+		dw.w.WriteString(html.EscapeString(rawText(n)))
+		dw.w.WriteString("</programlisting>\n")
+		return
+	case "img":
+		dw.image(n)
+		return
+	case "svg":
+		if img := svgImage(n); img != nil {
+			dw.image(img)
+		}
+		return
+	case "br":
+		if dw.inPara {
+			dw.w.WriteString("\n")
+		}
+		return
+	}
+
+	if isBlockElement(tag) {
+		dw.closePara()
+		dw.walkChildren(n)
+		dw.closePara()
+		return
+	}
+
+	open, close := docbookInline(n, dw.linkend(n))
+	if open == "" || hasBlockDescendant(n) {
+		dw.walkChildren(n)
+		return
+	}
+	dw.openPara()
+	dw.w.WriteString(open)
+	dw.walkChildren(n)
+	dw.w.WriteString(close)
+}
+
+// block wraps the children of n in the given DocBook block element.
+func (dw *docbookWriter) block(tag string, n *html.Node) {
+	dw.closePara()
+	dw.w.WriteString("<" + tag + ">\n")
+	dw.blocks++
+	dw.walkChildren(n)
+	dw.closePara()
+	dw.blocks--
+	dw.w.WriteString("</" + tag + ">\n")
+}
+
+func (dw *docbookWriter) openPara() {
+	if !dw.inPara {
+		dw.w.WriteString("<para>")
+		dw.inPara = true
+	}
+}
+
+func (dw *docbookWriter) closePara() {
+	if dw.inPara {
+		dw.w.WriteString("</para>\n")
+		dw.inPara = false
+	}
+}
+
+// openSection closes any sections at the same or a deeper level and opens a
+// new one for a heading of the given level.
+func (dw *docbookWriter) openSection(level int, title string) {
+	for len(dw.sections) > 0 && dw.sections[len(dw.sections)-1] >= level {
+		dw.w.WriteString("</section>\n")
+		dw.sections = dw.sections[:len(dw.sections)-1]
+	}
+	fmt.Fprintf(dw.w, "<section>\n<title>%s</title>\n", html.EscapeString(title))
+	dw.sections = append(dw.sections, level)
+}
+
+func (dw *docbookWriter) image(n *html.Node) {
+	src := getAttr(n, "src")
+	if src == "" {
+		return
+	}
+	imagePath := resolveEpubPath(epubDir(dw.chapter.Path), src)
+	rel, err := exportResource(dw.r, dw.pkg, imagePath, dw.assetDir)
+	if err != nil {
+		log.Printf("Warning: Could not export image %s: %v", imagePath, err)
+		return
+	}
+
+	element := "mediaobject"
+	if dw.inPara {
+		element = "inlinemediaobject"
+	}
+	fmt.Fprintf(dw.w, "<%s><imageobject><imagedata fileref=\"%s\"/></imageobject>", element, html.EscapeString(rel))
+	if alt := getAttr(n, "alt"); alt != "" {
+		fmt.Fprintf(dw.w, "<textobject><phrase>%s</phrase></textobject>", html.EscapeString(alt))
+	}
+	fmt.Fprintf(dw.w, "</%s>", element)
+	if !dw.inPara {
+		dw.w.WriteString("\n")
+	}
+}
+
+// linkend returns the chapter ID an internal link points to, or "" if the
+// element is not a link to another spine document.
+func (dw *docbookWriter) linkend(n *html.Node) string {
+	href := getAttr(n, "href")
+	if n.Data != "a" || href == "" || isExternalHref(href) {
+		return ""
+	}
+	target, _, _ := strings.Cut(href, "#")
+	if target == "" {
+		return dw.chapterIDs[dw.chapter.Path]
+	}
+	return dw.chapterIDs[resolveEpubPath(epubDir(dw.chapter.Path), target)]
+}
+
+// docbookInline returns the DocBook tags replacing an inline HTML element,
+// or empty strings if the element has no DocBook equivalent.
+func docbookInline(n *html.Node, linkend string) (string, string) {
+	switch n.Data {
+	case "em", "i", "cite", "var", "dfn":
+		return "<emphasis>", "</emphasis>"
+	case "strong", "b":
+		return "<emphasis role=\"bold\">", "</emphasis>"
+	case "code", "tt", "kbd", "samp":
+		return "<literal>", "</literal>"
+	case "sub":
+		return "<subscript>", "</subscript>"
+	case "sup":
+		return "<superscript>", "</superscript>"
+	case "q":
+		return "<quote>", "</quote>"
+	case "a":
+		if href := getAttr(n, "href"); isExternalHref(href) {
+			return fmt.Sprintf("<link xlink:href=\"%s\">", html.EscapeString(href)), "</link>"
+		}
+		if linkend != "" {
+			return fmt.Sprintf("<link linkend=\"%s\">", linkend), "</link>"
+		}
+	}
+	return "", ""
+}
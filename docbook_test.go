@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestDocBookWriter(t *testing.T) {
+	src := `<html><body>
+<h1>Chapter</h1>
+Loose <b>text</b>
+<h2>One</h2>
+<p>First <a href="http://example.com/">link</a></p>
+<h3>Nested</h3>
+<ul><li>Item</li></ul>
+<h2>Two</h2>
+<p><i>Last</i></p>
+</body></html>`
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	ch := Chapter{Path: "ch.xhtml", Doc: doc}
+	dw := &docbookWriter{
+		w:          bufio.NewWriter(&out),
+		chapter:    ch,
+		chapterIDs: map[string]string{"ch.xhtml": "ch1"},
+		titleNode:  chapterHeading(ch),
+	}
+	dw.writeChapter()
+	dw.w.Flush()
+
+	expected := "<chapter xml:id=\"ch1\">\n<title>Chapter</title>\n" +
+		"<para>Loose <emphasis role=\"bold\">text</emphasis>\n</para>\n" +
+		"<section>\n<title>One</title>\n" +
+		"<para>First <link xlink:href=\"http://example.com/\">link</link></para>\n" +
+		"<section>\n<title>Nested</title>\n" +
+		"<itemizedlist>\n<listitem>\n<para>Item</para>\n</listitem>\n</itemizedlist>\n" +
+		"</section>\n</section>\n" +
+		"<section>\n<title>Two</title>\n" +
+		"<para><emphasis>Last</emphasis></para>\n" +
+		"</section>\n</chapter>\n"
+	if got := out.String(); got != expected {
+		t.Errorf("DocBook output mismatch:\ngot:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestDocBookNestedHeadings(t *testing.T) {
+	src := `<html><body><h1>Chapter</h1><h2>One</h2><blockquote><h3>Quoted</h3><p>q</p></blockquote>
+<ul><li><h4>Item</h4>text</li></ul><p>After</p></body></html>`
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	ch := Chapter{Path: "ch.xhtml", Doc: doc}
+	dw := &docbookWriter{
+		w:          bufio.NewWriter(&out),
+		chapter:    ch,
+		chapterIDs: map[string]string{"ch.xhtml": "ch1"},
+		titleNode:  chapterHeading(ch),
+	}
+	dw.writeChapter()
+	dw.w.Flush()
+
+	dec := xml.NewDecoder(strings.NewReader(out.String()))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("DocBook output is not well-formed: %v\n%s", err, out.String())
+		}
+	}
+	for _, expected := range []string{
+		"<blockquote>\n<bridgehead>Quoted</bridgehead>\n<para>q</para>\n</blockquote>",
+		"<listitem>\n<bridgehead>Item</bridgehead>\n<para>text</para>\n</listitem>",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("DocBook output\n%s\ndoes not contain\n%s", out.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// exitDRM is the exit status for books that cannot be converted because
+// they are DRM-protected, so that batch conversions can tell them apart
+// from other failures, which exit with 1.
+const exitDRM = 3
+
+// drmSchemes name the DRM of a book by the license file the scheme keeps
+// in META-INF.
+var drmSchemes = []struct{ file, name string }{
+	{"META-INF/rights.xml", "Adobe ADEPT"},
+	{"META-INF/license.lcpl", "Readium LCP"},
+	{"META-INF/sinf.xml", "Apple FairPlay"},
+}
+
+// drmError reports a book whose content is encrypted.
+type drmError struct {
+	scheme string // "" if the DRM is not one of drmSchemes
+	files  int    // number of encrypted files
+}
+
+func (e *drmError) Error() string {
+	scheme := "DRM"
+	if e.scheme != "" {
+		scheme = e.scheme + " DRM"
+	}
+	return fmt.Sprintf("the book is protected with %s, which encrypts %d of its files", scheme, e.files)
+}
+
+// checkDRM returns a *drmError if META-INF/encryption.xml lists files
+// encrypted with anything but the font obfuscation algorithms, which
+// readObfuscatedFonts undoes. Such files cannot be read without the keys
+// of the DRM, and would turn into garbled or empty chapters.
+func checkDRM(r *epubArchive) error {
+	data, err := readZipFile(r, "META-INF/encryption.xml")
+	if err != nil {
+		return nil
+	}
+	var enc Encryption
+	if err := xml.Unmarshal(data, &enc); err != nil {
+		// Reported by readObfuscatedFonts.
+		return nil
+	}
+	files := 0
+	for _, ed := range enc.EncryptedData {
+		switch ed.Method.Algorithm {
+		case idpfObfuscation, adobeObfuscation:
+		default:
+			files++
+		}
+	}
+	if files == 0 {
+		return nil
+	}
+	e := &drmError{files: files}
+	for _, s := range drmSchemes {
+		if _, err := findZipFile(r, s.file); err == nil {
+			e.scheme = s.name
+			break
+		}
+	}
+	return e
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckDRM(t *testing.T) {
+	encryption := func(algorithms ...string) []byte {
+		xml := `<encryption xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">`
+		for _, a := range algorithms {
+			xml += `<enc:EncryptedData><enc:EncryptionMethod Algorithm="` + a + `"/><enc:CipherData><enc:CipherReference URI="OEBPS/file"/></enc:CipherData></enc:EncryptedData>`
+		}
+		return []byte(xml + `</encryption>`)
+	}
+	const aes = "http://www.w3.org/2001/04/xmlenc#aes128-cbc"
+	tests := []struct {
+		name   string
+		files  map[string][]byte
+		scheme string
+		count  int // encrypted files reported, 0 for no error
+	}{
+		{"no encryption.xml", map[string][]byte{"mimetype": []byte("application/epub+zip")}, "", 0},
+		{"obfuscated fonts", map[string][]byte{"META-INF/encryption.xml": encryption(idpfObfuscation, adobeObfuscation)}, "", 0},
+		{"ADEPT", map[string][]byte{"META-INF/encryption.xml": encryption(aes, aes, idpfObfuscation), "META-INF/rights.xml": nil}, "Adobe ADEPT", 2},
+		{"LCP", map[string][]byte{"META-INF/encryption.xml": encryption(aes), "META-INF/license.lcpl": nil}, "Readium LCP", 1},
+		{"unknown DRM", map[string][]byte{"META-INF/encryption.xml": encryption(aes)}, "", 1},
+	}
+	for _, tt := range tests {
+		err := checkDRM(openTestArchive(t, tt.files))
+		var drm *drmError
+		switch {
+		case tt.count == 0 && err != nil:
+			t.Errorf("checkDRM(%s) = %v, expected no error", tt.name, err)
+		case tt.count > 0 && (!errors.As(err, &drm) || drm.scheme != tt.scheme || drm.files != tt.count):
+			t.Errorf("checkDRM(%s) = %v, expected %s DRM on %d files", tt.name, err, tt.scheme, tt.count)
+		}
+	}
+}
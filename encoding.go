@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// xmlEncodingDecl matches the encoding of an XML declaration.
+var xmlEncodingDecl = regexp.MustCompile(`^\s*<\?xml[^>]*?\sencoding\s*=\s*["']([^"']+)["']`)
+
+// metaCharset matches the charset of a <meta charset> tag or of a
+// Content-Type <meta http-equiv> one.
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]*?charset\s*=\s*["']?\s*([\w.:-]+)`)
+
+// parseContent parses a content document of the book at docPath, decoded
+// to UTF-8 and with its XML entities and CDATA sections rewritten by
+// normalizeEntities first.
+func parseContent(data []byte, docPath string) (*html.Node, error) {
+	return html.Parse(bytes.NewReader(normalizeEntities(decodeContent(data, docPath), docPath)))
+}
+
+// decodeContent returns a content document as UTF-8, which the HTML parser
+// expects. Its encoding is given by its byte order mark, its XML
+// declaration or its <meta> charset declaration, in that order. Documents
+// without any are UTF-8, as XML is, unless they are not valid UTF-8: those
+// are legacy documents, read as windows-1252 like browsers do.
+func decodeContent(data []byte, docPath string) []byte {
+	var label string
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		return data[3:]
+	case bytes.HasPrefix(data, []byte("\xff\xfe")), bytes.HasPrefix(data, []byte("<\x00?\x00")):
+		label = "utf-16le"
+	case bytes.HasPrefix(data, []byte("\xfe\xff")), bytes.HasPrefix(data, []byte("\x00<\x00?")):
+		label = "utf-16be"
+	default:
+		head := data[:min(len(data), 1024)]
+		if m := xmlEncodingDecl.FindSubmatch(head); m != nil {
+			label = string(m[1])
+		} else if m := metaCharset.FindSubmatch(head); m != nil {
+			label = string(m[1])
+		} else if !utf8.Valid(data) {
+			log.Printf("Warning: %s declares no character encoding and is not UTF-8; reading it as windows-1252", docPath)
+			label = "windows-1252"
+		}
+		// A document that can be read this far as ASCII is not UTF-16,
+		// whatever it declares.
+		if strings.HasPrefix(strings.ToLower(label), "utf-16") {
+			label = ""
+		}
+	}
+	if label == "" {
+		return data
+	}
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		log.Printf("Warning: %s declares the unknown character encoding %q; reading it as UTF-8", docPath, label)
+		return data
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return data
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		log.Printf("Warning: Could not decode %s as %s: %v", docPath, label, err)
+		return data
+	}
+	return bytes.TrimPrefix(decoded, []byte("\xef\xbb\xbf"))
+}
+
+// lookupOutputEncoding resolves a character encoding label such as
+// "windows-1251" or "latin1" and returns the encoding with its canonical
+// name for the <meta charset> declaration.
+func lookupOutputEncoding(label string) (encoding.Encoding, string, error) {
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, "", fmt.Errorf("unsupported output encoding %q", label)
+	}
+	name, err := htmlindex.Name(enc)
+	if err != nil {
+		return nil, "", fmt.Errorf("unsupported output encoding %q", label)
+	}
+	return enc, name, nil
+}
+
+// encodeOutput wraps w so that UTF-8 written to it is transcoded to enc.
+// Characters the encoding cannot represent become numeric character
+// references, so no text is lost. It must be closed once everything is
+// written, as stateful encodings such as ISO-2022-JP end with a shift
+// sequence.
+func encodeOutput(w io.Writer, enc encoding.Encoding) io.WriteCloser {
+	return transform.NewWriter(w, encoding.HTMLEscapeUnsupported(enc.NewEncoder()))
+}
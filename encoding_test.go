@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestEncodeOutput(t *testing.T) {
+	_, name, err := lookupOutputEncoding("latin1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "windows-1252" {
+		t.Errorf("lookupOutputEncoding(latin1) name = %q, expected windows-1252", name)
+	}
+
+	tests := []struct {
+		label, text, expected string
+	}{
+		{"latin1", "café ✓", "caf\xe9 &#10003;"},
+		// The encoder only switches back to ASCII when it is closed.
+		{"iso-2022-jp", "日本", "\x1b$BF|K\\\x1b(B"},
+	}
+	for _, tt := range tests {
+		enc, _, err := lookupOutputEncoding(tt.label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		w := encodeOutput(&out, enc)
+		if _, err := io.WriteString(w, tt.text); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("encodeOutput to %s wrote %q, expected %q", tt.label, out.String(), tt.expected)
+		}
+	}
+
+	if _, _, err := lookupOutputEncoding("no-such-charset"); err == nil {
+		t.Error("lookupOutputEncoding accepted an unknown label")
+	}
+}
+
+func TestDecodeContent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"<p>café</p>", "<p>café</p>"},
+		{"\xef\xbb\xbf<p>café</p>", "<p>café</p>"},
+		{"\xff\xfe<\x00p\x00>\x00\xe9\x00", "<p>é"},
+		{"\xfe\xff\x00<\x00p\x00>\x00\xe9", "<p>é"},
+		{"<\x00?\x00x\x00", "<?x"},
+		{`<?xml version="1.0" encoding="ISO-8859-1"?><p>caf` + "\xe9</p>", `<?xml version="1.0" encoding="ISO-8859-1"?><p>café</p>`},
+		{`<html><head><meta charset="windows-1251"></head><p>` + "\xcf\xf0\xe8</p>", `<html><head><meta charset="windows-1251"></head><p>При</p>`},
+		{`<meta http-equiv="Content-Type" content="text/html; charset=koi8-r"><p>` + "\xf0\xd2\xc9</p>", `<meta http-equiv="Content-Type" content="text/html; charset=koi8-r"><p>При</p>`},
+		{`<?xml version="1.0" encoding="UTF-16"?><p>café</p>`, `<?xml version="1.0" encoding="UTF-16"?><p>café</p>`},
+		{"<p>caf\xe9</p>", "<p>café</p>"},
+		{`<meta charset="no-such-charset"><p>café</p>`, `<meta charset="no-such-charset"><p>café</p>`},
+	}
+	for _, tt := range tests {
+		if decoded := string(decodeContent([]byte(tt.input), "page.xhtml")); decoded != tt.expected {
+			t.Errorf("decodeContent(%q) = %q, expected %q", tt.input, decoded, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+
+	"golang.org/x/net/html"
+)
+
+// The XML constructs of content documents that the HTML parser does not
+// understand.
+var (
+	internalSubset = regexp.MustCompile(`(?is)(<!DOCTYPE[^>\[]*)\[(.*?)\]\s*>`)
+	entityDecl     = regexp.MustCompile(`(?s)<!ENTITY\s+([\w.:-]+)\s+(?:"([^"]*)"|'([^']*)')\s*>`)
+	entityRef      = regexp.MustCompile(`&([\w.:-]+);`)
+	cdataSection   = regexp.MustCompile(`(?s)<!\[CDATA\[(.*?)\]\]>`)
+	rawTextTag     = regexp.MustCompile(`(?i)<(/?)(script|style)\b`)
+)
+
+// Limits on expanding the entities of a content document, whose values may
+// refer to each other, so that a few nested declarations cannot blow a
+// small chapter up exponentially.
+const (
+	maxEntityDepth     = 16
+	maxEntityExpansion = 1 << 20 // bytes of entity values put into a document
+)
+
+// normalizeEntities rewrites the XML constructs of a content document into
+// HTML, before it is parsed as HTML: the entities declared in the
+// internal subset of its DOCTYPE, which the HTML parser would leave as
+// literal text, are replaced by their values, and the subset is removed,
+// as the parser would end the DOCTYPE at the first > in it; CDATA
+// sections are replaced by their escaped text, or by their raw content
+// in scripts and stylesheets, which the parser would turn into comments
+// or leave with their markers. Entities that refer to themselves or
+// exceed the expansion limits are left unexpanded.
+func normalizeEntities(data []byte, docPath string) []byte {
+	if loc := internalSubset.FindSubmatchIndex(data); loc != nil {
+		e := &entityExpander{values: make(map[string][]byte), open: make(map[string]bool)}
+		for _, m := range entityDecl.FindAllSubmatch(data[loc[4]:loc[5]], -1) {
+			// As in XML, the first declaration of an entity is binding.
+			if _, ok := e.values[string(m[1])]; !ok {
+				e.values[string(m[1])] = append(m[2], m[3]...)
+			}
+		}
+		doctype := bytes.TrimRight(data[loc[2]:loc[3]], " \t\r\n")
+		data = slices.Concat(data[:loc[2]], doctype, []byte(">"), data[loc[1]:])
+		if expanded := e.expand(data, 0); e.err == nil {
+			data = expanded
+		} else {
+			log.Printf("Warning: Not expanding the entities declared in %s: %v", docPath, e.err)
+		}
+	}
+	if !bytes.Contains(data, []byte("<![CDATA[")) {
+		return data
+	}
+
+	var b bytes.Buffer
+	last := 0
+	for _, m := range cdataSection.FindAllSubmatchIndex(data, -1) {
+		b.Write(data[last:m[0]])
+		content := data[m[2]:m[3]]
+		if inRawText(data[:m[0]]) {
+			b.Write(content)
+		} else {
+			b.WriteString(html.EscapeString(string(content)))
+		}
+		last = m[1]
+	}
+	b.Write(data[last:])
+	return b.Bytes()
+}
+
+// entityExpander replaces references to the entities declared in a
+// document by their values, expanding the references in those in turn.
+type entityExpander struct {
+	values map[string][]byte
+	open   map[string]bool // entities whose values are being expanded
+	size   int             // bytes of values put in so far
+	err    error           // the limit hit, which stops expanding
+}
+
+func (e *entityExpander) expand(text []byte, depth int) []byte {
+	return entityRef.ReplaceAllFunc(text, func(ref []byte) []byte {
+		name := string(ref[1 : len(ref)-1])
+		value, ok := e.values[name]
+		if !ok || e.err != nil {
+			return ref
+		}
+		if e.open[name] {
+			e.err = fmt.Errorf("the entity %s refers to itself", name)
+			return ref
+		}
+		if depth >= maxEntityDepth {
+			e.err = fmt.Errorf("the entities are nested more than %d deep", maxEntityDepth)
+			return ref
+		}
+		e.open[name] = true
+		value = e.expand(value, depth+1)
+		e.open[name] = false
+		if e.size += len(value); e.size > maxEntityExpansion {
+			e.err = fmt.Errorf("the entities expand to more than %d bytes", maxEntityExpansion)
+			return ref
+		}
+		return value
+	})
+}
+
+// inRawText reports whether the end of the document text before is inside
+// a <script> or <style> element.
+func inRawText(before []byte) bool {
+	tags := rawTextTag.FindAllSubmatch(before, -1)
+	return len(tags) > 0 && len(tags[len(tags)-1][1]) == 0
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEntities(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`<p>Caf&eacute;&nbsp;&amp; bar</p>`, `<p>Caf&eacute;&nbsp;&amp; bar</p>`},
+		{"<!DOCTYPE html [\n<!ENTITY pub \"Acme &amp; Sons\">\n<!ENTITY ed '2nd'>\n]>\n<html><p>&pub;, &ed; edition</p></html>",
+			"<!DOCTYPE html>\n<html><p>Acme &amp; Sons, 2nd edition</p></html>"},
+		{`<p><![CDATA[if (a < b && c > d)]]> holds</p>`, `<p>if (a &lt; b &amp;&amp; c &gt; d) holds</p>`},
+		{"<script>//<![CDATA[\nif (a < b) go();\n//]]></script><p><![CDATA[x]]></p>",
+			"<script>//\nif (a < b) go();\n//</script><p>x</p>"},
+		{`<style><![CDATA[p > em { color: red }]]></style>`, `<style>p > em { color: red }</style>`},
+		{"<!DOCTYPE html [<!ENTITY a \"x&b;\"><!ENTITY b \"y\">]><p>&a;</p>", "<!DOCTYPE html><p>xy</p>"},
+		{"<!DOCTYPE html [<!ENTITY a \"x&b;\"><!ENTITY b \"&a;\">]><p>&a;</p>", "<!DOCTYPE html><p>&a;</p>"},
+	}
+	for _, tt := range tests {
+		if got := string(normalizeEntities([]byte(tt.input), "ch.xhtml")); got != tt.expected {
+			t.Errorf("normalizeEntities(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestNormalizeNestedEntities(t *testing.T) {
+	var doc strings.Builder
+	doc.WriteString(`<!DOCTYPE html [<!ENTITY a0 "lol">`)
+	for i := 1; i <= 9; i++ {
+		fmt.Fprintf(&doc, `<!ENTITY a%d "%s">`, i, strings.Repeat(fmt.Sprintf("&a%d;", i-1), 10))
+	}
+	doc.WriteString(`]><p>&a9;</p>`)
+	out := normalizeEntities([]byte(doc.String()), "ch.xhtml")
+	if len(out) > maxEntityExpansion {
+		t.Errorf("normalizeEntities expanded nested entities to %d bytes", len(out))
+	}
+	if expected := "<!DOCTYPE html><p>&a9;</p>"; string(out) != expected {
+		t.Errorf("normalizeEntities of nested entities = %.100q, expected %q", out, expected)
+	}
+}
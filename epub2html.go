@@ -2,34 +2,60 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"encoding/base64"
 	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
+	"html/template"
+	"image"
 	"io"
 	"log"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 const defaultOutputFile = "output.html"
 
-type Metadata struct {
-	Title string `xml:"http://purl.org/dc/elements/1.1/ title"`
+// Meta is an OPF <meta> element: EPUB 3 property metadata or an EPUB 2
+// name/content pair.
+type Meta struct {
+	ID       string `xml:"id,attr" json:"id,omitempty"`
+	Property string `xml:"property,attr" json:"property,omitempty"`
+	Refines  string `xml:"refines,attr" json:"refines,omitempty"`
+	Name     string `xml:"name,attr" json:"name,omitempty"`
+	Content  string `xml:"content,attr" json:"content,omitempty"`
+	Value    string `xml:",chardata" json:"value,omitempty"`
+	// PropertyIRI is the IRI of Property, set by resolvePrefixes.
+	PropertyIRI string `xml:"-" json:"propertyIRI,omitempty"`
 }
 
 type Package struct {
-	XMLName  xml.Name `xml:"package"`
-	Metadata Metadata `xml:"metadata"`
-	Manifest Manifest `xml:"manifest"`
-	Spine    Spine    `xml:"spine"`
-	Version  string   `xml:"version,attr"`
-	UniqueID string   `xml:"unique-identifier,attr"`
+	XMLName  xml.Name    `xml:"package"`
+	Metadata Metadata    `xml:"metadata"`
+	Manifest Manifest    `xml:"manifest"`
+	Spine    Spine       `xml:"spine"`
+	Guide    []Reference `xml:"guide>reference"`
+	Version  string      `xml:"version,attr"`
+	UniqueID string      `xml:"unique-identifier,attr"`
+	Lang     string      `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Dir      string      `xml:"dir,attr"`
+	Prefix   string      `xml:"prefix,attr"` // prefixes of the properties, e.g. "ibooks: http://..."
 	OpfDir   string
+	// CoverImage is the archive path of the cover image, found by
+	// findCoverImage when the package is parsed.
+	CoverImage string `xml:"-"`
 }
 
 type Manifest struct {
@@ -37,18 +63,32 @@ type Manifest struct {
 }
 
 type Item struct {
-	ID        string `xml:"id,attr"`
-	Href      string `xml:"href,attr"`
-	MediaType string `xml:"media-type,attr"`
+	ID           string `xml:"id,attr"`
+	Href         string `xml:"href,attr"`
+	MediaType    string `xml:"media-type,attr"`
+	Properties   string `xml:"properties,attr"`
+	Fallback     string `xml:"fallback,attr"`      // ID of the item to use if this one's type is not supported
+	MediaOverlay string `xml:"media-overlay,attr"` // ID of the SMIL document reading this one aloud
 }
 
 type Spine struct {
-	Toc      string    `xml:"toc,attr"`
-	Itemrefs []Itemref `xml:"itemref"`
+	Toc                string    `xml:"toc,attr"`
+	PageProgressionDir string    `xml:"page-progression-direction,attr"`
+	Itemrefs           []Itemref `xml:"itemref"`
 }
 
 type Itemref struct {
-	Idref string `xml:"idref,attr"`
+	Idref      string `xml:"idref,attr"`
+	Linear     string `xml:"linear,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// Reference is an entry of the EPUB 2 <guide>, which points at structural
+// parts of the book such as the cover or the index.
+type Reference struct {
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr"`
+	Href  string `xml:"href,attr"`
 }
 
 type Container struct {
@@ -56,29 +96,153 @@ type Container struct {
 	Rootfiles []Rootfile `xml:"rootfiles>rootfile"`
 }
 
+// Rootfile is a package listed in container.xml. Books with several
+// renditions, such as a reflowable and a fixed-layout one, describe each
+// with the attributes of the EPUB Multiple-Rendition Publications spec.
 type Rootfile struct {
-	FullPath  string `xml:"full-path,attr"`
-	MediaType string `xml:"media-type,attr"`
+	FullPath   string `xml:"full-path,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+	Label      string `xml:"http://www.idpf.org/2013/rendition label,attr"`
+	Layout     string `xml:"http://www.idpf.org/2013/rendition layout,attr"`
+	Language   string `xml:"http://www.idpf.org/2013/rendition language,attr"`
+	Media      string `xml:"http://www.idpf.org/2013/rendition media,attr"` // CSS media query
+	AccessMode string `xml:"http://www.idpf.org/2013/rendition accessMode,attr"`
+}
+
+// opfMediaType is the media type of the package documents in container.xml.
+const opfMediaType = "application/oebps-package+xml"
+
+type options struct {
+	InputPath    string
+	OutputPath   string
+	Rootfile     int      // position of the package to convert in container.xml, from 1
+	RootfilePath string   // archive path of the package to convert
+	Rendition    []string // rendition selectors such as layout=reflowable
+
+	// Output format and layout
+	Format         string
+	TemplatePath   string
+	NavTemplate    string
+	Minify         bool
+	Pretty         bool
+	OutputEncoding string
+	TOC            bool
+	TOCDepth       int
+	Layout         string
+	TOCFile        string
+
+	// Styling
+	InlineCSS        bool
+	ScopeCSS         bool
+	KeepClasses      bool
+	KeepInlineStyles bool
+	ComputedStyles   bool
+	CSSFilter        string
+	CSSFiles         []string
+	Theme            string
+	Math             string
+	Responsive       bool
+	PrintCSS         bool
+	EmbedFonts       bool
+	SubsetFonts      bool
+	MinifyCSS        bool
+	ExternalCSS      bool
+
+	// Content
+	AssetsDir        string
+	BaseURL          string
+	NoTimestamp      bool
+	JSONLD           bool
+	TitlePage        bool
+	RightsFooter     bool
+	MetadataOut      string
+	Title            string
+	Authors          []string
+	Language         string
+	EmbedMaxBytes    int
+	FetchRemote      bool
+	NoImages         bool
+	NoSVG            bool
+	SVGPages         string
+	NoCover          bool
+	MaxImageSize     int
+	ImageFormat      string
+	ImageQuality     int
+	EInk             bool
+	Semanticize      bool
+	SemanticMapPath  string
+	SemanticMap      map[string]string // loaded from SemanticMapPath
+	Figures          bool
+	FiguresIndex     bool
+	PageNumbers      bool
+	KeepScripts      bool
+	ReadAlong        bool
+	IncludeNonLinear bool
+	StartAt          string
+	BodyOnly         bool
+	Sample           string
+	SamplePercent    float64 // parsed from Sample
+	SampleChapters   int
+	SampleNotice     string
+	Chapters         string
+	ChapterRanges    []spineRange // parsed from Chapters
+	Include          string
+	IncludeRe        *regexp.Regexp // compiled from Include
+	Exclude          string
+	ExcludeRe        *regexp.Regexp // compiled from Exclude
+	DeriveAlt        bool
+	AltReport        string
+	Strict           bool
+	Jobs             int
+	Pprof            string
 }
 
 func main() {
-	if len(os.Args) < 2 || len(os.Args) > 3 {
-		log.Fatalf("Usage: %s <input.epub> [output.html]", os.Args[0])
+	if len(os.Args) > 1 && os.Args[1] == "extract" {
+		if err := runExtract(os.Args[2:]); err != nil {
+			if errors.As(err, new(*drmError)) {
+				log.Print(err)
+				os.Exit(exitDRM)
+			}
+			log.Fatal(err)
+		}
+		return
 	}
 
-	epubPath := os.Args[1]
-	outputPath := defaultOutputFile
-	if len(os.Args) == 3 {
-		outputPath = os.Args[2]
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.Pprof != "" {
+		if err := startPprof(opts.Pprof); err != nil {
+			log.Fatalf("Failed to serve profiles: %v", err)
+		}
 	}
 
-	r, err := zip.OpenReader(epubPath)
+	r, err := openEpubArchive(opts.InputPath)
 	if err != nil {
 		log.Fatalf("Failed to open EPUB file: %v", err)
 	}
 	defer r.Close()
+	if err := checkDRM(r); err != nil {
+		log.Printf("Cannot convert %s: %v", opts.InputPath, err)
+		os.Exit(exitDRM)
+	}
+	if problems := mimetypeProblems(r); len(problems) > 0 {
+		level := "Warning"
+		if opts.Strict {
+			level = "Error"
+		}
+		for _, problem := range problems {
+			log.Printf("%s: %s", level, problem)
+		}
+		if opts.Strict {
+			log.Fatalf("Not converting %s, which breaks the EPUB container format, with --strict", opts.InputPath)
+		}
+	}
 
-	opfPath, err := findOpfPath(r)
+	opfPath, err := findOpfPath(r, opts.Rootfile, opts.RootfilePath, opts.Rendition)
 	if err != nil {
 		log.Fatalf("Failed to find OPF file path: %v", err)
 	}
@@ -91,107 +255,574 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to parse OPF file %s: %v", opfPath, err)
 	}
+	for _, warning := range versionWarnings(pkg) {
+		log.Printf("Warning: %s", warning)
+	}
+	pkg.Metadata.override(opts.Title, opts.Authors, opts.Language)
+	if strings.Contains(opts.OutputPath, "{id}") {
+		id := identifierFileName(pkg)
+		if id == "" {
+			log.Fatal("The book has no identifier to put in place of {id} in the output path")
+		}
+		opts.OutputPath = strings.ReplaceAll(opts.OutputPath, "{id}", id)
+	}
+	if opts.ChapterRanges != nil {
+		pkg.Spine.Itemrefs = selectSpine(pkg.Spine.Itemrefs, opts.ChapterRanges)
+		if len(pkg.Spine.Itemrefs) == 0 {
+			log.Fatalf("No spine items at the positions %s given to --chapters", opts.Chapters)
+		}
+	}
+	if opts.IncludeRe != nil || opts.ExcludeRe != nil {
+		pkg.Spine.Itemrefs = filterSpine(pkg, r, opts.IncludeRe, opts.ExcludeRe)
+		if len(pkg.Spine.Itemrefs) == 0 {
+			log.Fatal("No spine items are left after --include and --exclude")
+		}
+	}
 
-	outFile, err := os.Create(outputPath)
+	switch opts.Format {
+	case "gmi":
+		if err := writeGemtext(pkg, r, opts.OutputPath, opts.NavTemplate); err != nil {
+			log.Fatalf("Failed to write Gemtext output: %v", err)
+		}
+		log.Printf("Successfully converted EPUB to Gemtext: %s", opts.OutputPath)
+		return
+	case "docbook":
+		if err := writeDocBook(pkg, r, opts.OutputPath); err != nil {
+			log.Fatalf("Failed to write DocBook output: %v", err)
+		}
+		log.Printf("Successfully converted EPUB to DocBook: %s", opts.OutputPath)
+		return
+	case "rst":
+		if err := writeRst(pkg, r, opts.OutputPath, opts.NavTemplate); err != nil {
+			log.Fatalf("Failed to write reStructuredText output: %v", err)
+		}
+		log.Printf("Successfully converted EPUB to reStructuredText: %s", opts.OutputPath)
+		return
+	}
+
+	tmpl, err := loadTemplate(opts)
+	if err != nil {
+		log.Fatalf("Failed to load output template: %v", err)
+	}
+
+	userCSS, err := loadUserCSS(opts.CSSFiles)
+	if err != nil {
+		log.Fatalf("Failed to load custom CSS: %v", err)
+	}
+
+	outFile, err := os.Create(opts.OutputPath)
 	if err != nil {
 		log.Fatalf("Failed to create output HTML file: %v", err)
 	}
 	defer outFile.Close()
 
-	title := "Converted EPUB"
-	if pkg.Metadata.Title != "" {
-		title = pkg.Metadata.Title
+	var now time.Time
+	if !opts.NoTimestamp {
+		now = time.Now()
 	}
-	htmlHeader := fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head>\n<title>%s</title>\n</head>\n<body>\n", html.EscapeString(title))
-	_, err = outFile.WriteString(htmlHeader)
+	provenance, err := readProvenance(opts.InputPath, pkg, now)
 	if err != nil {
-		log.Fatalf("Failed to write HTML header: %v", err)
+		log.Fatalf("Failed to hash EPUB file: %v", err)
 	}
-	combinedHTML, err := processEpubContent(pkg, r)
-	if err != nil {
-		log.Fatalf("Failed to process EPUB content: %v", err)
+
+	data := buildTemplateData(pkg, r, opts)
+	defer data.spool.Close()
+	data.Provenance = provenance
+	data.MetaTags = append(data.MetaTags, provenance.metaTags()...)
+	if opts.AltReport != "" {
+		if err := writeAltReport(opts.AltReport, data.missingAlt); err != nil {
+			log.Fatalf("Failed to write alt text report: %v", err)
+		}
+	}
+	if opts.TOCFile != "" {
+		if err := writeTOCFile(opts.TOCFile, opts.OutputPath, data.Title, data.TOC); err != nil {
+			log.Fatalf("Failed to write table of contents: %v", err)
+		}
+	}
+	data.CSS = template.CSS(appendCSS(string(data.CSS), userCSS))
+	if opts.MinifyCSS {
+		data.CSS = template.CSS(minifyStylesheet(string(data.CSS)))
+	}
+	if opts.ExternalCSS && data.CSS != "" {
+		href, err := writeExternalCSS(opts.OutputPath, string(data.CSS))
+		if err != nil {
+			log.Fatalf("Failed to write stylesheet: %v", err)
+		}
+		data.Stylesheet, data.CSS = href, ""
 	}
 
-	_, err = outFile.WriteString(combinedHTML.String())
-	if err != nil {
-		log.Fatalf("Failed to write combined HTML content: %v", err)
+	var out io.Writer = outFile
+	var encoder io.WriteCloser
+	if opts.OutputEncoding != "" {
+		enc, name, _ := lookupOutputEncoding(opts.OutputEncoding)
+		encoder = encodeOutput(outFile, enc)
+		out = encoder
+		data.Charset = name
 	}
 
-	_, err = outFile.WriteString("</body>\n</html>\n")
+	stream := newStreamWriter(out, data.streamed, data.spool)
+	w := bufio.NewWriter(stream)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Fatalf("Failed to write HTML output: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("Failed to write HTML output: %v", err)
+	}
+	if err := streamEnd(stream); err != nil {
+		log.Fatalf("Failed to write HTML output: %v", err)
+	}
+	if encoder != nil {
+		if err := encoder.Close(); err != nil {
+			log.Fatalf("Failed to write HTML output: %v", err)
+		}
+	}
+	if opts.MetadataOut != "" {
+		if info, err := outFile.Stat(); err == nil {
+			data.stats.OutputBytes = info.Size()
+		}
+		if err := writeMetadataFile(opts.MetadataOut, pkg, provenance, data.stats); err != nil {
+			log.Fatalf("Failed to write metadata: %v", err)
+		}
+	}
+
+	log.Printf("Successfully converted EPUB to raw HTML: %s", opts.OutputPath)
+}
+
+func parseArgs(args []string) (*options, error) {
+	fs := flag.NewFlagSet("epub2html", flag.ContinueOnError)
+	opts := &options{}
+	fs.StringVar(&opts.Format, "format", "html", "output format: html, gmi, docbook or rst")
+	fs.IntVar(&opts.Rootfile, "rootfile", 0, "convert the `n`th package listed in container.xml, for books with several renditions")
+	fs.StringVar(&opts.RootfilePath, "rootfile-path", "", "convert the package document at `path` in the EPUB")
+	fs.Var((*stringList)(&opts.Rendition), "rendition", "convert the first package in container.xml with the rendition `attribute=value`, e.g. layout=reflowable or language=fr; may be repeated")
+	fs.StringVar(&opts.TemplatePath, "template", "", "Go html/template `file` used to lay out the HTML output")
+	fs.StringVar(&opts.NavTemplate, "nav-template", "", "Go text/template `file` writing the previous, next and contents links of each chapter file of the gmi and rst formats")
+	fs.BoolVar(&opts.Minify, "minify", false, "collapse whitespace and drop optional quotes and tags in the HTML output")
+	fs.BoolVar(&opts.Pretty, "pretty", false, "indent and line-wrap the HTML output")
+	fs.BoolVar(&opts.TOC, "toc", false, "add a table of contents linking to the chapters, taken from the book's NCX, at the top of the HTML output")
+	fs.IntVar(&opts.TOCDepth, "toc-depth", 0, "limit the table of contents to `levels` of nesting, 0 for all (implies --toc)")
+	fs.StringVar(&opts.TOCFile, "toc-file", "", "also write the table of contents to `file`, as JSON or, for a .html file, as a page of links")
+	fs.StringVar(&opts.Layout, "layout", "", "page layout of the HTML output: sidebar shows the table of contents in a fixed pane beside the text (implies --toc)")
+	fs.BoolVar(&opts.InlineCSS, "inline-css", false, "keep the book's stylesheets in a <style> block and keep class attributes")
+	fs.BoolVar(&opts.ScopeCSS, "scope-css", false, "like --inline-css, but wrap each chapter in a <section> and limit its stylesheets to it")
+	fs.BoolVar(&opts.KeepClasses, "keep-classes", false, "keep class attributes")
+	fs.BoolVar(&opts.KeepInlineStyles, "keep-inline-styles", false, "keep style attributes")
+	fs.BoolVar(&opts.ComputedStyles, "computed-styles", false, "apply the book's stylesheets as style attributes on each element, for readers without CSS support")
+	fs.BoolVar(&opts.EmbedFonts, "embed-fonts", false, "embed the book's fonts and their @font-face rules, also without --inline-css")
+	fs.BoolVar(&opts.SubsetFonts, "subset-fonts", false, "like --embed-fonts, but strip the glyphs the book does not use from TrueType and WOFF fonts")
+	fs.BoolVar(&opts.MinifyCSS, "minify-css", false, "strip comments and whitespace from the CSS of the HTML output and merge duplicate rules (implied by --minify)")
+	fs.BoolVar(&opts.ExternalCSS, "external-css", false, "write the CSS of the HTML output to styles.css next to it and link it instead of inlining it")
+	fs.StringVar(&opts.CSSFilter, "css-filter", "", "drop parts of the book's CSS: typography keeps only text formatting, no-layout removes positioning and sizing")
+	fs.Var((*stringList)(&opts.CSSFiles), "css", "append the stylesheet `file` to the HTML output; may be repeated")
+	fs.BoolVar(&opts.Responsive, "responsive", false, "add a viewport tag, a readable content column and fluid images for phones")
+	fs.BoolVar(&opts.PrintCSS, "print-css", false, "add print rules that start every chapter on a new page")
+	fs.StringVar(&opts.Math, "math", "", "render the book's formulas with `renderer` mathjax or katex, or replace them with their images: image")
+	fs.StringVar(&opts.Theme, "theme", "", "colour scheme of the HTML output: light, dark or auto to follow the reader's system setting")
+	fs.StringVar(&opts.Title, "title", "", "use `title` as the title of the book instead of the one in its metadata")
+	fs.Var((*stringList)(&opts.Authors), "author", "use `name` as the author of the book instead of the ones in its metadata; may be repeated")
+	fs.StringVar(&opts.Language, "language", "", "use the language `code`, e.g. en or pt-BR, as the language of the book instead of the one in its metadata")
+	fs.StringVar(&opts.MetadataOut, "metadata-out", "", "also write the book's metadata, spine, manifest and conversion stats to `file` as JSON")
+	fs.BoolVar(&opts.RightsFooter, "rights-footer", false, "end the book with a footer citing it and stating its rights, from dc:rights or its copyright page")
+	fs.BoolVar(&opts.TitlePage, "title-page", false, "start the book with a title page showing its title, subtitle, authors, publisher and date")
+	fs.BoolVar(&opts.JSONLD, "json-ld", false, "describe the book as a schema.org Book in a JSON-LD <script> in the head")
+	fs.BoolVar(&opts.NoTimestamp, "no-timestamp", false, "leave the conversion time out of the output, so that converting a book again gives the same file")
+	fs.StringVar(&opts.BaseURL, "base-url", "", "absolute `url` the HTML output will be published at, for og:url and an absolute og:image")
+	fs.StringVar(&opts.AssetsDir, "assets-dir", "", "write images and other resources to `dir` and link them instead of embedding them as data URIs")
+	fs.IntVar(&opts.EmbedMaxBytes, "embed-max-bytes", 0, "embed only resources of at most `N` bytes as data URIs and write larger ones to the assets directory")
+	fs.BoolVar(&opts.FetchRemote, "fetch-remote", false, "download images the book links from the web and embed them like its own")
+	fs.BoolVar(&opts.NoImages, "no-images", false, "replace images with a placeholder showing their alt text")
+	fs.BoolVar(&opts.NoCover, "no-cover", false, "do not add a cover page showing the cover image before the first chapter")
+	fs.BoolVar(&opts.NoSVG, "no-svg", false, "strip inline SVG drawings")
+	fs.StringVar(&opts.SVGPages, "svg-pages", "", "show the SVG documents of the spine `as` inline drawings (inline, the default) or as images (image)")
+	fs.IntVar(&opts.MaxImageSize, "max-image-size", 0, "scale JPEG and PNG images down so that neither side exceeds `pixels`")
+	fs.StringVar(&opts.ImageFormat, "image-format", "", "convert PNG images to `format` (webp), losslessly, where that makes them smaller")
+	fs.IntVar(&opts.ImageQuality, "image-quality", 0, "re-encode JPEG images at `quality` 1-100, and PNG images with the best compression, where that makes them smaller")
+	fs.BoolVar(&opts.EInk, "eink", false, "convert JPEG and PNG images to grayscale with boosted contrast for e-ink screens")
+	fs.BoolVar(&opts.Semanticize, "semanticize", false, "turn spans and divs with classes such as italic, bold or blockquote into <em>, <strong> and <blockquote>")
+	fs.StringVar(&opts.SemanticMapPath, "semantic-map", "", "`file` of \"class element\" lines extending the --semanticize mapping")
+	fs.BoolVar(&opts.Figures, "figures", false, "wrap images and the captions next to them, recognised by their class, in <figure> and <figcaption>")
+	fs.BoolVar(&opts.FiguresIndex, "figures-index", false, "append a list of illustrations linking to every captioned figure")
+	fs.StringVar(&opts.Chapters, "chapters", "", "convert only the spine items at the given `positions`, counting from 1, e.g. 3-7,12 or 5- for the fifth onwards")
+	fs.StringVar(&opts.Include, "include", "", "convert only the spine items whose table of contents title or manifest href matches `regexp`")
+	fs.StringVar(&opts.Exclude, "exclude", "", "leave out the spine items whose table of contents title or manifest href matches `regexp`, e.g. 'ads|copyright'")
+	fs.BoolVar(&opts.BodyOnly, "body-only", false, "leave out the chapters and sections marked with epub:type as front matter, back matter, copyright page or acknowledgments")
+	fs.StringVar(&opts.Sample, "sample", "", "convert only the first `share` of the book's text, e.g. 10%, followed by --sample-notice")
+	fs.IntVar(&opts.SampleChapters, "sample-chapters", 0, "convert only the first `n` chapters, followed by --sample-notice")
+	fs.StringVar(&opts.SampleNotice, "sample-notice", "End of sample", "`text` of the notice ending a --sample or --sample-chapters preview")
+	fs.StringVar(&opts.StartAt, "start-at", "", "leave out the chapters before the landmark of the given epub:`type`, e.g. bodymatter to skip the front matter")
+	fs.BoolVar(&opts.IncludeNonLinear, "include-nonlinear", false, "append the spine items marked linear=\"no\", such as answer keys, in an appendix instead of leaving them out")
+	fs.BoolVar(&opts.PageNumbers, "page-numbers", false, "show the print page numbers of the book's page list as [p. N] markers")
+	fs.BoolVar(&opts.ReadAlong, "read-along", false, "play the audio of the book's media overlays with players that highlight the text as it is read")
+	fs.BoolVar(&opts.KeepScripts, "keep-scripts", false, "keep the scripts of interactive books, inlining those of the book and dropping those from the web; only for books you trust")
+	fs.BoolVar(&opts.DeriveAlt, "derive-alt", false, "give images without alt text one taken from their title, figure caption or file name")
+	fs.StringVar(&opts.AltReport, "alt-report", "", "write a list of the images without alt text to `file`")
+	fs.IntVar(&opts.Jobs, "jobs", runtime.NumCPU(), "load, recompress and encode images on `n` goroutines")
+	fs.BoolVar(&opts.Strict, "strict", false, "stop with an error on books whose archive breaks the EPUB container format, such as a missing or compressed mimetype entry, instead of warning")
+	fs.StringVar(&opts.Pprof, "pprof", "", "serve net/http/pprof profiles of the conversion at `addr`")
+	fs.StringVar(&opts.OutputEncoding, "output-encoding", "", "character `encoding` of the HTML output, e.g. ISO-8859-1 or windows-1251 (default UTF-8)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [options] <input.epub> [output]\n       %s extract [options] <input.epub>\n\nOptions:\n", os.Args[0], os.Args[0])
+		printVisibleDefaults(fs)
+	}
+
+	positional, err := parseInterspersed(fs, args)
 	if err != nil {
-		log.Fatalf("Failed to write HTML footer: %v", err)
+		return nil, err
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		fs.Usage()
+		return nil, fmt.Errorf("expected an input EPUB and an optional output path")
+	}
+
+	switch opts.Format {
+	case "html", "gmi", "docbook", "rst":
+	default:
+		return nil, fmt.Errorf("unknown output format %q", opts.Format)
+	}
+	if opts.NavTemplate != "" && opts.Format != "gmi" && opts.Format != "rst" {
+		return nil, fmt.Errorf("--nav-template only applies to the gmi and rst formats")
+	}
+	if opts.Minify && opts.Pretty {
+		return nil, fmt.Errorf("--minify and --pretty cannot be used together")
+	}
+	if opts.ScopeCSS {
+		opts.InlineCSS = true
+	}
+	if opts.SubsetFonts {
+		opts.EmbedFonts = true
+	}
+	if opts.Minify {
+		opts.MinifyCSS = true
+	}
+	if opts.TOCDepth < 0 {
+		return nil, fmt.Errorf("--toc-depth must not be negative")
+	}
+	if opts.TOCDepth > 0 {
+		opts.TOC = true
+	}
+	if opts.Chapters != "" {
+		if opts.ChapterRanges, err = parseSpineRanges(opts.Chapters); err != nil {
+			return nil, fmt.Errorf("--chapters: %w", err)
+		}
+	}
+	if opts.Include != "" {
+		if opts.IncludeRe, err = regexp.Compile(opts.Include); err != nil {
+			return nil, fmt.Errorf("--include: %w", err)
+		}
+	}
+	if opts.Exclude != "" {
+		if opts.ExcludeRe, err = regexp.Compile(opts.Exclude); err != nil {
+			return nil, fmt.Errorf("--exclude: %w", err)
+		}
+	}
+	if opts.BaseURL != "" {
+		if u, err := url.Parse(opts.BaseURL); err != nil || !u.IsAbs() {
+			return nil, fmt.Errorf("--base-url must be an absolute URL")
+		}
+	}
+	if opts.Rootfile < 0 {
+		return nil, fmt.Errorf("--rootfile must not be negative")
+	}
+	if opts.Rootfile > 0 && opts.RootfilePath != "" {
+		return nil, fmt.Errorf("--rootfile and --rootfile-path cannot be used together")
+	}
+	if len(opts.Rendition) > 0 && (opts.Rootfile > 0 || opts.RootfilePath != "") {
+		return nil, fmt.Errorf("--rendition cannot be used with --rootfile or --rootfile-path")
+	}
+	for _, s := range opts.Rendition {
+		if _, _, err := parseRenditionSelector(s); err != nil {
+			return nil, err
+		}
+	}
+	if opts.SampleChapters < 0 {
+		return nil, fmt.Errorf("--sample-chapters must not be negative")
+	}
+	if opts.Jobs < 1 {
+		return nil, fmt.Errorf("--jobs must be at least 1")
+	}
+	if opts.Sample != "" {
+		if opts.SampleChapters > 0 {
+			return nil, fmt.Errorf("--sample and --sample-chapters cannot be used together")
+		}
+		if opts.SamplePercent, err = parseSamplePercent(opts.Sample); err != nil {
+			return nil, err
+		}
+	}
+	if opts.StartAt != "" && landmarkTitle(opts.StartAt) == "" {
+		return nil, fmt.Errorf("unknown landmark %q for --start-at", opts.StartAt)
+	}
+	switch opts.Layout {
+	case "":
+	case "sidebar":
+		opts.TOC = true
+	default:
+		return nil, fmt.Errorf("unknown layout %q", opts.Layout)
+	}
+	if _, ok := cssFilters[opts.CSSFilter]; !ok && opts.CSSFilter != "" {
+		return nil, fmt.Errorf("unknown CSS filter %q", opts.CSSFilter)
+	}
+	switch opts.SVGPages {
+	case "", "inline", "image":
+	default:
+		return nil, fmt.Errorf("unknown --svg-pages %q: must be inline or image", opts.SVGPages)
+	}
+	switch opts.Math {
+	case "", "mathjax", "katex", "image":
+	default:
+		return nil, fmt.Errorf("unknown --math renderer %q: must be mathjax, katex or image", opts.Math)
+	}
+	switch opts.Theme {
+	case "", "light", "dark", "auto":
+	default:
+		return nil, fmt.Errorf("unknown theme %q", opts.Theme)
+	}
+	if opts.MaxImageSize < 0 {
+		return nil, fmt.Errorf("--max-image-size must not be negative")
+	}
+	if opts.EmbedMaxBytes < 0 {
+		return nil, fmt.Errorf("--embed-max-bytes must not be negative")
+	}
+	if opts.ImageQuality < 0 || opts.ImageQuality > 100 {
+		return nil, fmt.Errorf("--image-quality must be between 1 and 100")
+	}
+	switch opts.ImageFormat {
+	case "", "webp":
+	case "avif":
+		return nil, fmt.Errorf("--image-format avif is not supported: no AVIF encoder is available")
+	default:
+		return nil, fmt.Errorf("unknown image format %q", opts.ImageFormat)
+	}
+	opts.SemanticMap = defaultSemanticMap
+	if opts.SemanticMapPath != "" {
+		opts.Semanticize = true
+		if opts.SemanticMap, err = loadSemanticMap(opts.SemanticMapPath); err != nil {
+			return nil, err
+		}
+	}
+	if opts.OutputEncoding != "" {
+		if _, _, err := lookupOutputEncoding(opts.OutputEncoding); err != nil {
+			return nil, err
+		}
 	}
 
-	log.Printf("Successfully converted EPUB to raw HTML: %s", outputPath)
+	opts.InputPath = positional[0]
+	if len(positional) == 2 {
+		opts.OutputPath = positional[1]
+	} else {
+		opts.OutputPath = defaultOutputPath(opts.Format)
+	}
+	return opts, nil
 }
 
-func processEpubContent(pkg *Package, r *zip.ReadCloser) (strings.Builder, error) {
+// stringList is a flag.Value collecting the values of a repeated flag.
+type stringList []string
 
-	manifestIDMap := make(map[string]string)
-	for _, item := range pkg.Manifest.Items {
-		fullHref := joinEpubPath(pkg.OpfDir, item.Href)
-		manifestIDMap[item.ID] = fullHref
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments and returns the positional arguments in order.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		// Parse consumes a "--" terminator; everything after it is positional.
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// defaultOutputPath returns the output location used when none is given.
+// Multi-file formats write into a directory named after the default file.
+func defaultOutputPath(format string) string {
+	base := strings.TrimSuffix(defaultOutputFile, path.Ext(defaultOutputFile))
+	switch format {
+	case "html":
+		return defaultOutputFile
+	case "docbook":
+		return base + ".xml"
+	}
+	return base
+}
+
+// bookTitle returns the full title of the book, with its subtitle, for the
+// document title.
+func bookTitle(pkg *Package) string {
+	if title := pkg.Metadata.FullTitle(); title != "" {
+		return title
+	}
+	return "Converted EPUB"
+}
+
+// bookLanguage returns the language of the book for the lang attribute of
+// the output: its first dc:language, or else the language of the package
+// document.
+func bookLanguage(pkg *Package) string {
+	for _, lang := range pkg.Metadata.Languages {
+		if lang != "" {
+			return lang
+		}
 	}
+	return strings.TrimSpace(pkg.Lang)
+}
 
+// bookDirection returns the text direction of the book for the dir
+// attribute of the output, ltr or rtl, from the dir attribute of the
+// package or else the page progression of the spine. It returns "" if the
+// book does not say.
+func bookDirection(pkg *Package) string {
+	for _, dir := range []string{pkg.Dir, pkg.Spine.PageProgressionDir} {
+		switch dir = strings.ToLower(strings.TrimSpace(dir)); dir {
+		case "ltr", "rtl":
+			return dir
+		}
+	}
+	return ""
+}
+
+// Chapter is a content document from the spine, parsed and ready to render.
+type Chapter struct {
+	Index       int    // position in reading order, starting at 0
+	Path        string // full path of the document inside the archive
+	Doc         *html.Node
+	MediaType   string
+	FixedLayout bool // pre-paginated page of a fixed-layout book
+	NonLinear   bool // marked linear="no", such as answer keys and pop-up notes
+	Scripted    bool // its manifest item has the scripted property
+	SVG         bool // its manifest item has the svg property, or is an SVG document
+}
+
+func buildManifestHrefMap(pkg *Package) map[string]Item {
 	manifestHrefMap := make(map[string]Item)
 	for _, item := range pkg.Manifest.Items {
 		fullHref := joinEpubPath(pkg.OpfDir, item.Href)
 		manifestHrefMap[fullHref] = item
 	}
+	return manifestHrefMap
+}
 
-	var combinedHTML strings.Builder
+// loadChapters reads and parses every spine item in reading order.
+// Items that cannot be found, read or parsed are skipped with a warning.
+func loadChapters(pkg *Package, r *epubArchive) []Chapter {
+	manifestIDMap := make(map[string]Item)
+	for _, item := range pkg.Manifest.Items {
+		manifestIDMap[item.ID] = item
+	}
 
+	var chapters []Chapter
 	for _, itemref := range pkg.Spine.Itemrefs {
-		contentFilePath, ok := manifestIDMap[itemref.Idref]
+		item, ok := manifestIDMap[itemref.Idref]
 		if !ok {
 			log.Printf("Warning: Could not find item with id %s in manifest", itemref.Idref)
 			continue
 		}
+		content, ok := spineContent(item, manifestIDMap)
+		if ok && content.ID != item.ID {
+			log.Printf("Using fallback %s for spine item %s of type %s", content.Href, item.Href, item.MediaType)
+		}
+		item = content
+		contentFilePath := joinEpubPath(pkg.OpfDir, item.Href)
 
 		log.Printf("Processing content file: %s", contentFilePath)
-		fileData, err := readZipFile(r, contentFilePath)
-		if err != nil {
-			log.Printf("Warning: Could not read content file %s: %v", contentFilePath, err)
+		var doc *html.Node
+		var err error
+		switch {
+		case strings.HasPrefix(item.MediaType, "audio/"):
+			doc, err = audioChapter(contentFilePath)
+		case !ok && strings.HasPrefix(item.MediaType, "image/"):
+			doc, err = imageChapter(contentFilePath)
+		case !ok && item.MediaType != "" && !strings.Contains(item.MediaType, "html") && !strings.Contains(item.MediaType, "xml"):
+			log.Printf("Warning: Skipping spine item %s: its type %s is not supported and it has no fallback", contentFilePath, item.MediaType)
 			continue
+		default:
+			var fileData []byte
+			fileData, err = readZipFile(r, contentFilePath)
+			if err != nil {
+				log.Printf("Warning: Could not read content file %s: %v", contentFilePath, err)
+				continue
+			}
+			doc, err = parseContent(fileData, contentFilePath)
+			if err == nil {
+				applyBase(doc, contentFilePath)
+			}
 		}
-
-		doc, err := html.Parse(bytes.NewReader(fileData))
 		if err != nil {
 			log.Printf("Warning: Could not parse HTML content from %s: %v", contentFilePath, err)
 			continue
 		}
+		resolveSwitches(doc)
+		normalizeMathML(doc)
 
-		extractRawHTML(doc, &combinedHTML, r, contentFilePath, manifestHrefMap)
-		combinedHTML.WriteString("\n<hr />\n")
+		chapters = append(chapters, Chapter{
+			Index:       len(chapters),
+			Path:        contentFilePath,
+			Doc:         doc,
+			MediaType:   item.MediaType,
+			FixedLayout: itemrefLayout(pkg, itemref) == "pre-paginated",
+			NonLinear:   itemref.Linear == "no",
+			Scripted:    item.hasProperty("scripted"),
+			SVG:         item.hasProperty("svg") || item.MediaType == svgMediaType,
+		})
 	}
-	return combinedHTML, nil
+	return chapters
 }
 
-func findOpfPath(r *zip.ReadCloser) (string, error) {
-	for _, f := range r.File {
-		if f.Name == "META-INF/container.xml" {
-			rc, err := f.Open()
-			if err != nil {
-				return "", fmt.Errorf("failed to open container.xml: %w", err)
-			}
-			defer rc.Close()
-
-			data, err := io.ReadAll(rc)
-			if err != nil {
-				return "", fmt.Errorf("failed to read container.xml: %w", err)
-			}
-
-			var container Container
-			if err := xml.Unmarshal(data, &container); err != nil {
-				return "", fmt.Errorf("failed to unmarshal container.xml: %w", err)
-			}
-
-			for _, rf := range container.Rootfiles {
-				if rf.MediaType == "application/oebps-package+xml" {
-					return rf.FullPath, nil
-				}
-			}
+// findOpfPath returns the archive path of the package document to convert:
+// the one at --rootfile-path, the one at position n in container.xml, or
+// else the one selectRootfile picks there by the --rendition selectors.
+// Books with several packages have them listed in the log. Archives
+// without container.xml are searched for an OPF file in the usual places.
+func findOpfPath(r *epubArchive, n int, opfPath string, selectors []string) (string, error) {
+	if opfPath != "" {
+		f, err := findZipFile(r, opfPath)
+		if err != nil {
+			return "", err
+		}
+		return f.Name, nil
+	}
+	rootfiles, err := readRootfiles(r)
+	if err != nil {
+		return "", err
+	}
+	if len(rootfiles) > 1 {
+		log.Printf("The book has %d packages; choose one with --rootfile or --rendition:", len(rootfiles))
+		for i, rf := range rootfiles {
+			log.Printf("  %d: %s", i+1, rootfileDescription(rf))
+		}
+	}
+	if n > len(rootfiles) {
+		return "", fmt.Errorf("--rootfile %d is out of range: container.xml lists %d packages", n, len(rootfiles))
+	}
+	if n > 0 && len(rootfiles) > 0 {
+		return rootfiles[n-1].FullPath, nil
+	}
+	if len(rootfiles) > 0 {
+		rf, err := selectRootfile(rootfiles, selectors)
+		if err != nil {
+			return "", err
 		}
+		return rf.FullPath, nil
+	}
+	if n > 1 {
+		return "", fmt.Errorf("--rootfile %d is out of range: the book has no container.xml listing packages", n)
+	}
+	if len(selectors) > 0 {
+		return "", fmt.Errorf("--rendition needs a container.xml listing packages")
 	}
 
 	for _, f := range r.File {
@@ -205,15 +836,57 @@ func findOpfPath(r *zip.ReadCloser) (string, error) {
 	return "", fmt.Errorf("OPF file path not found in container.xml and no fallback found")
 }
 
-func parseOpf(r *zip.ReadCloser, opfPath string) (*Package, error) {
-	var opfFile *zip.File
-	for _, f := range r.File {
-		if f.Name == opfPath {
-			opfFile = f
-			break
+// readRootfiles returns the package documents listed in container.xml, or
+// nil if the archive has none.
+func readRootfiles(r *epubArchive) ([]Rootfile, error) {
+	f, ok := r.files["META-INF/container.xml"]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open container.xml: %w", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container.xml: %w", err)
+	}
+
+	var container Container
+	if err := xml.Unmarshal(data, &container); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal container.xml: %w", err)
+	}
+
+	var rootfiles []Rootfile
+	for _, rf := range container.Rootfiles {
+		if rf.MediaType == opfMediaType {
+			rootfiles = append(rootfiles, rf)
+		}
+	}
+	return rootfiles, nil
+}
+
+// rootfileDescription describes a package listed in container.xml by its
+// path and rendition label, layout, language, media query and access mode,
+// e.g. "OEBPS/fixed.opf (Fixed layout, pre-paginated)".
+func rootfileDescription(rf Rootfile) string {
+	var details []string
+	for _, d := range []string{rf.Label, rf.Layout, rf.Language, rf.Media, rf.AccessMode} {
+		if d = strings.TrimSpace(d); d != "" {
+			details = append(details, d)
 		}
 	}
-	if opfFile == nil {
+	if len(details) == 0 {
+		return rf.FullPath
+	}
+	return rf.FullPath + " (" + strings.Join(details, ", ") + ")"
+}
+
+func parseOpf(r *epubArchive, opfPath string) (*Package, error) {
+	opfFile, ok := r.files[opfPath]
+	if !ok {
 		return nil, fmt.Errorf("OPF file %s not found in archive", opfPath)
 	}
 
@@ -228,30 +901,41 @@ func parseOpf(r *zip.ReadCloser, opfPath string) (*Package, error) {
 		return nil, fmt.Errorf("failed to read OPF file %s: %w", opfPath, err)
 	}
 
-	var pkg Package
-	if err := xml.Unmarshal(data, &pkg); err != nil {
+	pkg, err := unmarshalOPF(data, opfPath)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal OPF file %s: %w", opfPath, err)
 	}
 	pkg.OpfDir = filepath.Dir(opfPath)
+	pkg.resolvePrefixes()
+	pkg.Metadata.resolve()
+	pkg.CoverImage = findCoverImage(pkg, r)
+
+	return pkg, nil
+}
 
-	return &pkg, nil
+func readZipFile(r *epubArchive, filePath string) ([]byte, error) {
+	f, err := findZipFile(r, filePath)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
 }
 
-func readZipFile(r *zip.ReadCloser, filePath string) ([]byte, error) {
+// findZipFile returns the archive entry at filePath, refusing paths that
+// leave the archive.
+func findZipFile(r *epubArchive, filePath string) (*zip.File, error) {
 	cleanPath := normalizeEpubPath(filePath)
 	if strings.HasPrefix(cleanPath, "..") {
 		return nil, fmt.Errorf("invalid path trying to access parent directory: %s", filePath)
 	}
 
-	for _, f := range r.File {
-		if f.Name == cleanPath {
-			rc, err := f.Open()
-			if err != nil {
-				return nil, fmt.Errorf("failed to open %s: %w", cleanPath, err)
-			}
-			defer rc.Close()
-			return io.ReadAll(rc)
-		}
+	if f, ok := r.files[cleanPath]; ok {
+		return f, nil
 	}
 	return nil, fmt.Errorf("file %s not found in archive", cleanPath)
 }
@@ -293,7 +977,7 @@ func resolveEpubPath(base, rel string) string {
 	// Normalize both paths to use forward slashes
 	base = normalizeEpubPath(base)
 	rel = normalizeEpubPath(rel)
-	
+
 	// Join and clean the path
 	result := path.Join(base, rel)
 	return normalizeEpubPath(result)
@@ -313,91 +997,525 @@ func normalizeEpubPath(p string) string {
 	return p
 }
 
-func extractRawHTML(n *html.Node, w io.StringWriter, r *zip.ReadCloser, contentFilePath string, manifestHrefMap map[string]Item) {
-	var findBodyAndExtract func(*html.Node)
-	foundBody := false
+// renderer holds the state shared by all chapters while producing HTML.
+type renderer struct {
+	r               *epubArchive
+	manifestHrefMap map[string]Item
+	opts            *options
+	styles          stylesheetCollector
+	parsedSheets    map[int][]cssRule
+	fontChars       map[rune]bool // characters fonts are subset to
+	obfuscated      map[string]fontObfuscation
+	rendition       Rendition
+	opfDir          string
+	exported        map[string]string // --assets-dir URLs by archive path
+	exportedHashes  map[string]string // --assets-dir URLs by content hash
+	remoteURIs      map[string]string // data URIs of the --fetch-remote images by URL
+	imageHashes     map[string]string // content hashes of the chapter images by archive path
+	imageRefs       map[string]int    // number of <img> references by content hash
+	imageOrder      []string          // archive paths of the chapter images in order of appearance
+	images          *imagePool        // images loaded ahead on --jobs goroutines, if any
+	symbols         map[string]imageSymbol
+	symbolOrder     []string               // <symbol> elements of repeated images
+	imageSizes      map[string]image.Point // dimensions of the embedded images by archive path
+	srcsets         map[string]string      // srcset attributes of the linked images by archive path
+	missingAlt      []missingAlt
+	figures         []TOCEntry               // captioned figures for --figures-index
+	pages           map[string][]pageTarget  // print pages for --page-numbers by archive path
+	anchors         *anchors                 // IDs of the chapters and their elements in the output
+	streamed        []*zip.File              // large images to stream into the output, see imageURL
+	formulas        int                      // MathML formulas in the chapters
+	mathNoImage     int                      // formulas --math image found no altimg for
+	overlays        map[string][]overlayClip // media overlay clips for --read-along by archive path
+	players         int                      // audio players added for --read-along
+	svgPages        int                      // SVG documents of the spine written inline
+	svgDrawings     int                      // inline <svg> elements whose styles are scoped
+	fixedLayout     bool                     // the chapter being cleaned is a fixed-layout page, which keeps its styles
+	scripts         map[string]bool          // script files inlined by --keep-scripts by archive path
+}
+
+func newRenderer(pkg *Package, r *epubArchive, opts *options) *renderer {
+	return &renderer{
+		r:               r,
+		manifestHrefMap: buildManifestHrefMap(pkg),
+		opts:            opts,
+		obfuscated:      readObfuscatedFonts(r, pkg),
+		rendition:       packageRendition(pkg),
+		opfDir:          pkg.OpfDir,
+	}
+}
 
-	findBodyAndExtract = func(node *html.Node) {
-		if node.Type == html.ElementNode && node.Data == "body" {
-			foundBody = true
-			for c := node.FirstChild; c != nil; c = c.NextSibling {
-				renderNodeRaw(c, w, r, contentFilePath, manifestHrefMap)
-			}
-			return
+// renderChapter writes the cleaned body of a chapter as HTML.
+func (rd *renderer) renderChapter(ch Chapter, w io.StringWriter) {
+	if ch.MediaType == svgMediaType && (rd.opts.NoSVG || rd.opts.SVGPages == "image") {
+		// --no-svg would strip an SVG page whole, so it is shown as an
+		// image instead.
+		if doc := svgPageImage(ch.Doc, ch.Path); doc != nil {
+			ch.Doc, ch.MediaType = doc, ""
 		}
+	}
+	// Fixed-layout pages are positioned by their stylesheets, so these
+	// are applied to them whatever the options.
+	rd.fixedLayout = ch.FixedLayout
+	var sheets []int
+	if rd.opts.InlineCSS || rd.opts.ComputedStyles || rd.opts.EmbedFonts || ch.FixedLayout {
+		sheets = rd.collectStylesheets(ch.Doc, ch.Path)
+	}
 
-		if !foundBody {
-			for c := node.FirstChild; c != nil; c = c.NextSibling {
-				findBodyAndExtract(c)
-				if foundBody {
-					break
-				}
-			}
+	body := findElement(ch.Doc, "body")
+	if body == nil {
+		return
+	}
+	if rd.keepStyles() {
+		rd.embedStyleAttrURLs(body, ch.Path)
+	}
+	if rd.opts.ComputedStyles || ch.FixedLayout && !rd.opts.InlineCSS {
+		rd.applyComputedStyles(ch.Doc, sheets)
+	}
+	if rd.opts.Semanticize {
+		semanticize(body, rd.opts.SemanticMap)
+	}
+	if rd.opts.Figures {
+		synthesizeFigures(body)
+	}
+	if rd.opts.DeriveAlt || rd.opts.AltReport != "" {
+		rd.checkAltText(body, ch.Path)
+	}
+	if rd.opts.FiguresIndex {
+		rd.indexFigures(body, ch)
+	}
+	if rd.opts.KeepScripts {
+		headScripts(ch.Doc, body)
+	}
+	var audios []string
+	if rd.opts.ReadAlong {
+		audios = rd.markClips(body, ch)
+	}
+	rd.cleanNode(body, ch.Path)
+	rd.addPlayers(body, audios)
+	if ch.MediaType == svgMediaType {
+		rd.svgPage(body)
+	}
+	if rd.opts.PageNumbers {
+		rd.markPages(body, ch)
+	}
+	// The body element itself is not written, so a chapter marked on it
+	// gets a section carrying its role.
+	if role := epubTypeRole(body); sectionRoles[role] {
+		wrapChildren(body, "section", html.Attribute{Key: "role", Val: role})
+	}
+	if style := getAttr(body, "style"); style != "" && rd.opts.ComputedStyles && !ch.FixedLayout {
+		// The body element itself is not written, so carry its styles
+		// over to a wrapper for the chapter's content to inherit.
+		wrapChildren(body, "div", html.Attribute{Key: "style", Val: style})
+	}
+	if ch.FixedLayout {
+		wrapChildren(body, "div", fixedLayoutPageAttrs(ch.Doc, body, rd.rendition)...)
+	}
+	if rd.opts.ScopeCSS {
+		wrapChildren(body, "section", html.Attribute{Key: "class", Val: chapterScopeClass(ch, sheets)})
+	}
+
+	rd.writeBody(body, w)
+}
+
+// writeBody writes the children of a cleaned node in the output layout
+// asked for.
+func (rd *renderer) writeBody(body *html.Node, w io.StringWriter) {
+	switch {
+	case rd.opts.Minify:
+		writeMinified(body, w)
+		return
+	case rd.opts.Pretty:
+		writePretty(body, w)
+		return
+	}
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		renderNodeRaw(c, w)
+	}
+}
+
+// wrapChildren moves all children of n into a new element with the given
+// tag and attributes.
+func wrapChildren(n *html.Node, tag string, attrs ...html.Attribute) {
+	wrapper := &html.Node{
+		Type:     html.ElementNode,
+		Data:     tag,
+		DataAtom: atom.Lookup([]byte(tag)),
+		Attr:     attrs,
+	}
+	for n.FirstChild != nil {
+		c := n.FirstChild
+		n.RemoveChild(c)
+		wrapper.AppendChild(c)
+	}
+	n.AppendChild(wrapper)
+}
+
+// cleanNode strips everything below n that does not belong in raw HTML
+// output and embeds images as data URIs.
+func (rd *renderer) cleanNode(n *html.Node, contentFilePath string) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if !rd.cleanChild(c, contentFilePath) {
+			n.RemoveChild(c)
 		}
+		c = next
 	}
+	mergeTextNodes(n)
+}
 
-	findBodyAndExtract(n)
+// mergeTextNodes joins adjacent text children of n, which are left behind
+// when the elements between them are removed.
+func mergeTextNodes(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		for c.Type == html.TextNode && c.NextSibling != nil && c.NextSibling.Type == html.TextNode {
+			next := c.NextSibling
+			c.Data += next.Data
+			n.RemoveChild(next)
+		}
+	}
 }
 
-func renderNodeRaw(n *html.Node, w io.StringWriter, r *zip.ReadCloser, contentFilePath string, manifestHrefMap map[string]Item) {
+// cleanChild prepares a single node and reports whether it should be kept.
+func (rd *renderer) cleanChild(n *html.Node, contentFilePath string) bool {
 	switch n.Type {
 	case html.TextNode:
-		w.WriteString(html.EscapeString(n.Data))
+		return true
 	case html.ElementNode:
-		tag := n.Data
-		switch tag {
+	default:
+		return false
+	}
 
-		case "script", "style", "link", "meta", "head", "title", "svg":
-			return
+	switch n.Data {
+	case "script":
+		return rd.opts.KeepScripts && rd.keepScript(n, contentFilePath)
+	case "style", "link", "meta", "head", "title", "iframe":
+		return false
+	case "svg":
+		if !rd.opts.NoSVG {
+			rd.scopeDrawingStyles(n, contentFilePath)
+			rd.cleanSVG(n, contentFilePath)
+			return true
 		}
+		// A wrapper around a single image, such as a cover, is kept
+		// as a plain <img>.
+		img := svgImage(n)
+		if img == nil {
+			return false
+		}
+		n.Data, n.DataAtom, n.Namespace, n.Attr = img.Data, img.DataAtom, "", img.Attr
+		for n.FirstChild != nil {
+			n.RemoveChild(n.FirstChild)
+		}
+	}
 
-		if tag == "img" {
-			var src string
-			for i, attr := range n.Attr {
-				if attr.Key == "src" {
-					src = attr.Val
-					// Remove the original src attribute to replace it
-					n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
-					break
-				}
+	if n.Data == "math" {
+		rd.formulas++
+		if rd.opts.Math == "image" && !mathImage(n) {
+			rd.mathNoImage++
+		}
+	}
+	if n.Data == "img" && rd.opts.NoImages {
+		imagePlaceholder(n)
+		return true
+	}
+	if n.Data == "img" && !rd.embedImage(n, contentFilePath) {
+		return false
+	}
+	if isMediaElement(n) && !rd.embedMedia(n, contentFilePath) {
+		return false
+	}
+	rd.rewriteLinks(n, contentFilePath)
+	applyRole(n)
+
+	keepClasses := rd.opts.KeepClasses || rd.opts.InlineCSS
+	keepStyles := rd.keepStyles()
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		if (attr.Key == "class" && !keepClasses) || (attr.Key == "style" && !keepStyles) || (isScriptAttr(attr) && !rd.opts.KeepScripts) {
+			continue
+		}
+		if attr.Key == "style" && rd.opts.CSSFilter != "" {
+			attr.Val = serializeDeclarations(filterDeclarations(parseDeclarations(attr.Val), rd.opts.CSSFilter))
+			if attr.Val == "" {
+				continue
 			}
+		}
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+
+	rd.cleanNode(n, contentFilePath)
+	return true
+}
 
-			if src != "" {
-				// Resolve the image path relative to the current content file
-				contentDir := epubDir(contentFilePath)
-				imagePath := resolveEpubPath(contentDir, src)
-
-				imageData, err := readZipFile(r, imagePath)
-				if err != nil {
-					log.Printf("Warning: Could not read image file %s: %v", imagePath, err)
-					return
-				}
-
-				item, ok := manifestHrefMap[imagePath]
-				if !ok {
-					log.Printf("Warning: Could not find manifest item for image %s", imagePath)
-					return
-				}
-				mediaType := item.MediaType
-
-				encodedData := base64.StdEncoding.EncodeToString(imageData)
-				dataURI := fmt.Sprintf("data:%s;base64,%s", mediaType, encodedData)
-
-				// Add the new src attribute with the data URI
-				n.Attr = append(n.Attr, html.Attribute{Key: "src", Val: dataURI})
+// keepStyles reports whether the style attributes of the chapter being
+// cleaned are kept.
+func (rd *renderer) keepStyles() bool {
+	return rd.opts.KeepInlineStyles || rd.opts.InlineCSS || rd.opts.ComputedStyles || rd.fixedLayout
+}
+
+// embedImage replaces the src of an img element with a data URI holding the
+// image. It reports false if the image could not be embedded.
+func (rd *renderer) embedImage(n *html.Node, contentFilePath string) bool {
+	var src string
+	for i, attr := range n.Attr {
+		if attr.Key == "src" {
+			src = attr.Val
+			// Remove the original src attribute to replace it
+			n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+			break
+		}
+	}
+
+	if src == "" {
+		return true
+	}
+	if isExternalHref(src) {
+		// Images on the web are kept as they are, unless asked to
+		// fetch and embed them.
+		remote := src
+		if rd.opts.FetchRemote && isHTTPURL(src) {
+			if uri, err := rd.remoteImageURL(src); err != nil {
+				log.Printf("Warning: Could not fetch image %s: %v", src, err)
+			} else {
+				src = uri
 			}
 		}
+		n.Attr = append(n.Attr, html.Attribute{Key: "src", Val: src})
+		rd.setImageSize(n, remote)
+		return true
+	}
+
+	// Resolve the image path relative to the current content file
+	contentDir := epubDir(contentFilePath)
+	imagePath := resolveEpubPath(contentDir, src)
+
+	// Images shown more than once are embedded a single time and referenced
+	// from an inline <svg>, instead of repeating their data URI.
+	if !rd.opts.NoSVG && rd.isRepeatedImage(imagePath) && rd.useImageSymbol(n, imagePath) {
+		return true
+	}
+
+	src, err := rd.imageURL(imagePath)
+	if err != nil {
+		log.Printf("Warning: Could not embed image %s: %v", imagePath, err)
+		return false
+	}
+
+	// Add the new src attribute with the data URI
+	n.Attr = append(n.Attr, html.Attribute{Key: "src", Val: src})
+	rd.setImageSize(n, imagePath)
+	if !strings.HasPrefix(src, "data:") {
+		if rd.opts.MaxImageSize > 0 {
+			rd.setSrcset(n, imagePath, src)
+		}
+		// Linked images are fetched separately, so let the browser
+		// put off loading them until they are about to scroll into view.
+		setDefaultAttr(n, "loading", "lazy")
+		setDefaultAttr(n, "decoding", "async")
+	}
+	return true
+}
+
+// setDefaultAttr adds an attribute to n unless it already has one with that
+// name.
+func setDefaultAttr(n *html.Node, key, val string) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+// resourceURL returns the URL the output refers to an archive file by: a
+// data: URI, or with --assets-dir or for files above --embed-max-bytes the
+// relative path of a copy written to the assets directory.
+func (rd *renderer) resourceURL(archivePath string) (string, error) {
+	if rd.opts.AssetsDir == "" && rd.opts.EmbedMaxBytes == 0 {
+		return rd.dataURI(archivePath)
+	}
+	if href, ok := rd.exported[archivePath]; ok {
+		return href, nil
+	}
+	data, mediaType, err := rd.readResource(archivePath)
+	if err != nil {
+		return "", err
+	}
+	if rd.embeds(len(data)) {
+		return encodeDataURI(mediaType, data), nil
+	}
+	return rd.exportAsset(assetsDir(rd.opts), archivePath, data, mediaType)
+}
+
+// embeds reports whether a resource of the given size is embedded as a data
+// URI rather than written to the assets directory.
+func (rd *renderer) embeds(size int) bool {
+	if rd.opts.EmbedMaxBytes > 0 {
+		return size <= rd.opts.EmbedMaxBytes
+	}
+	return rd.opts.AssetsDir == ""
+}
+
+// exportAsset writes a resource read with readResource into dir and returns
+// its URL, which later references to the same archive path reuse.
+func (rd *renderer) exportAsset(dir, archivePath string, data []byte, mediaType string) (string, error) {
+	// Identical files stored under several names are written once.
+	hash := contentHash(data)
+	if href, ok := rd.exportedHashes[hash]; ok {
+		rd.exported[archivePath] = href
+		return href, nil
+	}
+	assetPath := archivePath
+	if mediaType != rd.manifestHrefMap[archivePath].MediaType {
+		// Converted images get the extension of their new format.
+		assetPath = strings.TrimSuffix(archivePath, path.Ext(archivePath)) + imageExtensions[mediaType]
+	}
+	href, err := writeAsset(dir, rd.opts.OutputPath, rd.opfDir, assetPath, data)
+	if err != nil {
+		return "", err
+	}
+	if rd.exported == nil {
+		rd.exported = make(map[string]string)
+		rd.exportedHashes = make(map[string]string)
+	}
+	rd.exported[archivePath] = href
+	rd.exportedHashes[hash] = href
+	return href, nil
+}
+
+// imagePlaceholder turns an <img> element into a visible placeholder for
+// --no-images, showing its alt text or else its file name.
+func imagePlaceholder(n *html.Node) {
+	label := strings.TrimSpace(getAttr(n, "alt"))
+	if label == "" {
+		src := getAttr(n, "src")
+		if unescaped, err := url.PathUnescape(src); err == nil {
+			src = unescaped
+		}
+		if label = path.Base(src); label == "." || label == "/" {
+			label = "image"
+		}
+	}
+	n.Data, n.DataAtom = "span", atom.Span
+	n.Attr = []html.Attribute{{Key: "class", Val: "image-placeholder"}}
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: "[Image: " + label + "]"})
+}
+
+// dataURI returns the contents of an archive file as a data: URI with the
+// media type declared for it in the manifest.
+func (rd *renderer) dataURI(archivePath string) (string, error) {
+	if job, ok := rd.pooledImage(archivePath); ok && job.uri != "" {
+		return job.uri, nil
+	}
+	data, mediaType, err := rd.readResource(archivePath)
+	if err != nil {
+		return "", err
+	}
+	return encodeDataURI(mediaType, data), nil
+}
+
+func encodeDataURI(mediaType string, data []byte) string {
+	// Encode straight into the result instead of into an intermediate
+	// string, which would hold a second copy of large images.
+	var b strings.Builder
+	b.Grow(len("data:;base64,") + len(mediaType) + base64.StdEncoding.EncodedLen(len(data)))
+	b.WriteString("data:" + mediaType + ";base64,")
+	enc := base64.NewEncoder(base64.StdEncoding, &b)
+	enc.Write(data)
+	enc.Close()
+	return b.String()
+}
+
+// readResource reads an archive file referenced by the content and returns
+// it with its manifest media type. Obfuscated fonts are restored and, with
+// --subset-fonts, subset.
+func (rd *renderer) readResource(archivePath string) ([]byte, string, error) {
+	if job, ok := rd.pooledImage(archivePath); ok {
+		return job.data, job.mediaType, nil
+	}
+	data, mediaType, err := rd.loadResource(archivePath)
+	if err != nil {
+		return nil, "", err
+	}
+	if strings.HasPrefix(mediaType, "image/") {
+		rd.recordImageSize(archivePath, bytes.NewReader(data))
+	}
+	return data, mediaType, nil
+}
+
+// loadResource is readResource without recording the size of images, so
+// that an imagePool can call it from its goroutines.
+func (rd *renderer) loadResource(archivePath string) ([]byte, string, error) {
+	data, err := readZipFile(rd.r, archivePath)
+	if err != nil {
+		return nil, "", err
+	}
+	item, ok := rd.manifestHrefMap[archivePath]
+	if !ok {
+		return nil, "", fmt.Errorf("no manifest item for %s", archivePath)
+	}
+	if o, ok := rd.obfuscated[archivePath]; ok {
+		data = o.deobfuscate(data)
+	}
+	if isFontMediaType(item.MediaType) && rd.opts.SubsetFonts {
+		data = rd.subsetFontData(archivePath, data)
+	}
+	mediaType := item.MediaType
+	if o, ok := rd.opts.imageOptions(); ok {
+		if processed, processedType, err := processImage(data, mediaType, o); err != nil {
+			log.Printf("Warning: Could not process image %s: %v", archivePath, err)
+		} else {
+			data, mediaType = processed, processedType
+		}
+	}
+	return data, mediaType, nil
+}
+
+// writeAsset writes a resource into dir, usually --assets-dir, keeping its
+// path relative to the OPF directory, and returns its URL relative to the
+// HTML output at outputPath.
+func writeAsset(dir, outputPath, opfDir, archivePath string, data []byte) (string, error) {
+	rel, err := writeResourceFile(dir, opfDir, archivePath, data)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, filepath.FromSlash(rel))
+	href, err := filepath.Rel(filepath.Dir(absPath(outputPath)), absPath(dest))
+	if err != nil {
+		return "", fmt.Errorf("failed to locate %s relative to the output: %w", dest, err)
+	}
+	return (&url.URL{Path: filepath.ToSlash(href)}).String(), nil
+}
+
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// renderNodeRaw writes a cleaned node as HTML.
+func renderNodeRaw(n *html.Node, w io.StringWriter) {
+	switch n.Type {
+	case html.TextNode:
+		if isScriptText(n) {
+			w.WriteString(n.Data)
+			return
+		}
+		w.WriteString(html.EscapeString(n.Data))
+	case html.ElementNode:
+		tag := n.Data
 
 		var openTag strings.Builder
 		openTag.WriteString("<")
 		openTag.WriteString(tag)
 
 		for _, attr := range n.Attr {
-			if attr.Key == "class" {
-				continue
-			}
 			openTag.WriteString(" ")
-			openTag.WriteString(attr.Key)
+			openTag.WriteString(attrName(attr))
 			openTag.WriteString(`="`)
 			openTag.WriteString(html.EscapeString(attr.Val))
 			openTag.WriteString(`"`)
@@ -406,15 +1524,170 @@ func renderNodeRaw(n *html.Node, w io.StringWriter, r *zip.ReadCloser, contentFi
 		w.WriteString(openTag.String())
 
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			renderNodeRaw(c, w, r, contentFilePath, manifestHrefMap)
+			renderNodeRaw(c, w)
 		}
-		if n.FirstChild != nil || tag != "img" { // Self-closing for img if no children
+		if !isVoidElement(tag) {
 			w.WriteString("</" + tag + ">")
 		}
+	}
+}
 
-	case html.CommentNode:
-		return
-	case html.DoctypeNode:
-		return
+// isVoidElement reports whether tag is an HTML element that never has
+// content and must not get an end tag.
+func isVoidElement(tag string) bool {
+	switch tag {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input", "link",
+		"meta", "source", "track", "wbr":
+		return true
+	}
+	return false
+}
+
+// findElement returns the first element with the given tag name in document
+// order, or nil if there is none.
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// getAttr returns the value of the named attribute, or "" if it is absent.
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// textContent returns the text below n with runs of whitespace collapsed
+// to single spaces.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			b.WriteString(node.Data)
+			b.WriteString(" ")
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// rawText returns the text below n without collapsing whitespace.
+func rawText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			b.WriteString(node.Data)
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// isBlockElement reports whether tag is a block-level element: it starts a
+// new block of text when flattening HTML into line-oriented formats, and
+// whitespace around it is not significant.
+func isBlockElement(tag string) bool {
+	switch tag {
+	case "address", "article", "aside", "blockquote", "body", "caption",
+		"colgroup", "dd", "details", "dialog", "div", "dl", "dt", "fieldset",
+		"figcaption", "figure", "footer", "form", "h1", "h2", "h3", "h4", "h5",
+		"h6", "header", "hgroup", "hr", "li", "main", "menu", "nav", "ol", "p",
+		"pre", "section", "summary", "table", "tbody", "td", "tfoot", "th",
+		"thead", "tr", "ul":
+		return true
+	}
+	return false
+}
+
+// hasBlockDescendant reports whether any element below n starts a block.
+func hasBlockDescendant(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (isBlockElement(c.Data) || hasBlockDescendant(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+// chapterHeading returns the highest-ranking heading of the chapter: the
+// first h1, or the first h2 if there is no h1, and so on.
+func chapterHeading(ch Chapter) *html.Node {
+	for _, tag := range []string{"h1", "h2", "h3", "h4", "h5", "h6"} {
+		if heading := findElement(ch.Doc, tag); heading != nil {
+			return heading
+		}
+	}
+	return nil
+}
+
+// chapterTitle returns the text of the chapter heading, falling back to a
+// numbered placeholder.
+func chapterTitle(ch Chapter) string {
+	if heading := chapterHeading(ch); heading != nil {
+		if title := textContent(heading); title != "" {
+			return title
+		}
+	}
+	return fmt.Sprintf("Chapter %d", ch.Index+1)
+}
+
+// isExternalHref reports whether href points outside the EPUB archive,
+// i.e. carries a URL scheme such as http: or mailto:.
+func isExternalHref(href string) bool {
+	u, err := url.Parse(href)
+	return err == nil && u.Scheme != ""
+}
+
+// exportResource copies an archive entry into destDir, keeping its path
+// relative to the OPF directory, and returns that relative path using
+// forward slashes.
+func exportResource(r *epubArchive, pkg *Package, archivePath, destDir string) (string, error) {
+	data, err := readZipFile(r, archivePath)
+	if err != nil {
+		return "", err
+	}
+	return writeResourceFile(destDir, pkg.OpfDir, archivePath, data)
+}
+
+// errInvalidResourcePath is returned by writeResourceFile for paths it
+// refuses to write.
+var errInvalidResourcePath = errors.New("invalid resource path")
+
+// writeResourceFile writes the data of an archive entry into destDir,
+// keeping its path relative to the OPF directory, and returns that relative
+// path using forward slashes. Paths outside the OPF directory are refused.
+func writeResourceFile(destDir, opfDir, archivePath string, data []byte) (string, error) {
+	rel := normalizeEpubPath(archivePath)
+	if dir := normalizeEpubPath(opfDir); dir != "" {
+		rel = strings.TrimPrefix(rel, dir+"/")
+	}
+	if rel == "" || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%w: %s", errInvalidResourcePath, archivePath)
+	}
+	dest := filepath.Join(destDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory for %s: %w", rel, err)
+	}
+	if err := os.WriteFile(dest, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", dest, err)
 	}
+	return rel, nil
 }
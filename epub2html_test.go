@@ -1,7 +1,14 @@
 package main
 
 import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"golang.org/x/net/html"
 )
 
 func TestNormalizeEpubPath(t *testing.T) {
@@ -85,3 +92,241 @@ func TestResolveEpubPath(t *testing.T) {
 		}
 	}
 }
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		input  string
+		output string
+		format string
+	}{
+		{[]string{"book.epub"}, "book.epub", "output.html", "html"},
+		{[]string{"book.epub", "out.html"}, "book.epub", "out.html", "html"},
+		{[]string{"--format", "gmi", "book.epub"}, "book.epub", "output", "gmi"},
+		{[]string{"book.epub", "capsule", "--format", "gmi"}, "book.epub", "capsule", "gmi"},
+		{[]string{"--", "-book.epub"}, "-book.epub", "output.html", "html"},
+	}
+
+	for _, tt := range tests {
+		opts, err := parseArgs(tt.args)
+		if err != nil {
+			t.Errorf("parseArgs(%v) returned error: %v", tt.args, err)
+			continue
+		}
+		if opts.InputPath != tt.input || opts.OutputPath != tt.output || opts.Format != tt.format {
+			t.Errorf("parseArgs(%v) = {%q %q %q}, expected {%q %q %q}", tt.args,
+				opts.InputPath, opts.OutputPath, opts.Format, tt.input, tt.output, tt.format)
+		}
+	}
+}
+
+func TestBookLanguageAndDirection(t *testing.T) {
+	tests := []struct {
+		pkg       Package
+		lang, dir string
+	}{
+		{Package{}, "", ""},
+		{Package{Lang: "fr"}, "fr", ""},
+		{Package{Lang: "en", Metadata: Metadata{Languages: []string{"ar"}}, Dir: "RTL"}, "ar", "rtl"},
+		{Package{Metadata: Metadata{Languages: []string{"ja"}}, Spine: Spine{PageProgressionDir: "rtl"}}, "ja", "rtl"},
+		{Package{Dir: "auto", Spine: Spine{PageProgressionDir: "default"}}, "", ""},
+	}
+	for _, tt := range tests {
+		if lang, dir := bookLanguage(&tt.pkg), bookDirection(&tt.pkg); lang != tt.lang || dir != tt.dir {
+			t.Errorf("bookLanguage, bookDirection(%+v) = %q, %q, expected %q, %q", tt.pkg, lang, dir, tt.lang, tt.dir)
+		}
+	}
+}
+
+// openTestArchive writes files into a zip archive and opens it for reading.
+func openTestArchive(t testing.TB, files map[string][]byte) *epubArchive {
+	t.Helper()
+	zipPath := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return newEpubArchive(r)
+}
+
+func TestFindOpfPath(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"META-INF/container.xml": []byte(`<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:rendition="http://www.idpf.org/2013/rendition">
+<rootfiles>
+<rootfile full-path="OEBPS/full.opf" media-type="application/oebps-package+xml"/>
+<rootfile full-path="OEBPS/fixed.opf" media-type="application/oebps-package+xml" rendition:layout="pre-paginated"/>
+</rootfiles>
+</container>`),
+		"OEBPS/full.opf":  nil,
+		"OEBPS/fixed.opf": nil,
+		"OEBPS/other.opf": nil,
+	})
+	tests := []struct {
+		n         int
+		path      string
+		selectors []string
+		expected  string
+	}{
+		{0, "", nil, "OEBPS/full.opf"},
+		{1, "", nil, "OEBPS/full.opf"},
+		{2, "", nil, "OEBPS/fixed.opf"},
+		{3, "", nil, ""},
+		{0, "OEBPS/other.opf", nil, "OEBPS/other.opf"},
+		{0, "OEBPS/missing.opf", nil, ""},
+		{0, "", []string{"layout=pre-paginated"}, "OEBPS/fixed.opf"},
+		{0, "", []string{"layout=reflowable", "language=fr"}, ""},
+	}
+	for _, tt := range tests {
+		opfPath, err := findOpfPath(r, tt.n, tt.path, tt.selectors)
+		if opfPath != tt.expected || (err != nil) != (tt.expected == "") {
+			t.Errorf("findOpfPath(%d, %q, %q) = %q, %v, expected %q", tt.n, tt.path, tt.selectors, opfPath, err, tt.expected)
+		}
+	}
+	r = openTestArchive(t, map[string][]byte{
+		"META-INF/container.xml": []byte(`<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:rendition="http://www.idpf.org/2013/rendition">
+<rootfiles>
+<rootfile full-path="fixed.opf" media-type="application/oebps-package+xml" rendition:layout="pre-paginated"/>
+<rootfile full-path="reflow.opf" media-type="application/oebps-package+xml" rendition:layout="reflowable"/>
+</rootfiles>
+</container>`),
+	})
+	if opfPath, err := findOpfPath(r, 0, "", nil); opfPath != "reflow.opf" {
+		t.Errorf("findOpfPath = %q, %v, expected the reflowable package reflow.opf", opfPath, err)
+	}
+	if d := rootfileDescription(Rootfile{FullPath: "fixed.opf", Label: "Fixed", Layout: "pre-paginated"}); d != "fixed.opf (Fixed, pre-paginated)" {
+		t.Errorf("rootfileDescription = %q, expected %q", d, "fixed.opf (Fixed, pre-paginated)")
+	}
+}
+
+func TestWriteAsset(t *testing.T) {
+	dir := t.TempDir()
+	opts := &options{
+		OutputPath: filepath.Join(dir, "out", "book.html"),
+		AssetsDir:  filepath.Join(dir, "out", "assets"),
+	}
+	href, err := writeAsset(opts.AssetsDir, opts.OutputPath, "OEBPS", "OEBPS/images/my pic.png", []byte("png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "assets/images/my%20pic.png"; href != expected {
+		t.Errorf("writeAsset href = %q, expected %q", href, expected)
+	}
+	if data, err := os.ReadFile(filepath.Join(opts.AssetsDir, "images", "my pic.png")); err != nil || string(data) != "png" {
+		t.Errorf("writeAsset did not write the resource: %v", err)
+	}
+	if _, err := writeAsset(opts.AssetsDir, opts.OutputPath, "OEBPS", "../secret", nil); err == nil {
+		t.Error("writeAsset accepted a path outside the book")
+	}
+}
+
+func TestImagePlaceholder(t *testing.T) {
+	tests := []struct {
+		img      string
+		expected string
+	}{
+		{`<img alt=" A map " src="map.png">`, `<span class="image-placeholder">[Image: A map]</span>`},
+		{`<img src="../images/my%20plate.jpg">`, `<span class="image-placeholder">[Image: my plate.jpg]</span>`},
+		{`<img>`, `<span class="image-placeholder">[Image: image]</span>`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := findElement(doc, "img")
+		imagePlaceholder(img)
+		var out strings.Builder
+		html.Render(&out, img)
+		if out.String() != tt.expected {
+			t.Errorf("imagePlaceholder(%q) = %q, expected %q", tt.img, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestSetDefaultAttr(t *testing.T) {
+	tests := []struct {
+		img      string
+		expected string
+	}{
+		{`<img src="a.png">`, `<img src="a.png" loading="lazy"/>`},
+		{`<img src="a.png" loading="eager">`, `<img src="a.png" loading="eager"/>`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := findElement(doc, "img")
+		setDefaultAttr(img, "loading", "lazy")
+		var out strings.Builder
+		html.Render(&out, img)
+		if out.String() != tt.expected {
+			t.Errorf("setDefaultAttr(%q) = %q, expected %q", tt.img, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestResourceURLEmbedMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	rd := &renderer{
+		r: openTestArchive(t, map[string][]byte{
+			"OEBPS/images/small.png": []byte("png"),
+			"OEBPS/images/large.png": []byte(strings.Repeat("png", 100)),
+		}),
+		opts:   &options{OutputPath: filepath.Join(dir, "book.html"), EmbedMaxBytes: 100},
+		opfDir: "OEBPS",
+		manifestHrefMap: map[string]Item{
+			"OEBPS/images/small.png": {Href: "images/small.png", MediaType: "image/png"},
+			"OEBPS/images/large.png": {Href: "images/large.png", MediaType: "image/png"},
+		},
+	}
+	tests := []struct {
+		archivePath string
+		expected    string
+	}{
+		{"OEBPS/images/small.png", "data:image/png;base64,cG5n"},
+		{"OEBPS/images/large.png", "book_files/images/large.png"},
+	}
+	for _, tt := range tests {
+		href, err := rd.resourceURL(tt.archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if href != tt.expected {
+			t.Errorf("resourceURL(%q) = %q, expected %q", tt.archivePath, href, tt.expected)
+		}
+	}
+}
+
+func TestWriteResourceFile(t *testing.T) {
+	dir := t.TempDir()
+	rel, err := writeResourceFile(dir, "OEBPS", "OEBPS/images/a.png", []byte("png"))
+	if err != nil || rel != "images/a.png" {
+		t.Errorf("writeResourceFile(OEBPS/images/a.png) = %q, %v, expected images/a.png", rel, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "images", "a.png")); err != nil || string(data) != "png" {
+		t.Errorf("writeResourceFile wrote %q, %v", data, err)
+	}
+	for _, archivePath := range []string{"", "../a.png"} {
+		if _, err := writeResourceFile(dir, "OEBPS", archivePath, nil); !errors.Is(err, errInvalidResourcePath) {
+			t.Errorf("writeResourceFile(%s) returned %v, expected errInvalidResourcePath", archivePath, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// extractTypes lists the resource types the extract subcommand knows, each
+// with a test on the manifest media type.
+var extractTypes = map[string]func(mediaType string) bool{
+	"image": func(t string) bool { return strings.HasPrefix(t, "image/") },
+	"font":  isFontMediaType,
+	"css":   func(t string) bool { return t == "text/css" },
+	"xhtml": func(t string) bool { return t == "application/xhtml+xml" || t == "text/html" },
+	"audio": func(t string) bool { return strings.HasPrefix(t, "audio/") },
+	"video": func(t string) bool { return strings.HasPrefix(t, "video/") },
+	"all":   func(string) bool { return true },
+}
+
+// runExtract implements "epub2html extract": it copies the manifest items
+// of the requested types out of the archive, keeping their paths relative to
+// the OPF directory, without converting anything. Obfuscated fonts are
+// restored so that they can be used.
+func runExtract(args []string) error {
+	fs := flag.NewFlagSet("epub2html extract", flag.ContinueOnError)
+	types := fs.String("type", "all", "comma-separated resource `types` to extract: image, font, css, xhtml, audio, video or all")
+	outDir := fs.String("out", "extracted", "`dir`ectory to write the resources to")
+	rootfile := fs.Int("rootfile", 0, "extract from the `n`th package listed in container.xml")
+	rootfilePath := fs.String("rootfile-path", "", "extract from the package document at `path` in the EPUB")
+	var rendition []string
+	fs.Var((*stringList)(&rendition), "rendition", "extract from the first package in container.xml with the rendition `attribute=value`; may be repeated")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s extract [options] <input.epub>\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected an input EPUB")
+	}
+	var matchers []func(string) bool
+	for _, name := range strings.Split(*types, ",") {
+		match, ok := extractTypes[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown resource type %q: must be image, font, css, xhtml, audio, video or all", name)
+		}
+		matchers = append(matchers, match)
+	}
+
+	r, err := openEpubArchive(positional[0])
+	if err != nil {
+		return fmt.Errorf("failed to open EPUB file: %w", err)
+	}
+	defer r.Close()
+	if err := checkDRM(r); err != nil {
+		return fmt.Errorf("cannot extract from %s: %w", positional[0], err)
+	}
+	opfPath, err := findOpfPath(r, *rootfile, *rootfilePath, rendition)
+	if err != nil {
+		return fmt.Errorf("failed to find OPF file path: %w", err)
+	}
+	pkg, err := parseOpf(r, opfPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse OPF file %s: %w", opfPath, err)
+	}
+
+	n, err := extractResources(r, pkg, matchers, *outDir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Extracted %d files to %s", n, *outDir)
+	return nil
+}
+
+// extractResources writes the manifest items whose media type satisfies
+// one of matchers into outDir and returns how many were written. Items
+// missing from the archive are skipped with a warning.
+func extractResources(r *epubArchive, pkg *Package, matchers []func(string) bool, outDir string) (int, error) {
+	obfuscated := readObfuscatedFonts(r, pkg)
+	n := 0
+	for _, item := range pkg.Manifest.Items {
+		matched := false
+		for _, match := range matchers {
+			matched = matched || match(item.MediaType)
+		}
+		if !matched {
+			continue
+		}
+		archivePath := joinEpubPath(pkg.OpfDir, item.Href)
+		data, err := readZipFile(r, archivePath)
+		if err != nil {
+			log.Printf("Warning: Could not read %s: %v", archivePath, err)
+			continue
+		}
+		if o, ok := obfuscated[archivePath]; ok {
+			data = o.deobfuscate(data)
+		}
+		if _, err := writeResourceFile(outDir, pkg.OpfDir, archivePath, data); errors.Is(err, errInvalidResourcePath) {
+			log.Printf("Warning: Not extracting %s: %v", archivePath, err)
+			continue
+		} else if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
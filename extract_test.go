@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractResources(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"OEBPS/images/a.png": []byte("png"),
+		"OEBPS/styles/b.css": []byte("p {}"),
+		"OEBPS/text/c.xhtml": []byte("<html/>"),
+	})
+	pkg := &Package{OpfDir: "OEBPS"}
+	pkg.Manifest.Items = []Item{
+		{Href: "images/a.png", MediaType: "image/png"},
+		{Href: "styles/b.css", MediaType: "text/css"},
+		{Href: "text/c.xhtml", MediaType: "application/xhtml+xml"},
+		{Href: "images/missing.jpg", MediaType: "image/jpeg"},
+	}
+	tests := []struct {
+		types    []string
+		expected []string
+	}{
+		{[]string{"image"}, []string{"images/a.png"}},
+		{[]string{"css", "xhtml"}, []string{"styles/b.css", "text/c.xhtml"}},
+		{[]string{"font"}, nil},
+		{[]string{"all"}, []string{"images/a.png", "styles/b.css", "text/c.xhtml"}},
+	}
+	for _, tt := range tests {
+		var matchers []func(string) bool
+		for _, name := range tt.types {
+			matchers = append(matchers, extractTypes[name])
+		}
+		dir := t.TempDir()
+		n, err := extractResources(r, pkg, matchers, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(tt.expected) {
+			t.Errorf("extractResources(%v) extracted %d files, expected %d", tt.types, n, len(tt.expected))
+		}
+		for _, name := range tt.expected {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("extractResources(%v) did not write %s: %v", tt.types, name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// contentMediaTypes are the media types of the spine items read as content
+// documents, including the OEB 1 documents of old EPUB 2 books.
+var contentMediaTypes = map[string]bool{
+	"application/xhtml+xml":    true,
+	"text/html":                true,
+	"image/svg+xml":            true,
+	"application/x-dtbook+xml": true,
+	"text/x-oeb1-document":     true,
+}
+
+// spineContent returns the manifest item a spine item is read from: the
+// item itself if it is a content document or audio, or else the first one
+// that is along the chain of its fallback attributes, as readers must for
+// spine items of other types, such as images or PDF pages. It reports
+// false if there is none.
+func spineContent(item Item, items map[string]Item) (Item, bool) {
+	seen := make(map[string]bool)
+	for current := item; !seen[current.ID]; {
+		if contentMediaTypes[current.MediaType] || strings.HasPrefix(current.MediaType, "audio/") {
+			return current, true
+		}
+		seen[current.ID] = true
+		next, ok := items[current.Fallback]
+		if !ok {
+			break
+		}
+		current = next
+	}
+	return item, false
+}
+
+// imageChapter returns a content document showing an image, for image items
+// placed in the spine without a fallback, as comics and picture books do.
+func imageChapter(imagePath string) (*html.Node, error) {
+	name := path.Base(imagePath)
+	doc := fmt.Sprintf(`<html><head><title>%s</title></head><body><p><img src="%s" alt=""></p></body></html>`,
+		html.EscapeString(name), html.EscapeString(name))
+	return html.Parse(strings.NewReader(doc))
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestSpineContent(t *testing.T) {
+	items := map[string]Item{
+		"page":  {ID: "page", MediaType: "application/pdf", Fallback: "scan"},
+		"scan":  {ID: "scan", MediaType: "image/png", Fallback: "text"},
+		"text":  {ID: "text", MediaType: "application/xhtml+xml"},
+		"loop1": {ID: "loop1", MediaType: "application/pdf", Fallback: "loop2"},
+		"loop2": {ID: "loop2", MediaType: "image/png", Fallback: "loop1"},
+		"photo": {ID: "photo", MediaType: "image/jpeg", Fallback: "missing"},
+		"track": {ID: "track", MediaType: "audio/mpeg"},
+	}
+	tests := []struct {
+		id       string
+		expected string
+		ok       bool
+	}{
+		{"text", "text", true},
+		{"page", "text", true},
+		{"scan", "text", true},
+		{"loop1", "loop1", false},
+		{"photo", "photo", false},
+		{"track", "track", true},
+	}
+	for _, tt := range tests {
+		if item, ok := spineContent(items[tt.id], items); item.ID != tt.expected || ok != tt.ok {
+			t.Errorf("spineContent(%q) = %q, %v, expected %q, %v", tt.id, item.ID, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestLoadChaptersFallback(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"OEBPS/page.pdf":   []byte("%PDF-1.4"),
+		"OEBPS/page.xhtml": []byte(`<html><body><p>Text of the page</p></body></html>`),
+		"OEBPS/plate.jpg":  []byte("JPEG"),
+		"OEBPS/video.mp4":  []byte("MP4"),
+	})
+	pkg := &Package{OpfDir: "OEBPS"}
+	pkg.Manifest.Items = []Item{
+		{ID: "pdf", Href: "page.pdf", MediaType: "application/pdf", Fallback: "xhtml"},
+		{ID: "xhtml", Href: "page.xhtml", MediaType: "application/xhtml+xml"},
+		{ID: "jpg", Href: "plate.jpg", MediaType: "image/jpeg"},
+		{ID: "mp4", Href: "video.mp4", MediaType: "video/mp4"},
+	}
+	pkg.Spine.Itemrefs = []Itemref{{Idref: "pdf"}, {Idref: "jpg"}, {Idref: "mp4"}}
+	chapters := loadChapters(pkg, r)
+	if len(chapters) != 2 {
+		t.Fatalf("loadChapters gave %d chapters, expected 2", len(chapters))
+	}
+	if chapters[0].Path != "OEBPS/page.xhtml" || textContent(findElement(chapters[0].Doc, "body")) != "Text of the page" {
+		t.Errorf("loadChapters read the PDF page as %s, expected its fallback", chapters[0].Path)
+	}
+	if img := findElement(chapters[1].Doc, "img"); img == nil || getAttr(img, "src") != "plate.jpg" {
+		t.Errorf("loadChapters did not show the image of the spine")
+	}
+}
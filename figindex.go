@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// illustrationsID is the ID of the list of illustrations in the output.
+const illustrationsID = "illustrations"
+
+// indexFigures records every <figure> of a chapter that has a caption for
+// the list of illustrations, giving figures without an ID one to link to.
+func (rd *renderer) indexFigures(n *html.Node, ch Chapter) {
+	if n.Type == html.ElementNode && n.Data == "figure" {
+		if caption := findElement(n, "figcaption"); caption != nil {
+			if text := strings.Join(strings.Fields(textContent(caption)), " "); text != "" {
+				id := getAttr(n, "id")
+				if id == "" {
+					id = fmt.Sprintf("ch%d-fig%d", ch.Index+1, len(rd.figures)+1)
+					n.Attr = append(n.Attr, html.Attribute{Key: "id", Val: id})
+				} else {
+					id = rd.anchors.id(ch.Path, id)
+				}
+				rd.figures = append(rd.figures, TOCEntry{Title: text, Href: "#" + id})
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		rd.indexFigures(c, ch)
+	}
+}
+
+// illustrationsChapter renders the list of illustrations appended to the
+// book by --figures-index, linking every captioned figure.
+func (rd *renderer) illustrationsChapter() ChapterData {
+	const title = "List of Illustrations"
+	list := &html.Node{Type: html.ElementNode, Data: "ol", DataAtom: atom.Ol}
+	for _, fig := range rd.figures {
+		link := &html.Node{Type: html.ElementNode, Data: "a", DataAtom: atom.A, Attr: []html.Attribute{{Key: "href", Val: fig.Href}}}
+		link.AppendChild(&html.Node{Type: html.TextNode, Data: fig.Title})
+		item := &html.Node{Type: html.ElementNode, Data: "li", DataAtom: atom.Li}
+		item.AppendChild(link)
+		list.AppendChild(item)
+	}
+	heading := &html.Node{Type: html.ElementNode, Data: "h1", DataAtom: atom.H1}
+	heading.AppendChild(&html.Node{Type: html.TextNode, Data: title})
+	section := &html.Node{Type: html.ElementNode, Data: "section", DataAtom: atom.Section,
+		Attr: []html.Attribute{{Key: "class", Val: "illustrations"}}}
+	section.AppendChild(heading)
+	section.AppendChild(list)
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	body.AppendChild(section)
+
+	var b strings.Builder
+	rd.writeBody(body, &b)
+	return ChapterData{ID: illustrationsID, Title: title, Body: template.HTML(b.String())}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestIndexFigures(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<figure><img src="a.png"><figcaption>A <i>map</i></figcaption></figure>` +
+		`<figure id="plate-2"><img src="b.png"><figcaption>Plate  II</figcaption></figure>` +
+		`<figure><img src="c.png"></figure>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd := &renderer{opts: &options{}}
+	rd.indexFigures(doc, Chapter{Index: 2, Doc: doc})
+
+	expected := []TOCEntry{{Title: "A map", Href: "#ch3-fig1"}, {Title: "Plate II", Href: "#plate-2"}}
+	if len(rd.figures) != len(expected) {
+		t.Fatalf("indexFigures found %d figures, expected %d", len(rd.figures), len(expected))
+	}
+	for i, fig := range rd.figures {
+		if fig.Title != expected[i].Title || fig.Href != expected[i].Href {
+			t.Errorf("figure %d = %+v, expected %+v", i, fig, expected[i])
+		}
+	}
+	if id := getAttr(findElement(doc, "figure"), "id"); id != "ch3-fig1" {
+		t.Errorf("indexFigures gave the first figure id %q, expected %q", id, "ch3-fig1")
+	}
+
+	chapter := rd.illustrationsChapter()
+	if expectedBody := `<section class="illustrations"><h1>List of Illustrations</h1><ol><li><a href="#ch3-fig1">A map</a></li><li><a href="#plate-2">Plate II</a></li></ol></section>`; string(chapter.Body) != expectedBody {
+		t.Errorf("illustrationsChapter() body = %q, expected %q", chapter.Body, expectedBody)
+	}
+}
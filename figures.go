@@ -0,0 +1,163 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// synthesizeFigures finds the figure patterns publishers build from plain
+// elements and class names, and turns them into <figure> and <figcaption>
+// elements so captions stay attached to their images once classes are
+// stripped:
+//
+//   - an image block next to an element with a caption class, such as
+//     <img …><p class="caption">…</p>, is wrapped in a new <figure>;
+//   - a div with a figure class holding an image and a caption, such as
+//     <div class="figure"><img …><p class="fig-caption">…</p></div>, becomes
+//     the <figure> itself.
+//
+// An image block is an <img> or <svg>, or a paragraph or div holding nothing
+// else. Existing figures are left alone.
+func synthesizeFigures(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.Data == "figure" || c.Data == "svg" {
+			continue
+		}
+		if c.Data == "div" && hasClassLike(c, isFigureClass) {
+			if caption := figureCaption(c); caption != nil {
+				c.Data, c.DataAtom = "figure", atom.Figure
+				makeFigcaption(caption)
+				continue
+			}
+		}
+		if !isImageBlock(c) {
+			synthesizeFigures(c)
+			continue
+		}
+		if next := nextElementSibling(c); next != nil && isCaption(next) {
+			c = wrapFigure(c, next)
+		} else if prev := prevElementSibling(c); prev != nil && isCaption(prev) {
+			c = wrapFigure(prev, c)
+		}
+	}
+}
+
+// wrapFigure moves the siblings from first to last into a new <figure> put
+// in their place, turning the caption among them into a <figcaption>, and
+// returns the figure.
+func wrapFigure(first, last *html.Node) *html.Node {
+	figure := &html.Node{Type: html.ElementNode, Data: "figure", DataAtom: atom.Figure}
+	first.Parent.InsertBefore(figure, first)
+	for c := first; ; {
+		next := c.NextSibling
+		c.Parent.RemoveChild(c)
+		figure.AppendChild(c)
+		if c == last {
+			break
+		}
+		c = next
+	}
+	if isCaption(first) {
+		makeFigcaption(first)
+	} else {
+		makeFigcaption(last)
+	}
+	return figure
+}
+
+func makeFigcaption(n *html.Node) {
+	n.Data, n.DataAtom = "figcaption", atom.Figcaption
+}
+
+// figureCaption returns the caption child of a figure div, or nil if the div
+// does not hold both an image and a caption.
+func figureCaption(n *html.Node) *html.Node {
+	var caption *html.Node
+	hasImage := false
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type != html.ElementNode:
+		case caption == nil && isCaption(c):
+			caption = c
+		case isImageBlock(c):
+			hasImage = true
+		}
+	}
+	if !hasImage {
+		return nil
+	}
+	return caption
+}
+
+func isImageBlock(n *html.Node) bool {
+	switch n.Data {
+	case "img", "svg":
+		return true
+	case "p", "div":
+		var only *html.Node
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode && strings.TrimSpace(c.Data) == "":
+			case c.Type != html.ElementNode || only != nil:
+				return false
+			default:
+				only = c
+			}
+		}
+		return only != nil && (only.Data == "img" || only.Data == "svg")
+	}
+	return false
+}
+
+func isCaption(n *html.Node) bool {
+	switch n.Data {
+	case "p", "div", "span":
+		return hasClassLike(n, func(class string) bool { return strings.Contains(class, "caption") })
+	}
+	return false
+}
+
+func isFigureClass(class string) bool {
+	switch class {
+	case "fig", "image", "img", "illustration", "illus", "picture":
+		return true
+	}
+	return strings.Contains(class, "figure")
+}
+
+// hasClassLike reports whether one of the classes of n, lowercased,
+// satisfies match.
+func hasClassLike(n *html.Node, match func(string) bool) bool {
+	for _, class := range strings.Fields(getAttr(n, "class")) {
+		if match(strings.ToLower(class)) {
+			return true
+		}
+	}
+	return false
+}
+
+func nextElementSibling(n *html.Node) *html.Node {
+	for c := n.NextSibling; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			return c
+		}
+		if c.Type == html.TextNode && strings.TrimSpace(c.Data) != "" {
+			return nil
+		}
+	}
+	return nil
+}
+
+func prevElementSibling(n *html.Node) *html.Node {
+	for c := n.PrevSibling; c != nil; c = c.PrevSibling {
+		if c.Type == html.ElementNode {
+			return c
+		}
+		if c.Type == html.TextNode && strings.TrimSpace(c.Data) != "" {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestSynthesizeFigures(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{
+			`<img src="a.png"> <p class="caption">Figure 1</p>`,
+			`<figure><img src="a.png"/> <figcaption class="caption">Figure 1</figcaption></figure>`,
+		},
+		{
+			`<p class="Image-Caption">Above</p><p class="centre"><img src="a.png"></p>`,
+			`<figure><figcaption class="Image-Caption">Above</figcaption><p class="centre"><img src="a.png"/></p></figure>`,
+		},
+		{
+			`<div class="figure"><img src="a.png"><div class="fig-caption">Map</div></div>`,
+			`<figure class="figure"><img src="a.png"/><figcaption class="fig-caption">Map</figcaption></figure>`,
+		},
+		{
+			`<figure><img src="a.png"><p class="caption">Kept</p></figure>`,
+			`<figure><img src="a.png"/><p class="caption">Kept</p></figure>`,
+		},
+		{
+			`<p><img src="a.png"> and text</p><p class="caption">Not a figure</p>`,
+			`<p><img src="a.png"/> and text</p><p class="caption">Not a figure</p>`,
+		},
+		{
+			`<img src="a.png"><p>Plain</p>`,
+			`<img src="a.png"/><p>Plain</p>`,
+		},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := findElement(doc, "body")
+		synthesizeFigures(body)
+		var out strings.Builder
+		for c := body.FirstChild; c != nil; c = c.NextSibling {
+			html.Render(&out, c)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("synthesizeFigures(%q) = %q, expected %q", tt.body, out.String(), tt.expected)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Rendition holds the EPUB 3 rendition:* properties of a package, which
+// describe how a fixed-layout book is meant to be shown.
+type Rendition struct {
+	Layout      string // "reflowable" or "pre-paginated"
+	Orientation string // "auto", "landscape" or "portrait"
+	Spread      string // "auto", "none", "landscape" or "both"
+	Viewport    string // EPUB 3.0 package-wide page size, e.g. "width=1200, height=1600"
+}
+
+// packageRendition reads the rendition properties of the package metadata.
+func packageRendition(pkg *Package) Rendition {
+	var rd Rendition
+	for _, m := range pkg.Metadata.Meta {
+		if m.Refines != "" {
+			continue
+		}
+		value := strings.TrimSpace(m.Value)
+		switch m.Property {
+		case "rendition:layout":
+			rd.Layout = value
+		case "rendition:orientation":
+			rd.Orientation = value
+		case "rendition:spread":
+			rd.Spread = value
+		case "rendition:viewport":
+			rd.Viewport = value
+		}
+	}
+	return rd
+}
+
+// itemrefLayout returns the layout of a spine item: its own
+// rendition:layout-* property if it has one, the package's otherwise.
+func itemrefLayout(pkg *Package, itemref Itemref) string {
+	for _, p := range strings.Fields(itemref.Properties) {
+		if layout, ok := strings.CutPrefix(p, "rendition:layout-"); ok {
+			return layout
+		}
+	}
+	return packageRendition(pkg).Layout
+}
+
+// fixedLayoutPageAttrs returns the attributes of the element wrapping the
+// body of a fixed-layout page. The page keeps the size its viewport <meta>
+// declares, or else the package-wide viewport, and is the containing block
+// of the page's absolutely positioned content. It takes over the styles of
+// the body, which is not written, such as the page's background.
+func fixedLayoutPageAttrs(doc, body *html.Node, rendition Rendition) []html.Attribute {
+	attrs := []html.Attribute{{Key: "class", Val: "fxl-page"}}
+	var decls []cssDecl
+	viewport := pageViewport(doc)
+	if viewport == "" {
+		viewport = rendition.Viewport
+	}
+	width, height, sized := parseViewportSize(viewport)
+	for _, d := range parseDeclarations(getAttr(body, "style")) {
+		switch strings.ToLower(d.Property) {
+		case "position", "width", "height", "overflow":
+			if sized {
+				continue
+			}
+		}
+		decls = append(decls, d)
+	}
+	if sized {
+		decls = append(decls,
+			cssDecl{Property: "position", Value: "relative"},
+			cssDecl{Property: "width", Value: fmt.Sprintf("%dpx", width)},
+			cssDecl{Property: "height", Value: fmt.Sprintf("%dpx", height)},
+			cssDecl{Property: "overflow", Value: "hidden"})
+	}
+	if len(decls) > 0 {
+		attrs = append(attrs, html.Attribute{Key: "style", Val: serializeDeclarations(decls)})
+	}
+	return attrs
+}
+
+// pageViewport returns the content of a document's viewport <meta> tag.
+func pageViewport(doc *html.Node) string {
+	head := findElement(doc, "head")
+	if head == nil {
+		return ""
+	}
+	for c := head.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "meta" && strings.EqualFold(getAttr(c, "name"), "viewport") {
+			return getAttr(c, "content")
+		}
+	}
+	return ""
+}
+
+// parseViewportSize extracts the pixel width and height from viewport
+// content such as "width=1200, height=1600".
+func parseViewportSize(viewport string) (width, height int, ok bool) {
+	for _, part := range strings.FieldsFunc(viewport, func(r rune) bool { return r == ',' || r == ';' }) {
+		name, value, found := strings.Cut(part, "=")
+		if !found {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "px"))
+		if err != nil || n <= 0 {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "width":
+			width = n
+		case "height":
+			height = n
+		}
+	}
+	return width, height, width > 0 && height > 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestParseViewportSize(t *testing.T) {
+	tests := []struct {
+		viewport      string
+		width, height int
+		ok            bool
+	}{
+		{"width=1200, height=1600", 1200, 1600, true},
+		{"height=800px;width=600px", 600, 800, true},
+		{"width=device-width, initial-scale=1", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		width, height, ok := parseViewportSize(tt.viewport)
+		if width != tt.width || height != tt.height || ok != tt.ok {
+			t.Errorf("parseViewportSize(%q) = %d, %d, %v, expected %d, %d, %v",
+				tt.viewport, width, height, ok, tt.width, tt.height, tt.ok)
+		}
+	}
+}
+
+func TestFixedLayoutPageAttrs(t *testing.T) {
+	pkg := &Package{
+		Metadata: Metadata{Meta: []Meta{
+			{Property: "rendition:layout", Value: "pre-paginated"},
+			{Property: "rendition:viewport", Value: "width=100, height=200"},
+		}},
+	}
+	if layout := itemrefLayout(pkg, Itemref{Properties: "page-spread-left rendition:layout-reflowable"}); layout != "reflowable" {
+		t.Errorf("itemrefLayout with an override = %q, expected reflowable", layout)
+	}
+	if layout := itemrefLayout(pkg, Itemref{}); layout != "pre-paginated" {
+		t.Errorf("itemrefLayout = %q, expected pre-paginated", layout)
+	}
+
+	rendition := packageRendition(pkg)
+	for _, tt := range []struct{ page, style string }{
+		{`<head><meta name="viewport" content="width=600, height=800"></head>`, "position: relative; width: 600px; height: 800px; overflow: hidden"},
+		{`<head></head>`, "position: relative; width: 100px; height: 200px; overflow: hidden"},
+		{`<body style="background: #036; width: 50px">`, "background: #036; position: relative; width: 100px; height: 200px; overflow: hidden"},
+	} {
+		doc, err := html.Parse(strings.NewReader(tt.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrapper := &html.Node{Type: html.ElementNode, Data: "div", Attr: fixedLayoutPageAttrs(doc, findElement(doc, "body"), rendition)}
+		if style := getAttr(wrapper, "style"); style != tt.style {
+			t.Errorf("fixedLayoutPageAttrs(%q) style = %q, expected %q", tt.page, style, tt.style)
+		}
+	}
+}
+
+func TestRenderFixedLayoutPage(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"OEBPS/page.css": []byte("body { background-color: #fed } .caption { position: absolute; left: 10px; top: 20px }"),
+	})
+	doc, err := html.Parse(strings.NewReader(`<html><head><meta name="viewport" content="width=600, height=800">
+<link rel="stylesheet" href="page.css"></head><body><p class="caption" style="color: red">Caption</p></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd := newRenderer(&Package{OpfDir: "OEBPS"}, r, &options{})
+	rd.anchors = &anchors{}
+	var b strings.Builder
+	rd.renderChapter(Chapter{Path: "OEBPS/page.xhtml", Doc: doc, FixedLayout: true}, &b)
+	expected := `<div class="fxl-page" style="background-color: #fed; position: relative; width: 600px; height: 800px; overflow: hidden">` +
+		`<p style="position: absolute; left: 10px; top: 20px; color: red">Caption</p></div>`
+	if out := b.String(); !strings.Contains(out, expected) {
+		t.Errorf("renderChapter gave %s, expected %s", out, expected)
+	}
+}
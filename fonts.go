@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// isFontMediaType reports whether a manifest media type denotes a font.
+func isFontMediaType(mediaType string) bool {
+	switch strings.ToLower(mediaType) {
+	case "application/vnd.ms-opentype", "application/x-font-ttf", "application/x-font-truetype",
+		"application/x-font-otf", "application/x-font-opentype", "application/font-woff",
+		"application/font-woff2", "application/font-sfnt":
+		return true
+	}
+	return strings.HasPrefix(strings.ToLower(mediaType), "font/")
+}
+
+// subsetFontData strips a font down to the characters of the book for
+// --subset-fonts. Fonts that cannot be subset are returned unchanged.
+func (rd *renderer) subsetFontData(archivePath string, data []byte) []byte {
+	subset, err := subsetFont(data, rd.fontChars)
+	switch {
+	case errors.Is(err, errUnsupportedFont):
+		log.Printf("Warning: Embedding font %s without subsetting: %v", archivePath, err)
+	case err != nil:
+		log.Printf("Warning: Could not subset font %s: %v", archivePath, err)
+	default:
+		return subset
+	}
+	return data
+}
+
+// bookChars returns every character of the chapters' text, in both cases so
+// that text-transform still finds its glyphs.
+func bookChars(chapters []Chapter) map[rune]bool {
+	chars := map[rune]bool{' ': true, '\u00a0': true}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			for _, r := range n.Data {
+				chars[r] = true
+				chars[unicode.ToUpper(r)] = true
+				chars[unicode.ToLower(r)] = true
+			}
+		case html.ElementNode:
+			if n.Data == "script" || n.Data == "style" || n.Data == "head" {
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, ch := range chapters {
+		walk(ch.Doc)
+	}
+	return chars
+}
+
+// fontFaceCSS returns the @font-face rules of the collected stylesheets, for
+// --embed-fonts without --inline-css.
+func (rd *renderer) fontFaceCSS() string {
+	var rules []cssRule
+	for i := range rd.styles.sheets {
+		for _, rule := range rd.parsedStylesheet(i) {
+			if rule.isAtRule("font-face") {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return escapeStyleText(strings.TrimSuffix(serializeCSS(rules), "\n"))
+}
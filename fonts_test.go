@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestBookChars(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><head><title>Tz</title><style>q{}</style></head><body><p>aÉ</p></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chars := bookChars([]Chapter{{Doc: doc}})
+	for _, r := range "aAÉé " {
+		if !chars[r] {
+			t.Errorf("bookChars is missing %q", r)
+		}
+	}
+	for _, r := range "Tzq" {
+		if chars[r] {
+			t.Errorf("bookChars contains %q from the document head", r)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// errUnsupportedFont is returned by subsetFont for fonts it cannot subset,
+// such as WOFF2, font collections and CFF-based OpenType fonts.
+var errUnsupportedFont = errors.New("unsupported font format")
+
+// sfntTable is one table of a TrueType or OpenType font.
+type sfntTable struct {
+	Tag  string
+	Data []byte
+}
+
+// subsetFont strips the outlines of every glyph not needed to draw the given
+// characters from a TrueType font, plain or wrapped in WOFF, and returns the
+// font in its original container. Glyph IDs are kept, so the character map
+// and metrics stay valid; glyph substitutions are dropped because they could
+// lead to stripped glyphs.
+func subsetFont(data []byte, chars map[rune]bool) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte("wOF2")) || bytes.HasPrefix(data, []byte("ttcf")) {
+		return nil, errUnsupportedFont
+	}
+	woff := bytes.HasPrefix(data, []byte("wOFF"))
+	var flavor uint32
+	var tables []sfntTable
+	var err error
+	if woff {
+		flavor, tables, err = readWOFF(data)
+	} else {
+		flavor, tables, err = readSfnt(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if flavor != 0x00010000 && flavor != 0x74727565 { // "true"
+		return nil, errUnsupportedFont
+	}
+
+	byTag := make(map[string][]byte)
+	for _, t := range tables {
+		byTag[t.Tag] = t.Data
+	}
+	head, loca, glyf, cmap := byTag["head"], byTag["loca"], byTag["glyf"], byTag["cmap"]
+	maxp := byTag["maxp"]
+	if len(head) < 54 || len(maxp) < 6 || loca == nil || glyf == nil || cmap == nil {
+		return nil, errUnsupportedFont
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	offsets, err := glyphOffsets(loca, numGlyphs, binary.BigEndian.Uint16(head[50:]) == 1, len(glyf))
+	if err != nil {
+		return nil, err
+	}
+
+	keep := map[int]bool{0: true} // .notdef
+	for gid := range cmapGlyphs(cmap, chars) {
+		if gid < numGlyphs {
+			keep[gid] = true
+		}
+	}
+	queue := make([]int, 0, len(keep))
+	for gid := range keep {
+		queue = append(queue, gid)
+	}
+	for len(queue) > 0 {
+		gid := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		for _, c := range compositeComponents(glyf[offsets[gid]:offsets[gid+1]]) {
+			if c < numGlyphs && !keep[c] {
+				keep[c] = true
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	var newGlyf bytes.Buffer
+	newLoca := make([]byte, 4*(numGlyphs+1))
+	for gid := 0; gid < numGlyphs; gid++ {
+		binary.BigEndian.PutUint32(newLoca[4*gid:], uint32(newGlyf.Len()))
+		if keep[gid] {
+			newGlyf.Write(glyf[offsets[gid]:offsets[gid+1]])
+			for newGlyf.Len()%4 != 0 {
+				newGlyf.WriteByte(0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[4*numGlyphs:], uint32(newGlyf.Len()))
+	newHead := bytes.Clone(head)
+	binary.BigEndian.PutUint16(newHead[50:], 1) // long loca offsets
+
+	var result []sfntTable
+	for _, t := range tables {
+		switch t.Tag {
+		case "GSUB", "morx", "mort", "DSIG":
+			continue
+		case "glyf":
+			t.Data = newGlyf.Bytes()
+		case "loca":
+			t.Data = newLoca
+		case "head":
+			t.Data = newHead
+		}
+		result = append(result, t)
+	}
+	if woff {
+		return writeWOFF(flavor, result)
+	}
+	return writeSfnt(flavor, result), nil
+}
+
+func readSfnt(data []byte) (uint32, []sfntTable, error) {
+	if len(data) < 12 {
+		return 0, nil, errUnsupportedFont
+	}
+	flavor := binary.BigEndian.Uint32(data)
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*n {
+		return 0, nil, fmt.Errorf("truncated font table directory")
+	}
+	tables := make([]sfntTable, n)
+	for i := range tables {
+		entry := data[12+16*i:]
+		offset := int(binary.BigEndian.Uint32(entry[8:]))
+		length := int(binary.BigEndian.Uint32(entry[12:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return 0, nil, fmt.Errorf("font table %q out of bounds", entry[:4])
+		}
+		tables[i] = sfntTable{Tag: string(entry[:4]), Data: data[offset : offset+length]}
+	}
+	return flavor, tables, nil
+}
+
+func readWOFF(data []byte) (uint32, []sfntTable, error) {
+	if len(data) < 44 {
+		return 0, nil, errUnsupportedFont
+	}
+	flavor := binary.BigEndian.Uint32(data[4:])
+	n := int(binary.BigEndian.Uint16(data[12:]))
+	if len(data) < 44+20*n {
+		return 0, nil, fmt.Errorf("truncated WOFF table directory")
+	}
+	tables := make([]sfntTable, n)
+	for i := range tables {
+		entry := data[44+20*i:]
+		offset := int(binary.BigEndian.Uint32(entry[4:]))
+		compLength := int(binary.BigEndian.Uint32(entry[8:]))
+		origLength := int(binary.BigEndian.Uint32(entry[12:]))
+		if offset < 0 || compLength < 0 || offset+compLength > len(data) {
+			return 0, nil, fmt.Errorf("WOFF table %q out of bounds", entry[:4])
+		}
+		table := data[offset : offset+compLength]
+		if compLength < origLength {
+			zr, err := zlib.NewReader(bytes.NewReader(table))
+			if err != nil {
+				return 0, nil, fmt.Errorf("WOFF table %q: %w", entry[:4], err)
+			}
+			table, err = io.ReadAll(io.LimitReader(zr, int64(origLength)))
+			if err != nil {
+				return 0, nil, fmt.Errorf("WOFF table %q: %w", entry[:4], err)
+			}
+		}
+		tables[i] = sfntTable{Tag: string(entry[:4]), Data: table}
+	}
+	return flavor, tables, nil
+}
+
+// writeSfnt assembles tables into a font file, sorted by tag as the
+// specification requires, with fresh checksums.
+func writeSfnt(flavor uint32, tables []sfntTable) []byte {
+	tables = sortedTables(tables)
+	n := len(tables)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := 16 << entrySelector
+
+	out := make([]byte, 12+16*n)
+	binary.BigEndian.PutUint32(out, flavor)
+	binary.BigEndian.PutUint16(out[4:], uint16(n))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(16*n-searchRange))
+	headOffset := -1
+	for i, t := range tables {
+		data := t.Data
+		if t.Tag == "head" {
+			headOffset = len(out)
+			data = bytes.Clone(data)
+			binary.BigEndian.PutUint32(data[8:], 0)
+		}
+		entry := out[12+16*i:]
+		copy(entry, t.Tag)
+		binary.BigEndian.PutUint32(entry[4:], sfntChecksum(data))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(entry[12:], uint32(len(data)))
+		out = append(out, data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-sfntChecksum(out))
+	}
+	return out
+}
+
+// writeWOFF wraps tables in a WOFF 1.0 container, compressing each table
+// where that makes it smaller.
+func writeWOFF(flavor uint32, tables []sfntTable) ([]byte, error) {
+	// The checksums and head adjustment are those of the equivalent sfnt.
+	sfnt := writeSfnt(flavor, tables)
+	_, tables, _ = readSfnt(sfnt)
+
+	n := len(tables)
+	out := make([]byte, 44+20*n)
+	copy(out, "wOFF")
+	binary.BigEndian.PutUint32(out[4:], flavor)
+	binary.BigEndian.PutUint16(out[12:], uint16(n))
+	binary.BigEndian.PutUint32(out[16:], uint32(len(sfnt)))
+	binary.BigEndian.PutUint16(out[20:], 1) // version 1.0
+	for i, t := range tables {
+		stored := t.Data
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(t.Data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		if buf.Len() < len(t.Data) {
+			stored = buf.Bytes()
+		}
+		entry := out[44+20*i:]
+		copy(entry, t.Tag)
+		binary.BigEndian.PutUint32(entry[4:], uint32(len(out)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(stored)))
+		binary.BigEndian.PutUint32(entry[12:], uint32(len(t.Data)))
+		binary.BigEndian.PutUint32(entry[16:], binary.BigEndian.Uint32(sfnt[12+16*i+4:]))
+		out = append(out, stored...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	binary.BigEndian.PutUint32(out[8:], uint32(len(out)))
+	return out, nil
+}
+
+func sortedTables(tables []sfntTable) []sfntTable {
+	tables = append([]sfntTable(nil), tables...)
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Tag < tables[j].Tag })
+	return tables
+}
+
+func sfntChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// glyphOffsets decodes the loca table into numGlyphs+1 offsets into glyf.
+func glyphOffsets(loca []byte, numGlyphs int, long bool, glyfLen int) ([]int, error) {
+	size := 2
+	if long {
+		size = 4
+	}
+	if len(loca) < size*(numGlyphs+1) {
+		return nil, fmt.Errorf("truncated loca table")
+	}
+	offsets := make([]int, numGlyphs+1)
+	for i := range offsets {
+		if long {
+			offsets[i] = int(binary.BigEndian.Uint32(loca[4*i:]))
+		} else {
+			offsets[i] = 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+		}
+		if offsets[i] > glyfLen || (i > 0 && offsets[i] < offsets[i-1]) {
+			return nil, fmt.Errorf("invalid loca table")
+		}
+	}
+	return offsets, nil
+}
+
+// cmapGlyphs returns the glyphs the font's Unicode character map assigns to
+// chars. Format 4 and format 12 subtables are understood.
+func cmapGlyphs(cmap []byte, chars map[rune]bool) map[int]bool {
+	glyphs := make(map[int]bool)
+	if len(cmap) < 4 {
+		return glyphs
+	}
+	n := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < n && 4+8*i+8 <= len(cmap); i++ {
+		record := cmap[4+8*i:]
+		platform, encoding := binary.BigEndian.Uint16(record), binary.BigEndian.Uint16(record[2:])
+		if platform != 0 && !(platform == 3 && (encoding == 1 || encoding == 10)) {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(record[4:]))
+		if offset+2 > len(cmap) {
+			continue
+		}
+		sub := cmap[offset:]
+		switch binary.BigEndian.Uint16(sub) {
+		case 4:
+			cmapFormat4(sub, chars, glyphs)
+		case 12:
+			cmapFormat12(sub, chars, glyphs)
+		}
+	}
+	return glyphs
+}
+
+func cmapFormat4(sub []byte, chars map[rune]bool, glyphs map[int]bool) {
+	if len(sub) < 14 {
+		return
+	}
+	segCount := int(binary.BigEndian.Uint16(sub[6:])) / 2
+	if len(sub) < 16+8*segCount {
+		return
+	}
+	u16 := func(i int) int { return int(binary.BigEndian.Uint16(sub[i:])) }
+	endCodes, startCodes := 14, 16+2*segCount
+	idDeltas, idRangeOffsets := startCodes+2*segCount, startCodes+4*segCount
+	for r := range chars {
+		if r > 0xFFFF {
+			continue
+		}
+		c := int(r)
+		for seg := 0; seg < segCount; seg++ {
+			if c > u16(endCodes+2*seg) {
+				continue
+			}
+			if c < u16(startCodes+2*seg) {
+				break
+			}
+			delta, rangeOffset := u16(idDeltas+2*seg), u16(idRangeOffsets+2*seg)
+			gid := 0
+			if rangeOffset == 0 {
+				gid = (c + delta) & 0xFFFF
+			} else if at := idRangeOffsets + 2*seg + rangeOffset + 2*(c-u16(startCodes+2*seg)); at+2 <= len(sub) {
+				if gid = u16(at); gid != 0 {
+					gid = (gid + delta) & 0xFFFF
+				}
+			}
+			if gid != 0 {
+				glyphs[gid] = true
+			}
+			break
+		}
+	}
+}
+
+func cmapFormat12(sub []byte, chars map[rune]bool, glyphs map[int]bool) {
+	if len(sub) < 16 {
+		return
+	}
+	n := int(binary.BigEndian.Uint32(sub[12:]))
+	for i := 0; i < n && 16+12*i+12 <= len(sub); i++ {
+		group := sub[16+12*i:]
+		start, end := binary.BigEndian.Uint32(group), binary.BigEndian.Uint32(group[4:])
+		first := binary.BigEndian.Uint32(group[8:])
+		for r := range chars {
+			if c := uint32(r); c >= start && c <= end {
+				glyphs[int(first+c-start)] = true
+			}
+		}
+	}
+}
+
+// compositeComponents returns the glyphs a composite glyph is built from.
+func compositeComponents(glyph []byte) []int {
+	if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+		return nil
+	}
+	var components []int
+	for i := 10; i+4 <= len(glyph); {
+		flags := binary.BigEndian.Uint16(glyph[i:])
+		components = append(components, int(binary.BigEndian.Uint16(glyph[i+2:])))
+		i += 4
+		if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+			i += 4
+		} else {
+			i += 2
+		}
+		switch {
+		case flags&0x0008 != 0: // WE_HAVE_A_SCALE
+			i += 2
+		case flags&0x0040 != 0: // WE_HAVE_AN_X_AND_Y_SCALE
+			i += 4
+		case flags&0x0080 != 0: // WE_HAVE_A_TWO_BY_TWO
+			i += 8
+		}
+		if flags&0x0020 == 0 { // MORE_COMPONENTS
+			break
+		}
+	}
+	return components
+}
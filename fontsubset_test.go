@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testFont builds a TrueType font with four glyphs: .notdef, a simple glyph
+// for 'A', a composite glyph for 'B' and the component it is built from.
+func testFont() []byte {
+	simple := []byte{0, 1, 0, 0, 0, 0, 0, 9, 0, 9, 0, 0, 0, 0, 1, 0, 0}
+	composite := []byte{0xFF, 0xFF, 0, 0, 0, 0, 0, 9, 0, 9, 0, 0, 0, 3, 0, 0}
+	glyphs := [][]byte{nil, simple, composite, simple}
+	var glyf bytes.Buffer
+	loca := make([]byte, 2*(len(glyphs)+1))
+	for i, g := range glyphs {
+		binary.BigEndian.PutUint16(loca[2*i:], uint16(glyf.Len()/2))
+		glyf.Write(g)
+		if glyf.Len()%2 != 0 {
+			glyf.WriteByte(0)
+		}
+	}
+	binary.BigEndian.PutUint16(loca[2*len(glyphs):], uint16(glyf.Len()/2))
+
+	u16 := func(vs ...int) []byte {
+		b := make([]byte, 2*len(vs))
+		for i, v := range vs {
+			binary.BigEndian.PutUint16(b[2*i:], uint16(v))
+		}
+		return b
+	}
+	// Format 4 segments 'A'-'B' -> glyphs 1-2 and the final 0xFFFF segment.
+	format4 := bytes.Join([][]byte{
+		u16(4, 32, 0, 4, 4, 1, 0),
+		u16('B', 0xFFFF), u16(0), u16('A', 0xFFFF), u16(1-'A', 1), u16(0, 0),
+	}, nil)
+	cmap := append(u16(0, 1, 3, 1, 0, 12), format4...)
+
+	head := make([]byte, 54)
+	maxp := u16(0, 0x5000, len(glyphs))
+	return writeSfnt(0x00010000, []sfntTable{
+		{"cmap", cmap}, {"glyf", glyf.Bytes()}, {"head", head}, {"loca", loca}, {"maxp", maxp},
+		{"GSUB", []byte{0, 1, 0, 0}},
+	})
+}
+
+func TestSubsetFont(t *testing.T) {
+	font := testFont()
+	for _, container := range []string{"sfnt", "woff"} {
+		input := font
+		if container == "woff" {
+			_, tables, _ := readSfnt(font)
+			var err error
+			if input, err = writeWOFF(0x00010000, tables); err != nil {
+				t.Fatal(err)
+			}
+		}
+		subset, err := subsetFont(input, map[rune]bool{'B': true})
+		if err != nil {
+			t.Fatalf("subsetFont(%s) returned error: %v", container, err)
+		}
+		var tables []sfntTable
+		if container == "woff" {
+			_, tables, err = readWOFF(subset)
+		} else {
+			_, tables, err = readSfnt(subset)
+		}
+		if err != nil {
+			t.Fatalf("subsetFont(%s) result cannot be read: %v", container, err)
+		}
+
+		byTag := make(map[string][]byte)
+		for _, table := range tables {
+			byTag[table.Tag] = table.Data
+		}
+		if _, ok := byTag["GSUB"]; ok {
+			t.Errorf("subsetFont(%s) kept the GSUB table", container)
+		}
+		offsets, err := glyphOffsets(byTag["loca"], 4, true, len(byTag["glyf"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sizes []int
+		for gid := 0; gid < 4; gid++ {
+			sizes = append(sizes, offsets[gid+1]-offsets[gid])
+		}
+		if sizes[0] != 0 || sizes[1] != 0 || sizes[2] == 0 || sizes[3] == 0 {
+			t.Errorf("subsetFont(%s) glyph sizes = %v, expected only glyphs 2 and 3", container, sizes)
+		}
+	}
+	if checksum := sfntChecksum(font); checksum != 0xB1B0AFBA {
+		t.Errorf("font checksum = %#x, expected 0xB1B0AFBA", checksum)
+	}
+}
+
+func TestSubsetFontUnsupported(t *testing.T) {
+	if _, err := subsetFont([]byte("wOF2 and more bytes"), nil); err != errUnsupportedFont {
+		t.Errorf("subsetFont(WOFF2) error = %v, expected %v", err, errUnsupportedFont)
+	}
+}
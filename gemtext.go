@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// writeGemtext writes every chapter as a separate .gmi file into outDir,
+// together with an index.gmi linking them in reading order. Images are
+// copied next to the chapters and referenced through link lines, and every
+// chapter links to the previous and next ones and to the index, through
+// the --nav-template at navTemplate or the default one.
+func writeGemtext(pkg *Package, r *epubArchive, outDir, navTemplate string) error {
+	nav, err := loadNavTemplate(navTemplate, "gmi")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	chapters := loadChapters(pkg, r)
+	fileNames := make(map[string]string)
+	var hrefs, titles []string
+	for _, ch := range chapters {
+		fileNames[ch.Path] = fmt.Sprintf("chapter%03d.gmi", ch.Index+1)
+		hrefs = append(hrefs, fileNames[ch.Path])
+		titles = append(titles, strings.Join(strings.Fields(chapterTitle(ch)), " "))
+	}
+	navs := chapterNavs(hrefs, titles, navLink{Href: "index.gmi", Title: "Contents"})
+
+	var index strings.Builder
+	fmt.Fprintf(&index, "# %s\n\n", bookTitle(pkg))
+
+	for i, ch := range chapters {
+		gw := &gemtextWriter{
+			r:         r,
+			pkg:       pkg,
+			chapter:   ch,
+			outDir:    outDir,
+			fileNames: fileNames,
+		}
+		if body := findElement(ch.Doc, "body"); body != nil {
+			gw.walk(body)
+		}
+		gw.flush()
+
+		name := fileNames[ch.Path]
+		top, err := navBlock(nav, navs[i], false)
+		if err != nil {
+			return fmt.Errorf("failed to write the navigation of %s: %w", name, err)
+		}
+		bottom, err := navBlock(nav, navs[i], true)
+		if err != nil {
+			return fmt.Errorf("failed to write the navigation of %s: %w", name, err)
+		}
+		text := top + gw.out.String()
+		if bottom != "" {
+			text = strings.TrimRight(text, "\n") + "\n\n" + bottom
+		}
+		if err := os.WriteFile(filepath.Join(outDir, name), []byte(text), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		fmt.Fprintf(&index, "=> %s %s\n", name, chapterTitle(ch))
+	}
+
+	if err := os.WriteFile(filepath.Join(outDir, "index.gmi"), []byte(index.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write index.gmi: %w", err)
+	}
+	return nil
+}
+
+type gemtextLink struct {
+	URL  string
+	Text string
+}
+
+// gemtextWriter flattens a chapter body into Gemtext lines. Gemtext has no
+// inline markup, so text is gathered per block and links found inside a
+// block are emitted as link lines right after it.
+type gemtextWriter struct {
+	r         *epubArchive
+	pkg       *Package
+	chapter   Chapter
+	outDir    string
+	fileNames map[string]string
+
+	out    strings.Builder
+	line   strings.Builder
+	prefix string
+	quoted bool
+	links  []gemtextLink
+}
+
+func (gw *gemtextWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		gw.line.WriteString(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.Data {
+	case "script", "style", "link", "meta", "head", "title":
+		return
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		gw.flush()
+		gw.prefix = strings.Repeat("#", min(int(n.Data[1]-'0'), 3)) + " "
+		gw.walkChildren(n)
+		gw.flush()
+		return
+	case "li":
+		gw.flush()
+		gw.prefix = "* "
+		gw.walkChildren(n)
+		gw.flush()
+		return
+	case "blockquote":
+		gw.flush()
+		outer := gw.quoted
+		gw.quoted = true
+		gw.walkChildren(n)
+		gw.flush()
+		gw.quoted = outer
+		return
+	case "pre":
+		gw.flush()
+		gw.out.WriteString("```\n")
+		text := strings.Trim(rawText(n), "\n")
+		gw.out.WriteString(text)
+		gw.out.WriteString("\n```\n\n")
+		return
+	case "br":
+		gw.flush()
+		return
+	case "img":
+		gw.flush()
+		gw.image(n)
+		return
+	case "svg":
+		if img := svgImage(n); img != nil {
+			gw.flush()
+			gw.image(img)
+		}
+		return
+	case "a":
+		href := getAttr(n, "href")
+		start := gw.line.Len()
+		gw.walkChildren(n)
+		if href != "" {
+			text := strings.Join(strings.Fields(gw.line.String()[start:]), " ")
+			if target := gw.linkTarget(href); target != "" {
+				gw.links = append(gw.links, gemtextLink{URL: target, Text: text})
+			}
+		}
+		return
+	}
+
+	if isBlockElement(n.Data) {
+		gw.flush()
+		gw.walkChildren(n)
+		gw.flush()
+		return
+	}
+	gw.walkChildren(n)
+}
+
+func (gw *gemtextWriter) walkChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		gw.walk(c)
+	}
+}
+
+// flush writes the pending text line, if any, followed by its links. The
+// line prefix (heading or list marker) is kept until a line uses it.
+func (gw *gemtextWriter) flush() {
+	text := strings.Join(strings.Fields(gw.line.String()), " ")
+	gw.line.Reset()
+	if text == "" && len(gw.links) == 0 {
+		return
+	}
+	if text != "" {
+		switch {
+		case gw.prefix != "":
+			gw.out.WriteString(gw.prefix)
+		case gw.quoted:
+			gw.out.WriteString("> ")
+		}
+		gw.out.WriteString(text)
+		gw.out.WriteString("\n")
+	}
+	for _, l := range gw.links {
+		gw.writeLink(l)
+	}
+	gw.out.WriteString("\n")
+	gw.links = nil
+	gw.prefix = ""
+}
+
+func (gw *gemtextWriter) writeLink(l gemtextLink) {
+	gw.out.WriteString("=> ")
+	gw.out.WriteString(l.URL)
+	if l.Text != "" {
+		gw.out.WriteString(" ")
+		gw.out.WriteString(l.Text)
+	}
+	gw.out.WriteString("\n")
+}
+
+// linkTarget maps an href to a Gemtext link target. Links to other spine
+// documents point at the matching .gmi file; fragments are dropped because
+// Gemtext has no anchors.
+func (gw *gemtextWriter) linkTarget(href string) string {
+	if isExternalHref(href) {
+		return href
+	}
+	target, _, _ := strings.Cut(href, "#")
+	if target == "" {
+		return ""
+	}
+	resolved := resolveEpubPath(epubDir(gw.chapter.Path), target)
+	if name, ok := gw.fileNames[resolved]; ok {
+		return name
+	}
+	return ""
+}
+
+func (gw *gemtextWriter) image(n *html.Node) {
+	src := getAttr(n, "src")
+	if src == "" {
+		return
+	}
+	imagePath := resolveEpubPath(epubDir(gw.chapter.Path), src)
+	rel, err := exportResource(gw.r, gw.pkg, imagePath, gw.outDir)
+	if err != nil {
+		log.Printf("Warning: Could not export image %s: %v", imagePath, err)
+		return
+	}
+	alt := getAttr(n, "alt")
+	if alt == "" {
+		alt = "Image"
+	}
+	gw.writeLink(gemtextLink{URL: rel, Text: alt})
+	gw.out.WriteString("\n")
+}
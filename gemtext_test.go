@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestGemtextWriter(t *testing.T) {
+	src := `<html><body>
+<h1>Title</h1>
+<p>Some <em>text</em> with <a href="http://example.com/">a link</a>.</p>
+<ul><li><p>One</p></li><li>Two</li></ul>
+<blockquote><p>Quoted</p></blockquote>
+<h5>Deep</h5>
+<pre>a
+  b</pre>
+</body></html>`
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw := &gemtextWriter{chapter: Chapter{Path: "text/ch1.xhtml", Doc: doc}}
+	gw.walk(findElement(doc, "body"))
+	gw.flush()
+
+	expected := "# Title\n\n" +
+		"Some text with a link.\n=> http://example.com/ a link\n\n" +
+		"* One\n\n* Two\n\n" +
+		"> Quoted\n\n" +
+		"### Deep\n\n" +
+		"```\na\n  b\n```\n\n"
+	if got := gw.out.String(); got != expected {
+		t.Errorf("gemtext output mismatch:\ngot:\n%s\nexpected:\n%s", got, expected)
+	}
+}
@@ -2,4 +2,10 @@ module github.com/sysoleg/epub2html
 
 go 1.24.3
 
-require golang.org/x/net v0.40.0
+require (
+	github.com/HugoSmits86/nativewebp v1.3.0
+	github.com/andybalholm/cascadia v1.3.3
+	golang.org/x/image v0.27.0
+	golang.org/x/net v0.40.0
+	golang.org/x/text v0.25.0
+)
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// guideTitles maps the documents the EPUB 2 guide points at as a whole to
+// the titles it gives them, such as "Title Page", for chapters that have no
+// heading to take their title from.
+func guideTitles(pkg *Package) map[string]string {
+	titles := make(map[string]string)
+	for _, ref := range pkg.Guide {
+		file, fragment, _ := strings.Cut(ref.Href, "#")
+		title := strings.TrimSpace(ref.Title)
+		if fragment != "" || title == "" {
+			continue
+		}
+		if path := resolveEpubPath(pkg.OpfDir, file); titles[path] == "" {
+			titles[path] = title
+		}
+	}
+	return titles
+}
+
+// landmarkPath returns the archive path of the document where the landmark
+// of the given epub:type, such as bodymatter, begins: as listed in the
+// landmarks of the navigation document or in the EPUB 2 guide, the one of
+// the package's version first, else the first chapter carrying the type.
+// It returns "" if the book does not mark the landmark.
+func landmarkPath(pkg *Package, r *epubArchive, chapters []Chapter, epubType string) string {
+	var target string
+	byVersion(pkg, func() bool {
+		if doc, path := readNavDoc(r, pkg); doc != nil {
+			if list := navList(doc, "landmarks"); list != nil {
+				for li := list.FirstChild; li != nil; li = li.NextSibling {
+					a := findElement(li, "a")
+					if a != nil && slices.Contains(strings.Fields(getAttr(a, "epub:type")), epubType) {
+						target, _ = resolveHref(path, getAttr(a, "href"))
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}, func() bool {
+		for _, ref := range pkg.Guide {
+			if guideTypes[ref.Type] == epubType {
+				file, _, _ := strings.Cut(ref.Href, "#")
+				target = resolveEpubPath(pkg.OpfDir, file)
+				return true
+			}
+		}
+		return false
+	})
+	if target != "" {
+		return target
+	}
+	for _, ch := range chapters {
+		if hasEpubType(ch.Doc, epubType) {
+			return ch.Path
+		}
+	}
+	return ""
+}
+
+// hasEpubType reports whether n or an element below it has the given
+// epub:type.
+func hasEpubType(n *html.Node, epubType string) bool {
+	if n.Type == html.ElementNode && slices.Contains(strings.Fields(getAttr(n, "epub:type")), epubType) {
+		return true
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if hasEpubType(c, epubType) {
+			return true
+		}
+	}
+	return false
+}
+
+// startAt drops the chapters before the landmark of the given epub:type
+// for --start-at and numbers the rest anew. All chapters are kept, with a
+// warning, if the book does not mark the landmark.
+func startAt(pkg *Package, r *epubArchive, chapters []Chapter, epubType string) []Chapter {
+	path := landmarkPath(pkg, r, chapters, epubType)
+	i := slices.IndexFunc(chapters, func(ch Chapter) bool { return ch.Path == path })
+	if i < 0 {
+		log.Printf("Warning: The book does not mark where its %s begins; converting all of it", epubType)
+		return chapters
+	}
+	return renumber(chapters[i:])
+}
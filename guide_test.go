@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestStartAt(t *testing.T) {
+	var chapters []Chapter
+	for i, doc := range []string{
+		`<p>Copyright</p>`,
+		`<body epub:type="bodymatter"><h1>One</h1></body>`,
+		`<h1>Two</h1>`,
+	} {
+		n, err := html.Parse(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chapters = append(chapters, Chapter{Index: i, Path: []string{"OEBPS/front.xhtml", "OEBPS/one.xhtml", "OEBPS/two.xhtml"}[i], Doc: n})
+	}
+	r := openTestArchive(t, map[string][]byte{})
+	withGuide := &Package{OpfDir: "OEBPS", Guide: []Reference{{Type: "text", Href: "two.xhtml#start"}}}
+	tests := []struct {
+		pkg      *Package
+		epubType string
+		expected string
+	}{
+		{&Package{OpfDir: "OEBPS"}, "bodymatter", "OEBPS/one.xhtml"},
+		{withGuide, "bodymatter", "OEBPS/two.xhtml"},
+		{withGuide, "index", "OEBPS/front.xhtml"},
+	}
+	for _, tt := range tests {
+		kept := startAt(tt.pkg, r, append([]Chapter(nil), chapters...), tt.epubType)
+		if kept[0].Path != tt.expected || kept[0].Index != 0 {
+			t.Errorf("startAt(%q) starts with %s at %d, expected %s at 0", tt.epubType, kept[0].Path, kept[0].Index, tt.expected)
+		}
+	}
+}
+
+func TestGuideTitles(t *testing.T) {
+	pkg := &Package{OpfDir: "OEBPS", Guide: []Reference{
+		{Type: "title-page", Title: " Title Page ", Href: "Text/title.xhtml"},
+		{Type: "text", Title: "Start", Href: "Text/ch1.xhtml#start"},
+	}}
+	titles := guideTitles(pkg)
+	if len(titles) != 1 || titles["OEBPS/Text/title.xhtml"] != "Title Page" {
+		t.Errorf("guideTitles = %v, expected the title page only", titles)
+	}
+}
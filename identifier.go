@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+)
+
+// identifierPrefixes maps the prefixes that name the scheme of an
+// identifier in its value to the scheme.
+var identifierPrefixes = []struct{ prefix, scheme string }{
+	{"urn:isbn:", "isbn"},
+	{"isbn:", "isbn"},
+	{"urn:uuid:", "uuid"},
+	{"uuid:", "uuid"},
+	{"urn:doi:", "doi"},
+	{"doi:", "doi"},
+	{"https://doi.org/", "doi"},
+	{"http://dx.doi.org/", "doi"},
+}
+
+// identifierSchemes maps the opf:scheme values and ONIX identifier types
+// of the identifier-type refinement to the schemes parseIdentifier knows.
+var identifierSchemes = map[string]string{
+	"isbn": "isbn",
+	"02":   "isbn", // ISBN-10
+	"15":   "isbn", // ISBN-13
+	"uuid": "uuid",
+	"doi":  "doi",
+	"06":   "doi",
+}
+
+// parseIdentifier returns the scheme of an identifier, isbn, uuid or doi,
+// and its value without the prefix naming the scheme, such as urn:isbn:.
+// The scheme is taken from the prefix, else from the declared scheme. It
+// returns "" for other schemes, and the trimmed value.
+func parseIdentifier(value, scheme string) (string, string) {
+	value = strings.TrimSpace(value)
+	for _, p := range identifierPrefixes {
+		if len(value) > len(p.prefix) && strings.EqualFold(value[:len(p.prefix)], p.prefix) {
+			return p.scheme, value[len(p.prefix):]
+		}
+	}
+	return identifierSchemes[strings.ToLower(strings.TrimSpace(scheme))], value
+}
+
+// uniqueIdentifier returns the dc:identifier the package's
+// unique-identifier attribute points to, or if it points to none the first
+// identifier of the book.
+func uniqueIdentifier(pkg *Package) string {
+	for _, id := range pkg.Metadata.Identifiers {
+		if id.ID == pkg.UniqueID {
+			return strings.TrimSpace(id.Value)
+		}
+	}
+	for _, id := range pkg.Metadata.Identifiers {
+		if value := strings.TrimSpace(id.Value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// identifierFileName returns the unique identifier of the book without its
+// scheme prefix, with the characters that are not safe in file names
+// replaced by dashes, e.g. "9780000000001" or "10.1000-182", or "" if the
+// book has no identifier.
+func identifierFileName(pkg *Package) string {
+	_, id := parseIdentifier(uniqueIdentifier(pkg), "")
+	return strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '-'
+	}, id), "-.")
+}
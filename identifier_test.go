@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestParseIdentifier(t *testing.T) {
+	tests := []struct {
+		value, scheme string
+		kind, id      string
+	}{
+		{"urn:isbn:9780000000001", "", "isbn", "9780000000001"},
+		{"URN:UUID:1234-abcd", "", "uuid", "1234-abcd"},
+		{" uuid:1234 ", "", "uuid", "1234"},
+		{"doi:10.1000/182", "", "doi", "10.1000/182"},
+		{"https://doi.org/10.1000/182", "", "doi", "10.1000/182"},
+		{"9780000000001", "ISBN", "isbn", "9780000000001"},
+		{"9780000000001", "15", "isbn", "9780000000001"},
+		{"calibre:42", "calibre", "", "calibre:42"},
+	}
+	for _, tt := range tests {
+		if kind, id := parseIdentifier(tt.value, tt.scheme); kind != tt.kind || id != tt.id {
+			t.Errorf("parseIdentifier(%q, %q) = %q, %q, expected %q, %q", tt.value, tt.scheme, kind, id, tt.kind, tt.id)
+		}
+	}
+}
+
+func TestUniqueIdentifier(t *testing.T) {
+	tests := []struct {
+		uniqueID    string
+		identifiers []Identifier
+		expected    string
+	}{
+		{"b", []Identifier{{ID: "a", Value: "first"}, {ID: "b", Value: " second "}}, "second"},
+		{"missing", []Identifier{{Value: " "}, {ID: "a", Value: "first"}}, "first"},
+		{"", nil, ""},
+	}
+	for _, tt := range tests {
+		pkg := &Package{UniqueID: tt.uniqueID, Metadata: Metadata{Identifiers: tt.identifiers}}
+		if id := uniqueIdentifier(pkg); id != tt.expected {
+			t.Errorf("uniqueIdentifier(%q, %+v) = %q, expected %q", tt.uniqueID, tt.identifiers, id, tt.expected)
+		}
+	}
+}
+
+func TestIdentifierFileName(t *testing.T) {
+	tests := []struct {
+		value, expected string
+	}{
+		{"urn:isbn:978-0-00-000000-1", "978-0-00-000000-1"},
+		{"doi:10.1000/182", "10.1000-182"},
+		{"http://example.com/book?id=1", "http---example.com-book-id-1"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		pkg := &Package{Metadata: Metadata{Identifiers: []Identifier{{Value: tt.value}}}}
+		if name := identifierFileName(pkg); name != tt.expected {
+			t.Errorf("identifierFileName(%q) = %q, expected %q", tt.value, name, tt.expected)
+		}
+	}
+}
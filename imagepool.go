@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// imagePool loads, recompresses and base64-encodes the images of the
+// chapters on several goroutines ahead of the renderer, which still
+// renders the chapters one after the other and takes each image as it
+// reaches it. Only a couple of images per worker are loaded ahead, so
+// memory use does not grow with the number of images.
+type imagePool struct {
+	mu    sync.Mutex
+	jobs  map[string]*imageJob // jobs not taken or dropped yet by archive path
+	order []*imageJob          // all jobs in the order the images appear
+	next  int                  // index in order of the first job not taken or dropped
+	slots chan struct{}        // one for each job started and not taken or dropped yet
+	quit  chan struct{}
+}
+
+// imageJob is the loading of an image by an imagePool.
+type imageJob struct {
+	index     int
+	path      string
+	started   bool // handed to a worker
+	dropped   bool // taken, or passed by the renderer without being taken
+	done      chan struct{}
+	data      []byte
+	mediaType string
+	uri       string // the data URI of the image, when it is embedded whole
+	err       error
+}
+
+// startImagePool starts loading the images at paths, the archive paths of
+// the <img> sources in the order prescanImages found them, on jobs
+// goroutines. Images that streamedDataURI streams are left to it.
+func (rd *renderer) startImagePool(paths []string, jobs int) *imagePool {
+	p := &imagePool{
+		jobs:  make(map[string]*imageJob),
+		slots: make(chan struct{}, 2*jobs),
+		quit:  make(chan struct{}),
+	}
+	for _, path := range paths {
+		if _, ok := p.jobs[path]; ok {
+			continue
+		}
+		if _, ok := rd.streamable(path); ok {
+			continue
+		}
+		job := &imageJob{index: len(p.order), path: path, done: make(chan struct{})}
+		p.jobs[path] = job
+		p.order = append(p.order, job)
+	}
+
+	inline := rd.opts.AssetsDir == "" && rd.opts.EmbedMaxBytes == 0
+	queue := make(chan *imageJob)
+	for range jobs {
+		go func() {
+			for job := range queue {
+				job.data, job.mediaType, job.err = rd.loadResource(job.path)
+				if job.err == nil && inline {
+					job.uri = encodeDataURI(job.mediaType, job.data)
+				}
+				close(job.done)
+			}
+		}()
+	}
+	go func() {
+		defer close(queue)
+		for i := range p.order {
+			p.mu.Lock()
+			job := p.order[i]
+			p.mu.Unlock()
+			if job == nil {
+				continue
+			}
+			select {
+			case p.slots <- struct{}{}:
+			case <-p.quit:
+				return
+			}
+			p.mu.Lock()
+			if job.dropped {
+				<-p.slots
+				p.mu.Unlock()
+				continue
+			}
+			job.started = true
+			p.mu.Unlock()
+			select {
+			case queue <- job:
+			case <-p.quit:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// take returns the loaded image at archivePath, waiting for it if it is
+// not loaded yet, or false if the pool does not have it, as it is not an
+// <img> source or has been taken already. The images
+// before it that were not taken are dropped: the renderer has passed
+// them, so they were not embedded after all.
+func (p *imagePool) take(archivePath string) (*imageJob, bool) {
+	if p == nil {
+		return nil, false
+	}
+	p.mu.Lock()
+	job, ok := p.jobs[archivePath]
+	if !ok {
+		p.mu.Unlock()
+		return nil, false
+	}
+	for ; p.next < job.index; p.next++ {
+		if earlier := p.order[p.next]; earlier != nil {
+			p.drop(earlier)
+		}
+	}
+	p.mu.Unlock()
+	// With the jobs before it dropped, the job has a slot to start in.
+	<-job.done
+	p.mu.Lock()
+	p.drop(job)
+	p.mu.Unlock()
+	return job, true
+}
+
+// drop forgets a job, freeing its slot if it was started. p.mu must be
+// held.
+func (p *imagePool) drop(job *imageJob) {
+	if job.dropped {
+		return
+	}
+	job.dropped = true
+	if job.started {
+		<-p.slots
+	}
+	delete(p.jobs, job.path)
+	p.order[job.index] = nil
+}
+
+// stop stops starting jobs. Those under way are finished and discarded.
+func (p *imagePool) stop() {
+	if p != nil {
+		close(p.quit)
+	}
+}
+
+// pooledImage takes an image from the pool of the renderer, recording its
+// size as readResource does.
+func (rd *renderer) pooledImage(archivePath string) (*imageJob, bool) {
+	job, ok := rd.images.take(archivePath)
+	if !ok || job.err != nil {
+		return nil, false
+	}
+	if strings.HasPrefix(job.mediaType, "image/") {
+		rd.recordImageSize(archivePath, bytes.NewReader(job.data))
+	}
+	return job, true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestImagePool(t *testing.T) {
+	files := make(map[string][]byte)
+	pkg := &Package{OpfDir: "OEBPS"}
+	for i := range 40 {
+		name := fmt.Sprintf("img%d.png", i)
+		files["OEBPS/"+name] = testPNG(t, i+1, 2)
+		pkg.Manifest.Items = append(pkg.Manifest.Items, Item{ID: fmt.Sprintf("i%d", i), Href: name, MediaType: "image/png"})
+	}
+	r := openTestArchive(t, files)
+
+	// The images of the head are found by prescanImages but never
+	// embedded, which the pool must get past.
+	var head, body strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&head, `<link rel="icon" href="img%d.png"><img src="img%d.png">`, i, i)
+	}
+	for i := 20; i < 40; i++ {
+		fmt.Fprintf(&body, `<p><img src="img%d.png" alt=""><img src="img%d.png" alt=""></p>`, i, 39-i+20)
+	}
+	body.WriteString(`<p><img src="missing.png" alt=""></p>`)
+	pages := []string{
+		`<html><head>` + head.String() + `</head><body>` + body.String() + `</body></html>`,
+		`<html><body><p><img src="img25.png" alt=""><img src="img3.png" alt=""></p></body></html>`,
+	}
+
+	render := func(opts *options) string {
+		var chapters []Chapter
+		for i, page := range pages {
+			doc, err := html.Parse(strings.NewReader(page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			chapters = append(chapters, Chapter{Index: i, Path: fmt.Sprintf("OEBPS/c%d.xhtml", i), Doc: doc})
+		}
+		rd := newRenderer(pkg, r, opts)
+		rd.anchors = newAnchors(chapters)
+		rd.prescanImages(chapters)
+		if opts.Jobs > 1 {
+			rd.images = rd.startImagePool(rd.imageOrder, opts.Jobs)
+			defer rd.images.stop()
+		}
+		var b strings.Builder
+		for _, ch := range chapters {
+			rd.renderChapter(ch, &b)
+		}
+		return b.String() + string(rd.imageSymbolsHTML())
+	}
+	for _, opts := range []options{{}, {NoSVG: true}, {MaxImageSize: 10}} {
+		serial := opts
+		serial.Jobs = 1
+		expected := render(&serial)
+		for _, jobs := range []int{2, 8} {
+			opts.Jobs = jobs
+			if out := render(&opts); out != expected {
+				t.Errorf("rendering with --jobs %d and %+v differs from rendering with --jobs 1", jobs, opts)
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	"golang.org/x/net/html"
+)
+
+// defaultJPEGQuality is the quality resized JPEG images are encoded at
+// unless --image-quality is given.
+const defaultJPEGQuality = 90
+
+// imageOptions controls how processImage changes embedded images.
+type imageOptions struct {
+	MaxSize   int    // largest width or height, 0 for any
+	Format    string // "webp" to convert to WebP, "" to keep the format
+	Quality   int    // JPEG quality from 1 to 100 to re-encode at, 0 to leave images be
+	Grayscale bool   // convert to grayscale with stretched contrast, for --eink
+}
+
+// imageOptions returns the image processing asked for on the command line,
+// and whether there is any.
+func (opts *options) imageOptions() (imageOptions, bool) {
+	o := imageOptions{MaxSize: opts.MaxImageSize, Format: opts.ImageFormat, Quality: opts.ImageQuality, Grayscale: opts.EInk}
+	return o, o != imageOptions{}
+}
+
+// imageExtensions maps the media types processImage writes to file name
+// extensions.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// processImage downscales a JPEG or PNG image whose width or height exceeds
+// the maximum size, keeping its aspect ratio, turns it gray, re-encodes it at
+// the given quality and converts it to WebP if asked to. PNG images are re-encoded with
+// the best compression, as quality does not apply to them, and WebP images
+// are encoded losslessly, so a re-encoded image is only used when it is
+// smaller than the image it replaces. For that reason only PNG images are
+// converted to WebP: a lossless WebP of a photo is hardly ever smaller
+// than its JPEG. Other images are returned unchanged. The media type of
+// the result is returned with it.
+func processImage(data []byte, mediaType string, o imageOptions) ([]byte, string, error) {
+	if mediaType != "image/jpeg" && mediaType != "image/png" {
+		return data, mediaType, nil
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	resize := o.MaxSize > 0 && (config.Width > o.MaxSize || config.Height > o.MaxSize)
+	webp := o.Format == "webp" && mediaType == "image/png"
+	if !resize && !webp && o.Quality == 0 && !o.Grayscale {
+		return data, mediaType, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if resize {
+		width, height := fitWithin(config.Width, config.Height, o.MaxSize)
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+		img = scaled
+	}
+	if o.Grayscale {
+		img = einkGray(img)
+	}
+	if resize || o.Grayscale {
+		if data, err = encodeImage(img, mediaType, o.Quality); err != nil {
+			return nil, "", err
+		}
+	} else if o.Quality > 0 {
+		if recoded, err := encodeImage(img, mediaType, o.Quality); err == nil && len(recoded) < len(data) {
+			data = recoded
+		}
+	}
+
+	if webp {
+		// Fall back to the original format if the image cannot be
+		// converted or does not get any smaller.
+		if webp, err := encodeImage(img, "image/webp", o.Quality); err == nil && len(webp) < len(data) {
+			return webp, "image/webp", nil
+		}
+	}
+	return data, mediaType, nil
+}
+
+// encodeImage encodes img in the given format. Quality only applies to
+// JPEG; for PNG a non-zero quality selects the best compression.
+func encodeImage(img image.Image, mediaType string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch mediaType {
+	case "image/jpeg":
+		if quality == 0 {
+			quality = defaultJPEGQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "image/webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		level := png.DefaultCompression
+		if quality > 0 {
+			level = png.BestCompression
+		}
+		err = (&png.Encoder{CompressionLevel: level}).Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fitWithin scales width and height down proportionally so that neither
+// exceeds maxSize.
+func fitWithin(width, height, maxSize int) (int, int) {
+	if width >= height {
+		return maxSize, max(1, (height*maxSize+width/2)/width)
+	}
+	return max(1, (width*maxSize+height/2)/height), maxSize
+}
+
+// recordImageSize remembers the dimensions of an embedded image so that
+// setImageSize can write them into the elements showing it. Only the header
+// is read from r. Images that cannot be decoded, such as SVG, are skipped.
+func (rd *renderer) recordImageSize(archivePath string, r io.Reader) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return
+	}
+	if rd.imageSizes == nil {
+		rd.imageSizes = make(map[string]image.Point)
+	}
+	rd.imageSizes[archivePath] = image.Pt(config.Width, config.Height)
+}
+
+// setImageSize gives an <img> element the width and height attributes of
+// its image, so that browsers reserve its space before it has loaded. Sizes
+// set by the book are left alone.
+func (rd *renderer) setImageSize(n *html.Node, archivePath string) {
+	size, ok := rd.imageSizes[archivePath]
+	if !ok || getAttr(n, "width") != "" || getAttr(n, "height") != "" {
+		return
+	}
+	n.Attr = append(n.Attr,
+		html.Attribute{Key: "width", Val: strconv.Itoa(size.X)},
+		html.Attribute{Key: "height", Val: strconv.Itoa(size.Y)})
+}
+
+// einkGray converts an image to grayscale for e-ink screens, which show few
+// shades: transparent areas become white, the page colour of such screens,
+// and the levels are stretched so that the darkest and lightest percent of
+// the pixels become black and white.
+func einkGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(bounds)
+	var histogram [256]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// The colour is premultiplied, so adding the missing alpha
+			// composites it over white.
+			lum := (19595*r+38470*g+7471*b+1<<15)>>16 + 0xffff - a
+			v := uint8(min(lum, 0xffff) >> 8)
+			gray.Pix[gray.PixOffset(x, y)] = v
+			histogram[v]++
+		}
+	}
+
+	clip := len(gray.Pix) / 100
+	lo, hi := 0, 255
+	for n := histogram[lo]; n <= clip && lo < 255; n += histogram[lo] {
+		lo++
+	}
+	for n := histogram[hi]; n <= clip && hi > 0; n += histogram[hi] {
+		hi--
+	}
+	if hi <= lo {
+		return gray
+	}
+	for i, v := range gray.Pix {
+		gray.Pix[i] = uint8((min(max(int(v), lo), hi) - lo) * 255 / (hi - lo))
+	}
+	return gray
+}
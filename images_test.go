@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func testPNG(t testing.TB, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: uint8(x), A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessImage(t *testing.T) {
+	tests := []struct {
+		width, height, maxSize int
+		expectedW, expectedH   int
+	}{
+		{400, 200, 100, 100, 50},
+		{200, 400, 100, 50, 100},
+		{80, 60, 100, 80, 60},
+		{400, 200, 0, 400, 200},
+	}
+	for _, tt := range tests {
+		data, _, err := processImage(testPNG(t, tt.width, tt.height), "image/png", imageOptions{MaxSize: tt.maxSize})
+		if err != nil {
+			t.Fatalf("processImage returned error: %v", err)
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != "png" || config.Width != tt.expectedW || config.Height != tt.expectedH {
+			t.Errorf("processImage(%dx%d, %d) = %s %dx%d, expected png %dx%d", tt.width, tt.height, tt.maxSize,
+				format, config.Width, config.Height, tt.expectedW, tt.expectedH)
+		}
+	}
+
+	svg := []byte("<svg/>")
+	if data, _, err := processImage(svg, "image/svg+xml", imageOptions{MaxSize: 10}); err != nil || !bytes.Equal(data, svg) {
+		t.Errorf("processImage changed an SVG image: %q, %v", data, err)
+	}
+}
+
+func TestProcessImageWebP(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x*4 + (x*y*7)%5), G: uint8(y*4 + (x*31+y*17)%3), B: uint8(128 + (x*x+y)%4), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	data, mediaType, err := processImage(buf.Bytes(), "image/png", imageOptions{Format: "webp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "image/webp" || !bytes.HasPrefix(data, []byte("RIFF")) {
+		t.Errorf("processImage to WebP = %s %q..., expected a WebP image", mediaType, data[:min(len(data), 4)])
+	}
+	if len(data) >= buf.Len() {
+		t.Errorf("processImage to WebP returned %d bytes, more than the %d of the PNG", len(data), buf.Len())
+	}
+
+	var photo bytes.Buffer
+	jpeg.Encode(&photo, img, nil)
+	data, mediaType, err = processImage(photo.Bytes(), "image/jpeg", imageOptions{Format: "webp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "image/jpeg" || !bytes.Equal(data, photo.Bytes()) {
+		t.Errorf("processImage to WebP of a JPEG = %s, %d bytes, expected the JPEG unchanged", mediaType, len(data))
+	}
+}
+
+func TestProcessImageQuality(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8(x * y), A: 255})
+		}
+	}
+	original, err := encodeImage(img, "image/jpeg", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, mediaType, err := processImage(original, "image/jpeg", imageOptions{Quality: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "image/jpeg" || len(data) >= len(original) {
+		t.Errorf("processImage at quality 30 = %s of %d bytes, expected a JPEG smaller than %d bytes", mediaType, len(data), len(original))
+	}
+	if again, _, _ := processImage(data, "image/jpeg", imageOptions{Quality: 100}); !bytes.Equal(again, data) {
+		t.Error("processImage at a higher quality replaced an image with a larger one")
+	}
+}
+
+func TestSetImageSize(t *testing.T) {
+	tests := []struct {
+		img      string
+		expected string
+	}{
+		{`<img src="a.png">`, `<img src="a.png" width="40" height="20"/>`},
+		{`<img src="a.png" width="100%">`, `<img src="a.png" width="100%"/>`},
+		{`<img src="b.svg">`, `<img src="b.svg"/>`},
+	}
+	rd := &renderer{}
+	rd.recordImageSize("OEBPS/a.png", bytes.NewReader(testPNG(t, 40, 20)))
+	rd.recordImageSize("OEBPS/b.svg", strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg"/>`))
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := findElement(doc, "img")
+		rd.setImageSize(img, "OEBPS/"+getAttr(img, "src"))
+		var out strings.Builder
+		html.Render(&out, img)
+		if out.String() != tt.expected {
+			t.Errorf("setImageSize(%q) = %q, expected %q", tt.img, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestProcessImageGrayscale(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.NRGBA{R: 100, G: 100, B: 100, A: 255})
+	img.Set(1, 0, color.NRGBA{R: 150, G: 100, B: 50, A: 255})
+	img.Set(2, 0, color.NRGBA{R: 200, G: 200, B: 200, A: 255})
+	img.Set(3, 0, color.NRGBA{}) // transparent
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data, mediaType, err := processImage(buf.Bytes(), "image/png", imageOptions{Grayscale: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil || mediaType != "image/png" {
+		t.Fatalf("processImage returned %s that does not decode: %v", mediaType, err)
+	}
+	gray, ok := decoded.(*image.Gray)
+	if !ok {
+		t.Fatalf("processImage returned a %T, expected *image.Gray", decoded)
+	}
+	// The darkest pixel becomes black and the transparent one white.
+	if expected := []uint8{0, 14, 164, 255}; !bytes.Equal(gray.Pix, expected) {
+		t.Errorf("processImage made pixels %v, expected %v", gray.Pix, expected)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"cmp"
+	"strings"
+)
+
+// bookLD is the schema.org Book description embedded as JSON-LD with
+// --json-ld. The output template marshals it into a <script> block.
+type bookLD struct {
+	Context       string     `json:"@context"`
+	Type          string     `json:"@type"`
+	Name          string     `json:"name"`
+	Alternative   string     `json:"alternativeHeadline,omitempty"`
+	Authors       []personLD `json:"author,omitempty"`
+	ISBN          string     `json:"isbn,omitempty"`
+	InLanguage    string     `json:"inLanguage,omitempty"`
+	DatePublished string     `json:"datePublished,omitempty"`
+	Publisher     *personLD  `json:"publisher,omitempty"`
+	Description   string     `json:"description,omitempty"`
+	Keywords      string     `json:"keywords,omitempty"`
+
+	AccessMode           []string `json:"accessMode,omitempty"`
+	AccessModeSufficient []string `json:"accessModeSufficient,omitempty"`
+	Features             []string `json:"accessibilityFeature,omitempty"`
+	Hazards              []string `json:"accessibilityHazard,omitempty"`
+	AccessibilitySummary string   `json:"accessibilitySummary,omitempty"`
+}
+
+// personLD is a schema.org Person or Organization.
+type personLD struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// bookJSONLD describes the book for search engines and other consumers of
+// structured data.
+func bookJSONLD(pkg *Package) *bookLD {
+	m := pkg.Metadata
+	ld := &bookLD{
+		Context:       "https://schema.org",
+		Type:          "Book",
+		Name:          cmp.Or(m.Title, bookTitle(pkg)),
+		Alternative:   m.Subtitle,
+		ISBN:          m.ISBN(),
+		DatePublished: m.Date(),
+		Description:   plainText(m.Description),
+
+		AccessMode:           m.Accessibility.AccessModes,
+		AccessModeSufficient: m.Accessibility.AccessModesSufficient,
+		Features:             m.Accessibility.Features,
+		Hazards:              m.Accessibility.Hazards,
+		AccessibilitySummary: m.Accessibility.Summary,
+	}
+	for _, author := range m.Authors() {
+		ld.Authors = append(ld.Authors, personLD{Type: "Person", Name: author})
+	}
+	if len(m.Languages) > 0 {
+		ld.InLanguage = m.Languages[0]
+	}
+	if len(m.Publishers) > 0 {
+		ld.Publisher = &personLD{Type: "Organization", Name: m.Publishers[0]}
+	}
+	if len(m.Subjects) > 0 {
+		ld.Keywords = strings.Join(m.Subjects, ", ")
+	}
+	return ld
+}
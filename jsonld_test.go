@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBookJSONLD(t *testing.T) {
+	pkg := &Package{Metadata: Metadata{
+		Title:       "Book </script>",
+		Creators:    []Contributor{{Name: "Jane Doe"}},
+		Languages:   []string{"en"},
+		Dates:       []Date{{Event: "creation", Value: "2019"}, {Event: "publication", Value: "2020-01-01"}},
+		Description: "<p>A <em>test</em> book.</p>",
+		Identifiers: []Identifier{{Scheme: "ISBN", Value: "9780000000001"}},
+	}}
+	tmpl, err := loadTemplate(&options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, TemplateData{Title: "Book", JSONLD: bookJSONLD(pkg)}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<script type="application/ld+json">{"@context":"https://schema.org","@type":"Book","name":"Book \u003c/script\u003e",` +
+		`"author":[{"@type":"Person","name":"Jane Doe"}],"isbn":"9780000000001","inLanguage":"en","datePublished":"2020-01-01",` +
+		`"description":"A test book."}</script>`
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("template output %q does not contain %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// landmarkTitles names the epub:type values that mark landmarks, the parts
+// of a book readers want to jump to, in the order they are listed.
+var landmarkTitles = []struct{ Type, Title string }{
+	{"cover", "Cover"},
+	{"titlepage", "Title Page"},
+	{"toc", "Table of Contents"},
+	{"frontmatter", "Front Matter"},
+	{"preface", "Preface"},
+	{"bodymatter", "Start of Content"},
+	{"backmatter", "Back Matter"},
+	{"loi", "List of Illustrations"},
+	{"lot", "List of Tables"},
+	{"glossary", "Glossary"},
+	{"bibliography", "Bibliography"},
+	{"index", "Index"},
+}
+
+// guideTypes maps the reference types of the EPUB 2 guide to the matching
+// epub:type values.
+var guideTypes = map[string]string{
+	"cover":        "cover",
+	"title-page":   "titlepage",
+	"toc":          "toc",
+	"preface":      "preface",
+	"text":         "bodymatter",
+	"loi":          "loi",
+	"lot":          "lot",
+	"glossary":     "glossary",
+	"bibliography": "bibliography",
+	"index":        "index",
+}
+
+// landmarkTitle returns the title of a landmark type, or "" if the type is
+// not a landmark.
+func landmarkTitle(epubType string) string {
+	for _, l := range landmarkTitles {
+		if l.Type == epubType {
+			return l.Title
+		}
+	}
+	return ""
+}
+
+// markLandmark records the first element of every landmark type found in
+// the chapters, such as <body epub:type="bodymatter"> or <section
+// epub:type="index">, giving it an ID to link to if it has none. The body
+// is linked through the ID of its chapter.
+func (a *anchors) markLandmark(n *html.Node, ch Chapter, taken map[string]bool) {
+	for _, t := range strings.Fields(getAttr(n, "epub:type")) {
+		title := landmarkTitle(t)
+		if _, ok := a.landmarks[t]; ok || title == "" {
+			continue
+		}
+		href := "#" + chapterID(ch)
+		if n.Data != "body" && n.Data != "html" {
+			id := getAttr(n, "id")
+			if id == "" {
+				id = uniqueID(taken, t)
+				taken[id] = true
+				n.Attr = append(n.Attr, html.Attribute{Key: "id", Val: id})
+			}
+			href = "#" + a.id(ch.Path, id)
+		}
+		a.landmarks[t] = TOCEntry{Title: title, Href: href}
+	}
+}
+
+// typeLandmarks returns the landmarks found by markLandmark in the order
+// of landmarkTitles.
+func (a *anchors) typeLandmarks() []TOCEntry {
+	var entries []TOCEntry
+	for _, l := range landmarkTitles {
+		if entry, ok := a.landmarks[l.Type]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// guideLandmarks turns the references of the EPUB 2 guide into links
+// within the output. References of unknown types keep their own title and
+// references to documents left out are dropped.
+func guideLandmarks(pkg *Package, a *anchors) []TOCEntry {
+	var entries []TOCEntry
+	for _, ref := range pkg.Guide {
+		file, fragment, _ := strings.Cut(ref.Href, "#")
+		href, ok := a.targetHref(resolveEpubPath(pkg.OpfDir, file), fragment)
+		if !ok {
+			continue
+		}
+		title := landmarkTitle(guideTypes[ref.Type])
+		if title == "" {
+			title = strings.TrimSpace(ref.Title)
+		}
+		if title == "" {
+			continue
+		}
+		entries = append(entries, TOCEntry{Title: title, Href: href})
+	}
+	return entries
+}
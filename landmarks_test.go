@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestTypeLandmarks(t *testing.T) {
+	var chapters []Chapter
+	for i, doc := range []string{
+		`<body epub:type="frontmatter"><p>Title</p></body>`,
+		`<body epub:type="bodymatter"><section epub:type="index"><p>Index</p></section><section id="more" epub:type="index"></section></body>`,
+		`<body><div id="idx" epub:type="glossary"></div></body>`,
+	} {
+		n, err := html.Parse(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chapters = append(chapters, Chapter{Index: i, Path: []string{"a.xhtml", "b.xhtml", "c.xhtml"}[i], Doc: n})
+	}
+	a := newAnchors(chapters)
+	expected := []TOCEntry{
+		{Title: "Front Matter", Href: "#ch1"},
+		{Title: "Start of Content", Href: "#ch2"},
+		{Title: "Glossary", Href: "#idx"},
+		{Title: "Index", Href: "#index"},
+	}
+	if landmarks := a.typeLandmarks(); !reflect.DeepEqual(landmarks, expected) {
+		t.Errorf("typeLandmarks = %+v, expected %+v", landmarks, expected)
+	}
+	if section := findElement(chapters[1].Doc, "section"); getAttr(section, "id") != "index" {
+		t.Errorf("markLandmark gave the index the ID %q, expected \"index\"", getAttr(section, "id"))
+	}
+}
+
+func TestGuideLandmarks(t *testing.T) {
+	pkg := &Package{OpfDir: "OEBPS", Guide: []Reference{
+		{Type: "text", Title: "Beginning", Href: "Text/ch1.xhtml"},
+		{Type: "other.ad", Title: "Other books", Href: "Text/ch2.xhtml#ads"},
+		{Type: "cover", Title: "Cover", Href: "Text/cover.xhtml"},
+	}}
+	a := &anchors{chapters: map[string]string{"OEBPS/Text/ch1.xhtml": "ch1", "OEBPS/Text/ch2.xhtml": "ch2"}}
+	expected := []TOCEntry{
+		{Title: "Start of Content", Href: "#ch1"},
+		{Title: "Other books", Href: "#ads"},
+	}
+	if landmarks := guideLandmarks(pkg, a); !reflect.DeepEqual(landmarks, expected) {
+		t.Errorf("guideLandmarks = %+v, expected %+v", landmarks, expected)
+	}
+}
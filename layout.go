@@ -0,0 +1,302 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// defaultTemplate reproduces the plain document layout used when no
+// --template is given.
+const defaultTemplate = `<!DOCTYPE html>
+<html{{with .Lang}} lang="{{.}}"{{end}}{{with .Dir}} dir="{{.}}"{{end}}>
+<head>
+{{with .Charset}}<meta charset="{{.}}">
+{{end}}{{with .Viewport}}<meta name="viewport" content="{{.}}">
+{{end}}<title>{{.Title}}</title>
+{{range .MetaTags}}<meta {{with .Name}}name="{{.}}"{{else}}property="{{.Property}}"{{end}} content="{{.Content}}">
+{{end}}{{with .JSONLD}}<script type="application/ld+json">{{.}}</script>
+{{end}}{{range .Scripts}}<script{{with .Src}} src="{{.}}" defer{{end}}>{{.Code}}</script>
+{{end}}{{with .Stylesheet}}<link rel="stylesheet" href="{{.}}">
+{{end}}{{with .CSS}}<style>
+{{.}}
+</style>
+{{end}}</head>
+<body>
+{{with .Symbols}}{{.}}
+{{end}}{{with .Cover}}{{.}}
+<hr class="chapter-break" />
+{{end}}{{with .Nav}}{{.}}
+<hr class="chapter-break" />
+{{end}}{{range .Chapters}}<a id="{{.ID}}"></a>{{.Body}}
+<hr class="chapter-break" />
+{{end}}</body>
+</html>
+`
+
+// minifiedTemplate is the default layout for --minify. It leaves out every
+// tag and end tag HTML allows to be omitted.
+const minifiedTemplate = `<!DOCTYPE html>{{if or .Lang .Dir}}<html{{with .Lang}} lang="{{.}}"{{end}}{{with .Dir}} dir="{{.}}"{{end}}>{{end}}{{with .Charset}}<meta charset={{.}}>{{end}}{{with .Viewport}}<meta name=viewport content="{{.}}">{{end}}<title>{{.Title}}</title>{{range .MetaTags}}<meta {{with .Name}}name={{.}}{{else}}property={{.Property}}{{end}} content="{{.Content}}">{{end}}{{with .JSONLD}}<script type=application/ld+json>{{.}}</script>{{end}}{{range .Scripts}}<script{{with .Src}} src="{{.}}" defer{{end}}>{{.Code}}</script>{{end}}{{with .Stylesheet}}<link rel=stylesheet href="{{.}}">{{end}}{{with .CSS}}<style>{{.}}</style>{{end}}{{.Symbols}}{{with .Cover}}{{.}}<hr class=chapter-break>{{end}}{{with .Nav}}{{.}}<hr class=chapter-break>{{end}}{{range .Chapters}}<a id={{.ID}}></a>{{.Body}}<hr class=chapter-break>{{end}}`
+
+// TemplateData is the value passed to the output template.
+type TemplateData struct {
+	Title      string
+	Lang       string // language of the book, for the lang attribute of <html>
+	Dir        string // text direction of the book, ltr or rtl, if it gives one
+	Charset    string // declared output encoding, empty for the UTF-8 default
+	Viewport   string // content of the viewport <meta> tag, set by --responsive
+	Metadata   Metadata
+	MetaTags   []MetaTag     // author, description and Open Graph tags of the head
+	JSONLD     *bookLD       // schema.org description of the book, set by --json-ld
+	Scripts    []Script      // scripts rendering the formulas, set by --math, and playing --read-along audio
+	Provenance Provenance    // the EPUB and converter the output came from
+	Rendition  Rendition     // fixed-layout properties of the book, if any
+	CSS        template.CSS  // stylesheets of the book and the styling options, if any
+	Stylesheet string        // href of the stylesheet written by --external-css
+	Cover      template.HTML // cover page shown before the first chapter, if any
+	Symbols    template.HTML // hidden <svg> holding the images shown more than once, if any
+	TOC        []TOCEntry
+	Landmarks  []TOCEntry    // landmarks of the EPUB 3 navigation document, if any
+	Pages      []TOCEntry    // print pages of the book's page list, if any
+	Nav        template.HTML // table of contents shown at the top with --toc, if any
+	Chapters   []ChapterData
+
+	missingAlt []missingAlt    // images without alt text, for --alt-report
+	stats      conversionStats // counts of the converted book, for --metadata-out
+	streamed   []*zip.File     // entries the stream markers in the bodies stand for
+	spool      *chapterSpool   // the chapters the chapter markers of the bodies stand for, if spooled
+}
+
+// ChapterData is a rendered chapter. Links to the start of a chapter point
+// at its ID, which the default layout puts on an empty anchor before the
+// body; custom templates should wrap each body in an element carrying it,
+// e.g. <section id="{{.ID}}">.
+type ChapterData struct {
+	ID    string
+	Title string
+	Body  template.HTML
+}
+
+// TOCEntry is one entry of the table of contents.
+type TOCEntry struct {
+	Title    string
+	Href     string
+	Children []TOCEntry
+}
+
+// loadTemplate parses the user-supplied layout, or the default one when no
+// --template is given.
+func loadTemplate(opts *options) (*template.Template, error) {
+	path := opts.TemplatePath
+	if path == "" {
+		layout := defaultTemplate
+		if opts.Minify {
+			layout = minifiedTemplate
+		}
+		return template.New("default").Parse(layout)
+	}
+	tmpl, err := template.New(filepath.Base(path)).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// buildTemplateData renders every spine item and gathers everything the
+// output template needs.
+func buildTemplateData(pkg *Package, r *epubArchive, opts *options) TemplateData {
+	rd := newRenderer(pkg, r, opts)
+
+	data := TemplateData{
+		Title:     bookTitle(pkg),
+		Lang:      bookLanguage(pkg),
+		Dir:       bookDirection(pkg),
+		Metadata:  pkg.Metadata,
+		Rendition: rd.rendition,
+	}
+	chapters := loadChapters(pkg, r)
+	var copyright []string
+	if opts.RightsFooter {
+		copyright = copyrightLines(pkg, r, chapters)
+	}
+	chapters = readingOrder(chapters, opts.IncludeNonLinear)
+	if opts.StartAt != "" {
+		chapters = startAt(pkg, r, chapters, opts.StartAt)
+	}
+	if opts.BodyOnly {
+		chapters = bodyOnly(chapters)
+	}
+	sampled := false
+	if opts.SampleChapters > 0 || opts.SamplePercent > 0 {
+		chapters, sampled = sample(chapters, opts.SampleChapters, opts.SamplePercent)
+	}
+	rd.anchors = newAnchors(chapters)
+	data.stats = bookStats(chapters)
+	pages := readPageList(r, pkg)
+	data.Pages = pageList(pages, rd.anchors)
+	if opts.PageNumbers {
+		rd.pages = pagesByPath(pages)
+	}
+	if opts.ReadAlong {
+		rd.overlays = readOverlays(r, pkg)
+	}
+	if opts.SubsetFonts {
+		rd.fontChars = bookChars(chapters)
+	}
+	if !opts.NoImages {
+		rd.prescanImages(chapters)
+		if opts.Jobs > 1 {
+			rd.images = rd.startImagePool(rd.imageOrder, opts.Jobs)
+			defer rd.images.stop()
+		}
+		if !opts.NoCover {
+			data.Cover = template.HTML(rd.coverPage(pkg, chapters))
+		}
+	}
+	data.MetaTags = rd.metaTags(pkg)
+	if opts.JSONLD {
+		data.JSONLD = bookJSONLD(pkg)
+	}
+	if opts.TitlePage {
+		data.Chapters = append(data.Chapters, rd.titlePageChapter(pkg))
+	}
+	for _, warning := range propertyWarnings(chapters, opts) {
+		log.Printf("Warning: %s", warning)
+	}
+	titles := guideTitles(pkg)
+	if spool, err := newChapterSpool(); err == nil {
+		data.spool = spool
+	} else {
+		log.Printf("Warning: Keeping the rendered chapters in memory: %v", err)
+	}
+	for i, ch := range chapters {
+		if ch.NonLinear && (i == 0 || !chapters[i-1].NonLinear) {
+			data.Chapters = append(data.Chapters, rd.appendixChapter())
+		}
+		title := chapterTitle(ch)
+		if chapterHeading(ch) == nil && titles[ch.Path] != "" {
+			title = titles[ch.Path]
+		}
+		var body template.HTML
+		if data.spool != nil {
+			body = data.spool.add(func(w io.StringWriter) { rd.renderChapter(ch, w) })
+		} else {
+			var b strings.Builder
+			rd.renderChapter(ch, &b)
+			body = template.HTML(b.String())
+		}
+		// Nothing needs the document once it is rendered.
+		chapters[i].Doc = nil
+		data.Chapters = append(data.Chapters, ChapterData{
+			ID:    chapterID(ch),
+			Title: title,
+			Body:  body,
+		})
+	}
+	if sampled {
+		data.Chapters = append(data.Chapters, rd.sampleEndChapter())
+	}
+	if len(rd.figures) > 0 {
+		data.Chapters = append(data.Chapters, rd.illustrationsChapter())
+	}
+	if opts.RightsFooter {
+		data.Chapters = append(data.Chapters, rd.rightsChapter(pkg, copyright))
+	}
+	data.Symbols = template.HTML(rd.imageSymbolsHTML())
+	data.TOC = chapterTOC(data.Chapters)
+	toc, landmarks := bookTOC(pkg, r, rd.anchors, opts.TOCDepth)
+	if len(toc) > 0 {
+		data.TOC = toc
+	}
+	// Books without landmarks in their navigation document may list them
+	// in the EPUB 2 guide or only mark them with epub:type. EPUB 2 books
+	// list them in the guide first.
+	if guide := guideLandmarks(pkg, rd.anchors); len(guide) > 0 && (len(landmarks) == 0 || isEPUB2(pkg)) {
+		landmarks = guide
+	}
+	if len(landmarks) == 0 {
+		landmarks = rd.anchors.typeLandmarks()
+	}
+	data.Landmarks = landmarks
+	switch {
+	case opts.TOC:
+		data.Nav = rd.tocNav(data.TOC, data.Landmarks)
+	case len(data.Landmarks) > 0:
+		data.Nav = rd.tocNav(nil, data.Landmarks)
+	}
+	if rd.formulas > 0 {
+		data.Scripts = mathScripts(opts.Math)
+	}
+	if rd.players > 0 {
+		data.Scripts = append(data.Scripts, Script{Code: readAlongScript})
+	}
+	if rd.mathNoImage > 0 {
+		log.Printf("Warning: %d formulas have no altimg image; keeping them as MathML", rd.mathNoImage)
+	}
+	data.missingAlt = rd.missingAlt
+	data.stats.Images = len(rd.imageSizes)
+	data.streamed = rd.streamed
+	var css string
+	if opts.Responsive {
+		data.Viewport = "width=device-width, initial-scale=1"
+		css = responsiveCSS
+	}
+	switch {
+	case opts.InlineCSS:
+		css = appendCSS(css, rd.combinedCSS())
+	case opts.EmbedFonts:
+		css = appendCSS(css, rd.fontFaceCSS())
+	}
+	if opts.Layout == "sidebar" {
+		css = appendCSS(css, sidebarCSS)
+	}
+	if opts.PageNumbers {
+		css = appendCSS(css, pageNumberCSS)
+	}
+	if opts.TitlePage {
+		css = appendCSS(css, titlePageCSS)
+	}
+	if rd.players > 0 {
+		css = appendCSS(css, readAlongCSS)
+	}
+	if rd.svgPages > 0 {
+		css = appendCSS(css, svgPageCSS)
+	}
+	if rd.formulas > 0 && opts.Math == "katex" {
+		// @import must come before the other rules.
+		css = appendCSS(`@import url("`+katexCSSURL+`");`, css)
+	}
+	css = appendCSS(css, themeCSS(opts.Theme))
+	if opts.PrintCSS {
+		css = appendCSS(css, printCSS)
+	}
+	data.CSS = template.CSS(css)
+	return data
+}
+
+// chapterID returns the ID the output gives the start of a chapter.
+func chapterID(ch Chapter) string {
+	return fmt.Sprintf("ch%d", ch.Index+1)
+}
+
+// chapterIDs maps the archive paths of the chapters to their IDs.
+func chapterIDs(chapters []Chapter) map[string]string {
+	ids := make(map[string]string, len(chapters))
+	for _, ch := range chapters {
+		ids[ch.Path] = chapterID(ch)
+	}
+	return ids
+}
+
+// chapterTOC builds a flat table of contents with one entry per chapter.
+func chapterTOC(chapters []ChapterData) []TOCEntry {
+	toc := make([]TOCEntry, 0, len(chapters))
+	for _, ch := range chapters {
+		toc = append(toc, TOCEntry{Title: ch.Title, Href: "#" + ch.ID})
+	}
+	return toc
+}
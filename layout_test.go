@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTemplate(t *testing.T) {
+	data := TemplateData{
+		Title: "A & B",
+		Chapters: []ChapterData{
+			{ID: "ch1", Title: "One", Body: "<p>First</p>"},
+			{ID: "ch2", Title: "Two", Body: "<p>Second</p>"},
+		},
+	}
+	data.TOC = chapterTOC(data.Chapters)
+
+	tmpl, err := loadTemplate(&options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<!DOCTYPE html>\n<html>\n<head>\n<title>A &amp; B</title>\n</head>\n<body>\n" +
+		"<a id=\"ch1\"></a><p>First</p>\n<hr class=\"chapter-break\" />\n<a id=\"ch2\"></a><p>Second</p>\n<hr class=\"chapter-break\" />\n</body>\n</html>\n"
+	if out.String() != expected {
+		t.Errorf("default template output = %q, expected %q", out.String(), expected)
+	}
+
+	path := filepath.Join(t.TempDir(), "custom.tmpl")
+	custom := `{{range .TOC}}<a href="{{.Href}}">{{.Title}}</a>{{end}}{{range .Chapters}}<section id="{{.ID}}">{{.Body}}</section>{{end}}`
+	if err := os.WriteFile(path, []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err = loadTemplate(&options{TemplatePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := tmpl.Execute(&out, data); err != nil {
+		t.Fatal(err)
+	}
+	expected = `<a href="#ch1">One</a><a href="#ch2">Two</a>` +
+		`<section id="ch1"><p>First</p></section><section id="ch2"><p>Second</p></section>`
+	if out.String() != expected {
+		t.Errorf("custom template output = %q, expected %q", out.String(), expected)
+	}
+}
+
+func TestTemplateLangDir(t *testing.T) {
+	data := TemplateData{Title: "Book", Lang: "he", Dir: "rtl"}
+	tests := []struct {
+		opts     *options
+		expected string
+	}{
+		{&options{}, "<!DOCTYPE html>\n<html lang=\"he\" dir=\"rtl\">\n<head>"},
+		{&options{Minify: true}, `<!DOCTYPE html><html lang="he" dir="rtl"><title>`},
+	}
+	for _, tt := range tests {
+		tmpl, err := loadTemplate(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, data); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out.String(), tt.expected) {
+			t.Errorf("template output %q, expected it to start with %q", out.String(), tt.expected)
+		}
+	}
+}
+
+// syntheticBook builds an EPUB of the given number of chapters, each a few
+// pages of headings, paragraphs, links and notes, with the given number of
+// images spread over them, for benchmarking large books. It silences the
+// log, which would otherwise get a line per chapter and iteration.
+func syntheticBook(b *testing.B, chapters, images int) (*Package, *epubArchive) {
+	b.Helper()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	files := map[string][]byte{}
+	var manifest, spine strings.Builder
+	for i := 0; i < images; i++ {
+		files[fmt.Sprintf("OEBPS/images/img%d.png", i)] = testPNG(b, 200+i%50, 150)
+		fmt.Fprintf(&manifest, `<item id="img%d" href="images/img%d.png" media-type="image/png"/>`, i, i)
+	}
+	for i := 0; i < chapters; i++ {
+		var page strings.Builder
+		fmt.Fprintf(&page, `<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Chapter %d</title></head><body><h1 id="top">Chapter %d</h1>`, i+1, i+1)
+		for p := 0; p < 40; p++ {
+			fmt.Fprintf(&page, `<p class="text">Paragraph %d of chapter %d, with <em>emphasis</em>, a <a href="ch%d.xhtml#top">link to the next chapter</a> and a note<a href="#n%d">%d</a>.</p>`, p, i, (i+1)%chapters, p, p)
+			if images > 0 && p%10 == 0 {
+				img := (i*4 + p/10) % images
+				fmt.Fprintf(&page, `<figure><img src="images/img%d.png" alt="Figure %d"/><figcaption>Figure %d</figcaption></figure>`, img, img, img)
+			}
+		}
+		page.WriteString(`<aside id="n0">The note.</aside></body></html>`)
+		files[fmt.Sprintf("OEBPS/ch%d.xhtml", i)] = []byte(page.String())
+		fmt.Fprintf(&manifest, `<item id="ch%d" href="ch%d.xhtml" media-type="application/xhtml+xml"/>`, i, i)
+		fmt.Fprintf(&spine, `<itemref idref="ch%d"/>`, i)
+	}
+	files["OEBPS/content.opf"] = []byte(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0"><metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Benchmark</dc:title></metadata><manifest>` +
+		manifest.String() + `</manifest><spine>` + spine.String() + `</spine></package>`)
+	r := openTestArchive(b, files)
+	pkg, err := parseOpf(r, "OEBPS/content.opf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return pkg, r
+}
+
+func BenchmarkConvert(b *testing.B) {
+	tmpl, err := loadTemplate(&options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarks := []struct {
+		name             string
+		chapters, images int
+		opts             options
+	}{
+		{"chapters=500", 500, 0, options{Jobs: 1}},
+		{"chapters=500/inline-css", 500, 0, options{Jobs: 1, InlineCSS: true}},
+		{"images=200/jobs=1", 50, 200, options{Jobs: 1}},
+		{"images=200/jobs=8", 50, 200, options{Jobs: 8}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			pkg, r := syntheticBook(b, bm.chapters, bm.images)
+			for b.Loop() {
+				data := buildTemplateData(pkg, r, &bm.opts)
+				w := bufio.NewWriter(newStreamWriter(io.Discard, data.streamed, data.spool))
+				if err := tmpl.Execute(w, data); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Flush(); err != nil {
+					b.Fatal(err)
+				}
+				data.spool.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkRenderChapter(b *testing.B) {
+	pkg, r := syntheticBook(b, 1, 4)
+	chapters := loadChapters(pkg, r)
+	rd := newRenderer(pkg, r, &options{Jobs: 1})
+	rd.anchors = newAnchors(chapters)
+	for b.Loop() {
+		var out strings.Builder
+		rd.renderChapter(chapters[0], &out)
+	}
+}
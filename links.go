@@ -0,0 +1,199 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// idRefAttrs lists the attributes, besides href, that refer to elements by
+// their IDs, as space-separated lists.
+var idRefAttrs = map[string]bool{
+	"for":              true,
+	"headers":          true,
+	"list":             true,
+	"aria-controls":    true,
+	"aria-describedby": true,
+	"aria-labelledby":  true,
+	"aria-owns":        true,
+}
+
+// anchors locates the chapters of the book and the elements within them in
+// the merged output.
+type anchors struct {
+	chapters map[string]string            // IDs of the chapters by archive path
+	renamed  map[string]map[string]string // IDs changed to keep them unique, by archive path
+
+	landmarks map[string]TOCEntry // first element of each landmark type, see markLandmark
+}
+
+// newAnchors gives every chapter an ID and renames the element IDs that
+// are already taken by an earlier chapter, such as the "page1" many books
+// start each chapter with, to "chN-page1". IDs inside SVG drawings are left
+// alone, as they are referenced in ways that are not rewritten. Headings
+// without an ID get one made from their text, so that any section can be
+// linked to, and the landmarks marked with epub:type are recorded.
+func newAnchors(chapters []Chapter) *anchors {
+	a := &anchors{
+		chapters:  chapterIDs(chapters),
+		renamed:   make(map[string]map[string]string),
+		landmarks: make(map[string]TOCEntry),
+	}
+	taken := map[string]bool{illustrationsID: true, appendixID: true, sampleEndID: true, titlePageID: true, rightsID: true}
+	for _, id := range a.chapters {
+		taken[id] = true
+	}
+	for _, ch := range chapters {
+		own := make(map[string]bool)
+		renamed := make(map[string]string)
+		a.renamed[ch.Path] = renamed
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.Data == "svg" {
+				return
+			}
+			if n.Type == html.ElementNode && isHeading(n.Data) && getAttr(n, "id") == "" {
+				id := uniqueID(taken, headingSlug(textContent(n)))
+				n.Attr = append(n.Attr, html.Attribute{Key: "id", Val: id})
+				own[id] = true
+				taken[id] = true
+			}
+			if id := getAttr(n, "id"); id != "" && !own[id] {
+				own[id] = true
+				if taken[id] {
+					unique := uniqueID(taken, chapterID(ch)+"-"+id)
+					renamed[id] = unique
+					id = unique
+				}
+				taken[id] = true
+			}
+			if n.Type == html.ElementNode {
+				a.markLandmark(n, ch, taken)
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(ch.Doc)
+		if len(renamed) == 0 {
+			delete(a.renamed, ch.Path)
+		}
+	}
+	return a
+}
+
+// uniqueID returns id, or if it is taken id with the lowest number
+// appended that makes it unique.
+func uniqueID(taken map[string]bool, id string) string {
+	unique := id
+	for i := 2; taken[unique]; i++ {
+		unique = id + "-" + strconv.Itoa(i)
+	}
+	return unique
+}
+
+// headingSlug derives an ID from the text of a heading: its letters and
+// digits in lower case, with dashes between words, e.g. "chapter-1-the-end"
+// for "Chapter 1: The End".
+func headingSlug(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// id returns the ID an element of the document at docPath has in the
+// output.
+func (a *anchors) id(docPath, id string) string {
+	if a == nil {
+		return id
+	}
+	if renamed, ok := a.renamed[docPath][id]; ok {
+		return renamed
+	}
+	return id
+}
+
+// href turns a link to a document of the book, found in the document at
+// docPath, into a link within the output: to the ID of the chapter it
+// points at, or to the element it names. It returns false for documents
+// that are not part of the output.
+func (a *anchors) href(docPath, href string) (string, bool) {
+	return a.targetHref(resolveHref(docPath, href))
+}
+
+// resolveHref splits a link found in the document at docPath into the
+// archive path of the document it points at and the fragment naming an
+// element in it, if any.
+func resolveHref(docPath, href string) (target, fragment string) {
+	file, fragment, _ := strings.Cut(href, "#")
+	if file == "" {
+		return docPath, fragment
+	}
+	return resolveEpubPath(epubDir(docPath), file), fragment
+}
+
+// targetHref returns the link within the output to the element with the
+// given ID in the document at archive path target, or to the start of the
+// document if the ID is empty.
+func (a *anchors) targetHref(target, fragment string) (string, bool) {
+	id, ok := a.chapters[target]
+	if !ok {
+		return "", false
+	}
+	if fragment != "" {
+		id = a.id(target, fragment)
+	}
+	return "#" + id, true
+}
+
+// rewriteLinks updates the IDs of an element and its references to other
+// elements for the merged output. Links to other chapters, such as
+// footnote references, are pointed at the place the chapter ended up in;
+// links to the web and to documents left out are kept.
+func (rd *renderer) rewriteLinks(n *html.Node, contentFilePath string) {
+	if rd.anchors == nil {
+		return
+	}
+	for i, attr := range n.Attr {
+		switch {
+		case attr.Namespace != "" || attr.Val == "":
+		case attr.Key == "id":
+			n.Attr[i].Val = rd.anchors.id(contentFilePath, attr.Val)
+		case attr.Key == "href" && (n.Data == "a" || n.Data == "area") && !isExternalHref(attr.Val):
+			if href, ok := rd.anchors.href(contentFilePath, attr.Val); ok {
+				n.Attr[i].Val = href
+			}
+		case idRefAttrs[attr.Key]:
+			ids := strings.Fields(attr.Val)
+			for j, id := range ids {
+				ids[j] = rd.anchors.id(contentFilePath, id)
+			}
+			n.Attr[i].Val = strings.Join(ids, " ")
+		}
+	}
+}
+
+// isHeading reports whether tag is one of the HTML heading elements.
+func isHeading(tag string) bool {
+	switch tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestNewAnchors(t *testing.T) {
+	var chapters []Chapter
+	for i, body := range []string{
+		`<p id="page1">One</p><p id="n1">Note</p><svg><g id="page1"/></svg>`,
+		`<p id="page1">Two</p><p id="ch1">Clash</p><p id="page1">Twice</p><h2>One</h2><h2>One</h2>`,
+	} {
+		doc, err := html.Parse(strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chapters = append(chapters, Chapter{Index: i, Path: []string{"OEBPS/one.xhtml", "OEBPS/two.xhtml"}[i], Doc: doc})
+	}
+	a := newAnchors(chapters)
+	var headings []string
+	for h := findElement(chapters[1].Doc, "h2"); h != nil; h = nextElementSibling(h) {
+		headings = append(headings, getAttr(h, "id"))
+	}
+	if expected := []string{"one", "one-2"}; strings.Join(headings, " ") != strings.Join(expected, " ") {
+		t.Errorf("newAnchors gave headings the IDs %q, expected %q", headings, expected)
+	}
+	tests := []struct {
+		docPath, id string
+		expected    string
+	}{
+		{"OEBPS/one.xhtml", "page1", "page1"},
+		{"OEBPS/one.xhtml", "n1", "n1"},
+		{"OEBPS/two.xhtml", "page1", "ch2-page1"},
+		{"OEBPS/two.xhtml", "ch1", "ch2-ch1"},
+	}
+	for _, tt := range tests {
+		if id := a.id(tt.docPath, tt.id); id != tt.expected {
+			t.Errorf("id(%q, %q) = %q, expected %q", tt.docPath, tt.id, id, tt.expected)
+		}
+	}
+}
+
+func TestRewriteLinks(t *testing.T) {
+	rd := &renderer{anchors: &anchors{
+		chapters: map[string]string{
+			"OEBPS/Text/ch1.xhtml":   "ch1",
+			"OEBPS/Text/notes.xhtml": "ch2",
+		},
+		renamed: map[string]map[string]string{
+			"OEBPS/Text/ch1.xhtml":   {"page1": "ch1-page1"},
+			"OEBPS/Text/notes.xhtml": {"note3": "ch2-note3"},
+		},
+	}}
+	tests := []struct {
+		link     string
+		expected string
+	}{
+		{`<a href="notes.xhtml#note3">3</a>`, `<a href="#ch2-note3">3</a>`},
+		{`<a href="notes.xhtml#note4">4</a>`, `<a href="#note4">4</a>`},
+		{`<a href="../Text/notes.xhtml">Notes</a>`, `<a href="#ch2">Notes</a>`},
+		{`<a href="#page1" id="page1">here</a>`, `<a href="#ch1-page1" id="ch1-page1">here</a>`},
+		{`<a href="ch1.xhtml#sec2">here</a>`, `<a href="#sec2">here</a>`},
+		{`<a href="https://example.com/notes.xhtml">web</a>`, `<a href="https://example.com/notes.xhtml">web</a>`},
+		{`<a href="cover.xhtml">cover</a>`, `<a href="cover.xhtml">cover</a>`},
+		{`<a aria-describedby="page1 other">x</a>`, `<a aria-describedby="ch1-page1 other">x</a>`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.link))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := findElement(doc, "a")
+		rd.rewriteLinks(a, "OEBPS/Text/ch1.xhtml")
+		var out strings.Builder
+		html.Render(&out, a)
+		if out.String() != tt.expected {
+			t.Errorf("rewriteLinks(%q) = %q, expected %q", tt.link, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestHeadingSlug(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"Chapter 1: The End", "chapter-1-the-end"},
+		{"  Über  Größe ", "über-größe"},
+		{"«  »", "section"},
+	}
+	for _, tt := range tests {
+		if slug := headingSlug(tt.text); slug != tt.expected {
+			t.Errorf("headingSlug(%q) = %q, expected %q", tt.text, slug, tt.expected)
+		}
+	}
+}
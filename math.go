@@ -0,0 +1,104 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// mathMLNamespace is the namespace of MathML formulas.
+const mathMLNamespace = "http://www.w3.org/1998/Math/MathML"
+
+// The scripts --math loads to render formulas in browsers without MathML
+// support, or with KaTeX's typesetting.
+const (
+	mathJaxURL  = "https://cdn.jsdelivr.net/npm/mathjax@3/es5/mml-chtml.js"
+	katexURL    = "https://cdn.jsdelivr.net/npm/katex@0.16/dist/katex.min.js"
+	katexCSSURL = "https://cdn.jsdelivr.net/npm/katex@0.16/dist/katex.min.css"
+)
+
+// katexRender replaces the formulas that carry their TeX source in an
+// annotation, as formulas converted from LaTeX do, with their KaTeX
+// rendering. KaTeX cannot read MathML, so the others are left to the
+// browser.
+const katexRender = `document.addEventListener("DOMContentLoaded", function () {
+  document.querySelectorAll("math").forEach(function (m) {
+    var tex = m.querySelector('annotation[encoding="application/x-tex"]');
+    if (!tex) return;
+    var span = document.createElement("span");
+    katex.render(tex.textContent, span, {displayMode: m.getAttribute("display") === "block", throwOnError: false});
+    m.replaceWith(span);
+  });
+});`
+
+// Script is a <script> of the output head, loaded from Src or holding Code.
+type Script struct {
+	Src  string
+	Code template.JS
+}
+
+// mathScripts returns the scripts --math adds to books with formulas.
+func mathScripts(mode string) []Script {
+	switch mode {
+	case "mathjax":
+		return []Script{{Src: mathJaxURL}}
+	case "katex":
+		return []Script{{Src: katexURL}, {Code: katexRender}}
+	}
+	return nil
+}
+
+// normalizeMathML turns formulas written with a namespace prefix, such as
+// <m:math xmlns:m="http://www.w3.org/1998/Math/MathML">, which HTML parses
+// as unknown elements, into plain MathML elements.
+func normalizeMathML(n *html.Node) {
+	if n.Type == html.ElementNode {
+		prefix, name, ok := strings.Cut(n.Data, ":")
+		if ok && name == "math" && getAttr(n, "xmlns:"+prefix) == mathMLNamespace {
+			unprefixMathML(n, prefix+":")
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		normalizeMathML(c)
+	}
+}
+
+// unprefixMathML strips prefix from the names of n and the elements below
+// it and puts them in the MathML namespace.
+func unprefixMathML(n *html.Node, prefix string) {
+	if n.Type == html.ElementNode {
+		if name, ok := strings.CutPrefix(n.Data, prefix); ok {
+			n.Data, n.DataAtom, n.Namespace = name, atom.Lookup([]byte(name)), "math"
+		}
+		attrs := n.Attr[:0]
+		for _, attr := range n.Attr {
+			if attr.Key != "xmlns:"+strings.TrimSuffix(prefix, ":") {
+				attrs = append(attrs, attr)
+			}
+		}
+		n.Attr = attrs
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		unprefixMathML(c, prefix)
+	}
+}
+
+// mathImage turns a formula into an <img> of the image the book provides
+// for it in its altimg attribute, for --math image, with its alttext as
+// the alt text. It reports false if the formula has no image.
+func mathImage(n *html.Node) bool {
+	src := getAttr(n, "altimg")
+	if src == "" {
+		return false
+	}
+	alt := getAttr(n, "alttext")
+	n.Data, n.DataAtom, n.Namespace = "img", atom.Img, ""
+	n.Attr = []html.Attribute{{Key: "src", Val: src}, {Key: "alt", Val: alt}}
+	for n.FirstChild != nil {
+		n.RemoveChild(n.FirstChild)
+	}
+	return true
+}
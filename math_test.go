@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestNormalizeMathML(t *testing.T) {
+	input := `<p><m:math xmlns:m="http://www.w3.org/1998/Math/MathML" display="block"><m:mi>x</m:mi><m:mo>=</m:mo><m:mn>1</m:mn></m:math>` +
+		`<x:math xmlns:x="urn:other"><x:mi>y</x:mi></x:math></p>`
+	doc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalizeMathML(doc)
+	var out strings.Builder
+	renderNodeRaw(findElement(doc, "p"), &out)
+	expected := `<p><math display="block"><mi>x</mi><mo>=</mo><mn>1</mn></math><x:math xmlns:x="urn:other"><x:mi>y</x:mi></x:math></p>`
+	if out.String() != expected {
+		t.Errorf("normalizeMathML(%q) = %q, expected %q", input, out.String(), expected)
+	}
+}
+
+func TestMathImage(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{`<math altimg="../images/eq1.png" alttext="x = 1"><mi>x</mi></math>`, `<img src="../images/eq1.png" alt="x = 1">`, true},
+		{`<math><mi>x</mi></math>`, `<math><mi>x</mi></math>`, false},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := findElement(doc, "math")
+		ok := mathImage(n)
+		var out strings.Builder
+		renderNodeRaw(n, &out)
+		if out.String() != tt.expected || ok != tt.ok {
+			t.Errorf("mathImage(%q) = %q, %v, expected %q, %v", tt.input, out.String(), ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestMathScriptsTemplate(t *testing.T) {
+	tests := []struct {
+		opts     *options
+		expected string
+	}{
+		{&options{Math: "mathjax"}, `<script src="` + mathJaxURL + `" defer></script>`},
+		{&options{Math: "katex"}, `<script src="` + katexURL + `" defer></script>` + "\n<script>" + katexRender + `</script>`},
+		{&options{Math: "katex", Minify: true}, `<script src="` + katexURL + `" defer></script><script>` + katexRender + `</script>`},
+	}
+	for _, tt := range tests {
+		tmpl, err := loadTemplate(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, TemplateData{Title: "Book", Scripts: mathScripts(tt.opts.Math)}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("template output %q does not contain %q", out.String(), tt.expected)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxEmbeddedMedia is the largest audio or subtitle file embedded as a data
+// URI, unless --embed-max-bytes sets a lower limit. Larger files are written
+// next to the output, and so is every video.
+const maxEmbeddedMedia = 1 << 20
+
+// assetsDir returns the directory resources that are not embedded are
+// written to: --assets-dir, or else a directory named after the output,
+// like browsers do when saving a complete page.
+func assetsDir(opts *options) string {
+	if opts.AssetsDir != "" {
+		return opts.AssetsDir
+	}
+	return strings.TrimSuffix(opts.OutputPath, filepath.Ext(opts.OutputPath)) + "_files"
+}
+
+// mediaURL returns the URL the output refers to an audio, video or subtitle
+// file by. Small files are embedded as data URIs like images if embeddable
+// is set; others are written to the assets directory, as base64 would make
+// the HTML unwieldy.
+func (rd *renderer) mediaURL(archivePath string, embeddable bool) (string, error) {
+	if href, ok := rd.exported[archivePath]; ok {
+		return href, nil
+	}
+	data, mediaType, err := rd.readResource(archivePath)
+	if err != nil {
+		return "", err
+	}
+	if embeddable && rd.embeds(len(data)) && len(data) <= maxEmbeddedMedia {
+		return encodeDataURI(mediaType, data), nil
+	}
+	return rd.exportAsset(assetsDir(rd.opts), archivePath, data, mediaType)
+}
+
+// embedMedia resolves the src of an <audio> or <video> element, or of a
+// <source> or <track> inside one, and the poster image of a video against
+// the archive. It reports false for sources and tracks that cannot be found,
+// which are removed so that players fall back to the next one. Players get
+// controls, as the scripts that drive them in the book are stripped.
+func (rd *renderer) embedMedia(n *html.Node, contentFilePath string) bool {
+	player := n
+	if n.Data == "source" || n.Data == "track" {
+		player = n.Parent
+	} else {
+		setDefaultAttr(n, "controls", "")
+	}
+
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		if (attr.Key != "src" && (attr.Key != "poster" || n.Data != "video")) ||
+			attr.Val == "" || isExternalHref(attr.Val) {
+			attrs = append(attrs, attr)
+			continue
+		}
+		archivePath := resolveEpubPath(epubDir(contentFilePath), attr.Val)
+		var src string
+		var err error
+		switch {
+		case attr.Key == "poster":
+			src, err = rd.resourceURL(archivePath)
+		default:
+			// Videos are too large to embed, but their subtitles are not.
+			src, err = rd.mediaURL(archivePath, player.Data == "audio" || n.Data == "track")
+		}
+		if err != nil {
+			log.Printf("Warning: Could not embed media %s: %v", archivePath, err)
+			if n != player {
+				return false
+			}
+			continue
+		}
+		attr.Val = src
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+	return true
+}
+
+// isMediaElement reports whether n is an <audio> or <video> element or one
+// of their <source> and <track> children, as opposed to the <source> of a
+// <picture>.
+func isMediaElement(n *html.Node) bool {
+	switch n.Data {
+	case "audio", "video":
+		return true
+	case "source", "track":
+		return n.Parent != nil && (n.Parent.Data == "audio" || n.Parent.Data == "video")
+	}
+	return false
+}
+
+// audioChapter returns a content document playing an audio file, for audio
+// items placed in the spine by audiobook EPUBs, which cannot be parsed as
+// HTML.
+func audioChapter(audioPath string) (*html.Node, error) {
+	name := path.Base(audioPath)
+	doc := fmt.Sprintf(`<html><head><title>%s</title></head><body><p><audio controls src="%s"></audio></p></body></html>`,
+		html.EscapeString(name), html.EscapeString(name))
+	return html.Parse(strings.NewReader(doc))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestEmbedMedia(t *testing.T) {
+	dir := t.TempDir()
+	large := make([]byte, maxEmbeddedMedia+1)
+	rd := &renderer{
+		r: openTestArchive(t, map[string][]byte{
+			"OEBPS/audio/clip.mp3":   []byte("mp3"),
+			"OEBPS/audio/long.mp3":   large,
+			"OEBPS/video/film.mp4":   []byte("mp4"),
+			"OEBPS/video/film.vtt":   []byte("WEBVTT"),
+			"OEBPS/images/still.png": []byte("png"),
+		}),
+		opts:   &options{OutputPath: filepath.Join(dir, "book.html")},
+		opfDir: "OEBPS",
+		manifestHrefMap: map[string]Item{
+			"OEBPS/audio/clip.mp3":   {Href: "audio/clip.mp3", MediaType: "audio/mpeg"},
+			"OEBPS/audio/long.mp3":   {Href: "audio/long.mp3", MediaType: "audio/mpeg"},
+			"OEBPS/video/film.mp4":   {Href: "video/film.mp4", MediaType: "video/mp4"},
+			"OEBPS/video/film.vtt":   {Href: "video/film.vtt", MediaType: "text/vtt"},
+			"OEBPS/images/still.png": {Href: "images/still.png", MediaType: "image/png"},
+		},
+	}
+	tests := []struct {
+		audio    string
+		expected string
+	}{
+		{`<audio src="../audio/clip.mp3"></audio>`, `<audio src="data:audio/mpeg;base64,bXAz" controls=""></audio>`},
+		{`<audio controls="controls" src="../audio/long.mp3"></audio>`, `<audio controls="controls" src="book_files/audio/long.mp3"></audio>`},
+		{`<audio><source src="../audio/missing.ogg"/><source src="https://example.com/a.mp3"/></audio>`, `<audio controls=""><source src="https://example.com/a.mp3"/></audio>`},
+		{
+			`<video poster="../images/still.png"><source src="../video/film.mp4" type="video/mp4"/><track src="../video/film.vtt" kind="subtitles"/></video>`,
+			`<video poster="data:image/png;base64,cG5n" controls=""><source src="book_files/video/film.mp4" type="video/mp4"/><track src="data:text/vtt;base64,V0VCVlRU" kind="subtitles"/></video>`,
+		},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.audio))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := findElement(doc, "body")
+		rd.cleanNode(body, "OEBPS/text/ch1.xhtml")
+		var out strings.Builder
+		html.Render(&out, body.FirstChild)
+		if out.String() != tt.expected {
+			t.Errorf("embedMedia(%q) = %q, expected %q", tt.audio, out.String(), tt.expected)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "book_files", "audio", "long.mp3")); err != nil || len(data) != len(large) {
+		t.Errorf("embedMedia did not write the long clip: %v", err)
+	}
+}
+
+func TestAudioChapter(t *testing.T) {
+	doc, err := audioChapter("OEBPS/audio/track%201.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio := findElement(doc, "audio")
+	if audio == nil || getAttr(audio, "src") != "track%201.mp3" {
+		t.Errorf("audioChapter did not play the track")
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Metadata is the Dublin Core metadata of the package. The fields without
+// an XML tag are filled in by resolve from the elements and their EPUB 3
+// refinements.
+type Metadata struct {
+	Title         string        `xml:"-" json:"title"` // the main title
+	Subtitle      string        `xml:"-" json:"subtitle,omitempty"`
+	Titles        []Title       `xml:"http://purl.org/dc/elements/1.1/ title" json:"titles,omitempty"`
+	Creators      []Contributor `xml:"http://purl.org/dc/elements/1.1/ creator" json:"creators,omitempty"`
+	Contributors  []Contributor `xml:"http://purl.org/dc/elements/1.1/ contributor" json:"contributors,omitempty"`
+	Languages     []string      `xml:"http://purl.org/dc/elements/1.1/ language" json:"languages,omitempty"`
+	Publishers    []string      `xml:"http://purl.org/dc/elements/1.1/ publisher" json:"publishers,omitempty"`
+	Dates         []Date        `xml:"http://purl.org/dc/elements/1.1/ date" json:"dates,omitempty"`
+	Modified      string        `xml:"-" json:"modified,omitempty"` // the dcterms:modified date of EPUB 3
+	Subjects      []string      `xml:"http://purl.org/dc/elements/1.1/ subject" json:"subjects,omitempty"`
+	Description   string        `xml:"http://purl.org/dc/elements/1.1/ description" json:"description,omitempty"`
+	Rights        string        `xml:"http://purl.org/dc/elements/1.1/ rights" json:"rights,omitempty"`
+	Series        string        `xml:"-" json:"series,omitempty"`      // the series the book belongs to
+	SeriesIndex   string        `xml:"-" json:"seriesIndex,omitempty"` // its number in the series, e.g. 2 or 1.5
+	Identifiers   []Identifier  `xml:"http://purl.org/dc/elements/1.1/ identifier" json:"identifiers,omitempty"`
+	Accessibility Accessibility `xml:"-" json:"accessibility,omitzero"` // the schema.org accessibility metadata
+	Meta          []Meta        `xml:"meta" json:"meta,omitempty"`
+	// Prefixes are the prefixes the package declares, by name.
+	Prefixes map[string]string `xml:"-" json:"prefixes,omitempty"`
+}
+
+// Accessibility is what the book claims about its accessibility in the
+// schema.org properties of the EPUB Accessibility specification: the
+// senses its content needs, such as textual or visual, the sets of them
+// that suffice, the features it has, such as alternativeText, its hazards
+// and a summary in prose.
+type Accessibility struct {
+	AccessModes           []string `json:"accessModes,omitempty"`
+	AccessModesSufficient []string `json:"accessModesSufficient,omitempty"`
+	Features              []string `json:"features,omitempty"`
+	Hazards               []string `json:"hazards,omitempty"`
+	Summary               string   `json:"summary,omitempty"`
+}
+
+// Title is a dc:title. Type is main, subtitle, short, collection, edition
+// or expanded, given by an EPUB 3 title-type refinement.
+type Title struct {
+	ID    string `xml:"id,attr" json:"id,omitempty"`
+	Value string `xml:",chardata" json:"value"`
+	Type  string `xml:"-" json:"type,omitempty"`
+}
+
+// Contributor is a dc:creator or dc:contributor. Role is its MARC relator
+// code, such as aut, edt or ill, and FileAs the form of its name for
+// sorting, taken from the EPUB 2 attributes or EPUB 3 refinements.
+type Contributor struct {
+	ID     string `xml:"id,attr" json:"id,omitempty"`
+	Name   string `xml:",chardata" json:"name"`
+	Role   string `xml:"http://www.idpf.org/2007/opf role,attr" json:"role,omitempty"`
+	FileAs string `xml:"http://www.idpf.org/2007/opf file-as,attr" json:"fileAs,omitempty"`
+}
+
+// Date is a dc:date. EPUB 2 books can tell what it is the date of, such as
+// publication or creation, with its Event.
+type Date struct {
+	Event string `xml:"http://www.idpf.org/2007/opf event,attr" json:"event,omitempty"`
+	Value string `xml:",chardata" json:"value"`
+}
+
+// Identifier is a dc:identifier. Scheme is its EPUB 2 opf:scheme, such as
+// ISBN, or its EPUB 3 identifier-type refinement.
+type Identifier struct {
+	ID     string `xml:"id,attr" json:"id,omitempty"`
+	Scheme string `xml:"http://www.idpf.org/2007/opf scheme,attr" json:"scheme,omitempty"`
+	Value  string `xml:",chardata" json:"value"`
+}
+
+// resolve trims the metadata values, applies the EPUB 3 <meta refines>
+// refinements to the elements they refine and picks the main title and
+// subtitle.
+func (m *Metadata) resolve() {
+	refinements := make(map[string]map[string]string)
+	for _, meta := range m.Meta {
+		id, ok := strings.CutPrefix(strings.TrimSpace(meta.Refines), "#")
+		property, value := strings.TrimSpace(meta.Property), metaText(meta.Value)
+		switch {
+		case ok && property != "":
+			if refinements[id] == nil {
+				refinements[id] = make(map[string]string)
+			}
+			if _, seen := refinements[id][property]; !seen {
+				refinements[id][property] = value
+			}
+		case property == "dcterms:modified":
+			m.Modified = value
+		}
+	}
+
+	for i := range m.Titles {
+		t := &m.Titles[i]
+		t.Value = metaText(t.Value)
+		t.Type = refinements[t.ID]["title-type"]
+	}
+	// Books with several titles but no title-type usually list the main
+	// title first. Titles of other types, such as short or edition, are
+	// used only if there is nothing better.
+	var main, plain, other string
+	m.Subtitle = ""
+	for _, t := range m.Titles {
+		switch {
+		case t.Value == "":
+		case t.Type == "main" && main == "":
+			main = t.Value
+		case t.Type == "subtitle" && m.Subtitle == "":
+			m.Subtitle = t.Value
+		case t.Type == "" && plain == "":
+			plain = t.Value
+		case t.Type != "subtitle" && t.Type != "collection" && other == "":
+			other = t.Value
+		}
+	}
+	m.Title = cmp.Or(main, plain, other)
+	m.resolveSeries(refinements)
+	m.resolveAccessibility()
+
+	for _, list := range [][]Contributor{m.Creators, m.Contributors} {
+		for i := range list {
+			c := &list[i]
+			c.Name = metaText(c.Name)
+			if role := refinements[c.ID]["role"]; role != "" {
+				c.Role = role
+			}
+			if fileAs := refinements[c.ID]["file-as"]; fileAs != "" {
+				c.FileAs = fileAs
+			}
+			c.Role, c.FileAs = strings.ToLower(strings.TrimSpace(c.Role)), strings.TrimSpace(c.FileAs)
+		}
+		// The display-seq refinement orders the names as the book displays
+		// them; the names without one follow.
+		slices.SortStableFunc(list, func(a, b Contributor) int {
+			return cmp.Compare(displaySeq(refinements[a.ID]), displaySeq(refinements[b.ID]))
+		})
+	}
+	for i := range m.Identifiers {
+		id := &m.Identifiers[i]
+		id.Value = strings.TrimSpace(id.Value)
+		if scheme := refinements[id.ID]["identifier-type"]; scheme != "" {
+			id.Scheme = scheme
+		}
+	}
+	for i := range m.Dates {
+		m.Dates[i].Value = strings.TrimSpace(m.Dates[i].Value)
+	}
+	for _, list := range [][]string{m.Languages, m.Publishers, m.Subjects} {
+		for i := range list {
+			list[i] = metaText(list[i])
+		}
+	}
+	m.Description = strings.TrimSpace(m.Description)
+	m.Rights = metaText(m.Rights)
+}
+
+// override replaces the title, the authors and the language of the book
+// with the ones given by --title, --author and --language, for books with
+// missing or wrong metadata. Creators in other roles than author, such as
+// illustrators, are kept.
+func (m *Metadata) override(title string, authors []string, language string) {
+	if title != "" {
+		m.Titles = []Title{{Value: title, Type: "main"}}
+		m.Title, m.Subtitle = title, ""
+	}
+	if len(authors) > 0 {
+		creators := make([]Contributor, 0, len(authors)+len(m.Creators))
+		for _, name := range authors {
+			creators = append(creators, Contributor{Name: name, Role: "aut"})
+		}
+		for _, c := range m.Creators {
+			if c.Role != "" && c.Role != "aut" {
+				creators = append(creators, c)
+			}
+		}
+		m.Creators = creators
+	}
+	if language != "" {
+		m.Languages = []string{language}
+	}
+}
+
+// FullTitle returns the title of the book followed by its subtitle, as in
+// "Dune: Book One", or its expanded title if it has one.
+func (m Metadata) FullTitle() string {
+	for _, t := range m.Titles {
+		if t.Type == "expanded" && t.Value != "" {
+			return t.Value
+		}
+	}
+	if m.Title != "" && m.Subtitle != "" {
+		return m.Title + ": " + m.Subtitle
+	}
+	return m.Title
+}
+
+// resolveSeries finds the series of the book, given by an EPUB 3
+// belongs-to-collection of the series type, by calibre's series meta
+// elements or by a title of the collection type.
+func (m *Metadata) resolveSeries(refinements map[string]map[string]string) {
+	m.Series, m.SeriesIndex = "", ""
+	for _, meta := range m.Meta {
+		if strings.TrimSpace(meta.Property) != "belongs-to-collection" || meta.Refines != "" {
+			continue
+		}
+		refined := refinements[meta.ID]
+		if t := refined["collection-type"]; t != "" && t != "series" {
+			continue
+		}
+		m.Series, m.SeriesIndex = metaText(meta.Value), seriesIndex(refined["group-position"])
+		return
+	}
+	for _, meta := range m.Meta {
+		switch meta.Name {
+		case "calibre:series":
+			m.Series = metaText(meta.Content)
+		case "calibre:series_index":
+			m.SeriesIndex = seriesIndex(meta.Content)
+		}
+	}
+	if m.Series == "" {
+		m.SeriesIndex = ""
+		for _, t := range m.Titles {
+			if t.Type == "collection" {
+				m.Series = t.Value
+				break
+			}
+		}
+	}
+}
+
+// displaySeq returns the display-seq refinement of a contributor, or a
+// number larger than any for one without.
+func displaySeq(refined map[string]string) int {
+	if seq, err := strconv.Atoi(refined["display-seq"]); err == nil && seq > 0 {
+		return seq
+	}
+	return int(^uint(0) >> 1)
+}
+
+// resolveAccessibility collects the schema.org accessibility properties,
+// given as EPUB 3 meta properties or as EPUB 2 meta names and contents.
+func (m *Metadata) resolveAccessibility() {
+	a := Accessibility{}
+	for _, meta := range m.Meta {
+		if meta.Refines != "" {
+			continue
+		}
+		name, value := strings.TrimSpace(meta.Property), metaText(meta.Value)
+		if name == "" {
+			name, value = strings.TrimSpace(meta.Name), metaText(meta.Content)
+		}
+		if value == "" {
+			continue
+		}
+		switch name {
+		case "schema:accessMode":
+			a.AccessModes = append(a.AccessModes, value)
+		case "schema:accessModeSufficient":
+			a.AccessModesSufficient = append(a.AccessModesSufficient, value)
+		case "schema:accessibilityFeature":
+			a.Features = append(a.Features, value)
+		case "schema:accessibilityHazard":
+			a.Hazards = append(a.Hazards, value)
+		case "schema:accessibilitySummary":
+			a.Summary = cmp.Or(a.Summary, value)
+		}
+	}
+	m.Accessibility = a
+}
+
+// seriesIndex normalizes a position in a series, which calibre writes as
+// a decimal such as 2.0.
+func seriesIndex(s string) string {
+	s = strings.TrimSpace(s)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return s
+}
+
+// Authors returns the names of the creators with the aut role, or if there
+// are none the creators without a role.
+func (m Metadata) Authors() []string {
+	var authors, all []string
+	for _, c := range m.Creators {
+		if c.Role == "aut" {
+			authors = append(authors, c.Name)
+		}
+		if c.Role == "" || c.Role == "aut" {
+			all = append(all, c.Name)
+		}
+	}
+	if len(authors) > 0 {
+		return authors
+	}
+	return all
+}
+
+// creditPhrases introduces the contributors in the roles credited beside
+// the authors, by MARC relator code.
+var creditPhrases = map[string]string{
+	"edt": "Edited by",
+	"trl": "Translated by",
+	"ill": "Illustrated by",
+	"pht": "Photographs by",
+	"aui": "Introduction by",
+	"aft": "Afterword by",
+	"nrt": "Narrated by",
+	"com": "Compiled by",
+}
+
+// Credits returns the contributors other than the authors, one line per
+// role in the order the roles first appear, such as "Edited by A and B".
+// Contributors in roles without a phrase, such as the book producer, are
+// left out.
+func (m Metadata) Credits() []string {
+	var roles []string
+	names := make(map[string][]string)
+	for _, c := range slices.Concat(m.Creators, m.Contributors) {
+		if creditPhrases[c.Role] == "" || c.Name == "" || slices.Contains(names[c.Role], c.Name) {
+			continue
+		}
+		if names[c.Role] == nil {
+			roles = append(roles, c.Role)
+		}
+		names[c.Role] = append(names[c.Role], c.Name)
+	}
+	credits := make([]string, 0, len(roles))
+	for _, role := range roles {
+		credits = append(credits, creditPhrases[role]+" "+joinNames(names[role]))
+	}
+	return credits
+}
+
+// Date returns the publication date: the dc:date with the publication
+// event, or else the first one without an event. EPUB 3 allows only the
+// publication date as dc:date.
+func (m Metadata) Date() string {
+	for _, d := range m.Dates {
+		if strings.EqualFold(d.Event, "publication") {
+			return d.Value
+		}
+	}
+	for _, d := range m.Dates {
+		if d.Event == "" {
+			return d.Value
+		}
+	}
+	return ""
+}
+
+// ISBN returns the ISBN of the book, without the urn:isbn: prefix, or ""
+// if it has none.
+func (m Metadata) ISBN() string {
+	for _, id := range m.Identifiers {
+		if scheme, value := parseIdentifier(id.Value, id.Scheme); scheme == "isbn" {
+			return value
+		}
+	}
+	return ""
+}
+
+// metaText trims a metadata value and replaces the runs of whitespace in
+// it, such as line breaks in the OPF, with single spaces.
+func metaText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
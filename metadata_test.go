@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+const testOPFMetadata = `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+<dc:title id="t2">A Subtitle</dc:title>
+<meta refines="#t2" property="title-type">subtitle</meta>
+<dc:title id="t1">The
+  Book</dc:title>
+<meta refines="#t1" property="title-type">main</meta>
+<dc:creator id="c1">Jane Doe</dc:creator>
+<meta refines="#c1" property="role" scheme="marc:relators">aut</meta>
+<meta refines="#c1" property="file-as">Doe, Jane</meta>
+<dc:creator opf:role="ill" opf:file-as="Roe, Rick">Rick Roe</dc:creator>
+<dc:contributor opf:role="edt">Ed Itor</dc:contributor>
+<dc:identifier id="isbn">9780000000001</dc:identifier>
+<meta refines="#isbn" property="identifier-type" scheme="onix:codelist5">15</meta>
+<dc:identifier opf:scheme="UUID"> urn:uuid:1234 </dc:identifier>
+<dc:language>en</dc:language>
+<dc:publisher>ACME</dc:publisher>
+<dc:date opf:event="creation">2019-05-01</dc:date>
+<dc:date>2020-01-01</dc:date>
+<dc:subject>Fiction</dc:subject>
+<dc:subject>Tests</dc:subject>
+<dc:description> A test book. </dc:description>
+<dc:rights>Public domain</dc:rights>
+<meta property="dcterms:modified">2021-02-03T04:05:06Z</meta>
+</metadata>
+</package>`
+
+func TestMetadataResolve(t *testing.T) {
+	var pkg Package
+	if err := xml.Unmarshal([]byte(testOPFMetadata), &pkg); err != nil {
+		t.Fatal(err)
+	}
+	m := pkg.Metadata
+	m.resolve()
+
+	if m.Title != "The Book" || m.Subtitle != "A Subtitle" {
+		t.Errorf("resolve gave title %q and subtitle %q, expected %q and %q", m.Title, m.Subtitle, "The Book", "A Subtitle")
+	}
+	creators := []Contributor{
+		{ID: "c1", Name: "Jane Doe", Role: "aut", FileAs: "Doe, Jane"},
+		{Name: "Rick Roe", Role: "ill", FileAs: "Roe, Rick"},
+	}
+	if !reflect.DeepEqual(m.Creators, creators) {
+		t.Errorf("resolve gave creators %+v, expected %+v", m.Creators, creators)
+	}
+	if len(m.Contributors) != 1 || m.Contributors[0].Role != "edt" {
+		t.Errorf("resolve gave contributors %+v, expected an editor", m.Contributors)
+	}
+	identifiers := []Identifier{{ID: "isbn", Scheme: "15", Value: "9780000000001"}, {Scheme: "UUID", Value: "urn:uuid:1234"}}
+	if !reflect.DeepEqual(m.Identifiers, identifiers) {
+		t.Errorf("resolve gave identifiers %+v, expected %+v", m.Identifiers, identifiers)
+	}
+	if authors := m.Authors(); !reflect.DeepEqual(authors, []string{"Jane Doe"}) {
+		t.Errorf("Authors() = %q, expected %q", authors, []string{"Jane Doe"})
+	}
+	if date := m.Date(); date != "2020-01-01" {
+		t.Errorf("Date() = %q, expected %q", date, "2020-01-01")
+	}
+	if m.Description != "A test book." || m.Rights != "Public domain" || m.Modified != "2021-02-03T04:05:06Z" {
+		t.Errorf("resolve gave description %q, rights %q and modified %q", m.Description, m.Rights, m.Modified)
+	}
+	if !reflect.DeepEqual(m.Languages, []string{"en"}) || !reflect.DeepEqual(m.Publishers, []string{"ACME"}) ||
+		!reflect.DeepEqual(m.Subjects, []string{"Fiction", "Tests"}) {
+		t.Errorf("resolve gave languages %q, publishers %q and subjects %q", m.Languages, m.Publishers, m.Subjects)
+	}
+}
+
+func TestMetadataCredits(t *testing.T) {
+	m := Metadata{
+		Creators: []Contributor{
+			{ID: "a", Name: "Ann", Role: "aut"},
+			{ID: "e", Name: "Ed", Role: "EDT"},
+			{ID: "i", Name: "Ivy"},
+		},
+		Contributors: []Contributor{{Name: "Eve", Role: "edt"}, {Name: "Bob", Role: "bkp"}, {Name: "Ed", Role: "edt"}},
+		Meta: []Meta{
+			{Refines: "#i", Property: "role", Value: "ill"},
+			{Refines: "#i", Property: "display-seq", Value: "1"},
+			{Refines: "#a", Property: "display-seq", Value: "2"},
+		},
+	}
+	m.resolve()
+	var names []string
+	for _, c := range m.Creators {
+		names = append(names, c.Name)
+	}
+	if expected := []string{"Ivy", "Ann", "Ed"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("resolve ordered the creators %q, expected %q", names, expected)
+	}
+	if credits, expected := m.Credits(), []string{"Illustrated by Ivy", "Edited by Ed and Eve"}; !reflect.DeepEqual(credits, expected) {
+		t.Errorf("Credits() = %q, expected %q", credits, expected)
+	}
+}
+
+func TestMetadataAccessibility(t *testing.T) {
+	m := Metadata{Meta: []Meta{
+		{Property: "schema:accessMode", Value: "textual"},
+		{Name: "schema:accessMode", Content: "visual"},
+		{Property: "schema:accessModeSufficient", Value: "textual"},
+		{Property: "schema:accessibilityFeature", Value: " alternativeText "},
+		{Property: "schema:accessibilityHazard", Value: "none"},
+		{Property: "schema:accessibilitySummary", Value: "Images have\n  descriptions."},
+		{Refines: "#x", Property: "schema:accessMode", Value: "auditory"},
+	}}
+	m.resolve()
+	expected := Accessibility{
+		AccessModes:           []string{"textual", "visual"},
+		AccessModesSufficient: []string{"textual"},
+		Features:              []string{"alternativeText"},
+		Hazards:               []string{"none"},
+		Summary:               "Images have descriptions.",
+	}
+	if !reflect.DeepEqual(m.Accessibility, expected) {
+		t.Errorf("resolve gave accessibility %+v, expected %+v", m.Accessibility, expected)
+	}
+}
+
+func TestMetadataTitleFallback(t *testing.T) {
+	tests := []struct {
+		titles   []Title
+		expected string
+	}{
+		{[]Title{{Value: "First"}, {Value: "Second"}}, "First"},
+		{[]Title{{ID: "s", Value: "Sub"}}, ""},
+		{[]Title{{ID: "s", Value: "Sub"}, {ID: "e", Value: "Edition"}}, "Edition"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		m := Metadata{Titles: tt.titles, Meta: []Meta{
+			{Refines: "#s", Property: "title-type", Value: "subtitle"},
+			{Refines: "#e", Property: "title-type", Value: "edition"},
+		}}
+		m.resolve()
+		if m.Title != tt.expected {
+			t.Errorf("resolve(%+v) gave title %q, expected %q", tt.titles, m.Title, tt.expected)
+		}
+	}
+}
+
+func TestMetadataISBN(t *testing.T) {
+	tests := []struct {
+		identifiers []Identifier
+		expected    string
+	}{
+		{[]Identifier{{Value: "urn:uuid:1234"}, {Scheme: "ISBN", Value: "0-123-45678-X"}}, "0-123-45678-X"},
+		{[]Identifier{{Scheme: "15", Value: "9780000000001"}}, "9780000000001"},
+		{[]Identifier{{Value: "URN:ISBN:9780000000001"}}, "9780000000001"},
+		{[]Identifier{{Value: "9780000000001"}}, ""},
+	}
+	for _, tt := range tests {
+		if isbn := (Metadata{Identifiers: tt.identifiers}).ISBN(); isbn != tt.expected {
+			t.Errorf("ISBN(%+v) = %q, expected %q", tt.identifiers, isbn, tt.expected)
+		}
+	}
+}
+
+func TestMetadataSeries(t *testing.T) {
+	tests := []struct {
+		meta          []Meta
+		series, index string
+	}{
+		{[]Meta{{Name: "calibre:series", Content: "Discworld"}, {Name: "calibre:series_index", Content: "2.0"}}, "Discworld", "2"},
+		{[]Meta{
+			{Name: "calibre:series", Content: "Calibre name"},
+			{ID: "c1", Property: "belongs-to-collection", Value: "Discworld"},
+			{Refines: "#c1", Property: "collection-type", Value: "series"},
+			{Refines: "#c1", Property: "group-position", Value: "1.5"},
+		}, "Discworld", "1.5"},
+		{[]Meta{
+			{ID: "c1", Property: "belongs-to-collection", Value: "Box"},
+			{Refines: "#c1", Property: "collection-type", Value: "set"},
+		}, "", ""},
+		{[]Meta{{Name: "calibre:series_index", Content: "3"}}, "", ""},
+		{[]Meta{{Refines: "#t", Property: "title-type", Value: "collection"}}, "The Dune Chronicles", ""},
+	}
+	for _, tt := range tests {
+		m := Metadata{Meta: tt.meta, Titles: []Title{{Value: "Dune"}, {ID: "t", Value: "The Dune Chronicles"}}}
+		m.resolve()
+		if m.Series != tt.series || m.SeriesIndex != tt.index {
+			t.Errorf("resolve(%+v) gave series %q %q, expected %q %q", tt.meta, m.Series, m.SeriesIndex, tt.series, tt.index)
+		}
+	}
+}
+
+func TestMetadataFullTitle(t *testing.T) {
+	tests := []struct {
+		m        Metadata
+		expected string
+	}{
+		{Metadata{Title: "Dune"}, "Dune"},
+		{Metadata{Title: "Dune", Subtitle: "Book One"}, "Dune: Book One"},
+		{Metadata{Title: "Dune", Subtitle: "Book One", Titles: []Title{{Type: "expanded", Value: "Dune, Book One of the Dune Chronicles"}}},
+			"Dune, Book One of the Dune Chronicles"},
+		{Metadata{Subtitle: "Book One"}, ""},
+	}
+	for _, tt := range tests {
+		if title := tt.m.FullTitle(); title != tt.expected {
+			t.Errorf("FullTitle(%+v) = %q, expected %q", tt.m, title, tt.expected)
+		}
+	}
+}
+
+func TestMetadataOverride(t *testing.T) {
+	m := Metadata{
+		Title:     "Untitled",
+		Subtitle:  "Junk",
+		Titles:    []Title{{Value: "Untitled"}, {Value: "Junk", Type: "subtitle"}},
+		Creators:  []Contributor{{Name: "Unknown", Role: "aut"}, {Name: "Ill Ustrator", Role: "ill"}, {Name: "Nobody"}},
+		Languages: []string{"und"},
+	}
+	m.override("", nil, "")
+	if m.Title != "Untitled" || len(m.Creators) != 3 || m.Languages[0] != "und" {
+		t.Errorf("override without values changed the metadata to %+v", m)
+	}
+
+	m.override("Dune", []string{"Frank Herbert", "Someone Else"}, "en")
+	if m.FullTitle() != "Dune" {
+		t.Errorf("override gave title %q, expected %q", m.FullTitle(), "Dune")
+	}
+	creators := []Contributor{{Name: "Frank Herbert", Role: "aut"}, {Name: "Someone Else", Role: "aut"}, {Name: "Ill Ustrator", Role: "ill"}}
+	if !reflect.DeepEqual(m.Creators, creators) {
+		t.Errorf("override gave creators %+v, expected %+v", m.Creators, creators)
+	}
+	if !reflect.DeepEqual(m.Languages, []string{"en"}) {
+		t.Errorf("override gave languages %q, expected %q", m.Languages, []string{"en"})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+)
+
+// epubMimetype is what the mimetype entry of an EPUB must hold.
+const epubMimetype = "application/epub+zip"
+
+// mimetypeProblems tells how the mimetype entry of the archive breaks the
+// EPUB container format, which wants it first, stored uncompressed, and
+// holding epubMimetype alone, so that the type of the file can be read
+// at a fixed offset. Many books get it wrong and open in readers all the
+// same, so the problems are only warned about unless --strict is given.
+func mimetypeProblems(r *epubArchive) []string {
+	f, ok := r.files["mimetype"]
+	if !ok {
+		return []string{"The archive has no mimetype entry"}
+	}
+	var problems []string
+	if r.File[0] != f {
+		problems = append(problems, "The mimetype entry is not the first in the archive")
+	}
+	if f.Method != zip.Store {
+		problems = append(problems, "The mimetype entry is compressed")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return append(problems, fmt.Sprintf("The mimetype entry cannot be read: %v", err))
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, 256))
+	if err != nil {
+		return append(problems, fmt.Sprintf("The mimetype entry cannot be read: %v", err))
+	}
+	if string(data) != epubMimetype {
+		problems = append(problems, fmt.Sprintf("The mimetype entry holds %q instead of %s", data, epubMimetype))
+	}
+	return problems
+}
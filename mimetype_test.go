@@ -0,0 +1,57 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMimetypeProblems(t *testing.T) {
+	type entry struct {
+		name   string
+		data   string
+		method uint16
+	}
+	tests := []struct {
+		entries  []entry
+		expected []string
+	}{
+		{[]entry{{"mimetype", epubMimetype, zip.Store}, {"META-INF/container.xml", "<container/>", zip.Deflate}}, nil},
+		{[]entry{{"META-INF/container.xml", "<container/>", zip.Deflate}}, []string{"The archive has no mimetype entry"}},
+		{[]entry{{"META-INF/container.xml", "<container/>", zip.Deflate}, {"mimetype", epubMimetype + "\n", zip.Deflate}},
+			[]string{
+				"The mimetype entry is not the first in the archive",
+				"The mimetype entry is compressed",
+				`The mimetype entry holds "application/epub+zip\n" instead of application/epub+zip`,
+			}},
+	}
+	for i, tt := range tests {
+		zipPath := filepath.Join(t.TempDir(), "book.epub")
+		f, err := os.Create(zipPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		for _, e := range tt.entries {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: e.method})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(e.data))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		r, err := zip.OpenReader(zipPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := mimetypeProblems(newEpubArchive(r)); !reflect.DeepEqual(problems, tt.expected) {
+			t.Errorf("mimetypeProblems of archive %d = %q, expected %q", i, problems, tt.expected)
+		}
+		r.Close()
+	}
+}
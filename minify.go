@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var minifyTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// writeMinified writes the children of a cleaned node as compact HTML:
+// whitespace is collapsed, whitespace between blocks is dropped, attribute
+// values are unquoted where HTML allows it and optional end tags are left
+// out.
+func writeMinified(n *html.Node, w io.StringWriter) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		minifyNode(c, w, false)
+	}
+}
+
+func minifyNode(n *html.Node, w io.StringWriter, preformatted bool) {
+	switch n.Type {
+	case html.TextNode:
+		if isScriptText(n) {
+			w.WriteString(n.Data)
+			return
+		}
+		if preformatted {
+			w.WriteString(minifyTextEscaper.Replace(n.Data))
+			return
+		}
+		if isInterBlockSpace(n) {
+			return
+		}
+		w.WriteString(minifyTextEscaper.Replace(collapseSpace(n.Data)))
+	case html.ElementNode:
+		tag := n.Data
+		w.WriteString("<" + tag)
+		for _, attr := range n.Attr {
+			w.WriteString(" " + attrName(attr))
+			if attr.Val != "" {
+				w.WriteString("=" + minifyAttrValue(attr.Val))
+			}
+		}
+		w.WriteString(">")
+
+		pre := preformatted || tag == "pre" || tag == "textarea"
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			minifyNode(c, w, pre)
+		}
+		if !isVoidElement(tag) && !canOmitEndTag(n) {
+			w.WriteString("</" + tag + ">")
+		}
+	}
+}
+
+// collapseSpace replaces every run of HTML whitespace with a single space.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// isInterBlockSpace reports whether n is whitespace-only text whose
+// neighbours are block boundaries, so removing it does not change rendering.
+func isInterBlockSpace(n *html.Node) bool {
+	if strings.Trim(n.Data, " \t\n\r\f") != "" {
+		return false
+	}
+	if n.Parent != nil && n.Parent.Type == html.ElementNode && !isBlockElement(n.Parent.Data) {
+		return false
+	}
+	prev, next := n.PrevSibling, n.NextSibling
+	return (prev == nil || isBlockNode(prev)) && (next == nil || isBlockNode(next))
+}
+
+func isBlockNode(n *html.Node) bool {
+	return n.Type == html.ElementNode && isBlockElement(n.Data)
+}
+
+// minifyAttrValue escapes an attribute value and leaves the quotes out when
+// the value is a valid unquoted attribute value.
+func minifyAttrValue(val string) string {
+	escaped := strings.ReplaceAll(val, "&", "&amp;")
+	if !strings.ContainsAny(escaped, " \t\n\r\f\"'=<>`") {
+		return escaped
+	}
+	return `"` + strings.ReplaceAll(escaped, `"`, "&quot;") + `"`
+}
+
+// canOmitEndTag implements the optional end tag rules of the HTML standard
+// for the elements that commonly occur in book content.
+func canOmitEndTag(n *html.Node) bool {
+	next := n.NextSibling
+	for next != nil && next.Type == html.TextNode && isInterBlockSpace(next) {
+		next = next.NextSibling
+	}
+	if next != nil && next.Type != html.ElementNode {
+		return false
+	}
+	nextTag := ""
+	if next != nil {
+		nextTag = next.Data
+	}
+
+	switch n.Data {
+	case "li":
+		return next == nil || nextTag == "li"
+	case "dt":
+		return nextTag == "dt" || nextTag == "dd"
+	case "dd":
+		return next == nil || nextTag == "dt" || nextTag == "dd"
+	case "tr":
+		return next == nil || nextTag == "tr"
+	case "td", "th":
+		return next == nil || nextTag == "td" || nextTag == "th"
+	case "thead":
+		return nextTag == "tbody" || nextTag == "tfoot"
+	case "tbody":
+		return next == nil || nextTag == "tbody" || nextTag == "tfoot"
+	case "option":
+		return next == nil || nextTag == "option" || nextTag == "optgroup"
+	case "p":
+		if next == nil {
+			if n.Parent == nil || n.Parent.Type != html.ElementNode {
+				return false
+			}
+			switch n.Parent.Data {
+			case "a", "audio", "del", "ins", "map", "noscript", "video", "body":
+				return false
+			}
+			return true
+		}
+		switch nextTag {
+		case "address", "article", "aside", "blockquote", "details", "div",
+			"dl", "fieldset", "figcaption", "figure", "footer", "form", "h1",
+			"h2", "h3", "h4", "h5", "h6", "header", "hgroup", "hr", "main",
+			"menu", "nav", "ol", "p", "pre", "section", "table", "ul":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestWriteMinified(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"<p>One</p>\n<p>Two</p>\n", "<p>One<p>Two</p>"},
+		{"<ul>\n  <li>A</li>\n  <li>B</li>\n</ul>", "<ul><li>A<li>B</ul>"},
+		{"<p>Text   with\n spaces <em>and</em>  more</p><div></div>", "<p>Text with spaces <em>and</em> more<div></div>"},
+		{"<pre>  keep\n  this </pre>", "<pre>  keep\n  this </pre>"},
+		{`<a href="a.html" title="x y">link</a>`, `<a href=a.html title="x y">link</a>`},
+		{`<img alt="" src="a.png"><br>`, `<img alt src=a.png><br>`},
+		{"<div><p>Last</p></div>", "<div><p>Last</div>"},
+		{"<p>Before</p>text", "<p>Before</p>text"},
+		{"<table><tr><td>1</td><td>2</td></tr></table>", "<table><tbody><tr><td>1<td>2</table>"},
+	}
+
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader("<body>" + tt.input + "</body>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		writeMinified(findElement(doc, "body"), &out)
+		if out.String() != tt.expected {
+			t.Errorf("writeMinified(%q) = %q, expected %q", tt.input, out.String(), tt.expected)
+		}
+	}
+}
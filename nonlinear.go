@@ -0,0 +1,55 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// appendixID is the ID of the heading the non-linear chapters follow.
+const appendixID = "appendix"
+
+// readingOrder returns the chapters of the main flow, leaving out the ones
+// marked linear="no" unless includeNonLinear is set, in which case they
+// follow all others. The chapters are numbered anew.
+func readingOrder(chapters []Chapter, includeNonLinear bool) []Chapter {
+	var linear, nonLinear []Chapter
+	for _, ch := range chapters {
+		if ch.NonLinear {
+			nonLinear = append(nonLinear, ch)
+		} else {
+			linear = append(linear, ch)
+		}
+	}
+	if includeNonLinear {
+		linear = append(linear, nonLinear...)
+	}
+	return renumber(linear)
+}
+
+// renumber sets the Index of the chapters to their new positions.
+func renumber(chapters []Chapter) []Chapter {
+	for i := range chapters {
+		chapters[i].Index = i
+	}
+	return chapters
+}
+
+// appendixChapter renders the heading that --include-nonlinear puts before
+// the non-linear chapters.
+func (rd *renderer) appendixChapter() ChapterData {
+	const title = "Appendix"
+	heading := &html.Node{Type: html.ElementNode, Data: "h1", DataAtom: atom.H1}
+	heading.AppendChild(&html.Node{Type: html.TextNode, Data: title})
+	section := &html.Node{Type: html.ElementNode, Data: "section", DataAtom: atom.Section,
+		Attr: []html.Attribute{{Key: "class", Val: "appendix"}}}
+	section.AppendChild(heading)
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	body.AppendChild(section)
+
+	var b strings.Builder
+	rd.writeBody(body, &b)
+	return ChapterData{ID: appendixID, Title: title, Body: template.HTML(b.String())}
+}
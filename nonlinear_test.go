@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestReadingOrder(t *testing.T) {
+	chapters := []Chapter{
+		{Index: 0, Path: "ch1.xhtml"},
+		{Index: 1, Path: "answers.xhtml", NonLinear: true},
+		{Index: 2, Path: "ch2.xhtml"},
+	}
+	tests := []struct {
+		includeNonLinear bool
+		expected         []string
+	}{
+		{false, []string{"ch1.xhtml", "ch2.xhtml"}},
+		{true, []string{"ch1.xhtml", "ch2.xhtml", "answers.xhtml"}},
+	}
+	for _, tt := range tests {
+		ordered := readingOrder(chapters, tt.includeNonLinear)
+		if len(ordered) != len(tt.expected) {
+			t.Errorf("readingOrder(%v) returned %d chapters, expected %d", tt.includeNonLinear, len(ordered), len(tt.expected))
+			continue
+		}
+		for i, ch := range ordered {
+			if ch.Path != tt.expected[i] || ch.Index != i {
+				t.Errorf("readingOrder(%v)[%d] = %s at %d, expected %s at %d", tt.includeNonLinear, i, ch.Path, ch.Index, tt.expected[i], i)
+			}
+		}
+	}
+}
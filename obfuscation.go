@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// Font obfuscation algorithms recorded in META-INF/encryption.xml.
+const (
+	idpfObfuscation  = "http://www.idpf.org/2008/embedding"
+	adobeObfuscation = "http://ns.adobe.com/pdf/enc#RC"
+)
+
+type Encryption struct {
+	EncryptedData []EncryptedData `xml:"EncryptedData"`
+}
+
+type EncryptedData struct {
+	Method struct {
+		Algorithm string `xml:"Algorithm,attr"`
+	} `xml:"EncryptionMethod"`
+	CipherReference struct {
+		URI string `xml:"URI,attr"`
+	} `xml:"CipherData>CipherReference"`
+}
+
+// fontObfuscation is the XOR key a font was mangled with and the number of
+// leading bytes it was applied to.
+type fontObfuscation struct {
+	key    []byte
+	length int
+}
+
+func (o fontObfuscation) deobfuscate(data []byte) []byte {
+	data = bytes.Clone(data)
+	for i := 0; i < len(data) && i < o.length; i++ {
+		data[i] ^= o.key[i%len(o.key)]
+	}
+	return data
+}
+
+// readObfuscatedFonts returns the archive files listed in
+// META-INF/encryption.xml as obfuscated with the IDPF or Adobe algorithm,
+// with the key derived from the book's identifier. Files encrypted in other
+// ways are left out; they cannot be read without DRM keys.
+func readObfuscatedFonts(r *epubArchive, pkg *Package) map[string]fontObfuscation {
+	data, err := readZipFile(r, "META-INF/encryption.xml")
+	if err != nil {
+		return nil
+	}
+	var enc Encryption
+	if err := xml.Unmarshal(data, &enc); err != nil {
+		log.Printf("Warning: Could not parse META-INF/encryption.xml: %v", err)
+		return nil
+	}
+
+	fonts := make(map[string]fontObfuscation)
+	for _, ed := range enc.EncryptedData {
+		var o fontObfuscation
+		switch ed.Method.Algorithm {
+		case idpfObfuscation:
+			o = idpfKey(pkg)
+		case adobeObfuscation:
+			o = adobeKey(pkg)
+		default:
+			continue
+		}
+		uri := ed.CipherReference.URI
+		if unescaped, err := url.PathUnescape(uri); err == nil {
+			uri = unescaped
+		}
+		if o.key == nil {
+			log.Printf("Warning: No identifier to deobfuscate %s with", uri)
+			continue
+		}
+		fonts[normalizeEpubPath(uri)] = o
+	}
+	return fonts
+}
+
+// idpfKey derives the key of the IDPF algorithm: the SHA-1 digest of the
+// unique identifier with all whitespace removed, applied to 1040 bytes.
+func idpfKey(pkg *Package) fontObfuscation {
+	id := uniqueIdentifier(pkg)
+	if id == "" {
+		return fontObfuscation{}
+	}
+	id = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, id)
+	sum := sha1.Sum([]byte(id))
+	return fontObfuscation{key: sum[:], length: 1040}
+}
+
+// adobeKey derives the key of the Adobe algorithm: the 16 bytes of the
+// book's UUID, applied to 1024 bytes. The unique identifier is preferred,
+// then any urn:uuid identifier.
+func adobeKey(pkg *Package) fontObfuscation {
+	candidates := []string{uniqueIdentifier(pkg)}
+	for _, id := range pkg.Metadata.Identifiers {
+		candidates = append(candidates, id.Value)
+	}
+	for _, id := range candidates {
+		_, id = parseIdentifier(id, "")
+		key, err := hex.DecodeString(strings.ReplaceAll(id, "-", ""))
+		if err == nil && len(key) == 16 {
+			return fontObfuscation{key: key, length: 1024}
+		}
+	}
+	return fontObfuscation{}
+}
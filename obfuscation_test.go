@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestObfuscationKeys(t *testing.T) {
+	pkg := &Package{
+		UniqueID: "bookid",
+		Metadata: Metadata{Identifiers: []Identifier{
+			{ID: "uuid", Value: "urn:uuid:0F1E2D3C-4B5A-6978-8796-A5B4C3D2E1F0"},
+			{ID: "bookid", Value: "\n  urn:isbn:978 0000 000002  \n"},
+		}},
+	}
+
+	idpf := idpfKey(pkg)
+	if got := hex.EncodeToString(idpf.key); got != "b877ec46d507b24041ac770710e8fca06ee2f297" || idpf.length != 1040 {
+		t.Errorf("idpfKey = %s/%d, expected the SHA-1 of urn:isbn:9780000000002 over 1040 bytes", got, idpf.length)
+	}
+	adobe := adobeKey(pkg)
+	if got := hex.EncodeToString(adobe.key); got != "0f1e2d3c4b5a69788796a5b4c3d2e1f0" || adobe.length != 1024 {
+		t.Errorf("adobeKey = %s/%d, expected the bytes of the urn:uuid identifier over 1024 bytes", got, adobe.length)
+	}
+
+	font := bytes.Repeat([]byte{0, 1, 0, 0, 'A'}, 300)
+	mangled := idpf.deobfuscate(font)
+	if bytes.Equal(mangled[:1040], font[:1040]) || !bytes.Equal(mangled[1040:], font[1040:]) {
+		t.Error("deobfuscate did not XOR exactly the first 1040 bytes")
+	}
+	if !bytes.Equal(idpf.deobfuscate(mangled), font) {
+		t.Error("deobfuscate does not restore the original font")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// MetaTag is a <meta> tag of the output head, with either a Name or, for
+// Open Graph, a Property.
+type MetaTag struct {
+	Name     string
+	Property string
+	Content  string
+}
+
+// metaTags describes the book in <meta> tags for search engines and, with
+// the Open Graph protocol, for the previews shown when the converted book
+// is shared: the authors, description and subjects, and the og: and book:
+// properties including the cover image, and the schema.org accessibility
+// claims of the book.
+func (rd *renderer) metaTags(pkg *Package) []MetaTag {
+	m := pkg.Metadata
+	var tags []MetaTag
+	add := func(name, property, content string) {
+		if content != "" {
+			tags = append(tags, MetaTag{Name: name, Property: property, Content: content})
+		}
+	}
+	authors := m.Authors()
+	description := plainText(m.Description)
+	add("author", "", strings.Join(authors, ", "))
+	add("description", "", description)
+	add("keywords", "", strings.Join(m.Subjects, ", "))
+
+	add("", "og:title", bookTitle(pkg))
+	add("", "og:type", "book")
+	add("", "og:url", rd.opts.BaseURL)
+	add("", "og:description", description)
+	add("", "og:image", rd.coverURL(pkg))
+	for _, author := range authors {
+		add("", "book:author", author)
+	}
+	add("", "book:isbn", m.ISBN())
+	add("", "book:release_date", m.Date())
+	for _, subject := range m.Subjects {
+		add("", "book:tag", subject)
+	}
+	a := m.Accessibility
+	for _, list := range []struct {
+		property string
+		values   []string
+	}{
+		{"schema:accessMode", a.AccessModes},
+		{"schema:accessModeSufficient", a.AccessModesSufficient},
+		{"schema:accessibilityFeature", a.Features},
+		{"schema:accessibilityHazard", a.Hazards},
+		{"schema:accessibilitySummary", []string{a.Summary}},
+	} {
+		for _, value := range list.values {
+			add("", list.property, value)
+		}
+	}
+	return tags
+}
+
+// coverURL returns the URL of the cover image for og:image, resolved
+// against --base-url if given. Sites showing previews do not load data
+// URIs, so there is none unless the cover is written to the assets
+// directory.
+func (rd *renderer) coverURL(pkg *Package) string {
+	imagePath := coverImagePath(pkg)
+	if imagePath == "" || rd.opts.NoImages || rd.opts.AssetsDir == "" {
+		return ""
+	}
+	src, err := rd.resourceURL(imagePath)
+	if err != nil {
+		log.Printf("Warning: Could not export cover image %s: %v", imagePath, err)
+		return ""
+	}
+	if strings.HasPrefix(src, "data:") {
+		return ""
+	}
+	if rd.opts.BaseURL != "" {
+		base, err := url.Parse(rd.opts.BaseURL)
+		ref, refErr := url.Parse(src)
+		if err == nil && refErr == nil {
+			return base.ResolveReference(ref).String()
+		}
+	}
+	return src
+}
+
+// plainText returns the text of a metadata value that may hold HTML
+// markup, as descriptions often do.
+func plainText(s string) string {
+	if !strings.Contains(s, "<") {
+		return metaText(s)
+	}
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return metaText(s)
+	}
+	return metaText(textContent(doc))
+}
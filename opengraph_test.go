@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetaTags(t *testing.T) {
+	pkg := &Package{Metadata: Metadata{
+		Title:       "Book",
+		Creators:    []Contributor{{Name: "Jane Doe", Role: "aut"}, {Name: "Rick Roe", Role: "ill"}},
+		Description: "<p>A <em>test</em> book.</p>",
+		Subjects:    []string{"Fiction", "Tests"},
+		Dates:       []Date{{Value: "2020"}},
+		Identifiers: []Identifier{{Value: "urn:isbn:9780000000001"}},
+		Accessibility: Accessibility{
+			AccessModes: []string{"textual", "visual"},
+			Features:    []string{"alternativeText"},
+			Summary:     "Images have descriptions.",
+		},
+	}}
+	rd := &renderer{opts: &options{BaseURL: "https://example.com/book.html"}}
+	expected := []MetaTag{
+		{Name: "author", Content: "Jane Doe"},
+		{Name: "description", Content: "A test book."},
+		{Name: "keywords", Content: "Fiction, Tests"},
+		{Property: "og:title", Content: "Book"},
+		{Property: "og:type", Content: "book"},
+		{Property: "og:url", Content: "https://example.com/book.html"},
+		{Property: "og:description", Content: "A test book."},
+		{Property: "book:author", Content: "Jane Doe"},
+		{Property: "book:isbn", Content: "9780000000001"},
+		{Property: "book:release_date", Content: "2020"},
+		{Property: "book:tag", Content: "Fiction"},
+		{Property: "book:tag", Content: "Tests"},
+		{Property: "schema:accessMode", Content: "textual"},
+		{Property: "schema:accessMode", Content: "visual"},
+		{Property: "schema:accessibilityFeature", Content: "alternativeText"},
+		{Property: "schema:accessibilitySummary", Content: "Images have descriptions."},
+	}
+	if tags := rd.metaTags(pkg); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("metaTags = %+v, expected %+v", tags, expected)
+	}
+}
+
+func TestMetaTagsTemplate(t *testing.T) {
+	data := TemplateData{Title: "Book", MetaTags: []MetaTag{
+		{Name: "author", Content: `Jane "JD" Doe`},
+		{Property: "og:type", Content: "book"},
+	}}
+	tests := []struct {
+		opts     *options
+		expected string
+	}{
+		{&options{}, "<meta name=\"author\" content=\"Jane &#34;JD&#34; Doe\">\n<meta property=\"og:type\" content=\"book\">\n"},
+		{&options{Minify: true}, `<meta name=author content="Jane &#34;JD&#34; Doe"><meta property=og:type content="book">`},
+	}
+	for _, tt := range tests {
+		tmpl, err := loadTemplate(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, data); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("template output %q does not contain %q", out.String(), tt.expected)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// opfNamespaces are the namespaces of the prefixes package documents use,
+// which malformed ones use without declaring them.
+var opfNamespaces = []struct{ prefix, uri string }{
+	{"dc", "http://purl.org/dc/elements/1.1/"},
+	{"opf", "http://www.idpf.org/2007/opf"},
+}
+
+// The parts of a package document scanOPF picks out of its text.
+var (
+	packageTag = regexp.MustCompile(`<(?:\w+:)?package\b`)
+	opfTag     = regexp.MustCompile(`<(?:\w+:)?(package|item|itemref|spine)\b([^>]*)>`)
+	opfAttr    = regexp.MustCompile(`([\w.:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	dcElement  = regexp.MustCompile(`(?s)<dc:(title|creator|language|identifier)\b([^>]*)>(.*?)</dc:\w+\s*>`)
+)
+
+// unmarshalOPF parses a package document. Malformed ones are parsed again
+// leniently after repairOPF, and if that fails too their manifest, spine
+// and main metadata are picked out of their text by scanOPF, so that
+// slightly broken books still convert.
+func unmarshalOPF(data []byte, opfPath string) (*Package, error) {
+	var pkg Package
+	err := xml.Unmarshal(data, &pkg)
+	if err == nil {
+		return &pkg, nil
+	}
+	log.Printf("Warning: %s is malformed, reading it leniently: %v", opfPath, err)
+	data = repairOPF(data, opfPath)
+
+	pkg = Package{}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	// repairOPF has already decoded the document to UTF-8.
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	if dec.Decode(&pkg) == nil && len(pkg.Manifest.Items) > 0 {
+		return &pkg, nil
+	}
+	scanned := scanOPF(data)
+	if len(scanned.Manifest.Items) == 0 {
+		return nil, err
+	}
+	log.Printf("Warning: Recovered %d manifest items and %d spine items from the text of %s",
+		len(scanned.Manifest.Items), len(scanned.Spine.Itemrefs), opfPath)
+	return scanned, nil
+}
+
+// repairOPF fixes the usual faults of malformed package documents: it
+// drops stray bytes before the XML declaration, decodes them to UTF-8 like
+// content documents, removes the characters XML does not allow, and declares
+// the dc and opf prefixes on the package element if they are used without
+// being declared.
+func repairOPF(data []byte, opfPath string) []byte {
+	utf16 := bytes.HasPrefix(data, []byte("\xff\xfe")) || bytes.HasPrefix(data, []byte("\xfe\xff"))
+	if i := bytes.IndexByte(data, '<'); i > 0 && !utf16 {
+		data = data[i:]
+	}
+	data = decodeContent(data, opfPath)
+	data = bytes.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}, bytes.ToValidUTF8(data, []byte(string(utf8.RuneError))))
+
+	var decls strings.Builder
+	for _, ns := range opfNamespaces {
+		if bytes.Contains(data, []byte(ns.prefix+":")) && !bytes.Contains(data, []byte("xmlns:"+ns.prefix)) {
+			decls.WriteString(` xmlns:` + ns.prefix + `="` + ns.uri + `"`)
+		}
+	}
+	if loc := packageTag.FindIndex(data); loc != nil && decls.Len() > 0 {
+		data = append(data[:loc[1]:loc[1]], append([]byte(decls.String()), data[loc[1]:]...)...)
+	}
+	return data
+}
+
+// scanOPF picks the package attributes, the manifest items, the spine and
+// the titles, creators, languages and identifiers out of the text of a
+// package document that cannot be parsed as XML.
+func scanOPF(data []byte) *Package {
+	var pkg Package
+	for _, m := range opfTag.FindAllSubmatch(data, -1) {
+		attrs := make(map[string]string)
+		for _, a := range opfAttr.FindAllSubmatch(m[2], -1) {
+			name := string(a[1])
+			if _, local, ok := strings.Cut(name, ":"); ok && !strings.HasPrefix(name, "xml:") {
+				name = local
+			}
+			attrs[name] = html.UnescapeString(string(a[2]) + string(a[3]))
+		}
+		switch string(m[1]) {
+		case "package":
+			pkg.Version, pkg.UniqueID = attrs["version"], attrs["unique-identifier"]
+			pkg.Lang, pkg.Dir, pkg.Prefix = attrs["xml:lang"], attrs["dir"], attrs["prefix"]
+		case "item":
+			pkg.Manifest.Items = append(pkg.Manifest.Items, Item{
+				ID: attrs["id"], Href: attrs["href"], MediaType: attrs["media-type"], Properties: attrs["properties"],
+				Fallback: attrs["fallback"], MediaOverlay: attrs["media-overlay"],
+			})
+		case "itemref":
+			pkg.Spine.Itemrefs = append(pkg.Spine.Itemrefs, Itemref{Idref: attrs["idref"], Linear: attrs["linear"], Properties: attrs["properties"]})
+		case "spine":
+			pkg.Spine.Toc, pkg.Spine.PageProgressionDir = attrs["toc"], attrs["page-progression-direction"]
+		}
+	}
+	for _, m := range dcElement.FindAllSubmatch(data, -1) {
+		var id string
+		for _, a := range opfAttr.FindAllSubmatch(m[2], -1) {
+			if string(a[1]) == "id" {
+				id = string(a[2]) + string(a[3])
+			}
+		}
+		value := strings.TrimSpace(html.UnescapeString(string(m[3])))
+		switch string(m[1]) {
+		case "title":
+			pkg.Metadata.Titles = append(pkg.Metadata.Titles, Title{ID: id, Value: value})
+		case "creator":
+			pkg.Metadata.Creators = append(pkg.Metadata.Creators, Contributor{ID: id, Name: value})
+		case "language":
+			pkg.Metadata.Languages = append(pkg.Metadata.Languages, value)
+		case "identifier":
+			pkg.Metadata.Identifiers = append(pkg.Metadata.Identifiers, Identifier{ID: id, Value: value})
+		}
+	}
+	return &pkg
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalOPF(t *testing.T) {
+	const body = `<metadata><dc:title>Caf` + "\xe9" + `</dc:title><dc:creator opf:role="aut">Jane Doe</dc:creator><dc:language>fr</dc:language></metadata>
+<manifest><item id="c1" href="c1.xhtml" media-type="application/xhtml+xml"/></manifest>
+<spine><itemref idref="c1"/></spine></package>`
+	tests := []struct {
+		name string
+		opf  string
+	}{
+		{"undeclared prefixes and a legacy encoding",
+			`<?xml version="1.0" encoding="ISO-8859-1"?><package xmlns="http://www.idpf.org/2007/opf" version="2.0">` + body},
+		{"stray bytes and control characters",
+			"junk\x00 <?xml version=\"1.0\" encoding=\"windows-1252\"?>\n<package version=\"2.0\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\" xmlns:opf=\"http://www.idpf.org/2007/opf\">\x01" + body},
+		{"mismatched tags",
+			`<package version="2.0"><metadata><dc:title>Caf` + "\xe9" + `</dc:title><dc:creator>Jane Doe</dc:creator><dc:language>fr</dc:language></p></metadata>
+<manifest><item id="c1" href="c1.xhtml" media-type="application/xhtml+xml"></manifest>
+<spine><itemref idref="c1"></spine></package>`},
+	}
+	for _, tt := range tests {
+		pkg, err := unmarshalOPF([]byte(tt.opf), "content.opf")
+		if err != nil {
+			t.Errorf("unmarshalOPF with %s: %v", tt.name, err)
+			continue
+		}
+		pkg.Metadata.resolve()
+		items := []Item{{ID: "c1", Href: "c1.xhtml", MediaType: "application/xhtml+xml"}}
+		if !reflect.DeepEqual(pkg.Manifest.Items, items) || len(pkg.Spine.Itemrefs) != 1 || pkg.Spine.Itemrefs[0].Idref != "c1" {
+			t.Errorf("unmarshalOPF with %s gave manifest %+v and spine %+v", tt.name, pkg.Manifest.Items, pkg.Spine.Itemrefs)
+		}
+		m := pkg.Metadata
+		if m.Title != "Café" || len(m.Creators) != 1 || m.Creators[0].Name != "Jane Doe" || !reflect.DeepEqual(m.Languages, []string{"fr"}) || pkg.Version != "2.0" {
+			t.Errorf("unmarshalOPF with %s gave version %q, title %q, creators %+v and languages %q", tt.name, pkg.Version, m.Title, m.Creators, m.Languages)
+		}
+	}
+
+	if _, err := unmarshalOPF([]byte("not a package"), "content.opf"); err == nil {
+		t.Error("unmarshalOPF accepted a document without a manifest")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// readAlongScript plays the audio of a --read-along chapter in step with its
+// text: the fragment being read is highlighted as the audio plays, and a
+// click on a fragment plays it.
+const readAlongScript = `document.addEventListener("DOMContentLoaded", function () {
+  var players = document.querySelectorAll("audio[data-read-along]");
+  players.forEach(function (audio) {
+    var clips = document.querySelectorAll('[data-clip-audio="' + audio.dataset.readAlong + '"]');
+    var active = null;
+    audio.addEventListener("timeupdate", function () {
+      var t = audio.currentTime, current = null;
+      clips.forEach(function (c) {
+        var end = c.dataset.clipEnd ? +c.dataset.clipEnd : Infinity;
+        if (t >= +c.dataset.clipBegin && t < end) current = c;
+      });
+      if (current === active) return;
+      if (active) active.classList.remove("read-along-active");
+      if (current) current.classList.add("read-along-active");
+      active = current;
+    });
+    audio.addEventListener("play", function () {
+      players.forEach(function (other) { if (other !== audio) other.pause(); });
+    });
+    clips.forEach(function (c) {
+      c.addEventListener("click", function () {
+        audio.currentTime = +c.dataset.clipBegin;
+        audio.play();
+      });
+    });
+  });
+});`
+
+// overlayClip is a fragment of a content document and the clip of audio
+// that reads it, from a par element of a media overlay.
+type overlayClip struct {
+	Path, ID   string  // archive path of the document and ID of the fragment
+	Audio      string  // archive path of the audio file
+	Begin, End float64 // clip in seconds, End 0 for the end of the file
+}
+
+// readOverlays reads the SMIL media overlays of the content documents of a
+// book, the manifest items their media-overlay attributes name, and groups
+// their clips by the document they read.
+func readOverlays(r *epubArchive, pkg *Package) map[string][]overlayClip {
+	items := make(map[string]Item)
+	for _, item := range pkg.Manifest.Items {
+		items[item.ID] = item
+	}
+	clips := make(map[string][]overlayClip)
+	seen := make(map[string]bool)
+	for _, item := range pkg.Manifest.Items {
+		overlay, ok := items[item.MediaOverlay]
+		if item.MediaOverlay == "" || seen[item.MediaOverlay] {
+			continue
+		}
+		seen[item.MediaOverlay] = true
+		if !ok {
+			log.Printf("Warning: Media overlay %s of %s is not in the manifest", item.MediaOverlay, item.Href)
+			continue
+		}
+		smilPath := resolveEpubPath(pkg.OpfDir, overlay.Href)
+		data, err := readZipFile(r, smilPath)
+		if err == nil {
+			var parsed []overlayClip
+			if parsed, err = parseSMIL(bytes.NewReader(data), smilPath); err == nil {
+				for _, clip := range parsed {
+					clips[clip.Path] = append(clips[clip.Path], clip)
+				}
+				continue
+			}
+		}
+		log.Printf("Warning: Could not read media overlay %s: %v", smilPath, err)
+	}
+	return clips
+}
+
+// parseSMIL returns the clips of the par elements of a SMIL document, with
+// their sources resolved against the document's archive path. Pars without
+// both a text and an audio source are skipped.
+func parseSMIL(r io.Reader, smilPath string) ([]overlayClip, error) {
+	var clips []overlayClip
+	var clip overlayClip
+	var hasText, hasAudio bool
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return clips, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			attr := func(name string) string {
+				for _, a := range t.Attr {
+					if a.Name.Local == name {
+						return a.Value
+					}
+				}
+				return ""
+			}
+			switch t.Name.Local {
+			case "par":
+				clip, hasText, hasAudio = overlayClip{}, false, false
+			case "text":
+				clip.Path, clip.ID = resolveHref(smilPath, attr("src"))
+				hasText = attr("src") != ""
+			case "audio":
+				if clip.Audio, _ = resolveHref(smilPath, attr("src")); attr("src") == "" {
+					continue
+				}
+				for _, c := range []struct {
+					name  string
+					value *float64
+				}{{"clipBegin", &clip.Begin}, {"clipEnd", &clip.End}} {
+					if v := attr(c.name); v != "" {
+						if *c.value, err = parseClockValue(v); err != nil {
+							return nil, fmt.Errorf("%s of %s: %w", c.name, attr("src"), err)
+						}
+					}
+				}
+				hasAudio = true
+			}
+		case xml.EndElement:
+			if t.Name.Local == "par" && hasText && hasAudio {
+				clips = append(clips, clip)
+			}
+		}
+	}
+}
+
+// parseClockValue returns the seconds of a SMIL clock value: a full clock
+// value such as "0:01:02.5", a partial one such as "01:02.5", or a timecount
+// such as "62.5s", "500ms", "2min" or "1h", in seconds without a unit.
+func parseClockValue(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("invalid clock value %q", s)
+		}
+		var seconds float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil || v < 0 || i < len(parts)-1 && strings.Contains(part, ".") {
+				return 0, fmt.Errorf("invalid clock value %q", s)
+			}
+			seconds = seconds*60 + v
+		}
+		return seconds, nil
+	}
+	value, scale := s, 1.0
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"ms", 0.001}, {"min", 60}, {"h", 3600}, {"s", 1}} {
+		if number, ok := strings.CutSuffix(s, unit.suffix); ok {
+			value, scale = number, unit.scale
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid clock value %q", s)
+	}
+	return v * scale, nil
+}
+
+// markClips tags the fragments of a chapter that its media overlay reads,
+// before cleaning renames their IDs, with the player of their audio and
+// their clip, and returns the audio files of the players in the order
+// they are first read.
+func (rd *renderer) markClips(body *html.Node, ch Chapter) []string {
+	clips := rd.overlays[ch.Path]
+	if len(clips) == 0 {
+		return nil
+	}
+	byID := make(map[string]*html.Node)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if id := getAttr(n, "id"); id != "" && byID[id] == nil {
+				byID[id] = n
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+
+	var audios []string
+	byAudio := make(map[string]int)
+	for _, clip := range clips {
+		n := byID[clip.ID]
+		if n == nil || hasAttr(n, "data-clip-begin") {
+			continue
+		}
+		player, ok := byAudio[clip.Audio]
+		if !ok {
+			player = rd.players + len(audios)
+			byAudio[clip.Audio] = player
+			audios = append(audios, clip.Audio)
+		}
+		n.Attr = append(n.Attr,
+			html.Attribute{Key: "data-clip-audio", Val: strconv.Itoa(player)},
+			html.Attribute{Key: "data-clip-begin", Val: strconv.FormatFloat(clip.Begin, 'f', -1, 64)})
+		if clip.End > 0 {
+			n.Attr = append(n.Attr, html.Attribute{Key: "data-clip-end", Val: strconv.FormatFloat(clip.End, 'f', -1, 64)})
+		}
+	}
+	return audios
+}
+
+// addPlayers inserts the audio players of the fragments markClips tagged at
+// the start of a cleaned chapter.
+func (rd *renderer) addPlayers(body *html.Node, audios []string) {
+	first := body.FirstChild
+	for _, audioPath := range audios {
+		player := strconv.Itoa(rd.players)
+		rd.players++
+		audio := &html.Node{Type: html.ElementNode, Data: "audio", DataAtom: atom.Audio, Attr: []html.Attribute{
+			{Key: "controls"}, {Key: "class", Val: "read-along"}, {Key: "data-read-along", Val: player}}}
+		src, err := rd.mediaURL(audioPath, true)
+		if err != nil {
+			log.Printf("Warning: Could not embed media %s: %v", audioPath, err)
+		} else {
+			audio.Attr = append(audio.Attr, html.Attribute{Key: "src", Val: src})
+		}
+		body.InsertBefore(audio, first)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestParseClockValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+		ok       bool
+	}{
+		{"0:01:02.5", 62.5, true},
+		{"01:02.5", 62.5, true},
+		{"62.5", 62.5, true},
+		{"62.5s", 62.5, true},
+		{"500ms", 0.5, true},
+		{"2min", 120, true},
+		{"1.5h", 5400, true},
+		{"1:2:3:4", 0, false},
+		{"1.5:00", 0, false},
+		{"-1s", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		seconds, err := parseClockValue(tt.input)
+		if (err == nil) != tt.ok || seconds != tt.expected {
+			t.Errorf("parseClockValue(%q) = %v, %v, expected %v", tt.input, seconds, err, tt.expected)
+		}
+	}
+}
+
+const testSMIL = `<smil xmlns="http://www.w3.org/ns/SMIL" xmlns:epub="http://www.idpf.org/2007/ops" version="3.0">
+<body>
+<seq epub:textref="../text/ch1.xhtml">
+<par><text src="../text/ch1.xhtml#p1"/><audio src="../audio/ch1.mp3" clipBegin="0:00:00" clipEnd="0:00:02.5"/></par>
+<par><text src="../text/ch1.xhtml#p2"/><audio src="../audio/ch1.mp3" clipBegin="2.5s" clipEnd="4s"/></par>
+<par><text src="../text/ch1.xhtml#p3"/></par>
+<par><text src="../text/ch1.xhtml#p3"/><audio src="../audio/ch1.mp3" clipBegin="4s"/></par>
+</seq>
+</body>
+</smil>`
+
+func TestReadAlong(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"OEBPS/smil/ch1.smil": []byte(testSMIL),
+		"OEBPS/audio/ch1.mp3": []byte("MP3"),
+	})
+	pkg := &Package{OpfDir: "OEBPS"}
+	pkg.Manifest.Items = []Item{
+		{ID: "ch1", Href: "text/ch1.xhtml", MediaType: "application/xhtml+xml", MediaOverlay: "smil1"},
+		{ID: "smil1", Href: "smil/ch1.smil", MediaType: "application/smil+xml"},
+		{ID: "mp3", Href: "audio/ch1.mp3", MediaType: "audio/mpeg"},
+	}
+	overlays := readOverlays(r, pkg)
+	clips := overlays["OEBPS/text/ch1.xhtml"]
+	expected := []overlayClip{
+		{Path: "OEBPS/text/ch1.xhtml", ID: "p1", Audio: "OEBPS/audio/ch1.mp3", Begin: 0, End: 2.5},
+		{Path: "OEBPS/text/ch1.xhtml", ID: "p2", Audio: "OEBPS/audio/ch1.mp3", Begin: 2.5, End: 4},
+		{Path: "OEBPS/text/ch1.xhtml", ID: "p3", Audio: "OEBPS/audio/ch1.mp3", Begin: 4},
+	}
+	if len(clips) != len(expected) {
+		t.Fatalf("readOverlays gave %+v, expected %+v", clips, expected)
+	}
+	for i := range expected {
+		if clips[i] != expected[i] {
+			t.Errorf("readOverlays gave clip %+v, expected %+v", clips[i], expected[i])
+		}
+	}
+
+	doc, err := html.Parse(strings.NewReader(`<html><body><p id="p1">One</p><p id="p2">Two</p><p id="p3">Three</p><p>Four</p></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd := newRenderer(pkg, r, &options{ReadAlong: true})
+	rd.anchors = &anchors{}
+	rd.overlays = overlays
+	var b strings.Builder
+	rd.renderChapter(Chapter{Path: "OEBPS/text/ch1.xhtml", Doc: doc}, &b)
+	out := b.String()
+	for _, want := range []string{
+		`<audio controls="" class="read-along" data-read-along="0" src="data:audio/mpeg;base64,`,
+		`data-clip-audio="0" data-clip-begin="0" data-clip-end="2.5">One</p>`,
+		`data-clip-audio="0" data-clip-begin="2.5" data-clip-end="4">Two</p>`,
+		`data-clip-audio="0" data-clip-begin="4">Three</p>`,
+		`<p>Four</p>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("renderChapter gave %s, expected it to contain %s", out, want)
+		}
+	}
+	if rd.players != 1 {
+		t.Errorf("renderChapter added %d players, expected 1", rd.players)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// pageTarget is a print page of the book's page list.
+type pageTarget struct {
+	Label string
+	Path  string // archive path of the document the page starts in
+	ID    string // element the page starts at, "" for the start of the document
+}
+
+// readPageList reads the print pages of a book from the page-list of its
+// EPUB 3 navigation document or the pageList of its NCX, the one of the
+// package's version first.
+func readPageList(r *epubArchive, pkg *Package) []pageTarget {
+	var pages []pageTarget
+	byVersion(pkg, func() bool {
+		if doc, path := readNavDoc(r, pkg); doc != nil {
+			if list := navList(doc, "page-list"); list != nil {
+				for li := list.FirstChild; li != nil; li = li.NextSibling {
+					if a := findElement(li, "a"); a != nil {
+						pages = append(pages, newPageTarget(path, textContent(a), getAttr(a, "href")))
+					}
+				}
+			}
+		}
+		return len(pages) > 0
+	}, func() bool {
+		if path := ncxPath(pkg); path != "" {
+			// Errors have been reported while reading the table of contents.
+			if ncx, err := parseNCX(r, path); err == nil {
+				for _, p := range ncx.PageTargets {
+					pages = append(pages, newPageTarget(path, p.Label, p.Content.Src))
+				}
+			}
+		}
+		return len(pages) > 0
+	})
+	return pages
+}
+
+func newPageTarget(docPath, label, href string) pageTarget {
+	target, id := resolveHref(docPath, href)
+	return pageTarget{Label: strings.Join(strings.Fields(label), " "), Path: target, ID: id}
+}
+
+// pageList returns the links to the pages of the book in the output. Pages
+// in documents left out are dropped.
+func pageList(pages []pageTarget, a *anchors) []TOCEntry {
+	var entries []TOCEntry
+	for _, p := range pages {
+		if href, ok := a.targetHref(p.Path, p.ID); ok {
+			entries = append(entries, TOCEntry{Title: p.Label, Href: href})
+		}
+	}
+	return entries
+}
+
+// pagesByPath groups pages by the document they start in.
+func pagesByPath(pages []pageTarget) map[string][]pageTarget {
+	byPath := make(map[string][]pageTarget)
+	for _, p := range pages {
+		byPath[p.Path] = append(byPath[p.Path], p)
+	}
+	return byPath
+}
+
+// markPages makes the print pages starting in a cleaned chapter visible
+// for --page-numbers with a <span class="page-number"> holding "[p. N]",
+// placed inside the element the page starts at, usually an empty page
+// break marker, or at the start of the chapter.
+func (rd *renderer) markPages(body *html.Node, ch Chapter) {
+	pages := rd.pages[ch.Path]
+	if len(pages) == 0 {
+		return
+	}
+	labels := make(map[string]string)
+	for _, p := range slices.Backward(pages) {
+		if p.ID == "" {
+			body.InsertBefore(pageMarker(p.Label), body.FirstChild)
+		} else {
+			labels[rd.anchors.id(ch.Path, p.ID)] = p.Label
+		}
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if label, ok := labels[getAttr(c, "id")]; ok {
+				if isVoidElement(c.Data) {
+					n.InsertBefore(pageMarker(label), c)
+				} else {
+					c.InsertBefore(pageMarker(label), c.FirstChild)
+				}
+			}
+			walk(c)
+		}
+	}
+	walk(body)
+}
+
+func pageMarker(label string) *html.Node {
+	span := &html.Node{Type: html.ElementNode, Data: "span", DataAtom: atom.Span,
+		Attr: []html.Attribute{{Key: "class", Val: "page-number"}}}
+	span.AppendChild(&html.Node{Type: html.TextNode, Data: "[p. " + label + "]"})
+	return span
+}
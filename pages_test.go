@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestReadPageListNCX(t *testing.T) {
+	ncx := `<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/"><navMap/><pageList>
+<pageTarget type="normal" value="1"><navLabel><text>1</text></navLabel><content src="Text/ch1.xhtml"/></pageTarget>
+<pageTarget type="normal" value="2"><navLabel><text> 2 </text></navLabel><content src="Text/ch1.xhtml#p2"/></pageTarget>
+</pageList></ncx>`
+	r := openTestArchive(t, map[string][]byte{"OEBPS/toc.ncx": []byte(ncx)})
+	pkg := &Package{OpfDir: "OEBPS"}
+	pkg.Manifest.Items = []Item{{ID: "ncx", Href: "toc.ncx", MediaType: ncxMediaType}}
+	expected := []pageTarget{
+		{Label: "1", Path: "OEBPS/Text/ch1.xhtml"},
+		{Label: "2", Path: "OEBPS/Text/ch1.xhtml", ID: "p2"},
+	}
+	if pages := readPageList(r, pkg); !reflect.DeepEqual(pages, expected) {
+		t.Errorf("readPageList = %+v, expected %+v", pages, expected)
+	}
+}
+
+func TestMarkPages(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>One</p><span id="p2" epub:type="pagebreak"></span><p>Two<br id="p3">Three</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := Chapter{Path: "ch1.xhtml", Doc: doc}
+	rd := &renderer{pages: pagesByPath([]pageTarget{
+		{Label: "1", Path: "ch1.xhtml"},
+		{Label: "2", Path: "ch1.xhtml", ID: "p2"},
+		{Label: "3", Path: "ch1.xhtml", ID: "p3"},
+		{Label: "4", Path: "ch2.xhtml"},
+	})}
+	body := findElement(doc, "body")
+	rd.markPages(body, ch)
+	var out strings.Builder
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		html.Render(&out, c)
+	}
+	expected := `<span class="page-number">[p. 1]</span><p>One</p>` +
+		`<span id="p2" epub:type="pagebreak"><span class="page-number">[p. 2]</span></span>` +
+		`<p>Two<span class="page-number">[p. 3]</span><br id="p3"/>Three</p>`
+	if out.String() != expected {
+		t.Errorf("markPages = %q, expected %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+)
+
+// hiddenFlags are the flags left out of the usage message, as they are
+// only of use for working on epub2html itself.
+var hiddenFlags = map[string]bool{"pprof": true}
+
+// printVisibleDefaults prints the defaults of the flags of fs like
+// fs.PrintDefaults, but without hiddenFlags.
+func printVisibleDefaults(fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+			// Var takes the current value as the default, which differs
+			// from it once the flag is set.
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// startPprof serves the net/http/pprof profiles of the conversion at addr,
+// e.g. localhost:6060, to measure where the renderer spends its time with
+// go tool pprof http://localhost:6060/debug/pprof/profile.
+func startPprof(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Serving profiles at http://%s/debug/pprof/", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, nil); err != nil {
+			log.Printf("Warning: Stopped serving profiles: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrintVisibleDefaults(t *testing.T) {
+	fs := flag.NewFlagSet("epub2html", flag.ContinueOnError)
+	fs.Int("jobs", 4, "use `n` goroutines")
+	fs.String("pprof", "", "serve profiles at `addr`")
+	if err := fs.Parse([]string{"--jobs", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	fs.SetOutput(&b)
+	printVisibleDefaults(fs)
+	expected := "  -jobs n\n    \tuse n goroutines (default 4)\n"
+	if b.String() != expected {
+		t.Errorf("printVisibleDefaults printed %q, expected %q", b.String(), expected)
+	}
+}
+
+func TestStartPprof(t *testing.T) {
+	if err := startPprof("localhost:-1"); err == nil {
+		t.Error("startPprof accepted an invalid address")
+	}
+	// Listening on port 0 picks a free port, which only the log tells, so
+	// check that the profiles are registered with the default mux instead.
+	if err := startPprof("localhost:0"); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine") {
+		t.Errorf("/debug/pprof/ gave status %d and %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// reservedPrefixes are the prefixes EPUB 3 predefines, which packages use
+// without declaring them.
+var reservedPrefixes = map[string]string{
+	"a11y":      "http://www.idpf.org/epub/vocab/package/a11y/#",
+	"dcterms":   "http://purl.org/dc/terms/",
+	"marc":      "http://id.loc.gov/vocabulary/",
+	"media":     "http://www.idpf.org/epub/vocab/overlays/#",
+	"msv":       "http://www.idpf.org/epub/vocab/structure/magazine/#",
+	"onix":      "http://www.editeur.org/ONIX/book/codelists/current.html#",
+	"prism":     "http://www.prismstandard.org/specifications/3.0/PRISM_CV_Spec_3.0.htm#",
+	"rendition": "http://www.idpf.org/vocab/rendition/#",
+	"schema":    "http://schema.org/",
+	"xsd":       "http://www.w3.org/2001/XMLSchema#",
+}
+
+// metaVocab is the vocabulary of the <meta> properties without a prefix,
+// such as title-type or belongs-to-collection.
+const metaVocab = "http://idpf.org/epub/vocab/package/meta/#"
+
+// parsePrefixes parses the prefix attribute of the package element, a list
+// of "prefix: IRI" pairs such as
+//
+//	ibooks: http://vocabulary.itunes.apple.com/rdf/ibooks/vocabulary-extensions-1.0/
+//
+// Pairs that are not well formed are reported and skipped.
+func parsePrefixes(attr string) map[string]string {
+	prefixes := make(map[string]string)
+	fields := strings.Fields(attr)
+	for i := 0; i < len(fields); i++ {
+		prefix, ok := strings.CutSuffix(fields[i], ":")
+		if !ok || prefix == "" || i+1 == len(fields) || strings.HasSuffix(fields[i+1], ":") {
+			log.Printf("Warning: Ignoring malformed prefix declaration %q", fields[i])
+			continue
+		}
+		i++
+		prefixes[prefix] = fields[i]
+	}
+	return prefixes
+}
+
+// expandProperty returns the IRI of a property, or "" if its prefix is not
+// declared. Properties without a prefix are in vocab.
+func expandProperty(property, vocab string, declared map[string]string) string {
+	prefix, ref, ok := strings.Cut(property, ":")
+	if !ok {
+		return vocab + property
+	}
+	if iri, ok := declared[prefix]; ok {
+		return iri + ref
+	}
+	if iri, ok := reservedPrefixes[prefix]; ok {
+		return iri + ref
+	}
+	return ""
+}
+
+// canonicalProperty returns the name of a property with the reserved prefix
+// of its vocabulary, such as schema:accessMode for s:accessMode when the
+// book declares s for schema.org, so that the properties are recognized
+// whatever the prefix the book uses. A property whose prefix is declared
+// for another vocabulary than the reserved one of the same name is
+// returned as its IRI, so that it is not taken for the reserved one.
+func canonicalProperty(property, iri string) string {
+	if iri == "" {
+		return property
+	}
+	for prefix, vocab := range reservedPrefixes {
+		if ref, ok := strings.CutPrefix(iri, vocab); ok && ref != "" {
+			return prefix + ":" + ref
+		}
+	}
+	if prefix, _, ok := strings.Cut(property, ":"); ok && reservedPrefixes[prefix] != "" {
+		return iri
+	}
+	return property
+}
+
+// resolvePrefixes reads the prefixes the package declares, gives every
+// <meta> property its IRI and renames the properties of the metadata, the
+// manifest and the spine to the reserved prefixes of their vocabularies.
+func (pkg *Package) resolvePrefixes() {
+	declared := parsePrefixes(pkg.Prefix)
+	if len(declared) > 0 {
+		pkg.Metadata.Prefixes = declared
+	}
+	for i := range pkg.Metadata.Meta {
+		meta := &pkg.Metadata.Meta[i]
+		property := strings.TrimSpace(meta.Property)
+		if property == "" {
+			continue
+		}
+		meta.PropertyIRI = expandProperty(property, metaVocab, declared)
+		if meta.PropertyIRI == "" {
+			log.Printf("Warning: The prefix of the metadata property %q is not declared", property)
+		}
+		meta.Property = canonicalProperty(property, meta.PropertyIRI)
+	}
+	if len(declared) == 0 {
+		return
+	}
+	canonical := func(properties string) string {
+		fields := strings.Fields(properties)
+		for i, p := range fields {
+			if strings.Contains(p, ":") {
+				fields[i] = canonicalProperty(p, expandProperty(p, "", declared))
+			}
+		}
+		return strings.Join(fields, " ")
+	}
+	for i := range pkg.Manifest.Items {
+		pkg.Manifest.Items[i].Properties = canonical(pkg.Manifest.Items[i].Properties)
+	}
+	for i := range pkg.Spine.Itemrefs {
+		pkg.Spine.Itemrefs[i].Properties = canonical(pkg.Spine.Itemrefs[i].Properties)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	tests := []struct {
+		attr     string
+		expected map[string]string
+	}{
+		{"", map[string]string{}},
+		{"ibooks: http://vocabulary.itunes.apple.com/rdf/ibooks/vocabulary-extensions-1.0/",
+			map[string]string{"ibooks": "http://vocabulary.itunes.apple.com/rdf/ibooks/vocabulary-extensions-1.0/"}},
+		{"  s: http://schema.org/\n\tfoaf:  http://xmlns.com/foaf/spec/ ",
+			map[string]string{"s": "http://schema.org/", "foaf": "http://xmlns.com/foaf/spec/"}},
+		{"broken http://example.com/ a: b: http://example.org/", map[string]string{"b": "http://example.org/"}},
+	}
+	for _, tt := range tests {
+		if got := parsePrefixes(tt.attr); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("parsePrefixes(%q) = %v, expected %v", tt.attr, got, tt.expected)
+		}
+	}
+}
+
+func TestResolvePrefixes(t *testing.T) {
+	pkg := &Package{
+		Prefix: "s: http://schema.org/ ibooks: http://vocabulary.itunes.apple.com/rdf/ibooks/vocabulary-extensions-1.0/ schema: http://example.com/schema/ r: http://www.idpf.org/vocab/rendition/#",
+		Metadata: Metadata{Meta: []Meta{
+			{Property: "s:accessMode", Value: "textual"},
+			{Property: "ibooks:version", Value: "1.2"},
+			{Property: "schema:accessMode", Value: "visual"},
+			{Property: "dcterms:modified", Value: "2024-01-01T00:00:00Z"},
+			{Property: "title-type", Refines: "#t1", Value: "main"},
+			{Property: "acme:edition", Value: "2"},
+		}},
+		Spine: Spine{Itemrefs: []Itemref{{Idref: "c1", Properties: "page-spread-left r:layout-pre-paginated"}}},
+	}
+	pkg.resolvePrefixes()
+	pkg.Metadata.resolve()
+
+	expected := []struct{ property, iri string }{
+		{"schema:accessMode", "http://schema.org/accessMode"},
+		{"ibooks:version", "http://vocabulary.itunes.apple.com/rdf/ibooks/vocabulary-extensions-1.0/version"},
+		{"http://example.com/schema/accessMode", "http://example.com/schema/accessMode"},
+		{"dcterms:modified", "http://purl.org/dc/terms/modified"},
+		{"title-type", "http://idpf.org/epub/vocab/package/meta/#title-type"},
+		{"acme:edition", ""},
+	}
+	for i, e := range expected {
+		if m := pkg.Metadata.Meta[i]; m.Property != e.property || m.PropertyIRI != e.iri {
+			t.Errorf("resolvePrefixes gave meta %d property %q with IRI %q, expected %q with IRI %q", i, m.Property, m.PropertyIRI, e.property, e.iri)
+		}
+	}
+	if modes := pkg.Metadata.Accessibility.AccessModes; !reflect.DeepEqual(modes, []string{"textual"}) {
+		t.Errorf("access modes = %q, expected only the one of the prefix declared for schema.org", modes)
+	}
+	if layout := itemrefLayout(pkg, pkg.Spine.Itemrefs[0]); layout != "pre-paginated" {
+		t.Errorf("itemrefLayout = %q, expected pre-paginated", layout)
+	}
+	if len(pkg.Metadata.Prefixes) != 4 {
+		t.Errorf("resolvePrefixes kept prefixes %v, expected the 4 declared", pkg.Metadata.Prefixes)
+	}
+}
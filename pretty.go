@@ -0,0 +1,193 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	prettyIndent = "  "
+	prettyWidth  = 100
+)
+
+// writePretty writes the children of a cleaned node as indented HTML. Every
+// block-level element starts on its own line, nested one level deeper than
+// its parent, and runs of inline content are wrapped at prettyWidth columns.
+// Line breaks are only placed where whitespace already was, and pre and
+// textarea elements are written as they are, so the rendered page only
+// changes where CSS makes other elements keep their whitespace.
+func writePretty(n *html.Node, w io.StringWriter) {
+	prettyChildren(n, w, 0)
+}
+
+func prettyChildren(n *html.Node, w io.StringWriter, depth int) {
+	var run strings.Builder
+	flushRun := func() {
+		prettyWrap(w, strings.TrimSpace(run.String()), depth)
+		run.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isBlockNode(c) || c.Type == html.ElementNode && c.Data == "script" {
+			flushRun()
+			prettyBlock(c, w, depth)
+			continue
+		}
+		prettyInline(c, &run)
+	}
+	flushRun()
+}
+
+func prettyBlock(n *html.Node, w io.StringWriter, depth int) {
+	indent := strings.Repeat(prettyIndent, depth)
+	tag := n.Data
+	if tag == "pre" || tag == "script" {
+		w.WriteString(indent)
+		renderNodeRaw(n, w)
+		w.WriteString("\n")
+		return
+	}
+
+	open := openTagHTML(n)
+	if isVoidElement(tag) {
+		w.WriteString(indent + open + "\n")
+		return
+	}
+	closeTag := "</" + tag + ">"
+
+	if !hasBlockDescendant(n) {
+		var content strings.Builder
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			prettyInline(c, &content)
+		}
+		text := strings.TrimSpace(content.String())
+		line := indent + open + text + closeTag
+		if utf8.RuneCountInString(line) <= prettyWidth || text == "" {
+			w.WriteString(line + "\n")
+			return
+		}
+		w.WriteString(indent + open + "\n")
+		prettyWrap(w, text, depth+1)
+		w.WriteString(indent + closeTag + "\n")
+		return
+	}
+
+	w.WriteString(indent + open + "\n")
+	prettyChildren(n, w, depth+1)
+	w.WriteString(indent + closeTag + "\n")
+}
+
+// prettyInline writes inline content on a single line with whitespace
+// collapsed.
+func prettyInline(n *html.Node, b *strings.Builder) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(collapseSpace(n.Data)))
+	case html.ElementNode:
+		if n.Data == "pre" || n.Data == "textarea" {
+			renderNodeRaw(n, b)
+			return
+		}
+		b.WriteString(openTagHTML(n))
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			prettyInline(c, b)
+		}
+		if !isVoidElement(n.Data) {
+			b.WriteString("</" + n.Data + ">")
+		}
+	}
+}
+
+func openTagHTML(n *html.Node) string {
+	var b strings.Builder
+	b.WriteString("<" + n.Data)
+	for _, attr := range n.Attr {
+		b.WriteString(" " + attrName(attr) + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// prettyWrap writes inline markup as indented lines of at most prettyWidth
+// columns, breaking only at spaces outside of tags. Words longer than a line,
+// such as data URIs, get a line of their own.
+func prettyWrap(w io.StringWriter, s string, depth int) {
+	if s == "" {
+		return
+	}
+	indent := strings.Repeat(prettyIndent, depth)
+	width := utf8.RuneCountInString(indent)
+	line := indent
+	lineWidth := width
+	for _, word := range splitOutsideTags(s) {
+		wordWidth := utf8.RuneCountInString(word)
+		if lineWidth > width && lineWidth+1+wordWidth > prettyWidth {
+			w.WriteString(line + "\n")
+			line, lineWidth = indent, width
+		}
+		if lineWidth > width {
+			line += " "
+			lineWidth++
+		}
+		line += word
+		lineWidth += wordWidth
+	}
+	w.WriteString(line + "\n")
+}
+
+// splitOutsideTags splits serialized HTML at spaces that are not part of a
+// tag, or of a pre or textarea element, whose whitespace is significant.
+func splitOutsideTags(s string) []string {
+	var words []string
+	var quote byte
+	inTag := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case inTag:
+			if c == '"' || c == '\'' {
+				quote = c
+			} else if c == '>' {
+				inTag = false
+			}
+		case c == '<':
+			if end := preformattedEnd(s, i); end > 0 {
+				i = end - 1
+				continue
+			}
+			inTag = true
+		case c == ' ':
+			if i > start {
+				words = append(words, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+// preformattedEnd returns the end of the pre or textarea element starting
+// at s[i], or 0 if none starts there.
+func preformattedEnd(s string, i int) int {
+	for _, tag := range []string{"pre", "textarea"} {
+		rest := s[i+1:]
+		if !strings.HasPrefix(rest, tag) || len(rest) == len(tag) || rest[len(tag)] != ' ' && rest[len(tag)] != '>' {
+			continue
+		}
+		if end := strings.Index(s[i:], "</"+tag+">"); end >= 0 {
+			return i + end + len("</"+tag+">")
+		}
+		return len(s)
+	}
+	return 0
+}
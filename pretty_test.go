@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestWritePretty(t *testing.T) {
+	src := "<div><p>Short <em>one</em></p><ul><li>A</li></ul>tail <b>text</b><hr><pre> keep\n  me</pre></div>"
+	doc, err := html.Parse(strings.NewReader("<body>" + src + "</body>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	writePretty(findElement(doc, "body"), &out)
+
+	expected := "<div>\n" +
+		"  <p>Short <em>one</em></p>\n" +
+		"  <ul>\n    <li>A</li>\n  </ul>\n" +
+		"  tail <b>text</b>\n" +
+		"  <hr>\n" +
+		"  <pre> keep\n  me</pre>\n" +
+		"</div>\n"
+	if out.String() != expected {
+		t.Errorf("writePretty output mismatch:\ngot:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestPrettyWrap(t *testing.T) {
+	words := strings.Repeat("word ", 30)
+	var out strings.Builder
+	prettyWrap(&out, strings.TrimSpace(words), 1)
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if len(line) > prettyWidth {
+			t.Errorf("line longer than %d columns: %q", prettyWidth, line)
+		}
+		if !strings.HasPrefix(line, prettyIndent+"word") {
+			t.Errorf("line not indented: %q", line)
+		}
+	}
+}
+
+func TestSplitOutsideTags(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`Hello <a href="x" title="a b">big world</a>  end`, []string{"Hello", `<a href="x" title="a b">big`, "world</a>", "end"}},
+		{"See <pre class=\"x\">code\n  block</pre> and <textarea>a  b</textarea> <preview>c d</preview>",
+			[]string{"See", "<pre class=\"x\">code\n  block</pre>", "and", "<textarea>a  b</textarea>", "<preview>c", "d</preview>"}},
+	}
+	for _, tt := range tests {
+		if result := splitOutsideTags(tt.input); !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("splitOutsideTags(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestWritePrettyInlinePre(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader("<body><div><a href=\"#x\"><pre>code\n  block</pre></a> after</div></body>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	writePretty(findElement(doc, "body"), &out)
+	if expected := "<pre>code\n  block</pre>"; !strings.Contains(out.String(), expected) {
+		t.Errorf("writePretty output %q does not keep %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// svgMediaType is the media type of SVG content documents.
+const svgMediaType = "image/svg+xml"
+
+// hasProperty reports whether the properties attribute of a manifest item
+// lists name, such as nav, cover-image, scripted or svg.
+func (item Item) hasProperty(name string) bool {
+	return slices.Contains(strings.Fields(item.Properties), name)
+}
+
+// propertyWarnings tells what the options about to render the chapters
+// lose of those the manifest marks as scripted or holding SVG.
+func propertyWarnings(chapters []Chapter, opts *options) []string {
+	var scripted, drawings int
+	for _, ch := range chapters {
+		if ch.Scripted {
+			scripted++
+		}
+		if ch.SVG && ch.MediaType != svgMediaType {
+			drawings++
+		}
+	}
+	var warnings []string
+	if scripted > 0 && !opts.KeepScripts {
+		warnings = append(warnings, fmt.Sprintf("%d chapters are scripted; their scripts are stripped unless --keep-scripts is given", scripted))
+	}
+	if drawings > 0 && opts.NoSVG {
+		warnings = append(warnings, fmt.Sprintf("%d chapters hold SVG drawings, which --no-svg strips", drawings))
+	}
+	return warnings
+}
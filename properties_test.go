@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestPropertyWarnings(t *testing.T) {
+	chapters := []Chapter{
+		{Scripted: true, SVG: true},
+		{Scripted: true},
+		{SVG: true, MediaType: svgMediaType},
+		{},
+	}
+	tests := []struct {
+		opts     options
+		expected []string
+	}{
+		{options{}, []string{"2 chapters are scripted; their scripts are stripped unless --keep-scripts is given"}},
+		{options{KeepScripts: true}, nil},
+		{options{KeepScripts: true, NoSVG: true}, []string{"1 chapters hold SVG drawings, which --no-svg strips"}},
+	}
+	for _, tt := range tests {
+		if warnings := propertyWarnings(chapters, &tt.opts); !reflect.DeepEqual(warnings, tt.expected) {
+			t.Errorf("propertyWarnings(%+v) = %q, expected %q", tt.opts, warnings, tt.expected)
+		}
+	}
+}
+
+func TestRenderSVGPage(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"OEBPS/page.svg": []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10"/></svg>`),
+	})
+	pkg := &Package{OpfDir: "OEBPS"}
+	pkg.Manifest.Items = []Item{{ID: "page", Href: "page.svg", MediaType: svgMediaType}}
+	for _, noSVG := range []bool{false, true} {
+		doc, err := html.Parse(strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10"/></svg>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd := newRenderer(pkg, r, &options{NoSVG: noSVG})
+		rd.anchors = &anchors{}
+		var b strings.Builder
+		rd.renderChapter(Chapter{Path: "OEBPS/page.svg", Doc: doc, MediaType: svgMediaType, SVG: true}, &b)
+		out := b.String()
+		if expected := "<rect"; !noSVG && !strings.Contains(out, expected) {
+			t.Errorf("renderChapter gave %s, expected the drawing inline", out)
+		}
+		if expected := `src="data:image/svg+xml;base64,`; noSVG && !strings.Contains(out, expected) {
+			t.Errorf("renderChapter with --no-svg gave %s, expected the drawing as an image", out)
+		}
+	}
+}
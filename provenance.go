@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// Provenance records where the HTML output came from: the EPUB it was
+// converted from, the converter and when the conversion took place.
+type Provenance struct {
+	Source    string `json:"source"` // the file name of the EPUB
+	SHA256    string `json:"sha256"` // the hex SHA-256 of the EPUB
+	Generator string `json:"generator"`
+	Modified  string `json:"modified,omitempty"`  // the dcterms:modified date of the book
+	Converted string `json:"converted,omitempty"` // left out with --no-timestamp
+}
+
+// readProvenance hashes the EPUB at path and records the provenance of its
+// conversion at now, or without a time if now is zero, so that converting
+// the same book twice gives the same output.
+func readProvenance(path string, pkg *Package, now time.Time) (Provenance, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Provenance{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return Provenance{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	p := Provenance{
+		Source:    filepath.Base(path),
+		SHA256:    hex.EncodeToString(h.Sum(nil)),
+		Generator: generator(),
+		Modified:  pkg.Metadata.Modified,
+	}
+	if !now.IsZero() {
+		p.Converted = now.UTC().Format(time.RFC3339)
+	}
+	return p, nil
+}
+
+// generator names the converter and its version, taken from the build
+// information of the binary.
+func generator() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return "epub2html " + info.Main.Version
+	}
+	return "epub2html"
+}
+
+// metaTags returns the provenance as <meta> tags of the output head.
+func (p Provenance) metaTags() []MetaTag {
+	var tags []MetaTag
+	for _, tag := range []MetaTag{
+		{Name: "generator", Content: p.Generator},
+		{Name: "dcterms.source", Content: p.Source},
+		{Name: "source-sha256", Content: p.SHA256},
+		{Name: "dcterms.modified", Content: p.Modified},
+		{Name: "dcterms.created", Content: p.Converted},
+	} {
+		if tag.Content != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadProvenance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.epub")
+	if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pkg := &Package{Metadata: Metadata{Modified: "2021-02-03T04:05:06Z"}}
+	p, err := readProvenance(path, pkg, time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []MetaTag{
+		{Name: "generator", Content: "epub2html"},
+		{Name: "dcterms.source", Content: "book.epub"},
+		{Name: "source-sha256", Content: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{Name: "dcterms.modified", Content: "2021-02-03T04:05:06Z"},
+		{Name: "dcterms.created", Content: "2024-05-06T07:08:09Z"},
+	}
+	if tags := p.metaTags(); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("readProvenance gave the tags %+v, expected %+v", tags, expected)
+	}
+
+	p, err = readProvenance(path, &Package{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Converted != "" || len(p.metaTags()) != 3 {
+		t.Errorf("readProvenance without a time gave %+v", p)
+	}
+}
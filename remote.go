@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// remoteFetchTimeout bounds the download of a remote image for
+// --fetch-remote, so that a dead server cannot stall the conversion.
+const remoteFetchTimeout = 30 * time.Second
+
+// maxRemoteSize is the largest remote image --fetch-remote downloads.
+const maxRemoteSize = 50 << 20
+
+var remoteClient = &http.Client{Timeout: remoteFetchTimeout}
+
+// isHTTPURL reports whether ref is an absolute http or https URL.
+func isHTTPURL(ref string) bool {
+	u, err := url.Parse(ref)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// fetchRemoteImage downloads an image and returns it with its media type,
+// taken from the Content-Type header or else sniffed from the data.
+func fetchRemoteImage(client *http.Client, rawURL string) ([]byte, string, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("server responded %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxRemoteSize {
+		return nil, "", fmt.Errorf("image is larger than %d bytes", maxRemoteSize)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, "", fmt.Errorf("not an image: %s", mediaType)
+	}
+	return data, mediaType, nil
+}
+
+// remoteImageURL downloads a remote image for --fetch-remote and returns
+// the URL the output refers to it by, like resourceURL does for the images
+// in the archive. Copies written to the assets directory are placed under
+// remote/ followed by the host and path of the URL.
+func (rd *renderer) remoteImageURL(rawURL string) (string, error) {
+	if href, ok := rd.exported[rawURL]; ok {
+		return href, nil
+	}
+	if uri, ok := rd.remoteURIs[rawURL]; ok {
+		return uri, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	data, mediaType, err := fetchRemoteImage(remoteClient, rawURL)
+	if err != nil {
+		return "", err
+	}
+	if o, ok := rd.opts.imageOptions(); ok {
+		if processed, processedType, err := processImage(data, mediaType, o); err == nil {
+			data, mediaType = processed, processedType
+		}
+	}
+	rd.recordImageSize(rawURL, bytes.NewReader(data))
+	if rd.embeds(len(data)) {
+		// Kept so that an image shown several times is downloaded once.
+		if rd.remoteURIs == nil {
+			rd.remoteURIs = make(map[string]string)
+		}
+		rd.remoteURIs[rawURL] = encodeDataURI(mediaType, data)
+		return rd.remoteURIs[rawURL], nil
+	}
+
+	// Ports are kept apart from the host with "_", as ':' is not allowed
+	// in Windows file names.
+	assetPath := path.Join("remote", strings.ReplaceAll(u.Host, ":", "_"), path.Clean("/"+u.Path))
+	if ext, ok := imageExtensions[mediaType]; ok && path.Ext(assetPath) != ext {
+		assetPath = strings.TrimSuffix(assetPath, path.Ext(assetPath)) + ext
+	}
+	href, err := writeAsset(assetsDir(rd.opts), rd.opts.OutputPath, "", assetPath, data)
+	if err != nil {
+		return "", err
+	}
+	if rd.exported == nil {
+		rd.exported = make(map[string]string)
+		rd.exportedHashes = make(map[string]string)
+	}
+	rd.exported[rawURL] = href
+	return href, nil
+}
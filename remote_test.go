@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRemoteImageURL(t *testing.T) {
+	pic := testPNG(t, 4, 2)
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		switch r.URL.Path {
+		case "/pic.png", "/img/photo":
+			w.Write(pic)
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<p>Not an image</p>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	rd := &renderer{opts: &options{OutputPath: filepath.Join(dir, "book.html")}}
+	uri, err := rd.remoteImageURL(server.URL + "/pic.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "data:image/png;base64,") {
+		t.Errorf("remoteImageURL(pic.png) = %q, expected a data URI", uri)
+	}
+	if size := rd.imageSizes[server.URL+"/pic.png"]; size.X != 4 || size.Y != 2 {
+		t.Errorf("remoteImageURL(pic.png) recorded size %v, expected 4x2", size)
+	}
+	if again, err := rd.remoteImageURL(server.URL + "/pic.png"); err != nil || again != uri || fetches.Load() != 1 {
+		t.Errorf("remoteImageURL(pic.png) again = %.40q, %v after %d downloads, expected the same data URI after one", again, err, fetches.Load())
+	}
+	if _, err := rd.remoteImageURL("http://[::1"); err == nil {
+		t.Error("remoteImageURL accepted a malformed URL")
+	}
+	for _, name := range []string{"/page.html", "/missing.png"} {
+		if _, err := rd.remoteImageURL(server.URL + name); err == nil {
+			t.Errorf("remoteImageURL(%s) succeeded, expected an error", name)
+		}
+	}
+
+	rd.opts.AssetsDir = filepath.Join(dir, "assets")
+	href, err := rd.remoteImageURL(server.URL + "/img/photo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := strings.ReplaceAll(strings.TrimPrefix(server.URL, "http://"), ":", "_")
+	if expected := "assets/remote/" + host + "/img/photo.png"; href != expected {
+		t.Errorf("remoteImageURL(img/photo) = %q, expected %q", href, expected)
+	}
+	if _, err := os.Stat(filepath.Join(rd.opts.AssetsDir, "remote", host, "img", "photo.png")); err != nil {
+		t.Errorf("remoteImageURL did not write the image: %v", err)
+	}
+}
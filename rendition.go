@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// renditionAttrs are the rendition selection attributes of container.xml
+// that --rendition selects packages by.
+var renditionAttrs = []string{"layout", "media", "language", "accessMode", "label"}
+
+// parseRenditionSelector splits a --rendition selector such as
+// layout=reflowable into the attribute and the value it must have.
+func parseRenditionSelector(s string) (attr, value string, err error) {
+	attr, value, ok := strings.Cut(s, "=")
+	attr, value = strings.TrimSpace(attr), strings.TrimSpace(value)
+	if !ok || value == "" {
+		return "", "", fmt.Errorf("invalid --rendition %q: must be attribute=value, e.g. layout=reflowable", s)
+	}
+	for _, a := range renditionAttrs {
+		if strings.EqualFold(attr, a) {
+			return a, value, nil
+		}
+	}
+	return "", "", fmt.Errorf("unknown --rendition attribute %q: must be layout, media, language, accessMode or label", attr)
+}
+
+// matchesRendition reports whether a package listed in container.xml has the
+// rendition selection attributes of the --rendition selectors: the layout,
+// access mode or label given, a language equal to the one given or more
+// specific, such as en-US for en, and a media query containing the text
+// given, such as orientation: portrait. Packages that do not declare a
+// layout count as reflowable.
+func matchesRendition(rf Rootfile, selectors []string) bool {
+	for _, s := range selectors {
+		attr, value, err := parseRenditionSelector(s)
+		if err != nil {
+			return false
+		}
+		var ok bool
+		switch attr {
+		case "layout":
+			layout := rf.Layout
+			if layout == "" {
+				layout = "reflowable"
+			}
+			ok = strings.EqualFold(layout, value)
+		case "media":
+			compact := func(s string) string { return strings.ToLower(strings.Join(strings.Fields(s), "")) }
+			ok = strings.Contains(compact(rf.Media), compact(value))
+		case "language":
+			ok = strings.EqualFold(rf.Language, value) || strings.HasPrefix(strings.ToLower(rf.Language), strings.ToLower(value)+"-")
+		case "accessMode":
+			for _, mode := range strings.Fields(strings.ReplaceAll(rf.AccessMode, ",", " ")) {
+				ok = ok || strings.EqualFold(mode, value)
+			}
+		case "label":
+			ok = strings.EqualFold(strings.TrimSpace(rf.Label), value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// selectRootfile picks the package to convert among those container.xml
+// lists: the first matching the --rendition selectors if there are any,
+// or else the first reflowable one, as the output is reflowed anyway, or
+// else the first, the book's default rendition.
+func selectRootfile(rootfiles []Rootfile, selectors []string) (Rootfile, error) {
+	if len(selectors) > 0 {
+		for _, rf := range rootfiles {
+			if matchesRendition(rf, selectors) {
+				return rf, nil
+			}
+		}
+		return Rootfile{}, fmt.Errorf("no package listed in container.xml matches --rendition %s", strings.Join(selectors, " "))
+	}
+	for _, rf := range rootfiles {
+		if !strings.EqualFold(rf.Layout, "pre-paginated") {
+			return rf, nil
+		}
+	}
+	return rootfiles[0], nil
+}
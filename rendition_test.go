@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestMatchesRendition(t *testing.T) {
+	rf := Rootfile{Layout: "reflowable", Language: "en-US", Media: "(min-width: 1024px) and (orientation: landscape)", AccessMode: "textual visual", Label: "Large screens"}
+	tests := []struct {
+		selectors []string
+		expected  bool
+	}{
+		{nil, true},
+		{[]string{"layout=reflowable"}, true},
+		{[]string{"layout=pre-paginated"}, false},
+		{[]string{"language=en"}, true},
+		{[]string{"language=en-us"}, true},
+		{[]string{"language=e"}, false},
+		{[]string{"media=orientation:landscape"}, true},
+		{[]string{"media=orientation: portrait"}, false},
+		{[]string{"accessMode=visual", "label=large screens"}, true},
+		{[]string{"accessMode=auditory"}, false},
+	}
+	for _, tt := range tests {
+		if ok := matchesRendition(rf, tt.selectors); ok != tt.expected {
+			t.Errorf("matchesRendition(%q) = %v, expected %v", tt.selectors, ok, tt.expected)
+		}
+	}
+	if !matchesRendition(Rootfile{}, []string{"layout=reflowable"}) {
+		t.Error("matchesRendition did not take a package without a layout as reflowable")
+	}
+}
+
+func TestParseRenditionSelector(t *testing.T) {
+	tests := []struct {
+		input       string
+		attr, value string
+	}{
+		{"layout=reflowable", "layout", "reflowable"},
+		{"AccessMode = auditory", "accessMode", "auditory"},
+		{"media=(orientation: portrait)", "media", "(orientation: portrait)"},
+		{"layout", "", ""},
+		{"layout=", "", ""},
+		{"size=large", "", ""},
+	}
+	for _, tt := range tests {
+		attr, value, err := parseRenditionSelector(tt.input)
+		if attr != tt.attr || value != tt.value || (err != nil) != (tt.attr == "") {
+			t.Errorf("parseRenditionSelector(%q) = %q, %q, %v, expected %q, %q", tt.input, attr, value, err, tt.attr, tt.value)
+		}
+	}
+}
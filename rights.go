@@ -0,0 +1,102 @@
+package main
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// rightsID is the ID of the footer of --rights-footer.
+const rightsID = "rights"
+
+// maxCopyrightLines limits the lines taken from the copyright page, which
+// may go on with disclaimers and printing history.
+const maxCopyrightLines = 3
+
+// copyrightNotice matches the lines of a copyright page that state the
+// copyright, such as "Copyright © 2020 Jane Doe".
+var copyrightNotice = regexp.MustCompile(`(?i)©|\(c\)|\bcopyright\b`)
+
+// copyrightLines returns the copyright notices of the book's copyright
+// page, the landmark of the copyright-page type: the text of the blocks
+// stating the copyright, or nil if there is no such page.
+func copyrightLines(pkg *Package, r *epubArchive, chapters []Chapter) []string {
+	path := landmarkPath(pkg, r, chapters, "copyright-page")
+	for _, ch := range chapters {
+		if ch.Path != path {
+			continue
+		}
+		var lines []string
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			if len(lines) == maxCopyrightLines {
+				return
+			}
+			if n.Type == html.ElementNode && (n.Data == "p" || n.Data == "div" && !hasChildElements(n) || isHeading(n.Data)) {
+				if text := textContent(n); copyrightNotice.MatchString(text) {
+					lines = append(lines, text)
+				}
+				return
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(ch.Doc)
+		return lines
+	}
+	return nil
+}
+
+// rightsChapter renders the footer --rights-footer appends to the book:
+// a citation of the book naming its authors, publisher, date and ISBN,
+// its dc:rights statement or else the notices of its copyright page, and
+// a note that the HTML is derived from the EPUB edition, as institutional
+// repositories require on derived formats.
+func (rd *renderer) rightsChapter(pkg *Package, copyright []string) ChapterData {
+	m := pkg.Metadata
+	footer := &html.Node{Type: html.ElementNode, Data: "footer", DataAtom: atom.Footer,
+		Attr: []html.Attribute{{Key: "class", Val: "rights"}}}
+	add := func(class, text string) {
+		p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P,
+			Attr: []html.Attribute{{Key: "class", Val: class}}}
+		p.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+		footer.AppendChild(p)
+	}
+
+	title := bookTitle(pkg)
+	if authors := m.Authors(); len(authors) > 0 {
+		title = strings.TrimRight(title, ".") + " by " + joinNames(authors)
+	}
+	citation := []string{title}
+	if len(m.Publishers) > 0 {
+		citation = append(citation, m.Publishers[0])
+	}
+	if date, _, _ := strings.Cut(m.Date(), "T"); date != "" {
+		citation = append(citation, date)
+	}
+	if isbn := m.ISBN(); isbn != "" {
+		citation = append(citation, "ISBN "+isbn)
+	}
+	for i, part := range citation {
+		citation[i] = strings.TrimRight(part, ".")
+	}
+	add("citation", strings.Join(citation, ". ")+".")
+	if m.Rights != "" {
+		add("statement", m.Rights)
+	} else {
+		for _, line := range copyright {
+			add("statement", line)
+		}
+	}
+	add("derivation", "This HTML edition was converted from the EPUB edition of the book.")
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	body.AppendChild(footer)
+
+	var b strings.Builder
+	rd.writeBody(body, &b)
+	return ChapterData{ID: rightsID, Title: "Rights", Body: template.HTML(b.String())}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCopyrightLines(t *testing.T) {
+	var chapters []Chapter
+	for i, doc := range []string{
+		`<h1>One</h1><p>Copyright is discussed here too.</p>`,
+		`<section epub:type="copyright-page"><p>Copyright © 2020
+  Jane Doe</p><p>All rights reserved.</p><div>(c) 2021 ACME</div><p>No copyright in the cover art.</p><p>© more</p></section>`,
+	} {
+		n, err := html.Parse(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chapters = append(chapters, Chapter{Index: i, Path: []string{"OEBPS/one.xhtml", "OEBPS/copyright.xhtml"}[i], Doc: n})
+	}
+	r := openTestArchive(t, map[string][]byte{})
+	lines := copyrightLines(&Package{OpfDir: "OEBPS"}, r, chapters)
+	expected := []string{"Copyright © 2020 Jane Doe", "(c) 2021 ACME", "No copyright in the cover art."}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("copyrightLines = %q, expected %q", lines, expected)
+	}
+	if lines := copyrightLines(&Package{OpfDir: "OEBPS"}, r, chapters[:1]); lines != nil {
+		t.Errorf("copyrightLines without a copyright page = %q, expected nil", lines)
+	}
+}
+
+func TestRightsChapter(t *testing.T) {
+	pkg := &Package{Metadata: Metadata{
+		Title:       "Book.",
+		Creators:    []Contributor{{Name: "Jane Doe"}},
+		Publishers:  []string{"ACME"},
+		Identifiers: []Identifier{{Value: "urn:isbn:9780000000001"}},
+	}}
+	rd := &renderer{opts: &options{}}
+	tests := []struct {
+		rights   string
+		expected string
+	}{
+		{"CC BY 4.0", `<p class="statement">CC BY 4.0</p>`},
+		{"", `<p class="statement">© 2020 Jane Doe</p>`},
+	}
+	for _, tt := range tests {
+		pkg.Metadata.Rights = tt.rights
+		body := string(rd.rightsChapter(pkg, []string{"© 2020 Jane Doe"}).Body)
+		expected := `<footer class="rights"><p class="citation">Book by Jane Doe. ACME. ISBN 9780000000001.</p>` + tt.expected +
+			`<p class="derivation">This HTML edition was converted from the EPUB edition of the book.</p></footer>`
+		if body != expected {
+			t.Errorf("rightsChapter with rights %q = %q, expected %q", tt.rights, body, expected)
+		}
+	}
+}
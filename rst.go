@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// rstSectionChars are the underline characters for headings below the
+// chapter title, following the Sphinx convention.
+var rstSectionChars = []string{"=", "-", "^", "\""}
+
+// writeRst writes every chapter as a separate reStructuredText document into
+// outDir plus an index.rst holding a toctree, ready to drop into a Sphinx
+// project. Images are copied next to the chapters, and every chapter links
+// to the previous and next ones and to the index below its title and at
+// its end, through the --nav-template at navTemplate or the default one.
+func writeRst(pkg *Package, r *epubArchive, outDir, navTemplate string) error {
+	nav, err := loadNavTemplate(navTemplate, "rst")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	chapters := loadChapters(pkg, r)
+	docNames := make(map[string]string)
+	var hrefs, titles []string
+	for _, ch := range chapters {
+		docNames[ch.Path] = fmt.Sprintf("chapter%03d", ch.Index+1)
+		hrefs = append(hrefs, docNames[ch.Path])
+		// The title is the text of a :doc: role, where < starts the target.
+		titles = append(titles, strings.ReplaceAll(rstEscape(strings.Join(strings.Fields(chapterTitle(ch)), " ")), "<", `\<`))
+	}
+	navs := chapterNavs(hrefs, titles, navLink{Href: "index", Title: "Contents"})
+
+	var index strings.Builder
+	writeRstTitle(&index, bookTitle(pkg), "#")
+	index.WriteString(".. toctree::\n   :maxdepth: 2\n\n")
+
+	for i, ch := range chapters {
+		name := docNames[ch.Path]
+		top, err := navBlock(nav, navs[i], false)
+		if err != nil {
+			return fmt.Errorf("failed to write the navigation of %s.rst: %w", name, err)
+		}
+		bottom, err := navBlock(nav, navs[i], true)
+		if err != nil {
+			return fmt.Errorf("failed to write the navigation of %s.rst: %w", name, err)
+		}
+		rw := &rstWriter{
+			r:         r,
+			pkg:       pkg,
+			chapter:   ch,
+			outDir:    outDir,
+			docNames:  docNames,
+			titleNode: chapterHeading(ch),
+			nav:       top,
+		}
+		rw.writeChapter()
+		rw.out.WriteString(bottom)
+
+		if err := os.WriteFile(filepath.Join(outDir, name+".rst"), []byte(rw.out.String()), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s.rst: %w", name, err)
+		}
+		fmt.Fprintf(&index, "   %s\n", name)
+	}
+
+	if err := os.WriteFile(filepath.Join(outDir, "index.rst"), []byte(index.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write index.rst: %w", err)
+	}
+	return nil
+}
+
+// writeRstTitle writes a title with an overline and underline of c.
+func writeRstTitle(w *strings.Builder, title, c string) {
+	rule := strings.Repeat(c, utf8.RuneCountInString(title))
+	fmt.Fprintf(w, "%s\n%s\n%s\n\n", rule, title, rule)
+}
+
+// rstWriter converts one chapter body to reStructuredText. Inline content is
+// collected into line until a block boundary; indent carries the nesting of
+// lists and block quotes.
+type rstWriter struct {
+	r         *epubArchive
+	pkg       *Package
+	chapter   Chapter
+	outDir    string
+	docNames  map[string]string
+	titleNode *html.Node
+	nav       string // navigation links written below the title
+
+	out        strings.Builder
+	line       strings.Builder
+	indent     string
+	bullet     string // list marker for the next paragraph, if any
+	needEscape bool   // inline markup just ended and must not touch a word
+}
+
+func (rw *rstWriter) writeChapter() {
+	writeRstTitle(&rw.out, rstEscape(chapterTitle(rw.chapter)), "*")
+	rw.out.WriteString(rw.nav)
+	if body := findElement(rw.chapter.Doc, "body"); body != nil {
+		rw.walkChildren(body)
+	}
+	rw.flush()
+}
+
+func (rw *rstWriter) walkChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		rw.walk(c)
+	}
+}
+
+func (rw *rstWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		rw.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	tag := n.Data
+	switch tag {
+	case "script", "style", "link", "meta", "head", "title", "hr":
+		return
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		rw.flush()
+		if n != rw.titleNode {
+			rw.heading(int(tag[1]-'0'), textContent(n))
+		}
+		return
+	case "ul", "ol":
+		rw.flush()
+		marker := "- "
+		if tag == "ol" {
+			marker = "#. "
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == "li" {
+				rw.listItem(c, marker)
+			}
+		}
+		return
+	case "blockquote":
+		rw.flush()
+		// An empty comment ends a preceding list or directive so that
+		// the indented text becomes a block quote of its own.
+		rw.out.WriteString(rw.indent + "..\n\n")
+		outer := rw.indent
+		rw.indent += "   "
+		rw.walkChildren(n)
+		rw.flush()
+		rw.indent = outer
+		return
+	case "pre":
+		rw.flush()
+		rw.out.WriteString(rw.indent + "::\n\n")
+		for _, l := range strings.Split(strings.Trim(rawText(n), "\n"), "\n") {
+			if strings.TrimSpace(l) == "" {
+				rw.out.WriteString("\n")
+				continue
+			}
+			rw.out.WriteString(rw.indent + "   " + l + "\n")
+		}
+		rw.out.WriteString("\n")
+		return
+	case "img":
+		rw.flush()
+		rw.image(n)
+		return
+	case "svg":
+		if img := svgImage(n); img != nil {
+			rw.flush()
+			rw.image(img)
+		}
+		return
+	case "br":
+		rw.text(" ")
+		return
+	}
+
+	if isBlockElement(tag) {
+		rw.flush()
+		rw.walkChildren(n)
+		rw.flush()
+		return
+	}
+	if hasBlockDescendant(n) || !rw.inline(n) {
+		rw.walkChildren(n)
+	}
+}
+
+// inline renders an inline element as reStructuredText markup and reports
+// whether it did. reStructuredText markup cannot nest, so only the text of
+// the element is kept.
+func (rw *rstWriter) inline(n *html.Node) bool {
+	var open, close string
+	switch n.Data {
+	case "em", "i", "cite", "var", "dfn":
+		open, close = "*", "*"
+	case "strong", "b":
+		open, close = "**", "**"
+	case "code", "tt", "kbd", "samp":
+		open, close = "``", "``"
+	case "a":
+		open, close = rw.link(getAttr(n, "href"))
+	}
+	if open == "" {
+		return false
+	}
+
+	raw := rawText(n)
+	core := strings.Join(strings.Fields(raw), " ")
+	if core == "" {
+		return false
+	}
+	if strings.TrimLeftFunc(raw, unicode.IsSpace) != raw {
+		rw.text(" ")
+	}
+	if prev, _ := utf8.DecodeLastRuneInString(rw.line.String()); rw.line.Len() > 0 && !unicode.IsSpace(prev) && !strings.ContainsRune("([{<'\"-/:", prev) {
+		rw.line.WriteString(`\ `)
+	}
+	rw.line.WriteString(open)
+	if open == "``" {
+		rw.line.WriteString(core)
+	} else {
+		rw.line.WriteString(rstEscape(core))
+	}
+	rw.line.WriteString(close)
+	rw.needEscape = true
+	if strings.TrimRightFunc(raw, unicode.IsSpace) != raw {
+		rw.text(" ")
+	}
+	return true
+}
+
+// link returns the markup around the text of a hyperlink. Links to other
+// spine documents use the Sphinx :doc: role.
+func (rw *rstWriter) link(href string) (string, string) {
+	if href == "" {
+		return "", ""
+	}
+	if isExternalHref(href) {
+		return "`", " <" + href + ">`__"
+	}
+	target, _, _ := strings.Cut(href, "#")
+	if target == "" {
+		return "", ""
+	}
+	if doc, ok := rw.docNames[resolveEpubPath(epubDir(rw.chapter.Path), target)]; ok {
+		return ":doc:`", " <" + doc + ">`"
+	}
+	return "", ""
+}
+
+func (rw *rstWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	if rw.needEscape {
+		if first, _ := utf8.DecodeRuneInString(s); unicode.IsLetter(first) || unicode.IsDigit(first) {
+			rw.line.WriteString(`\ `)
+		}
+		rw.needEscape = false
+	}
+	rw.line.WriteString(rstEscape(s))
+}
+
+func (rw *rstWriter) listItem(li *html.Node, marker string) {
+	outer := rw.indent
+	rw.bullet = marker
+	rw.walkChildren(li)
+	rw.flush()
+	if rw.bullet != "" {
+		// An empty item still needs its marker.
+		rw.out.WriteString(rw.indent + strings.TrimSpace(rw.bullet) + "\n\n")
+	}
+	rw.indent = outer
+	rw.bullet = ""
+}
+
+func (rw *rstWriter) heading(level int, title string) {
+	// Sections cannot nest in a list or block quote, and would end it.
+	if rw.indent != "" || rw.bullet != "" {
+		rw.directive(".. rubric:: " + rstEscape(title))
+		rw.out.WriteString("\n")
+		return
+	}
+	titleLevel := 1
+	if rw.titleNode != nil {
+		titleLevel = int(rw.titleNode.Data[1] - '0')
+	}
+	depth := min(max(level-titleLevel, 1), len(rstSectionChars)) - 1
+	title = rstEscape(title)
+	rw.out.WriteString(title + "\n")
+	rw.out.WriteString(strings.Repeat(rstSectionChars[depth], utf8.RuneCountInString(title)) + "\n\n")
+}
+
+// flush writes the pending paragraph. The first paragraph of a list item
+// carries the list marker; later blocks of that item are indented under it.
+func (rw *rstWriter) flush() {
+	text := strings.Join(strings.Fields(rw.line.String()), " ")
+	rw.line.Reset()
+	rw.needEscape = false
+	if text == "" {
+		return
+	}
+	if rw.bullet == "" {
+		text = rstEscapeLineStart(text)
+	}
+	rw.out.WriteString(rw.indent + rw.bullet + text + "\n\n")
+	if rw.bullet != "" {
+		rw.indent += strings.Repeat(" ", len(rw.bullet))
+		rw.bullet = ""
+	}
+}
+
+func (rw *rstWriter) image(n *html.Node) {
+	src := getAttr(n, "src")
+	if src == "" {
+		return
+	}
+	imagePath := resolveEpubPath(epubDir(rw.chapter.Path), src)
+	rel, err := exportResource(rw.r, rw.pkg, imagePath, rw.outDir)
+	if err != nil {
+		log.Printf("Warning: Could not export image %s: %v", imagePath, err)
+		return
+	}
+	options := rw.directive(".. image:: " + rel)
+	if alt := strings.Join(strings.Fields(getAttr(n, "alt")), " "); alt != "" {
+		rw.out.WriteString(options + ":alt: " + alt + "\n")
+	}
+	rw.out.WriteString("\n")
+}
+
+// directive writes the first line of a directive, after the list marker if
+// it starts a list item, and returns the indent of its options.
+func (rw *rstWriter) directive(line string) string {
+	rw.out.WriteString(rw.indent + rw.bullet + line + "\n")
+	if rw.bullet != "" {
+		rw.indent += strings.Repeat(" ", len(rw.bullet))
+		rw.bullet = ""
+	}
+	return rw.indent + "   "
+}
+
+var rstEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "`", "\\`", "_", `\_`, "|", `\|`)
+
+// rstEscape escapes characters that would otherwise start inline markup.
+func rstEscape(s string) string {
+	return rstEscaper.Replace(s)
+}
+
+// rstEscapeLineStart escapes a paragraph that would otherwise be read as a
+// list item, e.g. one starting with "- " or "1. ".
+func rstEscapeLineStart(s string) string {
+	if len(s) > 1 && strings.ContainsRune("-+", rune(s[0])) && s[1] == ' ' {
+		return `\` + s
+	}
+	digits := strings.TrimLeftFunc(s, unicode.IsDigit)
+	if len(digits) < len(s) && (strings.HasPrefix(digits, ". ") || strings.HasPrefix(digits, ") ")) {
+		return s[:len(s)-len(digits)] + `\` + digits
+	}
+	if strings.HasPrefix(s, "#. ") {
+		return `\` + s
+	}
+	return s
+}
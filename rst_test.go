@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRstWriter(t *testing.T) {
+	src := `<html><body>
+<h1>Title</h1>
+<p>Some <em>emphasised</em>text, <code>a_b</code> and <a href="http://example.com/">a link</a>.</p>
+<h2>Section</h2>
+<ul><li><p>One</p><ol><li>Nested</li></ol></li><li>Two</li></ul>
+<blockquote><p>Quoted</p></blockquote>
+<p>1. Not a list</p>
+</body></html>`
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := Chapter{Path: "ch.xhtml", Doc: doc}
+	rw := &rstWriter{chapter: ch, titleNode: chapterHeading(ch)}
+	rw.writeChapter()
+
+	expected := "*****\nTitle\n*****\n\n" +
+		"Some *emphasised*\\ text, ``a_b`` and `a link <http://example.com/>`__.\n\n" +
+		"Section\n=======\n\n" +
+		"- One\n\n  #. Nested\n\n- Two\n\n" +
+		"..\n\n   Quoted\n\n" +
+		"1\\. Not a list\n\n"
+	if got := rw.out.String(); got != expected {
+		t.Errorf("reStructuredText output mismatch:\ngot:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestRstWriterNested(t *testing.T) {
+	src := `<html><body><h1>Title</h1>
+<blockquote><h3>Quoted</h3><p>q</p></blockquote>
+<ul><li><img src="images/a.png" alt="A"/>After</li><li><h4>Item</h4>text</li></ul>
+</body></html>`
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := openTestArchive(t, map[string][]byte{"OEBPS/images/a.png": testPNG(t, 2, 2)})
+	ch := Chapter{Path: "OEBPS/ch.xhtml", Doc: doc}
+	rw := &rstWriter{r: r, pkg: &Package{OpfDir: "OEBPS"}, chapter: ch, outDir: t.TempDir(), titleNode: chapterHeading(ch)}
+	rw.writeChapter()
+
+	expected := "*****\nTitle\n*****\n\n" +
+		"..\n\n   .. rubric:: Quoted\n\n   q\n\n" +
+		"- .. image:: images/a.png\n     :alt: A\n\n  After\n\n" +
+		"- .. rubric:: Item\n\n  text\n\n"
+	if got := rw.out.String(); got != expected {
+		t.Errorf("reStructuredText output mismatch:\ngot:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestRstEscapeLineStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"- dash", `\- dash`},
+		{"12. twelve", `12\. twelve`},
+		{"#. auto", `\#. auto`},
+		{"plain text", "plain text"},
+		{"2020 was a year", "2020 was a year"},
+	}
+
+	for _, tt := range tests {
+		if result := rstEscapeLineStart(tt.input); result != tt.expected {
+			t.Errorf("rstEscapeLineStart(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// sampleEndID is the ID of the notice that ends a --sample preview.
+const sampleEndID = "sample-end"
+
+// parseSamplePercent parses the --sample share of the book, such as "10%".
+func parseSamplePercent(s string) (float64, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid sample size %q, expected a percentage such as 10%%", s)
+	}
+	return percent, nil
+}
+
+// sample keeps the start of the book for --sample and --sample-chapters:
+// the first n chapters if n is positive, or else the given percentage of
+// its text. The chapter where that share is reached is cut after the
+// paragraph completing it. It reports whether anything was left out.
+func sample(chapters []Chapter, n int, percent float64) ([]Chapter, bool) {
+	if n > 0 {
+		if n >= len(chapters) {
+			return chapters, false
+		}
+		return chapters[:n], true
+	}
+	total := 0
+	for _, ch := range chapters {
+		total += textLen(ch.Doc)
+	}
+	budget := int(float64(total) * percent / 100)
+	for i, ch := range chapters {
+		size := textLen(ch.Doc)
+		if size <= budget {
+			budget -= size
+			continue
+		}
+		if body := findElement(ch.Doc, "body"); body != nil {
+			truncateText(body, budget)
+		}
+		return chapters[:i+1], true
+	}
+	return chapters, false
+}
+
+// truncateText removes everything in n after the first budget characters
+// of text, keeping whole the paragraph or other element without child
+// elements that they end in.
+func truncateText(n *html.Node, budget int) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		size := textLen(c)
+		if size <= budget {
+			budget -= size
+			continue
+		}
+		if hasChildElements(c) {
+			truncateText(c, budget)
+		}
+		for c.NextSibling != nil {
+			n.RemoveChild(c.NextSibling)
+		}
+		return
+	}
+}
+
+// textLen returns the number of characters of text in n.
+func textLen(n *html.Node) int {
+	return utf8.RuneCountInString(textContent(n))
+}
+
+// hasChildElements reports whether n has an element among its children.
+func hasChildElements(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleEndChapter renders the notice that follows a --sample preview.
+func (rd *renderer) sampleEndChapter() ChapterData {
+	p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+	p.AppendChild(&html.Node{Type: html.TextNode, Data: rd.opts.SampleNotice})
+	section := &html.Node{Type: html.ElementNode, Data: "section", DataAtom: atom.Section,
+		Attr: []html.Attribute{{Key: "class", Val: "sample-end"}}}
+	section.AppendChild(p)
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	body.AppendChild(section)
+
+	var b strings.Builder
+	rd.writeBody(body, &b)
+	return ChapterData{ID: sampleEndID, Title: rd.opts.SampleNotice, Body: template.HTML(b.String())}
+}
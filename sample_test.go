@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestParseSamplePercent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"10%", 10},
+		{"2.5%", 2.5},
+		{"50", 50},
+		{"0%", 0},
+		{"150%", 0},
+		{"ten", 0},
+	}
+	for _, tt := range tests {
+		percent, err := parseSamplePercent(tt.input)
+		if tt.expected == 0 && err == nil || tt.expected != 0 && (err != nil || percent != tt.expected) {
+			t.Errorf("parseSamplePercent(%q) = %v, %v, expected %v", tt.input, percent, err, tt.expected)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	newChapters := func() []Chapter {
+		var chapters []Chapter
+		for i, doc := range []string{
+			`<p>0123456789</p><p>0123456789</p>`,
+			`<div><p>0123456789</p><p>0123456789</p></div><p>0123456789</p>`,
+			`<p>0123456789</p><p>0123456789</p><p>0123456789</p>`,
+		} {
+			n, err := html.Parse(strings.NewReader(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			chapters = append(chapters, Chapter{Index: i, Doc: n})
+		}
+		return chapters
+	}
+	tests := []struct {
+		n        int
+		percent  float64
+		expected []int // characters of text kept in each chapter
+		sampled  bool
+	}{
+		{2, 0, []int{21, 32}, true},
+		{3, 0, []int{21, 32, 32}, false},
+		{0, 25, []int{21, 10}, true},
+		{0, 40, []int{21, 21}, true},
+		{0, 50, []int{21, 32}, true},
+		{0, 100, []int{21, 32, 32}, false},
+	}
+	for _, tt := range tests {
+		kept, sampled := sample(newChapters(), tt.n, tt.percent)
+		var sizes []int
+		for _, ch := range kept {
+			sizes = append(sizes, textLen(ch.Doc))
+		}
+		if !slices.Equal(sizes, tt.expected) || sampled != tt.sampled {
+			t.Errorf("sample(%d, %v) kept %v, %v, expected %v, %v", tt.n, tt.percent, sizes, sampled, tt.expected, tt.sampled)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// scriptEnd matches the sequences that would end or derail a <script>
+// element if they appeared in the script inlined into it.
+var scriptEnd = regexp.MustCompile(`(?i)</script|<!--`)
+
+// isScriptAttr reports whether an attribute runs script: an event handler
+// or a javascript: URL.
+func isScriptAttr(attr html.Attribute) bool {
+	return strings.HasPrefix(attr.Key, "on") ||
+		(attr.Key == "href" || attr.Key == "src" || attr.Key == "action") &&
+			strings.HasPrefix(strings.ToLower(strings.TrimSpace(attr.Val)), "javascript:")
+}
+
+// isScriptText reports whether n is the code of an HTML <script>, which is
+// written as it is rather than escaped.
+func isScriptText(n *html.Node) bool {
+	return n.Type == html.TextNode && n.Parent != nil && n.Parent.DataAtom == atom.Script && n.Parent.Namespace == ""
+}
+
+// keepScript prepares a <script> element of a chapter for --keep-scripts and
+// reports whether it should be kept. Scripts of the book are inlined, each
+// file once, and scripts from the web are dropped, so that the output does
+// not run code from outside the book.
+func (rd *renderer) keepScript(n *html.Node, contentFilePath string) bool {
+	src := getAttr(n, "src")
+	if src == "" {
+		return true
+	}
+	if isExternalHref(src) {
+		log.Printf("Warning: Dropping remote script %s", src)
+		return false
+	}
+	scriptPath := resolveEpubPath(epubDir(contentFilePath), src)
+	if rd.scripts[scriptPath] {
+		return false
+	}
+	data, err := readZipFile(rd.r, scriptPath)
+	if err != nil {
+		log.Printf("Warning: Could not read script %s: %v", scriptPath, err)
+		return false
+	}
+	if rd.scripts == nil {
+		rd.scripts = make(map[string]bool)
+	}
+	rd.scripts[scriptPath] = true
+
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "src", "async", "defer", "integrity", "crossorigin", "charset":
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+	for n.FirstChild != nil {
+		n.RemoveChild(n.FirstChild)
+	}
+	code := scriptEnd.ReplaceAllStringFunc(string(data), func(s string) string {
+		return s[:1] + `\` + s[1:]
+	})
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: code})
+	return true
+}
+
+// headScripts moves the scripts of a chapter's head to the start of its
+// body for --keep-scripts, as the head is not written, so that they run
+// before the chapter's content as they would in the book.
+func headScripts(doc, body *html.Node) {
+	head := findElement(doc, "head")
+	if head == nil {
+		return
+	}
+	first := body.FirstChild
+	for c := head.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && c.DataAtom == atom.Script {
+			head.RemoveChild(c)
+			body.InsertBefore(c, first)
+		}
+		c = next
+	}
+}
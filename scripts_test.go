@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestIsScriptAttr(t *testing.T) {
+	tests := []struct {
+		attr     html.Attribute
+		expected bool
+	}{
+		{html.Attribute{Key: "onclick", Val: "check()"}, true},
+		{html.Attribute{Key: "href", Val: " JavaScript:check()"}, true},
+		{html.Attribute{Key: "action", Val: "javascript:void(0)"}, true},
+		{html.Attribute{Key: "href", Val: "#answer"}, false},
+		{html.Attribute{Key: "title", Val: "javascript:"}, false},
+	}
+	for _, tt := range tests {
+		if got := isScriptAttr(tt.attr); got != tt.expected {
+			t.Errorf("isScriptAttr(%+v) = %v, expected %v", tt.attr, got, tt.expected)
+		}
+	}
+}
+
+func TestKeepScripts(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"OEBPS/js/quiz.js": []byte(`document.write("</script>");`),
+	})
+	const page = `<html><head><script src="js/quiz.js"></script><script src="https://example.com/track.js"></script></head>
+<body><p><button onclick="check()">Check</button></p><script src="js/quiz.js"></script><script>check()</script></body></html>`
+	tests := []struct {
+		name     string
+		opts     options
+		expected string
+	}{
+		{"without --keep-scripts", options{}, `<p><button>Check</button></p>`},
+		{"with --keep-scripts", options{KeepScripts: true}, `<script>document.write("<\/script>");</script><p><button onclick="check()">Check</button></p><script>check()</script>`},
+		{"with --keep-scripts --minify", options{KeepScripts: true, Minify: true}, `<script>document.write("<\/script>");</script><p><button onclick=check()>Check</button></p><script>check()</script>`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd := newRenderer(&Package{OpfDir: "OEBPS"}, r, &tt.opts)
+		rd.anchors = &anchors{}
+		var b strings.Builder
+		rd.renderChapter(Chapter{Path: "OEBPS/page.xhtml", Doc: doc}, &b)
+		if out := strings.ReplaceAll(b.String(), "\n", ""); out != tt.expected {
+			t.Errorf("renderChapter %s gave %s, expected %s", tt.name, out, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// spineRange is a range of spine positions given to --chapters, counting
+// from 1. Last is 0 for a range that runs to the end of the spine.
+type spineRange struct {
+	First, Last int
+}
+
+// parseSpineRanges parses a --chapters list such as "3-7,12" or "5-".
+func parseSpineRanges(s string) ([]spineRange, error) {
+	var ranges []spineRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		var rg spineRange
+		var err error
+		if rg.First, err = strconv.Atoi(first); err != nil || rg.First < 1 {
+			return nil, fmt.Errorf("invalid chapter range %q", part)
+		}
+		switch {
+		case !isRange:
+			rg.Last = rg.First
+		case last != "":
+			if rg.Last, err = strconv.Atoi(last); err != nil || rg.Last < rg.First {
+				return nil, fmt.Errorf("invalid chapter range %q", part)
+			}
+		}
+		ranges = append(ranges, rg)
+	}
+	return ranges, nil
+}
+
+// contains reports whether the spine position pos is in the range.
+func (rg spineRange) contains(pos int) bool {
+	return pos >= rg.First && (rg.Last == 0 || pos <= rg.Last)
+}
+
+// selectSpine keeps the spine items at the positions given to --chapters,
+// in spine order.
+func selectSpine(itemrefs []Itemref, ranges []spineRange) []Itemref {
+	var selected []Itemref
+	for i, itemref := range itemrefs {
+		for _, rg := range ranges {
+			if rg.contains(i + 1) {
+				selected = append(selected, itemref)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// filterSpine keeps the spine items whose title in the table of contents
+// or manifest href matches include, if given, and neither matches exclude,
+// for --include and --exclude.
+func filterSpine(pkg *Package, r *epubArchive, include, exclude *regexp.Regexp) []Itemref {
+	titles := spineTitles(pkg, r)
+	hrefs := make(map[string]string)
+	for _, item := range pkg.Manifest.Items {
+		hrefs[item.ID] = item.Href
+	}
+	matches := func(re *regexp.Regexp, itemref Itemref) bool {
+		href := hrefs[itemref.Idref]
+		title, ok := titles[joinEpubPath(pkg.OpfDir, href)]
+		return re.MatchString(href) || ok && re.MatchString(title)
+	}
+	var kept []Itemref
+	for _, itemref := range pkg.Spine.Itemrefs {
+		if include != nil && !matches(include, itemref) || exclude != nil && matches(exclude, itemref) {
+			continue
+		}
+		kept = append(kept, itemref)
+	}
+	return kept
+}
+
+// spineTitles maps the documents of the book to the title of the first
+// entry pointing at them in the EPUB 3 navigation document or in the NCX,
+// the one of the package's version first.
+func spineTitles(pkg *Package, r *epubArchive) map[string]string {
+	titles := make(map[string]string)
+	add := func(docPath, href, title string) {
+		target, _ := resolveHref(docPath, href)
+		if _, ok := titles[target]; !ok {
+			titles[target] = strings.Join(strings.Fields(title), " ")
+		}
+	}
+	byVersion(pkg, func() bool {
+		doc, path := readNavDoc(r, pkg)
+		if doc == nil {
+			return false
+		}
+		list := navList(doc, "toc")
+		if list == nil {
+			return false
+		}
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.Data == "a" {
+				add(path, getAttr(n, "href"), textContent(n))
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(list)
+		return true
+	}, func() bool {
+		path := ncxPath(pkg)
+		if path == "" {
+			return false
+		}
+		ncx, err := parseNCX(r, path)
+		if err != nil {
+			return false
+		}
+		var walk func([]NavPoint)
+		walk = func(points []NavPoint) {
+			for _, p := range points {
+				add(path, p.Content.Src, p.Label)
+				walk(p.Children)
+			}
+		}
+		walk(ncx.NavPoints)
+		return len(ncx.NavPoints) > 0
+	})
+	return titles
+}
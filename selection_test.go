@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestParseSpineRanges(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []spineRange
+	}{
+		{"12", []spineRange{{12, 12}}},
+		{"3-7,12", []spineRange{{3, 7}, {12, 12}}},
+		{"1, 5-", []spineRange{{1, 1}, {5, 0}}},
+		{"0", nil},
+		{"7-3", nil},
+		{"a-b", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		ranges, err := parseSpineRanges(tt.input)
+		if tt.expected == nil {
+			if err == nil {
+				t.Errorf("parseSpineRanges(%q) = %v, expected an error", tt.input, ranges)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(ranges, tt.expected) {
+			t.Errorf("parseSpineRanges(%q) = %v, %v, expected %v", tt.input, ranges, err, tt.expected)
+		}
+	}
+}
+
+func TestSelectSpine(t *testing.T) {
+	var itemrefs []Itemref
+	for _, id := range []string{"c1", "c2", "c3", "c4", "c5", "c6"} {
+		itemrefs = append(itemrefs, Itemref{Idref: id})
+	}
+	tests := []struct {
+		ranges   []spineRange
+		expected []string
+	}{
+		{[]spineRange{{5, 5}, {2, 3}}, []string{"c2", "c3", "c5"}},
+		{[]spineRange{{4, 0}}, []string{"c4", "c5", "c6"}},
+		{[]spineRange{{2, 9}, {3, 3}}, []string{"c2", "c3", "c4", "c5", "c6"}},
+		{[]spineRange{{7, 7}}, nil},
+	}
+
+	for _, tt := range tests {
+		var ids []string
+		for _, itemref := range selectSpine(itemrefs, tt.ranges) {
+			ids = append(ids, itemref.Idref)
+		}
+		if !slices.Equal(ids, tt.expected) {
+			t.Errorf("selectSpine(%v) = %v, expected %v", tt.ranges, ids, tt.expected)
+		}
+	}
+}
+
+func TestFilterSpine(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{"OEBPS/nav.xhtml": []byte(testNavDoc)})
+	pkg := &Package{OpfDir: "OEBPS"}
+	pkg.Manifest.Items = []Item{
+		{ID: "nav", Href: "nav.xhtml", MediaType: "application/xhtml+xml", Properties: "nav"},
+		{ID: "ads", Href: "Text/ads.xhtml", MediaType: "application/xhtml+xml"},
+		{ID: "ch1", Href: "Text/ch1.xhtml", MediaType: "application/xhtml+xml"},
+		{ID: "ch2", Href: "Text/ch2.xhtml", MediaType: "application/xhtml+xml"},
+	}
+	pkg.Spine.Itemrefs = []Itemref{{Idref: "ads"}, {Idref: "ch1"}, {Idref: "ch2"}}
+	tests := []struct {
+		include, exclude string
+		expected         []string
+	}{
+		{"", "ads", []string{"ch1", "ch2"}},
+		{"^Chapter", "", []string{"ch1", "ch2"}},
+		{"Chapter", "ch2", []string{"ch1"}},
+		{"", "Chapter 1", []string{"ads", "ch2"}},
+	}
+
+	for _, tt := range tests {
+		var include, exclude *regexp.Regexp
+		if tt.include != "" {
+			include = regexp.MustCompile(tt.include)
+		}
+		if tt.exclude != "" {
+			exclude = regexp.MustCompile(tt.exclude)
+		}
+		var ids []string
+		for _, itemref := range filterSpine(pkg, r, include, exclude) {
+			ids = append(ids, itemref.Idref)
+		}
+		if !slices.Equal(ids, tt.expected) {
+			t.Errorf("filterSpine(%q, %q) = %v, expected %v", tt.include, tt.exclude, ids, tt.expected)
+		}
+	}
+}
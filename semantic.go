@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// defaultSemanticMap maps class names that publishers commonly use for
+// styled spans and divs onto the elements that carry the same meaning.
+var defaultSemanticMap = map[string]string{
+	"italic":      "em",
+	"italics":     "em",
+	"ital":        "em",
+	"emphasis":    "em",
+	"em":          "em",
+	"bold":        "strong",
+	"strong":      "strong",
+	"underline":   "u",
+	"strike":      "s",
+	"sup":         "sup",
+	"superscript": "sup",
+	"sub":         "sub",
+	"subscript":   "sub",
+	"code":        "code",
+	"monospace":   "code",
+	"blockquote":  "blockquote",
+	"quote":       "blockquote",
+	"extract":     "blockquote",
+	"epigraph":    "blockquote",
+}
+
+// semanticInline lists the inline elements a class can be mapped to. Other
+// targets are treated as blocks.
+var semanticInline = map[string]bool{
+	"em": true, "strong": true, "i": true, "b": true, "u": true, "s": true,
+	"small": true, "sup": true, "sub": true, "code": true, "cite": true,
+	"q": true, "mark": true, "abbr": true, "dfn": true, "kbd": true, "samp": true, "var": true,
+}
+
+// loadSemanticMap reads a --semantic-map file. Each line holds a class name
+// and the element it maps to, separated by whitespace or "="; blank lines
+// and lines starting with "#" are ignored. The entries are added to the
+// defaults, overriding them.
+func loadSemanticMap(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open semantic map %s: %w", path, err)
+	}
+	defer f.Close()
+
+	mapping := make(map[string]string, len(defaultSemanticMap))
+	for class, tag := range defaultSemanticMap {
+		mapping[class] = tag
+	}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.Replace(text, "=", " ", 1))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a class name and an element", path, line)
+		}
+		class := strings.TrimPrefix(fields[0], ".")
+		tag := strings.ToLower(strings.Trim(fields[1], "<>"))
+		if atom.Lookup([]byte(tag)) == 0 {
+			return nil, fmt.Errorf("%s:%d: unknown element %q", path, line, tag)
+		}
+		mapping[class] = tag
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read semantic map %s: %w", path, err)
+	}
+	return mapping, nil
+}
+
+// semanticize replaces spans and divs carrying a mapped class with the
+// mapped element, so their meaning survives when classes are stripped. A
+// span becomes the inline element it maps to; a div or paragraph becomes
+// the block it maps to, or has its content wrapped in the inline element.
+func semanticize(n *html.Node, mapping map[string]string) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		semanticize(c, mapping)
+	}
+	if n.Type != html.ElementNode {
+		return
+	}
+	for _, class := range strings.Fields(getAttr(n, "class")) {
+		tag, ok := mapping[class]
+		if !ok || tag == n.Data {
+			continue
+		}
+		inline := semanticInline[tag]
+		switch {
+		case n.Data == "span" && inline, (n.Data == "div" || n.Data == "p") && !inline:
+			n.Data, n.DataAtom = tag, atom.Lookup([]byte(tag))
+		case inline && n.FirstChild != nil && !hasBlockDescendant(n) && hasInlineWrapTarget(n, tag):
+			wrapChildren(n, tag)
+		}
+	}
+}
+
+// hasInlineWrapTarget reports whether the content of n is not already
+// wrapped in tag.
+func hasInlineWrapTarget(n *html.Node, tag string) bool {
+	only := n.FirstChild
+	return !(only.NextSibling == nil && only.Type == html.ElementNode && only.Data == tag)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestSemanticize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`<p>A <span class="italic">word</span></p>`, `<p>A <em class="italic">word</em></p>`},
+		{`<span class="bold italic">both</span>`, `<strong class="bold italic"><em>both</em></strong>`},
+		{`<p class="italic">line</p>`, `<p class="italic"><em>line</em></p>`},
+		{`<p class="italic"><em>line</em></p>`, `<p class="italic"><em>line</em></p>`},
+		{`<div class="blockquote"><p>quoted</p></div>`, `<blockquote class="blockquote"><p>quoted</p></blockquote>`},
+		{`<div class="italic"><p>block</p></div>`, `<div class="italic"><p>block</p></div>`},
+		{`<span class="quote">inline</span>`, `<span class="quote">inline</span>`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := findElement(doc, "body")
+		semanticize(body, defaultSemanticMap)
+		var out strings.Builder
+		for c := body.FirstChild; c != nil; c = c.NextSibling {
+			html.Render(&out, c)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("semanticize(%q) = %q, expected %q", tt.input, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestLoadSemanticMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.txt")
+	os.WriteFile(path, []byte("# publisher classes\n.calibre3 = <i>\nital strong\n\n"), 0o644)
+	mapping, err := loadSemanticMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping["calibre3"] != "i" || mapping["ital"] != "strong" || mapping["bold"] != "strong" {
+		t.Errorf("loadSemanticMap = %v, expected calibre3=i, ital=strong and the defaults", mapping)
+	}
+
+	os.WriteFile(path, []byte("x notatag\n"), 0o644)
+	if _, err := loadSemanticMap(path); err == nil {
+		t.Error("loadSemanticMap with an unknown element returned no error")
+	}
+}
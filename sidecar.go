@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// conversionStats counts what went into the HTML output, for
+// --metadata-out.
+type conversionStats struct {
+	Chapters    int   `json:"chapters"`
+	Words       int   `json:"words"`
+	Images      int   `json:"images"`
+	OutputBytes int64 `json:"outputBytes"`
+}
+
+// sidecarSpineItem is an entry of the spine summary of --metadata-out.
+type sidecarSpineItem struct {
+	ID         string   `json:"id"`
+	Href       string   `json:"href"`
+	MediaType  string   `json:"mediaType"`
+	Linear     bool     `json:"linear"`
+	Properties []string `json:"properties,omitempty"` // of the manifest item, such as scripted or svg
+}
+
+// sidecarIdentifier is the unique identifier of the book in the output of
+// --metadata-out, with its scheme and its value without the scheme prefix.
+type sidecarIdentifier struct {
+	Value  string `json:"value"`
+	Scheme string `json:"scheme,omitempty"` // isbn, uuid or doi
+	ID     string `json:"id"`
+}
+
+// bookStats counts the chapters and the words of their text.
+func bookStats(chapters []Chapter) conversionStats {
+	stats := conversionStats{Chapters: len(chapters)}
+	for _, ch := range chapters {
+		if body := findElement(ch.Doc, "body"); body != nil {
+			stats.Words += len(strings.Fields(textContent(body)))
+		}
+	}
+	return stats
+}
+
+// writeMetadataFile writes the parsed OPF metadata of the book, a summary
+// of its spine and manifest, the provenance of the output and the
+// conversion stats to path as JSON, so
+// that scripts managing a library of converted books do not have to read
+// the EPUB themselves.
+func writeMetadataFile(path string, pkg *Package, provenance Provenance, stats conversionStats) error {
+	items := make(map[string]Item, len(pkg.Manifest.Items))
+	mediaTypes := make(map[string]int)
+	for _, item := range pkg.Manifest.Items {
+		items[item.ID] = item
+		mediaTypes[item.MediaType]++
+	}
+	spine := make([]sidecarSpineItem, 0, len(pkg.Spine.Itemrefs))
+	for _, itemref := range pkg.Spine.Itemrefs {
+		item := items[itemref.Idref]
+		spine = append(spine, sidecarSpineItem{
+			ID:         itemref.Idref,
+			Href:       item.Href,
+			MediaType:  item.MediaType,
+			Linear:     itemref.Linear != "no",
+			Properties: strings.Fields(item.Properties),
+		})
+	}
+
+	var identifier *sidecarIdentifier
+	if value := uniqueIdentifier(pkg); value != "" {
+		identifier = &sidecarIdentifier{Value: value}
+		for _, id := range pkg.Metadata.Identifiers {
+			if strings.TrimSpace(id.Value) == value {
+				identifier.Scheme, identifier.ID = parseIdentifier(value, id.Scheme)
+				break
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Version          string             `json:"version"`
+		UniqueIdentifier *sidecarIdentifier `json:"uniqueIdentifier,omitempty"`
+		Metadata         Metadata           `json:"metadata"`
+		Spine            []sidecarSpineItem `json:"spine"`
+		Manifest         map[string]int     `json:"manifest"` // number of items by media type
+		Provenance       Provenance         `json:"provenance"`
+		Stats            conversionStats    `json:"stats"`
+	}{pkg.Version, identifier, pkg.Metadata, spine, mediaTypes, provenance, stats}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestBookStats(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<head><title>Not counted</title></head><body><h1>One</h1><p>Two three, four.</p></body>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := bookStats([]Chapter{{Doc: doc}})
+	if stats.Chapters != 1 || stats.Words != 4 {
+		t.Errorf("bookStats = %+v, expected 1 chapter and 4 words", stats)
+	}
+}
+
+func TestWriteMetadataFile(t *testing.T) {
+	pkg := &Package{Version: "3.0", UniqueID: "id", Metadata: Metadata{
+		Title:       "Book",
+		Creators:    []Contributor{{Name: "Jane Doe", Role: "aut"}},
+		Identifiers: []Identifier{{ID: "id", Value: "urn:uuid:1234"}},
+	}}
+	pkg.Manifest.Items = []Item{
+		{ID: "c1", Href: "c1.xhtml", MediaType: "application/xhtml+xml"},
+		{ID: "c2", Href: "c2.xhtml", MediaType: "application/xhtml+xml", Properties: "scripted svg"},
+		{ID: "img", Href: "a.png", MediaType: "image/png"},
+	}
+	pkg.Spine.Itemrefs = []Itemref{{Idref: "c1"}, {Idref: "c2", Linear: "no"}}
+	path := filepath.Join(t.TempDir(), "book.json")
+	if err := writeMetadataFile(path, pkg, Provenance{Source: "book.epub", SHA256: "abc", Generator: "epub2html"}, conversionStats{Chapters: 1, Words: 10, Images: 1, OutputBytes: 100}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"version":          "3.0",
+		"uniqueIdentifier": map[string]any{"value": "urn:uuid:1234", "scheme": "uuid", "id": "1234"},
+		"metadata": map[string]any{
+			"title":       "Book",
+			"creators":    []any{map[string]any{"name": "Jane Doe", "role": "aut"}},
+			"identifiers": []any{map[string]any{"id": "id", "value": "urn:uuid:1234"}},
+		},
+		"spine": []any{
+			map[string]any{"id": "c1", "href": "c1.xhtml", "mediaType": "application/xhtml+xml", "linear": true},
+			map[string]any{"id": "c2", "href": "c2.xhtml", "mediaType": "application/xhtml+xml", "linear": false, "properties": []any{"scripted", "svg"}},
+		},
+		"manifest":   map[string]any{"application/xhtml+xml": 2.0, "image/png": 1.0},
+		"provenance": map[string]any{"source": "book.epub", "sha256": "abc", "generator": "epub2html"},
+		"stats":      map[string]any{"chapters": 1.0, "words": 10.0, "images": 1.0, "outputBytes": 100.0},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("writeMetadataFile wrote %s", data)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// minSrcsetSize is the smallest image side, in pixels, written as an extra
+// srcset candidate; smaller images are not worth another request.
+const minSrcsetSize = 320
+
+// imageSrcset writes smaller copies of a linked image, halving its size down
+// to minSrcsetSize, and returns the srcset listing them together with the
+// image itself at href. It returns "" if the image is too small to need
+// smaller copies or cannot be scaled.
+func (rd *renderer) imageSrcset(archivePath, href string) string {
+	if srcset, ok := rd.srcsets[archivePath]; ok {
+		return srcset
+	}
+	srcset := rd.buildSrcset(archivePath, href)
+	if rd.srcsets == nil {
+		rd.srcsets = make(map[string]string)
+	}
+	rd.srcsets[archivePath] = srcset
+	return srcset
+}
+
+func (rd *renderer) buildSrcset(archivePath, href string) string {
+	size, ok := rd.imageSizes[archivePath]
+	if !ok {
+		return ""
+	}
+	data, err := readZipFile(rd.r, archivePath)
+	if err != nil {
+		return ""
+	}
+	mediaType := rd.manifestHrefMap[archivePath].MediaType
+	if mediaType != "image/jpeg" && mediaType != "image/png" {
+		return ""
+	}
+
+	candidates := []string{fmt.Sprintf("%s %dw", href, size.X)}
+	for maxSize := max(size.X, size.Y) / 2; maxSize >= minSrcsetSize; maxSize /= 2 {
+		o, _ := rd.opts.imageOptions()
+		o.MaxSize = maxSize
+		scaled, scaledType, err := processImage(data, mediaType, o)
+		if err != nil {
+			log.Printf("Warning: Could not scale image %s: %v", archivePath, err)
+			return ""
+		}
+		width, _ := fitWithin(size.X, size.Y, maxSize)
+		variant := fmt.Sprintf("%s-%dw%s", strings.TrimSuffix(archivePath, path.Ext(archivePath)), width, imageExtensions[scaledType])
+		variantHref, err := writeAsset(assetsDir(rd.opts), rd.opts.OutputPath, rd.opfDir, variant, scaled)
+		if err != nil {
+			log.Printf("Warning: Could not write image %s: %v", variant, err)
+			return ""
+		}
+		candidates = append(candidates, fmt.Sprintf("%s %dw", variantHref, width))
+	}
+	if len(candidates) == 1 {
+		return ""
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// setSrcset lets browsers pick a smaller copy of a linked image on narrow
+// screens, for --max-image-size. Images that come with a
+// srcset of their own are left alone.
+func (rd *renderer) setSrcset(n *html.Node, archivePath, href string) {
+	if getAttr(n, "srcset") != "" || getAttr(n, "sizes") != "" {
+		return
+	}
+	srcset := rd.imageSrcset(archivePath, href)
+	if srcset == "" {
+		return
+	}
+	width := rd.imageSizes[archivePath].X
+	n.Attr = append(n.Attr,
+		html.Attribute{Key: "srcset", Val: srcset},
+		html.Attribute{Key: "sizes", Val: fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", width, width)})
+}
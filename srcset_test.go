@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestSetSrcset(t *testing.T) {
+	dir := t.TempDir()
+	rd := &renderer{
+		r: openTestArchive(t, map[string][]byte{
+			"OEBPS/images/map.png":  testPNG(t, 1600, 800),
+			"OEBPS/images/icon.png": testPNG(t, 400, 400),
+		}),
+		opts: &options{
+			OutputPath:   filepath.Join(dir, "book.html"),
+			AssetsDir:    filepath.Join(dir, "assets"),
+			MaxImageSize: 1200,
+		},
+		opfDir: "OEBPS",
+		manifestHrefMap: map[string]Item{
+			"OEBPS/images/map.png":  {Href: "images/map.png", MediaType: "image/png"},
+			"OEBPS/images/icon.png": {Href: "images/icon.png", MediaType: "image/png"},
+		},
+	}
+	tests := []struct {
+		img      string
+		expected string
+	}{
+		{
+			`<img src="../images/map.png">`,
+			`<img src="assets/images/map.png" width="1200" height="600" srcset="assets/images/map.png 1200w, assets/images/map-600w.png 600w" sizes="(max-width: 1200px) 100vw, 1200px" loading="lazy" decoding="async"/>`,
+		},
+		{
+			`<img src="../images/icon.png">`,
+			`<img src="assets/images/icon.png" width="400" height="400" loading="lazy" decoding="async"/>`,
+		},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := findElement(doc, "img")
+		rd.embedImage(img, "OEBPS/text/ch1.xhtml")
+		var out strings.Builder
+		html.Render(&out, img)
+		if out.String() != tt.expected {
+			t.Errorf("embedImage(%q) = %q, expected %q", tt.img, out.String(), tt.expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "assets", "images", "map-600w.png")); err != nil {
+		t.Errorf("setSrcset did not write the smaller copy: %v", err)
+	}
+}
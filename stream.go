@@ -0,0 +1,245 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// minStreamedSize is the size from which images embedded as data URIs are
+// streamed into the output instead of being encoded in memory.
+const minStreamedSize = 256 << 10
+
+// imageURL is resourceURL for the source of an <img> element. Large images
+// that are embedded unchanged are not read yet: their data URI ends in a
+// marker that streamWriter replaces with the base64-encoded archive entry
+// while the output is written, so that memory use does not grow with the
+// size of the images.
+func (rd *renderer) imageURL(archivePath string) (string, error) {
+	if uri, ok := rd.streamedDataURI(archivePath); ok {
+		return uri, nil
+	}
+	return rd.resourceURL(archivePath)
+}
+
+// streamedDataURI returns the data URI with a stream marker for an image,
+// or false if the image is small, written to the assets directory or
+// changed on the way.
+func (rd *renderer) streamedDataURI(archivePath string) (string, bool) {
+	f, ok := rd.streamable(archivePath)
+	if !ok {
+		return "", false
+	}
+	if _, ok := rd.imageSizes[archivePath]; !ok {
+		rc, err := f.Open()
+		if err != nil {
+			return "", false
+		}
+		rd.recordImageSize(archivePath, rc)
+		rc.Close()
+	}
+	rd.streamed = append(rd.streamed, f)
+	return "data:" + rd.manifestHrefMap[archivePath].MediaType + ";base64," + streamMarker(len(rd.streamed)-1), true
+}
+
+// streamable returns the archive entry of an image that streamedDataURI
+// streams, or false if it does not.
+func (rd *renderer) streamable(archivePath string) (*zip.File, bool) {
+	if rd.opts.AssetsDir != "" || rd.opts.EmbedMaxBytes > 0 {
+		return nil, false
+	}
+	if _, ok := rd.opts.imageOptions(); ok {
+		return nil, false
+	}
+	item, ok := rd.manifestHrefMap[archivePath]
+	if _, obfuscated := rd.obfuscated[archivePath]; !ok || obfuscated || !strings.HasPrefix(item.MediaType, "image/") {
+		return nil, false
+	}
+	f, err := findZipFile(rd.r, archivePath)
+	if err != nil || f.UncompressedSize64 < minStreamedSize {
+		return nil, false
+	}
+	return f, true
+}
+
+// streamMarker returns the placeholder for the i-th streamed entry. NUL
+// bytes cannot occur in parsed content, and the "=" keeps --minify from
+// unquoting the attribute, as base64 padding may take its place.
+func streamMarker(i int) string {
+	return "\x00stream=" + strconv.Itoa(i) + "\x00"
+}
+
+// chapterMarker returns the placeholder for the i-th chapter of a
+// chapterSpool.
+func chapterMarker(i int) string {
+	return "\x00chapter=" + strconv.Itoa(i) + "\x00"
+}
+
+// chapterSpool keeps the rendered chapters in a temporary file until the
+// output is written. The head of the output depends on what rendering the
+// chapters found, such as their stylesheets, formulas and repeated images,
+// so they are all rendered before anything is written; spooling them
+// keeps memory use from growing with the length of the book. The bodies
+// are then chapter markers, which streamWriter replaces with the spooled
+// HTML.
+type chapterSpool struct {
+	f        *os.File
+	w        *bufio.Writer
+	size     int64      // bytes written to f so far
+	chapters [][2]int64 // start and end offsets of each chapter in f
+	removed  bool       // whether f is already removed from its directory
+}
+
+// newChapterSpool creates a chapterSpool in the temporary directory.
+func newChapterSpool() (*chapterSpool, error) {
+	f, err := os.CreateTemp("", "epub2html-chapters-*")
+	if err != nil {
+		return nil, err
+	}
+	// Removing the file while it is open leaves nothing behind when the
+	// conversion stops with log.Fatal, which skips deferred calls. Where
+	// open files cannot be removed, Close removes it.
+	sp := &chapterSpool{f: f, removed: os.Remove(f.Name()) == nil}
+	sp.w = bufio.NewWriter(spoolFile{sp})
+	return sp, nil
+}
+
+// spoolFile counts what is written to the file of a chapterSpool.
+type spoolFile struct{ sp *chapterSpool }
+
+func (sf spoolFile) Write(p []byte) (int, error) {
+	n, err := sf.sp.f.Write(p)
+	sf.sp.size += int64(n)
+	return n, err
+}
+
+// add spools what render writes and returns the marker standing for it.
+func (sp *chapterSpool) add(render func(io.StringWriter)) template.HTML {
+	start := sp.size + int64(sp.w.Buffered())
+	render(sp.w)
+	end := sp.size + int64(sp.w.Buffered())
+	sp.chapters = append(sp.chapters, [2]int64{start, end})
+	return template.HTML(chapterMarker(len(sp.chapters) - 1))
+}
+
+// chapter returns a reader of the i-th spooled chapter.
+func (sp *chapterSpool) chapter(i int) (io.Reader, error) {
+	if err := sp.w.Flush(); err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(sp.f, sp.chapters[i][0], sp.chapters[i][1]-sp.chapters[i][0]), nil
+}
+
+// Close closes the file of the spool, removing it if it is still there.
+func (sp *chapterSpool) Close() error {
+	if sp == nil {
+		return nil
+	}
+	err := sp.f.Close()
+	if !sp.removed {
+		return os.Remove(sp.f.Name())
+	}
+	return err
+}
+
+// streamWriter passes output through to w, replacing stream markers with
+// the base64 encoding of the archive entries they stand for, and chapter
+// markers with the chapters spooled.
+type streamWriter struct {
+	w        io.Writer
+	files    []*zip.File
+	spool    *chapterSpool
+	inMarker bool
+	marker   []byte // the part of the current marker seen so far
+}
+
+// newStreamWriter returns w itself when nothing is streamed or spooled.
+func newStreamWriter(w io.Writer, files []*zip.File, spool *chapterSpool) io.Writer {
+	if len(files) == 0 && spool == nil {
+		return w
+	}
+	return &streamWriter{w: w, files: files, spool: spool}
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, 0)
+		if !sw.inMarker {
+			if i < 0 {
+				i = len(p)
+			}
+			if _, err := sw.w.Write(p[:i]); err != nil {
+				return 0, err
+			}
+			sw.inMarker = i < len(p)
+			p = p[min(i+1, len(p)):]
+			continue
+		}
+		if i < 0 {
+			sw.marker = append(sw.marker, p...)
+			break
+		}
+		sw.marker = append(sw.marker, p[:i]...)
+		p = p[i+1:]
+		sw.inMarker = false
+		if err := sw.expand(); err != nil {
+			return 0, err
+		}
+		sw.marker = sw.marker[:0]
+	}
+	return n, nil
+}
+
+// expand writes the entry or the chapter the marker just read stands for.
+// Anything else between NUL bytes is written back unchanged.
+func (sw *streamWriter) expand() error {
+	if id, ok := bytes.CutPrefix(sw.marker, []byte("chapter=")); ok && sw.spool != nil {
+		if i, err := strconv.Atoi(string(id)); err == nil && i >= 0 && i < len(sw.spool.chapters) {
+			chapter, err := sw.spool.chapter(i)
+			if err != nil {
+				return fmt.Errorf("failed to read spooled chapter: %w", err)
+			}
+			// The chapter's own stream markers are expanded as well.
+			w := newStreamWriter(sw.w, sw.files, nil)
+			if _, err := io.Copy(w, chapter); err != nil {
+				return err
+			}
+			return streamEnd(w)
+		}
+	}
+	id, ok := bytes.CutPrefix(sw.marker, []byte("stream="))
+	i, err := strconv.Atoi(string(id))
+	if !ok || err != nil || i < 0 || i >= len(sw.files) {
+		_, err := sw.w.Write(append(append([]byte{0}, sw.marker...), 0))
+		return err
+	}
+	f := sw.files[i]
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	enc := base64.NewEncoder(base64.StdEncoding, sw.w)
+	if _, err := io.Copy(enc, rc); err != nil {
+		return fmt.Errorf("failed to embed %s: %w", f.Name, err)
+	}
+	return enc.Close()
+}
+
+// streamEnd reports an error if the output written to a writer returned by
+// newStreamWriter ends in the middle of a marker, which is otherwise never
+// written.
+func streamEnd(w io.Writer) error {
+	if sw, ok := w.(*streamWriter); ok && sw.inMarker {
+		return fmt.Errorf("the output ends inside the placeholder %q", "\x00"+string(sw.marker))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestStreamedImageURL(t *testing.T) {
+	large := append(testPNG(t, 4, 2), bytes.Repeat([]byte{0}, minStreamedSize)...)
+	small := testPNG(t, 4, 2)
+	rd := &renderer{
+		r: openTestArchive(t, map[string][]byte{
+			"OEBPS/large.png": large,
+			"OEBPS/small.png": small,
+		}),
+		opts: &options{},
+		manifestHrefMap: map[string]Item{
+			"OEBPS/large.png": {Href: "large.png", MediaType: "image/png"},
+			"OEBPS/small.png": {Href: "small.png", MediaType: "image/png"},
+		},
+	}
+	var page strings.Builder
+	for _, archivePath := range []string{"OEBPS/large.png", "OEBPS/small.png", "OEBPS/large.png"} {
+		uri, err := rd.imageURL(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page.WriteString(`<img src="` + uri + `">`)
+	}
+	if len(rd.streamed) != 2 {
+		t.Fatalf("imageURL streamed %d images, expected 2", len(rd.streamed))
+	}
+	if size := rd.imageSizes["OEBPS/large.png"]; size.X != 4 || size.Y != 2 {
+		t.Errorf("imageURL recorded a size of %v for a streamed image, expected 4x2", size)
+	}
+
+	// Write a byte at a time so that markers are split across writes.
+	var out bytes.Buffer
+	sw := newStreamWriter(&out, rd.streamed, nil)
+	for _, b := range []byte(page.String() + "\x00other\x00") {
+		if _, err := sw.Write([]byte{b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	largeURI := encodeDataURI("image/png", large)
+	expected := `<img src="` + largeURI + `"><img src="` + encodeDataURI("image/png", small) + `"><img src="` + largeURI + `">` + "\x00other\x00"
+	if out.String() != expected {
+		t.Errorf("streamWriter wrote %d bytes, expected %d bytes of embedded images", out.Len(), len(expected))
+	}
+}
+
+func TestChapterSpool(t *testing.T) {
+	sp, err := newChapterSpool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	// Only the open file keeps the spool, so that nothing is left behind
+	// by log.Fatal.
+	if _, err := os.Stat(sp.f.Name()); runtime.GOOS != "windows" && !os.IsNotExist(err) {
+		t.Errorf("newChapterSpool left the spool file %s in its directory: %v", sp.f.Name(), err)
+	}
+	var bodies []string
+	for _, chapter := range []string{"<p>One</p>", "", strings.Repeat("<p>Two</p>", 1000)} {
+		bodies = append(bodies, string(sp.add(func(w io.StringWriter) { w.WriteString(chapter) })))
+	}
+
+	var out bytes.Buffer
+	sw := newStreamWriter(&out, nil, sp)
+	page := "<body>" + bodies[2] + "<hr>" + bodies[0] + bodies[1] + bodies[0] + "</body>"
+	if _, err := io.WriteString(sw, page); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<body>" + strings.Repeat("<p>Two</p>", 1000) + "<hr><p>One</p><p>One</p></body>"
+	if out.String() != expected {
+		t.Errorf("streamWriter wrote %d bytes for the spooled chapters, expected %q...", out.Len(), expected[:40])
+	}
+
+	out.Reset()
+	sw = newStreamWriter(&out, nil, sp)
+	io.WriteString(sw, "<style>a { content: '\x00chapter=0' }</style>")
+	if err := streamEnd(sw); err == nil {
+		t.Errorf("streamEnd accepted output ending inside a marker, after writing %q", out.String())
+	}
+
+	name := sp.f.Name()
+	sp.Close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Close left the spool file %s: %v", name, err)
+	}
+}
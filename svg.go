@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// attrName returns the name an attribute is written with, restoring the
+// prefix of foreign attributes such as xlink:href and xml:lang.
+func attrName(attr html.Attribute) string {
+	if attr.Namespace != "" {
+		return attr.Namespace + ":" + attr.Key
+	}
+	return attr.Key
+}
+
+// cleanSVG prepares an inline <svg> element for the output. Unlike HTML
+// content, its class and style attributes are kept, as drawings depend on
+// them, but scripts and event handlers are removed and the images it shows
+// are embedded like <img> sources.
+func (rd *renderer) cleanSVG(n *html.Node, contentFilePath string) {
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		if isScriptAttr(attr) {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.TextNode:
+		case c.Type != html.ElementNode, c.Data == "script", isScriptAnimation(c):
+			n.RemoveChild(c)
+		case (c.Data == "image" || c.Data == "feImage") && !rd.embedSVGImage(c, contentFilePath):
+			n.RemoveChild(c)
+		case c.Data == "foreignObject":
+			// Its content is HTML, cleaned like the rest of the chapter.
+			c.Attr = slices.DeleteFunc(c.Attr, isScriptAttr)
+			rd.cleanNode(c, contentFilePath)
+		default:
+			rd.cleanSVG(c, contentFilePath)
+		}
+		c = next
+	}
+}
+
+// isScriptAnimation reports whether an SVG animation element changes a
+// link, which it can turn into a javascript: URL once the drawing is shown.
+func isScriptAnimation(n *html.Node) bool {
+	switch n.Data {
+	case "set", "animate":
+	default:
+		return false
+	}
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "attributeName":
+			if name := strings.TrimSpace(attr.Val); name == "href" || name == "xlink:href" {
+				return true
+			}
+		case "to", "from", "by", "values":
+			if strings.Contains(strings.ToLower(attr.Val), "javascript:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scopeDrawingStyles limits the rules of the <style> elements of an inline
+// <svg> to the drawing, as in the output they would otherwise restyle the
+// whole book. Those of SVG documents of the spine are scoped by svgPage.
+func (rd *renderer) scopeDrawingStyles(n *html.Node, contentFilePath string) {
+	if rd.manifestHrefMap[contentFilePath].MediaType == svgMediaType {
+		return
+	}
+	scope := fmt.Sprintf("svg-drawing-%d", rd.svgDrawings+1)
+	if !scopeStyles(n, scope) {
+		return
+	}
+	rd.svgDrawings++
+	for i, attr := range n.Attr {
+		if attr.Key == "class" && attr.Namespace == "" {
+			n.Attr[i].Val = strings.TrimSpace(attr.Val + " " + scope)
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: "class", Val: scope})
+}
+
+// scopeStyles scopes the rules of the <style> elements below n to the
+// class scope, and reports whether there were any.
+func scopeStyles(n *html.Node, scope string) bool {
+	found := false
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == "style" {
+				found = true
+				if t := c.FirstChild; t != nil && t.Type == html.TextNode {
+					t.Data = serializeCSS(scopeRules(parseCSS(t.Data), "."+scope))
+				}
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// embedSVGImage points the href or xlink:href of an SVG <image> element at
+// the embedded image. It reports false if the element should be removed,
+// because images are left out or the image could not be embedded.
+func (rd *renderer) embedSVGImage(n *html.Node, contentFilePath string) bool {
+	if rd.opts.NoImages {
+		return false
+	}
+	for i, attr := range n.Attr {
+		if attr.Key != "href" || (attr.Namespace != "" && attr.Namespace != "xlink") {
+			continue
+		}
+		href := strings.TrimSpace(attr.Val)
+		if href == "" || strings.HasPrefix(href, "#") || isExternalHref(href) {
+			continue
+		}
+		imagePath := resolveEpubPath(epubDir(contentFilePath), href)
+		src, err := rd.resourceURL(imagePath)
+		if err != nil {
+			log.Printf("Warning: Could not embed image %s: %v", imagePath, err)
+			return false
+		}
+		n.Attr[i].Val = src
+	}
+	return true
+}
+
+// svgImage returns an <img> element equivalent to an <svg> wrapper that does
+// nothing but show a single image, as EPUB 2 books commonly do for their
+// cover, or nil if the drawing holds anything else. The alt text is taken
+// from the wrapper's <title> or aria-label.
+func svgImage(n *html.Node) *html.Node {
+	var image *html.Node
+	alt := getAttr(n, "aria-label")
+	var walk func(n *html.Node) bool
+	walk = func(n *html.Node) bool {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				if strings.TrimSpace(c.Data) != "" && c.Parent.Data != "title" && c.Parent.Data != "desc" {
+					return false
+				}
+			case c.Type != html.ElementNode:
+			case c.Data == "title":
+				if alt == "" {
+					alt = strings.TrimSpace(textContent(c))
+				}
+			case c.Data == "desc", c.Data == "metadata":
+			case c.Data == "g":
+				if !walk(c) {
+					return false
+				}
+			case c.Data == "image" && image == nil:
+				image = c
+			default:
+				return false
+			}
+		}
+		return true
+	}
+	if !walk(n) || image == nil {
+		return nil
+	}
+
+	var src string
+	for _, attr := range image.Attr {
+		if attr.Key == "href" && (attr.Namespace == "" || attr.Namespace == "xlink") {
+			src = attr.Val
+		}
+	}
+	if src == "" {
+		return nil
+	}
+	return &html.Node{
+		Type:     html.ElementNode,
+		Data:     "img",
+		DataAtom: atom.Img,
+		Attr:     []html.Attribute{{Key: "src", Val: src}, {Key: "alt", Val: alt}},
+	}
+}
+
+// svgPage wraps the drawing of an SVG document of the spine in a <div>
+// that svgPageCSS fits to the width of the output. The rules of its <style>
+// elements, written for a document of their own, are scoped to the
+// wrapper so that they do not restyle the rest of the book.
+func (rd *renderer) svgPage(body *html.Node) {
+	rd.svgPages++
+	class := "svg-page"
+	if scope := fmt.Sprintf("svg-page-%d", rd.svgPages); scopeStyles(body, scope) {
+		class += " " + scope
+	}
+	wrapChildren(body, "div", html.Attribute{Key: "class", Val: class})
+}
+
+// svgPageImage returns a content document showing an SVG document of the
+// spine as an image: the image the drawing wraps, if that is all it does,
+// as comics often do, or else the SVG document itself. Images the drawing
+// links to are not shown in the latter case, as an SVG image cannot load
+// other files.
+func svgPageImage(doc *html.Node, docPath string) *html.Node {
+	if root := findElement(doc, "svg"); root != nil {
+		if img := svgImage(root); img != nil {
+			p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+			p.AppendChild(img)
+			root.Parent.InsertBefore(p, root)
+			root.Parent.RemoveChild(root)
+			return doc
+		}
+	}
+	doc, err := imageChapter(docPath)
+	if err != nil {
+		return nil
+	}
+	return doc
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCleanSVG(t *testing.T) {
+	tests := []struct {
+		svg      string
+		opts     options
+		expected string
+	}{
+		{
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10" onload="run()"><script>run()</script><a xlink:href="javascript:run()" href="javascript:run()"><circle class="dot" r="5" style="fill: red"/></a></svg>`,
+			options{},
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10"><a><circle class="dot" r="5" style="fill: red"></circle></a></svg>`,
+		},
+		{
+			`<svg><image xlink:href="https://example.com/a.png" width="1" height="1"/><use href="#shape"/></svg>`,
+			options{},
+			`<svg><image xlink:href="https://example.com/a.png" width="1" height="1"></image><use href="#shape"></use></svg>`,
+		},
+		{
+			`<svg xml:lang="en"><image xlink:href="../images/cover.jpg"/><text>Cover</text></svg>`,
+			options{NoImages: true},
+			`<svg xml:lang="en"><text>Cover</text></svg>`,
+		},
+		{
+			`<svg><a href="#x"><set attributeName="href" to="javascript:run()"/><animate attributeName="fill" values="red;javascript:run()"/><animate attributeName="r" to="5"/><circle r="1"/></a></svg>`,
+			options{},
+			`<svg><a href="#x"><animate attributeName="r" to="5"></animate><circle r="1"></circle></a></svg>`,
+		},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.svg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		svg := findElement(doc, "svg")
+		rd := &renderer{opts: &tt.opts}
+		rd.cleanSVG(svg, "OEBPS/text/cover.xhtml")
+		var out strings.Builder
+		renderNodeRaw(svg, &out)
+		if out.String() != tt.expected {
+			t.Errorf("cleanSVG(%q) = %q, expected %q", tt.svg, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestInlineSVG(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{"OEBPS/images/a.png": {0x89, 'P', 'N', 'G'}})
+	const page = `<html><body><p>Text</p>
+<svg class="chart"><style>p { display: none }</style><foreignObject><p>Label<img src="../images/a.png" alt="A"/></p><iframe src="other.xhtml"></iframe></foreignObject></svg>
+<svg><style>text { fill: red }</style></svg></body></html>`
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &Package{OpfDir: "OEBPS", Manifest: Manifest{Items: []Item{{ID: "a", Href: "images/a.png", MediaType: "image/png"}}}}
+	rd := newRenderer(pkg, r, &options{})
+	rd.anchors = &anchors{}
+	var b strings.Builder
+	rd.renderChapter(Chapter{Path: "OEBPS/text/ch.xhtml", Doc: doc}, &b)
+	expected := `<p>Text</p><svg class="chart svg-drawing-1"><style>.svg-drawing-1 p { display: none }</style>` +
+		`<foreignObject><p>Label<img alt="A" src="data:image/png;base64,iVBORw=="></p></foreignObject></svg>` +
+		`<svg class="svg-drawing-2"><style>.svg-drawing-2 text { fill: red }</style></svg>`
+	if out := strings.ReplaceAll(b.String(), "\n", ""); out != expected {
+		t.Errorf("renderChapter with inline SVG gave %s, expected %s", out, expected)
+	}
+}
+
+func TestSVGImage(t *testing.T) {
+	tests := []struct {
+		svg      string
+		expected string
+	}{
+		{
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 600 800"><image width="600" height="800" xlink:href="../images/cover.jpg"/></svg>`,
+			`<img src="../images/cover.jpg" alt=""/>`,
+		},
+		{
+			`<svg><title>Cover</title><g><image href="cover.png"/></g></svg>`,
+			`<img src="cover.png" alt="Cover"/>`,
+		},
+		{`<svg aria-label="Map"> <image href="map.png"/> </svg>`, `<img src="map.png" alt="Map"/>`},
+		{`<svg><image href="a.png"/><image href="b.png"/></svg>`, ``},
+		{`<svg><image href="a.png"/><text>Caption</text></svg>`, ``},
+		{`<svg><circle r="5"/></svg>`, ``},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.svg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if img := svgImage(findElement(doc, "svg")); img != nil {
+			html.Render(&out, img)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("svgImage(%q) = %q, expected %q", tt.svg, out.String(), tt.expected)
+		}
+	}
+}
+
+func TestSVGPage(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{"OEBPS/p1.png": {0x89, 'P', 'N', 'G'}})
+	const page = `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="800" height="1200" viewBox="0 0 800 1200">
+<title>Page one</title><style>text { font-size: 40px }</style><image width="800" height="1200" xlink:href="p1.png"/><text x="10" y="50">Bang!</text></svg>`
+	const wrapper = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 800 1200"><title>Page two</title><image width="800" height="1200" xlink:href="p1.png"/></svg>`
+	tests := []struct {
+		name, svg string
+		opts      options
+		expected  string
+	}{
+		{"inline", page, options{},
+			`<div class="svg-page svg-page-1"><svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="800" height="1200" viewBox="0 0 800 1200"><title>Page one</title><style>.svg-page-1 text { font-size: 40px }</style><image width="800" height="1200" xlink:href="data:image/png;base64,iVBORw=="></image><text x="10" y="50">Bang!</text></svg></div>`},
+		{"inline without styles", wrapper, options{},
+			`<div class="svg-page"><svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 800 1200"><title>Page two</title><image width="800" height="1200" xlink:href="data:image/png;base64,iVBORw=="></image></svg></div>`},
+		{"wrapper as an image", wrapper, options{SVGPages: "image"},
+			`<p><img alt="Page two" src="data:image/png;base64,iVBORw=="></p>`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.svg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg := &Package{OpfDir: "OEBPS", Manifest: Manifest{Items: []Item{
+			{ID: "page", Href: "p1.svg", MediaType: svgMediaType},
+			{ID: "p1", Href: "p1.png", MediaType: "image/png"},
+		}}}
+		rd := newRenderer(pkg, r, &tt.opts)
+		rd.anchors = &anchors{}
+		var b strings.Builder
+		rd.renderChapter(Chapter{Path: "OEBPS/p1.svg", Doc: doc, MediaType: svgMediaType}, &b)
+		if out := strings.ReplaceAll(b.String(), "\n", ""); out != tt.expected {
+			t.Errorf("renderChapter %s gave %s, expected %s", tt.name, out, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"golang.org/x/net/html"
+)
+
+// supportedNamespaces are the namespaces an epub:case may require for its
+// content to be chosen: browsers render MathML and SVG on their own.
+var supportedNamespaces = map[string]bool{
+	"http://www.w3.org/1998/Math/MathML": true,
+	"http://www.w3.org/2000/svg":         true,
+}
+
+// resolveSwitches replaces every epub:switch below n with the content of
+// its first epub:case whose required namespace is supported, or else of
+// its epub:default, the fallback such as an image of a formula.
+// epub:trigger elements, which control media through scripts the output
+// does not have, are removed.
+func resolveSwitches(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type != html.ElementNode:
+		case c.Data == "epub:switch":
+			if branch := switchBranch(c); branch != nil {
+				resolveSwitches(branch)
+				for branch.FirstChild != nil {
+					child := branch.FirstChild
+					branch.RemoveChild(child)
+					n.InsertBefore(child, c)
+				}
+			}
+			n.RemoveChild(c)
+		case c.Data == "epub:trigger":
+			n.RemoveChild(c)
+		default:
+			resolveSwitches(c)
+		}
+		c = next
+	}
+}
+
+// switchBranch returns the epub:case or epub:default of an epub:switch to
+// render, or nil if it has neither.
+func switchBranch(sw *html.Node) *html.Node {
+	var fallback *html.Node
+	for c := sw.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "epub:case":
+			if supportedNamespaces[getAttr(c, "required-namespace")] {
+				return c
+			}
+		case "epub:default":
+			if fallback == nil {
+				fallback = c
+			}
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestResolveSwitches(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`<p>a<epub:switch><epub:case required-namespace="http://www.w3.org/1998/Math/MathML"><math><mi>x</mi></math></epub:case>` +
+				`<epub:default><img src="x.png"/></epub:default></epub:switch>b</p>`,
+			`<p>a<math><mi>x</mi></math>b</p>`,
+		},
+		{
+			`<epub:switch><epub:case required-namespace="http://www.xml-cml.org/schema"><cml></cml></epub:case>` +
+				`<epub:default><p>Fallback</p></epub:default></epub:switch>`,
+			`<p>Fallback</p>`,
+		},
+		{
+			`<epub:switch><epub:case required-namespace="urn:unknown">X</epub:case></epub:switch><p>After</p>`,
+			`<p>After</p>`,
+		},
+		{
+			`<epub:switch><epub:default><epub:switch><epub:default><p>Nested</p></epub:default></epub:switch></epub:default></epub:switch>`,
+			`<p>Nested</p>`,
+		},
+		{`<p>Play<epub:trigger action="show" ref="x"></epub:trigger></p>`, `<p>Play</p>`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := findElement(doc, "body")
+		resolveSwitches(body)
+		var out strings.Builder
+		for c := body.FirstChild; c != nil; c = c.NextSibling {
+			html.Render(&out, c)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("resolveSwitches(%q) = %q, expected %q", tt.input, out.String(), tt.expected)
+		}
+	}
+}
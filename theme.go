@@ -0,0 +1,99 @@
+package main
+
+import "strings"
+
+// responsiveCSS is the base stylesheet of --responsive: a centred column of
+// readable width and images that shrink to fit small screens. It comes
+// before the book's CSS, which may override it.
+const responsiveCSS = `html { -webkit-text-size-adjust: 100%; text-size-adjust: 100% }
+body { max-width: 38em; margin: 0 auto; padding: 0 1em; font-size: 1.05em; line-height: 1.6; overflow-wrap: break-word }
+img, svg, video { max-width: 100%; height: auto }
+pre { overflow-x: auto; white-space: pre-wrap }
+table { display: block; max-width: 100%; overflow-x: auto }`
+
+// sidebarCSS is the stylesheet of --layout sidebar. The table of contents
+// stays in a pane on the left while the text scrolls, and moves back above
+// the text on narrow screens and in print.
+const sidebarCSS = `html { scroll-behavior: smooth }
+aside.sidebar { position: fixed; top: 0; bottom: 0; left: 0; width: 18rem; box-sizing: border-box; overflow-y: auto; padding: 1em; background: inherit; border-right: 1px solid rgba(128, 128, 128, .3); font-size: .9em }
+aside.sidebar ol { padding-left: 1.2em }
+aside.sidebar + hr.chapter-break { display: none }
+body { margin-left: 20rem }
+@media (max-width: 50em), print {
+  aside.sidebar { position: static; width: auto; border-right: 0 }
+  body { margin-left: 0 }
+}
+@media (prefers-reduced-motion: reduce) {
+  html { scroll-behavior: auto }
+}`
+
+// pageNumberCSS sets the page numbers of --page-numbers apart from the
+// text.
+const pageNumberCSS = `span.page-number { font-size: .75em; font-weight: normal; font-style: normal; color: #888; margin: 0 .25em }`
+
+// readAlongCSS highlights the fragment a --read-along player is reading.
+const readAlongCSS = `audio.read-along { display: block; width: 100%; margin: 1em 0 }
+[data-clip-begin] { cursor: pointer }
+.read-along-active { background: #fff3a8; color: #000 }`
+
+// svgPageCSS scales the drawings of SVG pages, which are usually given the
+// size of the page in pixels, down to the width of the output.
+const svgPageCSS = `div.svg-page > svg { display: block; max-width: 100%; height: auto; margin: 0 auto }`
+
+// titlePageCSS centres the title page of --title-page and gives it a page
+// of its own in print.
+const titlePageCSS = `section.title-page { text-align: center; margin: 4em 0; break-after: page }
+section.title-page .title { font-size: 2.4em; margin-bottom: .2em }
+section.title-page .subtitle { font-size: 1.4em; font-style: italic; margin-top: 0 }
+section.title-page .series { font-variant: small-caps }
+section.title-page .authors { font-size: 1.2em; margin: 2em 0 .5em }
+section.title-page .credit { margin: .2em 0 }
+section.title-page .publisher, section.title-page .date { margin: .2em 0 }`
+
+// printCSS is the stylesheet of --print-css. Every chapter starts on a new
+// page, and colours, navigation and the screen column are dropped.
+const printCSS = `@media print {
+  @page { margin: 2cm 2.5cm }
+  body { max-width: none; margin: 0; padding: 0; background: none; color: #000 }
+  hr.chapter-break { visibility: hidden; margin: 0; break-after: page; page-break-after: always }
+  hr.chapter-break:last-child { break-after: auto; page-break-after: auto }
+  nav { display: none }
+  a { color: inherit; text-decoration: none }
+  h1, h2, h3, h4, h5, h6 { break-after: avoid; page-break-after: avoid }
+  p { orphans: 3; widows: 3 }
+  img, figure, table, pre { break-inside: avoid; page-break-inside: avoid }
+}`
+
+// themeLight and themeDark are the colour schemes of --theme. They only set
+// colours, so the book's own typography is left alone.
+const (
+	themeLight = `:root { color-scheme: light }
+body { background: #fdfdfb; color: #1f1f1f }
+a { color: #1a5fb4 }
+hr { border: 0; border-top: 1px solid #d0d0d0 }`
+
+	themeDark = `:root { color-scheme: dark }
+body { background: #1c1c1e; color: #d8d8d4 }
+a { color: #8ab4f8 }
+a:visited { color: #c58af9 }
+hr { border: 0; border-top: 1px solid #444 }
+img { opacity: .9 }`
+)
+
+// themeCSS returns the stylesheet for a --theme value, or "" for none. The
+// auto theme follows the reader's prefers-color-scheme setting.
+func themeCSS(theme string) string {
+	switch theme {
+	case "light":
+		return themeLight
+	case "dark":
+		return themeDark
+	case "auto":
+		return themeLight + "\n@media (prefers-color-scheme: dark) {\n" + indentCSS(themeDark) + "\n}"
+	}
+	return ""
+}
+
+func indentCSS(css string) string {
+	return "  " + strings.ReplaceAll(css, "\n", "\n  ")
+}
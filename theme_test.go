@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestThemeCSS(t *testing.T) {
+	if css := themeCSS(""); css != "" {
+		t.Errorf("themeCSS(\"\") = %q, expected no CSS", css)
+	}
+	rules := parseCSS(themeCSS("auto"))
+	last := rules[len(rules)-1]
+	if !last.isAtRule("media") || len(last.Rules) != len(parseCSS(themeDark)) {
+		t.Errorf("themeCSS(\"auto\") does not end with the dark theme in a media query: %q", last.Prelude)
+	}
+}
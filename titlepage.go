@@ -0,0 +1,69 @@
+package main
+
+import (
+	"cmp"
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// titlePageID is the ID of the title page of --title-page.
+const titlePageID = "title-page"
+
+// titlePageChapter renders the title page --title-page puts before the
+// first chapter: the title and subtitle of the book, the series it belongs
+// to, its authors, the editors, translators and others credited beside
+// them, its publisher and its publication date, as far as the
+// metadata gives them.
+func (rd *renderer) titlePageChapter(pkg *Package) ChapterData {
+	m := pkg.Metadata
+	section := &html.Node{Type: html.ElementNode, Data: "section", DataAtom: atom.Section,
+		Attr: []html.Attribute{{Key: "class", Val: "title-page"}}}
+	add := func(tag atom.Atom, class, text string) {
+		if text == "" {
+			return
+		}
+		n := &html.Node{Type: html.ElementNode, Data: tag.String(), DataAtom: tag,
+			Attr: []html.Attribute{{Key: "class", Val: class}}}
+		n.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+		section.AppendChild(n)
+	}
+	title := cmp.Or(m.Title, bookTitle(pkg))
+	add(atom.H1, "title", title)
+	add(atom.P, "subtitle", m.Subtitle)
+	add(atom.P, "series", seriesLine(m))
+	add(atom.P, "authors", joinNames(m.Authors()))
+	for _, credit := range m.Credits() {
+		add(atom.P, "credit", credit)
+	}
+	if len(m.Publishers) > 0 {
+		add(atom.P, "publisher", m.Publishers[0])
+	}
+	date, _, _ := strings.Cut(m.Date(), "T")
+	add(atom.P, "date", date)
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	body.AppendChild(section)
+
+	var b strings.Builder
+	rd.writeBody(body, &b)
+	return ChapterData{ID: titlePageID, Title: title, Body: template.HTML(b.String())}
+}
+
+// joinNames lists names in prose, e.g. "A, B and C".
+func joinNames(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// seriesLine tells which series the book belongs to, e.g. "Book 2 of
+// Discworld", or "" if it belongs to none.
+func seriesLine(m Metadata) string {
+	if m.Series == "" || m.SeriesIndex == "" {
+		return m.Series
+	}
+	return "Book " + m.SeriesIndex + " of " + m.Series
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestTitlePageChapter(t *testing.T) {
+	pkg := &Package{Metadata: Metadata{
+		Title:       "Book & Co",
+		Subtitle:    "A Tale",
+		Series:      "Tales",
+		SeriesIndex: "2",
+		Creators:    []Contributor{{Name: "Ann", Role: "aut"}, {Name: "Ben", Role: "aut"}, {Name: "Cy", Role: "aut"}, {Name: "Ed", Role: "edt"}},
+		Publishers:  []string{"ACME"},
+		Dates:       []Date{{Value: "2020-01-01T00:00:00Z"}},
+	}}
+	rd := &renderer{opts: &options{}}
+	ch := rd.titlePageChapter(pkg)
+	expected := `<section class="title-page"><h1 class="title">Book &amp; Co</h1><p class="subtitle">A Tale</p><p class="series">Book 2 of Tales</p>` +
+		`<p class="authors">Ann, Ben and Cy</p><p class="credit">Edited by Ed</p><p class="publisher">ACME</p><p class="date">2020-01-01</p></section>`
+	if ch.ID != titlePageID || ch.Title != "Book & Co" || string(ch.Body) != expected {
+		t.Errorf("titlePageChapter = %q %q %q, expected %q %q %q", ch.ID, ch.Title, ch.Body, titlePageID, "Book & Co", expected)
+	}
+
+	ch = rd.titlePageChapter(&Package{})
+	if expected := `<section class="title-page"><h1 class="title">Converted EPUB</h1></section>`; string(ch.Body) != expected {
+		t.Errorf("titlePageChapter without metadata = %q, expected %q", ch.Body, expected)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"log"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ncxMediaType is the media type of the EPUB 2 table of contents.
+const ncxMediaType = "application/x-dtbncx+xml"
+
+// NCX is the navigation control file of EPUB 2 books, toc.ncx.
+type NCX struct {
+	NavPoints   []NavPoint `xml:"navMap>navPoint"`
+	PageTargets []NavPoint `xml:"pageList>pageTarget"`
+}
+
+// NavPoint is an entry of the NCX navMap or pageList.
+type NavPoint struct {
+	Label    string     `xml:"navLabel>text"`
+	Content  NavContent `xml:"content"`
+	Children []NavPoint `xml:"navPoint"`
+}
+
+// NavContent is the target of a NavPoint.
+type NavContent struct {
+	Src string `xml:"src,attr"`
+}
+
+// ncxPath returns the archive path of the NCX named by the spine's toc
+// attribute, or else of any NCX in the manifest, and "" if there is none.
+func ncxPath(pkg *Package) string {
+	for _, item := range pkg.Manifest.Items {
+		if pkg.Spine.Toc != "" && item.ID == pkg.Spine.Toc {
+			return joinEpubPath(pkg.OpfDir, item.Href)
+		}
+	}
+	for _, item := range pkg.Manifest.Items {
+		if item.MediaType == ncxMediaType {
+			return joinEpubPath(pkg.OpfDir, item.Href)
+		}
+	}
+	return ""
+}
+
+// parseNCX reads the NCX at ncxPath.
+func parseNCX(r *epubArchive, ncxPath string) (*NCX, error) {
+	data, err := readZipFile(r, ncxPath)
+	if err != nil {
+		return nil, err
+	}
+	var ncx NCX
+	if err := xml.Unmarshal(data, &ncx); err != nil {
+		return nil, fmt.Errorf("failed to parse NCX %s: %w", ncxPath, err)
+	}
+	return &ncx, nil
+}
+
+// ncxTOC turns the navMap of an NCX at ncxPath into table of contents
+// entries linking into the output. Entries pointing at documents that are
+// not part of the output are left out, their children taking their place.
+// Only depth levels are kept, all of them if depth is 0.
+func ncxTOC(points []NavPoint, ncxPath string, a *anchors, depth int) []TOCEntry {
+	var entries []TOCEntry
+	for _, p := range points {
+		var children []TOCEntry
+		if depth != 1 {
+			children = ncxTOC(p.Children, ncxPath, a, max(depth-1, 0))
+		}
+		href, ok := a.href(ncxPath, p.Content.Src)
+		if !ok {
+			entries = append(entries, children...)
+			continue
+		}
+		entries = append(entries, TOCEntry{
+			Title:    strings.Join(strings.Fields(p.Label), " "),
+			Href:     href,
+			Children: children,
+		})
+	}
+	return entries
+}
+
+// navDocPath returns the archive path of the EPUB 3 navigation document,
+// the manifest item with the nav property, or "" if there is none.
+func navDocPath(pkg *Package) string {
+	for _, item := range pkg.Manifest.Items {
+		if item.hasProperty("nav") {
+			return joinEpubPath(pkg.OpfDir, item.Href)
+		}
+	}
+	return ""
+}
+
+// readNavDoc parses the EPUB 3 navigation document and returns it with its
+// archive path, or nil if the book has none or it cannot be read.
+func readNavDoc(r *epubArchive, pkg *Package) (*html.Node, string) {
+	path := navDocPath(pkg)
+	if path == "" {
+		return nil, ""
+	}
+	data, err := readZipFile(r, path)
+	if err != nil {
+		log.Printf("Warning: Could not read the navigation document %s: %v", path, err)
+		return nil, ""
+	}
+	doc, err := parseContent(data, path)
+	if err != nil {
+		log.Printf("Warning: Could not parse the navigation document %s: %v", path, err)
+		return nil, ""
+	}
+	return doc, path
+}
+
+// navList returns the list of the <nav> element of the given epub:type in
+// a navigation document, or nil if there is none.
+func navList(n *html.Node, epubType string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == "nav" && slices.Contains(strings.Fields(getAttr(n, "epub:type")), epubType) {
+		return findElement(n, "ol")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if list := navList(c, epubType); list != nil {
+			return list
+		}
+	}
+	return nil
+}
+
+// navTOC turns an <ol> of the navigation document at navPath into table of
+// contents entries like ncxTOC does. Items labelled with a <span> instead
+// of a link, used for headings, are left out like entries pointing outside
+// the output.
+func navTOC(list *html.Node, navPath string, a *anchors, depth int) []TOCEntry {
+	var entries []TOCEntry
+	for li := list.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.Data != "li" {
+			continue
+		}
+		var label *html.Node
+		var children []TOCEntry
+		for c := li.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type != html.ElementNode:
+			case c.Data == "a" || c.Data == "span":
+				label = c
+			case c.Data == "ol" && depth != 1:
+				children = navTOC(c, navPath, a, max(depth-1, 0))
+			}
+		}
+		href, ok := "", false
+		if label != nil && label.Data == "a" {
+			href, ok = a.href(navPath, getAttr(label, "href"))
+		}
+		if !ok {
+			entries = append(entries, children...)
+			continue
+		}
+		entries = append(entries, TOCEntry{Title: textContent(label), Href: href, Children: children})
+	}
+	return entries
+}
+
+// bookTOC reads the table of contents and the landmarks of a book, linking
+// into the output, from its EPUB 3 navigation document or its NCX, the one
+// of the package's version first. It returns no entries if the book has
+// neither.
+func bookTOC(pkg *Package, r *epubArchive, a *anchors, depth int) (toc, landmarks []TOCEntry) {
+	doc, navPath := readNavDoc(r, pkg)
+	if doc != nil {
+		if list := navList(doc, "landmarks"); list != nil {
+			landmarks = navTOC(list, navPath, a, 1)
+		}
+	}
+	byVersion(pkg, func() bool {
+		if doc != nil {
+			if list := navList(doc, "toc"); list != nil {
+				toc = navTOC(list, navPath, a, depth)
+			}
+		}
+		return len(toc) > 0
+	}, func() bool {
+		path := ncxPath(pkg)
+		if path == "" {
+			return false
+		}
+		ncx, err := parseNCX(r, path)
+		if err != nil {
+			log.Printf("Warning: Could not read the table of contents: %v", err)
+			return false
+		}
+		toc = ncxTOC(ncx.NavPoints, path, a, depth)
+		return len(toc) > 0
+	})
+	return toc, landmarks
+}
+
+// tocNav renders the table of contents shown at the top of the output with
+// --toc as nested lists of links, followed by quick links to the landmarks
+// if there are any. With --layout sidebar both go into an <aside> that
+// sidebarCSS keeps in view.
+func (rd *renderer) tocNav(toc, landmarks []TOCEntry) template.HTML {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	parent := body
+	if rd.opts.Layout == "sidebar" {
+		parent = &html.Node{Type: html.ElementNode, Data: "aside", DataAtom: atom.Aside,
+			Attr: []html.Attribute{{Key: "class", Val: "sidebar"}}}
+		body.AppendChild(parent)
+	}
+	if len(toc) > 0 {
+		parent.AppendChild(navSection("toc", "Contents", atom.H1, toc))
+	}
+	if len(landmarks) > 0 {
+		parent.AppendChild(navSection("landmarks", "Quick links", atom.H2, landmarks))
+	}
+
+	var b strings.Builder
+	rd.writeBody(body, &b)
+	return template.HTML(b.String())
+}
+
+// navSection returns a <nav> of the given class with a heading and a list
+// of the entries.
+func navSection(class, title string, heading atom.Atom, entries []TOCEntry) *html.Node {
+	h := &html.Node{Type: html.ElementNode, Data: heading.String(), DataAtom: heading}
+	h.AppendChild(&html.Node{Type: html.TextNode, Data: title})
+	nav := &html.Node{Type: html.ElementNode, Data: "nav", DataAtom: atom.Nav,
+		Attr: []html.Attribute{{Key: "class", Val: class}}}
+	nav.AppendChild(h)
+	nav.AppendChild(tocList(entries))
+	return nav
+}
+
+// tocList returns an <ol> with an item for every entry, holding a list of
+// its children if it has any.
+func tocList(entries []TOCEntry) *html.Node {
+	list := &html.Node{Type: html.ElementNode, Data: "ol", DataAtom: atom.Ol}
+	for _, entry := range entries {
+		link := &html.Node{Type: html.ElementNode, Data: "a", DataAtom: atom.A, Attr: []html.Attribute{{Key: "href", Val: entry.Href}}}
+		link.AppendChild(&html.Node{Type: html.TextNode, Data: entry.Title})
+		item := &html.Node{Type: html.ElementNode, Data: "li", DataAtom: atom.Li}
+		item.AppendChild(link)
+		if len(entry.Children) > 0 {
+			item.AppendChild(tocList(entry.Children))
+		}
+		list.AppendChild(item)
+	}
+	return list
+}
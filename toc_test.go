@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+const testNCX = `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<navMap>
+<navPoint id="n1"><navLabel><text>Part
+  One</text></navLabel><content src="Text/part1.xhtml"/>
+<navPoint id="n2"><navLabel><text>Chapter 1</text></navLabel><content src="Text/ch1.xhtml"/>
+<navPoint id="n3"><navLabel><text>Section 1.1</text></navLabel><content src="Text/ch1.xhtml#s1"/></navPoint>
+</navPoint>
+</navPoint>
+<navPoint id="n4"><navLabel><text>Chapter 2</text></navLabel><content src="Text/ch2.xhtml"/></navPoint>
+</navMap>
+</ncx>`
+
+func TestNCXTOC(t *testing.T) {
+	var ncx NCX
+	if err := xml.Unmarshal([]byte(testNCX), &ncx); err != nil {
+		t.Fatal(err)
+	}
+	// part1.xhtml is not part of the output, so its children move up.
+	ids := &anchors{chapters: map[string]string{"OEBPS/Text/ch1.xhtml": "ch1", "OEBPS/Text/ch2.xhtml": "ch2"}}
+	tests := []struct {
+		depth    int
+		expected []TOCEntry
+	}{
+		{0, []TOCEntry{
+			{Title: "Chapter 1", Href: "#ch1", Children: []TOCEntry{{Title: "Section 1.1", Href: "#s1"}}},
+			{Title: "Chapter 2", Href: "#ch2"},
+		}},
+		{2, []TOCEntry{
+			{Title: "Chapter 1", Href: "#ch1"},
+			{Title: "Chapter 2", Href: "#ch2"},
+		}},
+		{1, []TOCEntry{
+			{Title: "Chapter 2", Href: "#ch2"},
+		}},
+	}
+	for _, tt := range tests {
+		toc := ncxTOC(ncx.NavPoints, "OEBPS/toc.ncx", ids, tt.depth)
+		if !reflect.DeepEqual(toc, tt.expected) {
+			t.Errorf("ncxTOC(depth %d) = %+v, expected %+v", tt.depth, toc, tt.expected)
+		}
+	}
+}
+
+const testNavDoc = `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body>
+<nav epub:type="toc"><h1>Contents</h1><ol>
+<li><span>Part One</span><ol>
+<li><a href="Text/ch1.xhtml">Chapter <em>1</em></a><ol><li><a href="Text/ch1.xhtml#s1">Section 1.1</a></li></ol></li>
+</ol></li>
+<li><a href="Text/ch2.xhtml">Chapter 2</a></li>
+</ol></nav>
+<nav epub:type="landmarks"><ol><li><a epub:type="bodymatter" href="Text/ch1.xhtml">Start</a></li></ol></nav>
+</body></html>`
+
+func TestBookTOCNavDoc(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"OEBPS/nav.xhtml": []byte(testNavDoc),
+		"OEBPS/toc.ncx":   []byte(testNCX),
+	})
+	pkg := &Package{OpfDir: "OEBPS"}
+	pkg.Manifest.Items = []Item{
+		{ID: "ncx", Href: "toc.ncx", MediaType: ncxMediaType},
+		{ID: "nav", Href: "nav.xhtml", MediaType: "application/xhtml+xml", Properties: "nav"},
+	}
+	ids := &anchors{chapters: map[string]string{"OEBPS/Text/ch1.xhtml": "ch1", "OEBPS/Text/ch2.xhtml": "ch2"}}
+	toc, landmarks := bookTOC(pkg, r, ids, 0)
+	expected := []TOCEntry{
+		{Title: "Chapter 1", Href: "#ch1", Children: []TOCEntry{{Title: "Section 1.1", Href: "#s1"}}},
+		{Title: "Chapter 2", Href: "#ch2"},
+	}
+	if !reflect.DeepEqual(toc, expected) {
+		t.Errorf("bookTOC = %+v, expected %+v", toc, expected)
+	}
+	if expected := []TOCEntry{{Title: "Start", Href: "#ch1"}}; !reflect.DeepEqual(landmarks, expected) {
+		t.Errorf("bookTOC landmarks = %+v, expected %+v", landmarks, expected)
+	}
+}
+
+func TestTOCNav(t *testing.T) {
+	toc := []TOCEntry{{Title: "One", Href: "#ch1", Children: []TOCEntry{{Title: "A & B", Href: "#a"}}}}
+	tests := []struct {
+		layout   string
+		expected string
+	}{
+		{"", `<nav class="toc"><h1>Contents</h1><ol><li><a href="#ch1">One</a><ol><li><a href="#a">A &amp; B</a></li></ol></li></ol></nav>`},
+		{"sidebar", `<aside class="sidebar"><nav class="toc"><h1>Contents</h1><ol><li><a href="#ch1">One</a><ol><li><a href="#a">A &amp; B</a></li></ol></li></ol></nav></aside>`},
+	}
+	for _, tt := range tests {
+		rd := &renderer{opts: &options{Layout: tt.layout}}
+		if nav := string(rd.tocNav(toc, nil)); nav != tt.expected {
+			t.Errorf("tocNav with layout %q = %q, expected %q", tt.layout, nav, tt.expected)
+		}
+	}
+}
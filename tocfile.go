@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// tocFileEntry is an entry of the navigation tree written by --toc-file.
+type tocFileEntry struct {
+	Title    string         `json:"title"`
+	Href     string         `json:"href"`   // link to the entry from the TOC file
+	Anchor   string         `json:"anchor"` // ID of the entry in the HTML output
+	Depth    int            `json:"depth"`  // 1 for the top level
+	Children []tocFileEntry `json:"children,omitempty"`
+}
+
+// writeTOCFile writes the table of contents of the HTML output at
+// outputPath to path, as a standalone HTML page of links if the file name
+// ends in .html or .htm and as JSON otherwise.
+func writeTOCFile(path, outputPath, title string, toc []TOCEntry) error {
+	target, err := filepath.Rel(filepath.Dir(absPath(path)), absPath(outputPath))
+	if err != nil {
+		return fmt.Errorf("failed to locate the output relative to %s: %w", path, err)
+	}
+	entries := tocFileEntries(toc, filepath.ToSlash(target), 1)
+
+	var b bytes.Buffer
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		writeTOCPage(&b, title, entries)
+	default:
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Title   string         `json:"title"`
+			Entries []tocFileEntry `json:"entries"`
+		}{title, entries}); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// tocFileEntries turns table of contents entries, which link within the
+// output, into entries linking to the output file at target.
+func tocFileEntries(toc []TOCEntry, target string, depth int) []tocFileEntry {
+	entries := make([]tocFileEntry, 0, len(toc))
+	for _, entry := range toc {
+		anchor := strings.TrimPrefix(entry.Href, "#")
+		entries = append(entries, tocFileEntry{
+			Title:    entry.Title,
+			Href:     target + "#" + anchor,
+			Anchor:   anchor,
+			Depth:    depth,
+			Children: tocFileEntries(entry.Children, target, depth+1),
+		})
+	}
+	return entries
+}
+
+// writeTOCPage renders the entries as an HTML page of nested lists.
+func writeTOCPage(b *bytes.Buffer, title string, entries []tocFileEntry) {
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>")
+	b.WriteString(html.EscapeString(title))
+	b.WriteString("</title>\n</head>\n<body>\n<nav class=\"toc\">\n<h1>")
+	b.WriteString(html.EscapeString(title))
+	b.WriteString("</h1>\n")
+	writeTOCPageList(b, entries)
+	b.WriteString("</nav>\n</body>\n</html>\n")
+}
+
+func writeTOCPageList(b *bytes.Buffer, entries []tocFileEntry) {
+	b.WriteString("<ol>\n")
+	for _, entry := range entries {
+		fmt.Fprintf(b, "<li><a href=\"%s\">%s</a>", html.EscapeString(entry.Href), html.EscapeString(entry.Title))
+		if len(entry.Children) > 0 {
+			b.WriteString("\n")
+			writeTOCPageList(b, entry.Children)
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</ol>\n")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testTOC = []TOCEntry{
+	{Title: "One", Href: "#ch1", Children: []TOCEntry{{Title: "A & B", Href: "#a-b"}}},
+	{Title: "Two", Href: "#ch2"},
+}
+
+func TestTOCFileJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "meta", "toc.json")
+	if err := os.Mkdir(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTOCFile(path, filepath.Join(dir, "book.html"), "Book", testTOC); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "title": "Book",
+  "entries": [
+    {
+      "title": "One",
+      "href": "../book.html#ch1",
+      "anchor": "ch1",
+      "depth": 1,
+      "children": [
+        {
+          "title": "A & B",
+          "href": "../book.html#a-b",
+          "anchor": "a-b",
+          "depth": 2
+        }
+      ]
+    },
+    {
+      "title": "Two",
+      "href": "../book.html#ch2",
+      "anchor": "ch2",
+      "depth": 1
+    }
+  ]
+}
+`
+	if string(data) != expected {
+		t.Errorf("writeTOCFile wrote %s, expected %s", data, expected)
+	}
+}
+
+func TestTOCFileHTML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toc.html")
+	if err := writeTOCFile(path, filepath.Join(dir, "book.html"), "Book", testTOC); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<title>Book</title>",
+		"<li><a href=\"book.html#ch1\">One</a>\n<ol>\n<li><a href=\"book.html#a-b\">A &amp; B</a></li>\n</ol>\n</li>",
+		"<li><a href=\"book.html#ch2\">Two</a></li>",
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("writeTOCFile wrote %s, expected it to contain %q", data, expected)
+		}
+	}
+}
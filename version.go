@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isEPUB2 reports whether the package declares EPUB 2, whose books find
+// their way around with the NCX and the guide rather than the navigation
+// document of EPUB 3. Packages without a version are taken for EPUB 3.
+func isEPUB2(pkg *Package) bool {
+	return strings.HasPrefix(strings.TrimSpace(pkg.Version), "2")
+}
+
+// byVersion looks something up in the EPUB 3 way and, if that finds
+// nothing, in the EPUB 2 way, or the other way round for EPUB 2 packages,
+// so that books carrying both for compatibility are read as their version
+// intends. Each function reports whether it found anything.
+func byVersion(pkg *Package, epub3, epub2 func() bool) {
+	first, second := epub3, epub2
+	if isEPUB2(pkg) {
+		first, second = epub2, epub3
+	}
+	if !first() {
+		second()
+	}
+}
+
+// versionWarnings reports the constructs of the other EPUB version a
+// package uses, which suggest the book was converted or edited carelessly
+// and its navigation may be read from the wrong place.
+func versionWarnings(pkg *Package) []string {
+	version := strings.TrimSpace(pkg.Version)
+	if version == "" {
+		return []string{"The package does not declare its EPUB version; reading it as EPUB 3"}
+	}
+	var warnings []string
+	if isEPUB2(pkg) {
+		var features []string
+		if navDocPath(pkg) != "" {
+			features = append(features, "a navigation document")
+		}
+		for _, meta := range pkg.Metadata.Meta {
+			if meta.Property != "" {
+				features = append(features, "<meta property> elements")
+				break
+			}
+		}
+		for _, item := range pkg.Manifest.Items {
+			if item.Properties != "" {
+				features = append(features, "manifest item properties")
+				break
+			}
+		}
+		if len(features) > 0 {
+			warnings = append(warnings, fmt.Sprintf("The package declares EPUB %s but uses EPUB 3 features: %s", version, joinNames(features)))
+		}
+		return warnings
+	}
+	if navDocPath(pkg) == "" {
+		var fallbacks []string
+		if ncxPath(pkg) != "" {
+			fallbacks = append(fallbacks, "NCX")
+		}
+		if len(pkg.Guide) > 0 {
+			fallbacks = append(fallbacks, "guide")
+		}
+		fallback := "falling back to the spine order"
+		if len(fallbacks) > 0 {
+			fallback = "using its " + strings.Join(fallbacks, " and ")
+		}
+		warnings = append(warnings, fmt.Sprintf("The package declares EPUB %s but has no navigation document; %s", version, fallback))
+	}
+	return warnings
+}
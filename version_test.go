@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVersionWarnings(t *testing.T) {
+	nav := Item{ID: "nav", Href: "nav.xhtml", Properties: "nav"}
+	ncx := Item{ID: "ncx", Href: "toc.ncx", MediaType: ncxMediaType}
+	tests := []struct {
+		name     string
+		pkg      Package
+		expected []string
+	}{
+		{"EPUB 3", Package{Version: "3.0", Manifest: Manifest{Items: []Item{nav}}}, nil},
+		{"EPUB 2", Package{Version: "2.0"}, nil},
+		{"EPUB 3 without nav", Package{Version: "3.0"},
+			[]string{"The package declares EPUB 3.0 but has no navigation document; falling back to the spine order"}},
+		{"EPUB 3 with only an NCX", Package{Version: "3.0", Manifest: Manifest{Items: []Item{ncx}}, Spine: Spine{Toc: "ncx"}},
+			[]string{"The package declares EPUB 3.0 but has no navigation document; using its NCX"}},
+		{"EPUB 3 with only a guide", Package{Version: "3.0", Guide: []Reference{{Type: "toc", Href: "toc.xhtml"}}},
+			[]string{"The package declares EPUB 3.0 but has no navigation document; using its guide"}},
+		{"EPUB 3 with an NCX and a guide", Package{Version: "3.0", Manifest: Manifest{Items: []Item{ncx}}, Guide: []Reference{{Type: "toc", Href: "toc.xhtml"}}},
+			[]string{"The package declares EPUB 3.0 but has no navigation document; using its NCX and guide"}},
+		{"EPUB 2 with EPUB 3 features", Package{Version: "2.0", Manifest: Manifest{Items: []Item{nav}},
+			Metadata: Metadata{Meta: []Meta{{Property: "dcterms:modified"}}}},
+			[]string{"The package declares EPUB 2.0 but uses EPUB 3 features: a navigation document, <meta property> elements and manifest item properties"}},
+		{"no version", Package{}, []string{"The package does not declare its EPUB version; reading it as EPUB 3"}},
+	}
+	for _, tt := range tests {
+		if warnings := versionWarnings(&tt.pkg); !reflect.DeepEqual(warnings, tt.expected) {
+			t.Errorf("versionWarnings(%s) = %q, expected %q", tt.name, warnings, tt.expected)
+		}
+	}
+}
+
+func TestBookTOCVersion(t *testing.T) {
+	r := openTestArchive(t, map[string][]byte{
+		"OEBPS/nav.xhtml": []byte(testNavDoc),
+		"OEBPS/toc.ncx":   []byte(testNCX),
+	})
+	ids := &anchors{chapters: map[string]string{"OEBPS/Text/part1.xhtml": "part1", "OEBPS/Text/ch1.xhtml": "ch1", "OEBPS/Text/ch2.xhtml": "ch2"}}
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"3.0", "Chapter 1"},
+		{"2.0", "Part One"},
+	}
+	for _, tt := range tests {
+		pkg := &Package{Version: tt.version, OpfDir: "OEBPS"}
+		pkg.Manifest.Items = []Item{
+			{ID: "ncx", Href: "toc.ncx", MediaType: ncxMediaType},
+			{ID: "nav", Href: "nav.xhtml", MediaType: "application/xhtml+xml", Properties: "nav"},
+		}
+		if toc, _ := bookTOC(pkg, r, ids, 0); len(toc) == 0 || toc[0].Title != tt.expected {
+			t.Errorf("bookTOC of EPUB %s = %+v, expected it to start with %q", tt.version, toc, tt.expected)
+		}
+	}
+}